@@ -138,6 +138,11 @@ type GitHubSource struct {
 	// Required. The workflow run attempts.
 	// Example: 1
 	WorkflowRunAttempt int64 `protobuf:"varint,8,opt,name=workflow_run_attempt,json=workflowRunAttempt,proto3" json:"workflow_run_attempt,omitempty"`
+	// Optional. The owner (user or organization) of the repository, parsed
+	// from the repo_name of the form "owner/repo". It's empty when the
+	// repo_name has no owner.
+	// Example: abcxyz
+	RepoOwner string `protobuf:"bytes,9,opt,name=repo_owner,json=repoOwner,proto3" json:"repo_owner,omitempty"`
 }
 
 func (x *GitHubSource) Reset() {
@@ -228,6 +233,13 @@ func (x *GitHubSource) GetWorkflowRunAttempt() int64 {
 	return 0
 }
 
+func (x *GitHubSource) GetRepoOwner() string {
+	if x != nil {
+		return x.RepoOwner
+	}
+	return ""
+}
+
 var File_pmap_event_proto protoreflect.FileDescriptor
 
 var file_pmap_event_proto_rawDesc = []byte{
@@ -249,7 +261,7 @@ var file_pmap_event_proto_rawDesc = []byte{
 	0x62, 0x5f, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19,
 	0x2e, 0x61, 0x62, 0x63, 0x78, 0x79, 0x7a, 0x2e, 0x70, 0x6d, 0x61, 0x70, 0x2e, 0x47, 0x69, 0x74,
 	0x48, 0x75, 0x62, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x0c, 0x67, 0x69, 0x74, 0x68, 0x75,
-	0x62, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x22, 0xd7, 0x02, 0x0a, 0x0c, 0x47, 0x69, 0x74, 0x48,
+	0x62, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x22, 0xf6, 0x02, 0x0a, 0x0c, 0x47, 0x69, 0x74, 0x48,
 	0x75, 0x62, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x72, 0x65, 0x70, 0x6f,
 	0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x70,
 	0x6f, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x70, 0x61,
@@ -271,10 +283,11 @@ var file_pmap_event_proto_rawDesc = []byte{
 	0x30, 0x0a, 0x14, 0x77, 0x6f, 0x72, 0x6b, 0x66, 0x6c, 0x6f, 0x77, 0x5f, 0x72, 0x75, 0x6e, 0x5f,
 	0x61, 0x74, 0x74, 0x65, 0x6d, 0x70, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x12, 0x77,
 	0x6f, 0x72, 0x6b, 0x66, 0x6c, 0x6f, 0x77, 0x52, 0x75, 0x6e, 0x41, 0x74, 0x74, 0x65, 0x6d, 0x70,
-	0x74, 0x42, 0x26, 0x5a, 0x24, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f,
-	0x61, 0x62, 0x63, 0x78, 0x79, 0x7a, 0x2f, 0x70, 0x6d, 0x61, 0x70, 0x2f, 0x61, 0x70, 0x69, 0x73,
-	0x2f, 0x76, 0x31, 0x61, 0x6c, 0x70, 0x68, 0x61, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x33,
+	0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x70, 0x6f, 0x5f, 0x6f, 0x77, 0x6e, 0x65, 0x72, 0x18,
+	0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x72, 0x65, 0x70, 0x6f, 0x4f, 0x77, 0x6e, 0x65, 0x72,
+	0x42, 0x26, 0x5a, 0x24, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61,
+	0x62, 0x63, 0x78, 0x79, 0x7a, 0x2f, 0x70, 0x6d, 0x61, 0x70, 0x2f, 0x61, 0x70, 0x69, 0x73, 0x2f,
+	0x76, 0x31, 0x61, 0x6c, 0x70, 0x68, 0x61, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
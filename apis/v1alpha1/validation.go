@@ -21,17 +21,215 @@ import (
 	"fmt"
 	"net/mail"
 	"net/url"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"unicode"
+
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 const (
 	// Reserved key where annotation from CAIS will be stored.
 	AnnotationKeyAssetInfo = "assetInfo"
+
+	// DefaultMaxContacts is the maximum number of contact emails of a
+	// ResourceMapping unless configured with WithMaxContacts. Mappings with
+	// more contacts are almost always an accidental paste.
+	DefaultMaxContacts = 50
+)
+
+// Validator is an additional check of a ResourceMapping, e.g. an
+// org-specific requirement on the contacts.
+type Validator func(m *ResourceMapping) error
+
+var (
+	validatorsMu sync.RWMutex
+	validators   []Validator
+)
+
+// RegisterValidator registers an additional validator which
+// ValidateResourceMapping runs after the built-in checks, in registration
+// order. It's typically called from an init function.
+func RegisterValidator(v Validator) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	validators = append(validators, v)
+}
+
+// ValidateOption is the option to configure ValidateResourceMapping.
+type ValidateOption func(o *validateOptions)
+
+type validateOptions struct {
+	reservedAnnotationPrefix string
+	maxContacts              int
+	validators               []Validator
+	allowedQualifierKeys     []string
+}
+
+// WithReservedAnnotationPrefix rejects user annotations whose keys start with
+// the given prefix, e.g. "sys.". The prefix is reserved for annotations
+// injected by processors. An empty prefix reserves nothing.
+func WithReservedAnnotationPrefix(prefix string) ValidateOption {
+	return func(o *validateOptions) {
+		o.reservedAnnotationPrefix = prefix
+	}
+}
+
+// WithMaxContacts rejects ResourceMappings with more than n contact emails,
+// overriding DefaultMaxContacts. A non-positive n disables the check.
+func WithMaxContacts(n int) ValidateOption {
+	return func(o *validateOptions) {
+		o.maxContacts = n
+	}
+}
+
+// WithAllowedQualifierKeys rejects subscopes with qualifier keys other than
+// the given ones, e.g. "region" and "shard". Any qualifier key is allowed when
+// no keys are given.
+func WithAllowedQualifierKeys(keys ...string) ValidateOption {
+	return func(o *validateOptions) {
+		o.allowedQualifierKeys = keys
+	}
+}
+
+// WithValidators runs the given validators after the registered ones, for
+// checks that are configured per call rather than at init.
+func WithValidators(vs ...Validator) ValidateOption {
+	return func(o *validateOptions) {
+		o.validators = append(o.validators, vs...)
+	}
+}
+
+// RequiredAnnotationKeys returns a Validator which fails when any of the
+// given annotation keys is absent, e.g. for orgs mandating a
+// "dataClassification" annotation on every mapping:
+//
+//	v1alpha1.RegisterValidator(v1alpha1.RequiredAnnotationKeys("dataClassification"))
+func RequiredAnnotationKeys(keys ...string) Validator {
+	return func(m *ResourceMapping) (vErr error) {
+		for _, k := range keys {
+			if _, ok := m.GetAnnotations().GetFields()[k]; !ok {
+				vErr = errors.Join(vErr, fmt.Errorf("required annotation key %q is missing", k))
+			}
+		}
+		return
+	}
+}
+
+// KeyCasing is the casing annotation keys are canonicalized to, so the same
+// annotation isn't spread across keys like "Env" and "env".
+type KeyCasing string
+
+const (
+	// KeyCasingLowerCamel is the lowerCamel casing, e.g. "dataClassification".
+	KeyCasingLowerCamel KeyCasing = "lowerCamel"
+
+	// KeyCasingSnake is the lowercase snake casing, e.g. "data_classification".
+	KeyCasingSnake KeyCasing = "snake"
 )
 
+// Canonical returns the key in the casing. The words of the key are split at
+// non-alphanumeric characters and case changes, e.g. "Data-Classification",
+// "data_classification" and "DataClassification" are all
+// "dataClassification" in lowerCamel.
+func (c KeyCasing) Canonical(key string) (string, error) {
+	words := splitKeyWords(key)
+	switch c {
+	case KeyCasingLowerCamel:
+		for i, w := range words {
+			w = strings.ToLower(w)
+			if i > 0 {
+				r := []rune(w)
+				r[0] = unicode.ToUpper(r[0])
+				w = string(r)
+			}
+			words[i] = w
+		}
+		return strings.Join(words, ""), nil
+	case KeyCasingSnake:
+		for i, w := range words {
+			words[i] = strings.ToLower(w)
+		}
+		return strings.Join(words, "_"), nil
+	default:
+		return "", fmt.Errorf("unknown key casing %q", c)
+	}
+}
+
+// splitKeyWords splits the key into words at non-alphanumeric characters, at
+// lower to upper case changes and before the last upper case letter of an
+// acronym followed by a lower case letter, e.g. "HTTPServer" is "HTTP" and
+// "Server". Digits belong to the preceding word.
+func splitKeyWords(key string) []string {
+	rs := []rune(key)
+	var words []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			words = append(words, string(cur))
+			cur = nil
+		}
+	}
+	for i, r := range rs {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(cur) > 0 {
+			prev := cur[len(cur)-1]
+			nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if !unicode.IsUpper(prev) || nextLower {
+				flush()
+			}
+		}
+		cur = append(cur, r)
+	}
+	flush()
+	return words
+}
+
+// AnnotationKeyCasing returns a Validator which fails when any annotation key
+// is not in the canonical form of the casing, e.g. "Env" for lowerCamel.
+func AnnotationKeyCasing(casing KeyCasing) Validator {
+	return func(m *ResourceMapping) (vErr error) {
+		keys := make([]string, 0, len(m.GetAnnotations().GetFields()))
+		for k := range m.GetAnnotations().GetFields() {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			want, err := casing.Canonical(k)
+			if err != nil {
+				return err
+			}
+			if want != k {
+				vErr = errors.Join(vErr, fmt.Errorf("annotation key %q is not %s, want %q", k, casing, want))
+			}
+		}
+		return
+	}
+}
+
+// ReservedAnnotationKey returns the key under which a processor injects the
+// annotation with the given key, namespaced by the reserved prefix.
+func ReservedAnnotationKey(prefix, key string) string {
+	return prefix + key
+}
+
 // ValidateResourceMapping checks if the ResourceMapping is valid.
-func ValidateResourceMapping(m *ResourceMapping) (vErr error) {
+func ValidateResourceMapping(m *ResourceMapping, opts ...ValidateOption) (vErr error) {
+	o := &validateOptions{maxContacts: DefaultMaxContacts}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if n := len(m.GetContacts().GetEmail()); o.maxContacts > 0 && n > o.maxContacts {
+		vErr = errors.Join(vErr, fmt.Errorf("too many contacts: got %d, want at most %d", n, o.maxContacts))
+	}
+
 	for _, e := range m.GetContacts().GetEmail() {
 		if _, err := mail.ParseAddress(e); err != nil {
 			vErr = errors.Join(vErr, fmt.Errorf("invalid owner: %w", err))
@@ -42,14 +240,50 @@ func ValidateResourceMapping(m *ResourceMapping) (vErr error) {
 		vErr = errors.Join(vErr, fmt.Errorf("reserved key is included: %s", AnnotationKeyAssetInfo))
 	}
 
-	if err := validateResource(m.GetResource()); err != nil {
+	if err := validateReservedPrefix(m.GetAnnotations(), o.reservedAnnotationPrefix); err != nil {
 		vErr = errors.Join(vErr, err)
 	}
 
+	if err := validateResource(m.GetResource(), o.allowedQualifierKeys); err != nil {
+		vErr = errors.Join(vErr, err)
+	}
+
+	validatorsMu.RLock()
+	defer validatorsMu.RUnlock()
+	for _, v := range validators {
+		if err := v(m); err != nil {
+			vErr = errors.Join(vErr, err)
+		}
+	}
+	for _, v := range o.validators {
+		if err := v(m); err != nil {
+			vErr = errors.Join(vErr, err)
+		}
+	}
+
 	return
 }
 
-func validateResource(r *Resource) (vErr error) {
+func validateReservedPrefix(annos *structpb.Struct, prefix string) (vErr error) {
+	if prefix == "" {
+		return nil
+	}
+
+	keys := make([]string, 0, len(annos.GetFields()))
+	for k := range annos.GetFields() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if strings.HasPrefix(k, prefix) {
+			vErr = errors.Join(vErr, fmt.Errorf("annotation key %q uses reserved prefix %q", k, prefix))
+		}
+	}
+	return
+}
+
+func validateResource(r *Resource, allowedQualifierKeys []string) (vErr error) {
 	if r.GetName() == "" {
 		vErr = errors.Join(vErr, fmt.Errorf("empty resource name"))
 	}
@@ -58,14 +292,39 @@ func validateResource(r *Resource) (vErr error) {
 		vErr = errors.Join(vErr, fmt.Errorf("empty resource provider"))
 	}
 
-	if err := validateSubscope(r); err != nil {
+	if err := validateSubscope(r, allowedQualifierKeys); err != nil {
+		vErr = errors.Join(vErr, err)
+	}
+
+	if err := validateAliases(r); err != nil {
 		vErr = errors.Join(vErr, err)
 	}
 
 	return
 }
 
-func validateSubscope(r *Resource) error {
+// validateAliases checks the aliases are non-empty and differ from the
+// resource name and each other.
+func validateAliases(r *Resource) (vErr error) {
+	seen := make(map[string]struct{}, len(r.GetAliases()))
+	for _, a := range r.GetAliases() {
+		switch _, dup := seen[a]; {
+		case a == "":
+			vErr = errors.Join(vErr, fmt.Errorf("empty resource alias"))
+		case a == r.GetName():
+			vErr = errors.Join(vErr, fmt.Errorf("resource alias %q is the resource name", a))
+		case dup:
+			vErr = errors.Join(vErr, fmt.Errorf("duplicate resource alias %q", a))
+		}
+		seen[a] = struct{}{}
+	}
+	return
+}
+
+// validateSubscope checks the subscope qualifiers are parsable and in
+// alphabetical order, and that their keys are allowed unless
+// allowedQualifierKeys is empty.
+func validateSubscope(r *Resource, allowedQualifierKeys []string) error {
 	if r.GetSubscope() == "" {
 		return nil
 	}
@@ -77,11 +336,62 @@ func validateSubscope(r *Resource) error {
 		return fmt.Errorf("subscope validation failed: failed to parse subscope string %s: %w", r.GetSubscope(), err)
 	}
 
+	wantQueryString, err := normalizeQualifiers(u.RawQuery)
+	if err != nil {
+		return fmt.Errorf("subscope validation failed: %w", err)
+	}
+	if wantQueryString != u.RawQuery {
+		return fmt.Errorf("subscope validation failed: qualifiers must be in alphabetical order, want: %s, got: %s", wantQueryString, u.RawQuery)
+	}
+
+	if len(allowedQualifierKeys) == 0 {
+		return nil
+	}
+	// The qualifiers are known to be parsable and sorted.
+	q, _ := url.ParseQuery(u.RawQuery)
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var vErr error
+	for _, k := range keys {
+		if !slices.Contains(allowedQualifierKeys, k) {
+			vErr = errors.Join(vErr, fmt.Errorf("subscope validation failed: qualifier key %q is not one of the allowed keys: %v", k, allowedQualifierKeys))
+		}
+	}
+	return vErr
+}
+
+// NormalizeSubscope returns the subscope with its qualifiers in alphabetical
+// order, so subscopes which only differ in the qualifier order are equal, e.g.
+// "parent/foo?key1=value1&key2=value2" for
+// "parent/foo?key2=value2&key1=value1".
+func NormalizeSubscope(subscope string) (string, error) {
+	if subscope == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(subscope)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse subscope string %s: %w", subscope, err)
+	}
+	q, err := normalizeQualifiers(u.RawQuery)
+	if err != nil {
+		return "", err
+	}
+	u.RawQuery = q
+	return u.String(), nil
+}
+
+// normalizeQualifiers returns the qualifier string with the keys and the
+// values of each key sorted.
+func normalizeQualifiers(rawQuery string) (string, error) {
 	// [url.Parse] silently discards malformed value pairs. So we need to use
 	// [url.ParseQuery] to check if there are any errors.
-	q, err := url.ParseQuery(u.RawQuery)
+	q, err := url.ParseQuery(rawQuery)
 	if err != nil {
-		return fmt.Errorf("subscope validation failed: failed to parse qualifier string %s: %w", u.RawQuery, err)
+		return "", fmt.Errorf("failed to parse qualifier string %s: %w", rawQuery, err)
 	}
 
 	keys := make([]string, 0, len(q))
@@ -98,10 +408,5 @@ func validateSubscope(r *Resource) error {
 		}
 	}
 
-	wantQueryString := strings.Join(kvPairs, "&")
-	if wantQueryString != u.RawQuery {
-		return fmt.Errorf("subscope validation failed: qualifiers must be in alphabetical order, want: %s, got: %s", wantQueryString, u.RawQuery)
-	}
-
-	return nil
+	return strings.Join(kvPairs, "&"), nil
 }
@@ -16,6 +16,7 @@ package v1alpha1
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -31,6 +32,7 @@ func TestValidateResouceMapping(t *testing.T) {
 		name         string
 		expErr       string
 		data         *ResourceMapping
+		opts         []ValidateOption
 		wantSubscope string
 	}{
 		{
@@ -183,12 +185,330 @@ func TestValidateResouceMapping(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:   "reserved_prefix_user_key",
+			expErr: `annotation key "sys.location" uses reserved prefix "sys."`,
+			opts:   []ValidateOption{WithReservedAnnotationPrefix("sys.")},
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+				Annotations: &structpb.Struct{
+					Fields: map[string]*structpb.Value{
+						"location":     structpb.NewStringValue("global"),
+						"sys.location": structpb.NewStringValue("global"),
+					},
+				},
+			},
+		},
+		{
+			name: "reserved_prefix_multiple_user_keys",
+			expErr: `annotation key "sys.a" uses reserved prefix "sys."` + "\n" +
+				`annotation key "sys.b" uses reserved prefix "sys."`,
+			opts: []ValidateOption{WithReservedAnnotationPrefix("sys.")},
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+				Annotations: &structpb.Struct{
+					Fields: map[string]*structpb.Value{
+						"sys.b": structpb.NewStringValue("b"),
+						"sys.a": structpb.NewStringValue("a"),
+					},
+				},
+			},
+		},
+		{
+			name: "reserved_prefix_no_conflict",
+			opts: []ValidateOption{WithReservedAnnotationPrefix("sys.")},
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+				Annotations: &structpb.Struct{
+					Fields: map[string]*structpb.Value{
+						"system":   structpb.NewStringValue("billing"),
+						"location": structpb.NewStringValue("global"),
+					},
+				},
+			},
+		},
+		{
+			name: "required_annotation_keys_present",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+				Annotations: &structpb.Struct{
+					Fields: map[string]*structpb.Value{
+						"dataClassification": structpb.NewStringValue("confidential"),
+						"retention":          structpb.NewStringValue("30d"),
+					},
+				},
+			},
+			opts: []ValidateOption{WithValidators(RequiredAnnotationKeys("dataClassification", "retention"))},
+		},
+		{
+			name: "required_annotation_keys_missing",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+				Annotations: &structpb.Struct{
+					Fields: map[string]*structpb.Value{
+						"retention": structpb.NewStringValue("30d"),
+					},
+				},
+			},
+			opts:   []ValidateOption{WithValidators(RequiredAnnotationKeys("dataClassification", "retention", "owner"))},
+			expErr: "required annotation key \"dataClassification\" is missing\nrequired annotation key \"owner\" is missing",
+		},
+		{
+			name: "required_annotation_keys_no_annotations",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+			},
+			opts:   []ValidateOption{WithValidators(RequiredAnnotationKeys("dataClassification"))},
+			expErr: `required annotation key "dataClassification" is missing`,
+		},
+		{
+			name: "no_required_annotation_keys",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+			},
+			opts: []ValidateOption{WithValidators(RequiredAnnotationKeys())},
+		},
+		{
+			name: "no_reserved_prefix_by_default",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+				Annotations: &structpb.Struct{
+					Fields: map[string]*structpb.Value{
+						"sys.location": structpb.NewStringValue("global"),
+					},
+				},
+			},
+		},
+		{
+			name: "valid_aliases",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+					Aliases:  []string{"//pubsub.googleapis.com/projects/old-project/topics/test-topic", "//pubsub.googleapis.com/projects/test-project/topics/old-topic"},
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+			},
+		},
+		{
+			name:   "empty_alias",
+			expErr: "empty resource alias",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+					Aliases:  []string{""},
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+			},
+		},
+		{
+			name:   "alias_is_the_name",
+			expErr: "resource alias \"//pubsub.googleapis.com/projects/test-project/topics/test-topic\" is the resource name",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+					Aliases:  []string{"//pubsub.googleapis.com/projects/test-project/topics/test-topic"},
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+			},
+		},
+		{
+			name:   "duplicate_alias",
+			expErr: "duplicate resource alias \"//pubsub.googleapis.com/projects/old-project/topics/test-topic\"",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+					Aliases:  []string{"//pubsub.googleapis.com/projects/old-project/topics/test-topic", "//pubsub.googleapis.com/projects/old-project/topics/test-topic"},
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+			},
+		},
+		{
+			name: "contacts_at_default_limit",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: testEmails(DefaultMaxContacts),
+				},
+			},
+		},
+		{
+			name:   "contacts_above_default_limit",
+			expErr: "too many contacts: got 51, want at most 50",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: testEmails(DefaultMaxContacts + 1),
+				},
+			},
+		},
+		{
+			name: "contacts_at_configured_limit",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: testEmails(3),
+				},
+			},
+			opts: []ValidateOption{WithMaxContacts(3)},
+		},
+		{
+			name:   "contacts_above_configured_limit",
+			expErr: "too many contacts: got 4, want at most 3",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: testEmails(4),
+				},
+			},
+			opts: []ValidateOption{WithMaxContacts(3)},
+		},
+		{
+			name: "contacts_limit_disabled",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &Contacts{
+					Email: testEmails(DefaultMaxContacts + 1),
+				},
+			},
+			opts: []ValidateOption{WithMaxContacts(0)},
+		},
+		{
+			name: "qualifier_keys_unrestricted",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+					Subscope: "parent/foo?anything=value1&region=us",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+			},
+		},
+		{
+			name: "qualifier_keys_allowed",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+					Subscope: "parent/foo?region=us&shard=1",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+			},
+			opts: []ValidateOption{WithAllowedQualifierKeys("region", "shard")},
+		},
+		{
+			name: "qualifier_keys_allowed_without_qualifiers",
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+					Subscope: "parent/foo",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+			},
+			opts: []ValidateOption{WithAllowedQualifierKeys("region")},
+		},
+		{
+			name:   "qualifier_keys_disallowed",
+			expErr: `subscope validation failed: qualifier key "zone" is not one of the allowed keys: [region shard]`,
+			data: &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+					Subscope: "parent/foo?region=us&zone=a",
+				},
+				Contacts: &Contacts{
+					Email: []string{"pmap@example.com"},
+				},
+			},
+			opts: []ValidateOption{WithAllowedQualifierKeys("region", "shard")},
+		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
-			err := ValidateResourceMapping(tc.data)
+			err := ValidateResourceMapping(tc.data, tc.opts...)
 			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
 				t.Errorf("ValidateResourceMapping got unexpected error: %s", diff)
 			}
@@ -200,3 +520,277 @@ func TestValidateResouceMapping(t *testing.T) {
 		})
 	}
 }
+
+// testEmails returns n distinct valid contact emails.
+func testEmails(n int) []string {
+	emails := make([]string, 0, n)
+	for i := range n {
+		emails = append(emails, fmt.Sprintf("pmap-%d@example.com", i))
+	}
+	return emails
+}
+
+// TestRegisterValidator is not parallel as it modifies the global validators,
+// it runs before and restores them for the parallel tests.
+func TestRegisterValidator(t *testing.T) {
+	validatorsMu.Lock()
+	orig := validators
+	validators = nil
+	validatorsMu.Unlock()
+	t.Cleanup(func() {
+		validatorsMu.Lock()
+		defer validatorsMu.Unlock()
+		validators = orig
+	})
+
+	var calls int
+	RegisterValidator(func(m *ResourceMapping) error {
+		calls++
+		for _, e := range m.GetContacts().GetEmail() {
+			if !strings.HasSuffix(e, "@corp.example.com") {
+				return fmt.Errorf("contact %q is not a corporate email", e)
+			}
+		}
+		return nil
+	})
+
+	cases := []struct {
+		name   string
+		email  string
+		expErr string
+	}{
+		{
+			name:  "corporate_domain",
+			email: "pmap@corp.example.com",
+		},
+		{
+			name:   "non_corporate_domain",
+			email:  "pmap@example.com",
+			expErr: `contact "pmap@example.com" is not a corporate email`,
+		},
+		{
+			name:  "runs_after_built_ins",
+			email: "invalid",
+			expErr: "invalid owner: mail: missing '@' or angle-addr\n" +
+				`contact "invalid" is not a corporate email`,
+		},
+	}
+
+	for _, tc := range cases {
+		calls = 0
+		err := ValidateResourceMapping(&ResourceMapping{
+			Resource: &Resource{
+				Provider: "gcp",
+				Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+			},
+			Contacts: &Contacts{
+				Email: []string{tc.email},
+			},
+		})
+		if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+			t.Errorf("ValidateResourceMapping(%s) got unexpected error: %s", tc.name, diff)
+		}
+		if calls != 1 {
+			t.Errorf("ValidateResourceMapping(%s) ran the validator %d times, want 1", tc.name, calls)
+		}
+	}
+}
+
+func TestNormalizeSubscope(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		subscope string
+		want     string
+		wantErr  string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "no_qualifiers",
+			subscope: "parent/foo/child/bar",
+			want:     "parent/foo/child/bar",
+		},
+		{
+			name:     "sorted_qualifiers",
+			subscope: "parent/foo/child/bar?key1=value1&key2=value2",
+			want:     "parent/foo/child/bar?key1=value1&key2=value2",
+		},
+		{
+			name:     "unsorted_qualifiers",
+			subscope: "parent/foo/child/bar?key2=value2&key1=value1&key1=value0",
+			want:     "parent/foo/child/bar?key1=value0&key1=value1&key2=value2",
+		},
+		{
+			name:     "invalid_subscope_url",
+			subscope: "parent/foo/child/\\\bar?key1=value1",
+			wantErr:  "failed to parse subscope string",
+		},
+		{
+			name:     "invalid_qualifiers",
+			subscope: "parent/foo?key1=%zz",
+			wantErr:  "failed to parse qualifier string",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := NormalizeSubscope(tc.subscope)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("NormalizeSubscope(%q) got diff (-want, +got): %v", tc.subscope, diff)
+			}
+		})
+	}
+}
+
+func TestKeyCasing_Canonical(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		casing  KeyCasing
+		key     string
+		wantKey string
+		expErr  string
+	}{
+		{
+			name:    "lower_camel_canonical",
+			casing:  KeyCasingLowerCamel,
+			key:     "dataClassification",
+			wantKey: "dataClassification",
+		},
+		{
+			name:    "lower_camel_from_upper_camel",
+			casing:  KeyCasingLowerCamel,
+			key:     "Env",
+			wantKey: "env",
+		},
+		{
+			name:    "lower_camel_from_snake",
+			casing:  KeyCasingLowerCamel,
+			key:     "data_classification",
+			wantKey: "dataClassification",
+		},
+		{
+			name:    "lower_camel_from_kebab",
+			casing:  KeyCasingLowerCamel,
+			key:     "Data-Classification",
+			wantKey: "dataClassification",
+		},
+		{
+			name:    "lower_camel_acronym",
+			casing:  KeyCasingLowerCamel,
+			key:     "HTTPServerID",
+			wantKey: "httpServerId",
+		},
+		{
+			name:    "lower_camel_digits",
+			casing:  KeyCasingLowerCamel,
+			key:     "retention30Days",
+			wantKey: "retention30Days",
+		},
+		{
+			name:    "snake_canonical",
+			casing:  KeyCasingSnake,
+			key:     "data_classification",
+			wantKey: "data_classification",
+		},
+		{
+			name:    "snake_from_lower_camel",
+			casing:  KeyCasingSnake,
+			key:     "dataClassification",
+			wantKey: "data_classification",
+		},
+		{
+			name:    "snake_from_upper",
+			casing:  KeyCasingSnake,
+			key:     "ENV",
+			wantKey: "env",
+		},
+		{
+			name:   "unknown_casing",
+			casing: "kebab",
+			key:    "env",
+			expErr: `unknown key casing "kebab"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tc.casing.Canonical(tc.key)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Errorf("Canonical(%q) got unexpected error: %s", tc.key, diff)
+			}
+			if got != tc.wantKey {
+				t.Errorf("Canonical(%q) got %q, want %q", tc.key, got, tc.wantKey)
+			}
+		})
+	}
+}
+
+func TestAnnotationKeyCasing(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		casing KeyCasing
+		keys   []string
+		expErr string
+	}{
+		{
+			name:   "canonical_keys",
+			casing: KeyCasingLowerCamel,
+			keys:   []string{"env", "dataClassification"},
+		},
+		{
+			name:   "no_annotations",
+			casing: KeyCasingLowerCamel,
+		},
+		{
+			name:   "rejects_non_canonical_keys",
+			casing: KeyCasingLowerCamel,
+			keys:   []string{"env", "Env", "data_classification"},
+			expErr: "annotation key \"Env\" is not lowerCamel, want \"env\"\n" +
+				`annotation key "data_classification" is not lowerCamel, want "dataClassification"`,
+		},
+		{
+			name:   "rejects_non_snake_keys",
+			casing: KeyCasingSnake,
+			keys:   []string{"dataClassification"},
+			expErr: `annotation key "dataClassification" is not snake, want "data_classification"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := &ResourceMapping{
+				Resource: &Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+			}
+			if len(tc.keys) > 0 {
+				m.Annotations = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+				for _, k := range tc.keys {
+					m.Annotations.Fields[k] = structpb.NewStringValue("value")
+				}
+			}
+
+			err := ValidateResourceMapping(m, WithValidators(AnnotationKeyCasing(tc.casing)))
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Errorf("ValidateResourceMapping got unexpected error: %s", diff)
+			}
+		})
+	}
+}
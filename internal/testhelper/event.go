@@ -0,0 +1,112 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testhelper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+// Defaults of the test events, they match the objects uploaded by the
+// snapshot workflows.
+const (
+	TestEventBucketID = "test-bucket"
+	TestEventObjectID = "test-dir/gh-prefix/test-file.yaml"
+)
+
+// NewTestMappingEvent returns a representative mapping event with a GCP
+// ResourceMapping payload annotated with the traceID, so the event can be
+// looked up downstream.
+func NewTestMappingEvent(traceID string) (*v1alpha1.PmapEvent, error) {
+	annotations, err := structpb.NewStruct(map[string]any{"traceID": traceID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build annotations: %w", err)
+	}
+	return newTestEvent("mapping", &v1alpha1.ResourceMapping{
+		Resource: &v1alpha1.Resource{
+			Provider: "gcp",
+			Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+		},
+		Contacts:    &v1alpha1.Contacts{Email: []string{"pmap@example.com"}},
+		Annotations: annotations,
+	})
+}
+
+// NewTestPolicyEvent returns a representative policy event with a policy
+// payload carrying the traceID, so the event can be looked up downstream.
+func NewTestPolicyEvent(traceID string) (*v1alpha1.PmapEvent, error) {
+	policy, err := structpb.NewStruct(map[string]any{
+		"policy_id": "test-policy",
+		"traceID":   traceID,
+		"deletion_policy": map[string]any{
+			"retention_days": 30,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build policy: %w", err)
+	}
+	return newTestEvent("policy", policy)
+}
+
+func newTestEvent(eventType string, payload proto.Message) (*v1alpha1.PmapEvent, error) {
+	p, err := anypb.New(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert payload to any: %w", err)
+	}
+	now := time.Now().UTC()
+	return &v1alpha1.PmapEvent{
+		Payload:   p,
+		Type:      eventType,
+		Timestamp: timestamppb.New(now),
+		GithubSource: &v1alpha1.GitHubSource{
+			RepoName:                   "abcxyz/pmap",
+			FilePath:                   "test-file.yaml",
+			Commit:                     "0123456789abcdef0123456789abcdef01234567",
+			Workflow:                   "snapshot",
+			WorkflowSha:                "89abcdef0123456789abcdef0123456789abcdef",
+			WorkflowTriggeredTimestamp: timestamppb.New(now),
+			WorkflowRunId:              "1",
+			WorkflowRunAttempt:         1,
+		},
+	}, nil
+}
+
+// PublishTestEvent publishes the event with the messenger the same way the
+// handler publishes successful events, and returns the attributes used.
+func PublishTestEvent(ctx context.Context, m *server.PubSubMessenger, event *v1alpha1.PmapEvent) (map[string]string, error) {
+	data, err := protojson.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	attr := map[string]string{
+		server.AttrKeyOutcome:  server.OutcomeSuccess,
+		server.AttrKeyBucketID: TestEventBucketID,
+		server.AttrKeyObjectID: TestEventObjectID,
+	}
+	if err := m.Send(ctx, data, attr); err != nil {
+		return nil, fmt.Errorf("failed to publish event: %w", err)
+	}
+	return attr, nil
+}
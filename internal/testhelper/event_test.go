@@ -0,0 +1,110 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testhelper
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+func TestPublishTestEvent(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		newEvent func(traceID string) (*v1alpha1.PmapEvent, error)
+		wantType string
+	}{
+		{
+			name:     "mapping",
+			newEvent: NewTestMappingEvent,
+			wantType: "mapping",
+		},
+		{
+			name:     "policy",
+			newEvent: NewTestPolicyEvent,
+			wantType: "policy",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			psSrv := pstest.NewServer()
+			t.Cleanup(func() { psSrv.Close() })
+			psConn, err := grpc.NewClient(psSrv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatalf("failed to connect to fake pubsub server: %v", err)
+			}
+			pubsubClient, err := pubsub.NewClient(ctx, "test-project", option.WithGRPCConn(psConn))
+			if err != nil {
+				t.Fatalf("failed to create pubsub client: %v", err)
+			}
+			t.Cleanup(func() { pubsubClient.Close() })
+			topic, err := pubsubClient.CreateTopic(ctx, "test-topic")
+			if err != nil {
+				t.Fatalf("failed to create topic: %v", err)
+			}
+			t.Cleanup(topic.Stop)
+
+			event, err := tc.newEvent("test-trace")
+			if err != nil {
+				t.Fatalf("failed to build event: %v", err)
+			}
+			if got := event.GetType(); got != tc.wantType {
+				t.Errorf("event got type %q, want %q", got, tc.wantType)
+			}
+
+			attr, err := PublishTestEvent(ctx, server.NewPubSubMessenger(topic), event)
+			if err != nil {
+				t.Fatalf("PublishTestEvent got unexpected error: %v", err)
+			}
+
+			msgs := psSrv.Messages()
+			if got, want := len(msgs), 1; got != want {
+				t.Fatalf("got %d published messages, want %d", got, want)
+			}
+			if diff := cmp.Diff(attr, msgs[0].Attributes); diff != "" {
+				t.Errorf("published attributes diff (-want, +got): %v", diff)
+			}
+			if got, want := attr[server.AttrKeyOutcome], server.OutcomeSuccess; got != want {
+				t.Errorf("published attributes got outcome %q, want %q", got, want)
+			}
+
+			got := &v1alpha1.PmapEvent{}
+			if err := protojson.Unmarshal(msgs[0].Data, got); err != nil {
+				t.Fatalf("failed to unmarshal published event: %v", err)
+			}
+			if diff := cmp.Diff(event, got, protocmp.Transform()); diff != "" {
+				t.Errorf("published event diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testhelper
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// FakeGRPCServer is like [testutil.FakeGRPCServer], but waits for the
+// server to stop when the test finishes, so it can't log after the test.
+func FakeGRPCServer(tb testing.TB, registerFunc testutil.RegisterFunc) (string, *grpc.ClientConn) {
+	tb.Helper()
+
+	s := grpc.NewServer()
+	registerFunc(s)
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		tb.Fatalf("net.Listen(tcp, localhost:0) failed: %v", err)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve(lis)
+	}()
+	tb.Cleanup(func() {
+		s.GracefulStop()
+		// Serve fails with ErrServerStopped when stopped before it started.
+		if err := <-serveErr; err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			tb.Errorf("fake grpc server failed to serve: %v", err)
+		}
+	})
+
+	addr := lis.Addr().String()
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		tb.Fatalf("failed to dial %q: %v", addr, err)
+	}
+	return addr, conn
+}
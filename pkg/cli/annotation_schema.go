@@ -0,0 +1,48 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/pmap/pkg/mapping/processors"
+)
+
+// loadAnnotationSchema loads the annotation schema file which maps annotation
+// keys to the constraints of their values:
+//
+//	dataClassification:
+//	  enum: [public, internal, confidential]
+//	owner:
+//	  pattern: "team-[a-z]+"
+func loadAnnotationSchema(path string) (map[string]processors.AnnotationConstraint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read annotation schema file %q: %w", path, err)
+	}
+
+	// Unknown fields are rejected so misspelled constraints aren't ignored.
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var schema map[string]processors.AnnotationConstraint
+	if err := dec.Decode(&schema); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal annotation schema file %q: %w", path, err)
+	}
+	return schema, nil
+}
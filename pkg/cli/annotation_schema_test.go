@@ -0,0 +1,87 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/pkg/mapping/processors"
+)
+
+func TestLoadAnnotationSchema(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		content string
+		want    map[string]processors.AnnotationConstraint
+		wantErr string
+	}{
+		{
+			name: "success",
+			content: `
+dataClassification:
+  enum: [public, internal, confidential]
+owner:
+  pattern: "team-[a-z]+"
+`,
+			want: map[string]processors.AnnotationConstraint{
+				"dataClassification": {Enum: []string{"public", "internal", "confidential"}},
+				"owner":              {Pattern: "team-[a-z]+"},
+			},
+		},
+		{
+			name: "unknown_constraint",
+			content: `
+dataClassification:
+  enums: [public]
+`,
+			wantErr: "field enums not found",
+		},
+		{
+			name:    "invalid_yaml",
+			content: `dataClassification: public`,
+			wantErr: "failed to unmarshal annotation schema file",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "schema.yaml")
+			if err := os.WriteFile(path, []byte(tc.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := loadAnnotationSchema(path)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("loadAnnotationSchema got diff (-want, +got): %v", diff)
+			}
+		})
+	}
+
+	if _, err := loadAnnotationSchema(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("loadAnnotationSchema got no error for a missing file")
+	}
+}
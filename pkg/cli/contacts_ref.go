@@ -0,0 +1,137 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// contactsRefKey is the opt-in field of a resource mapping file that
+// references a shared contacts file, the path is relative to the referencing
+// file. A contacts file lists emails and may reference another contacts file:
+//
+//	email:
+//	  - team@example.com
+//	contactsRef: ../org/contacts.yaml
+const contactsRefKey = "contactsRef"
+
+// contactsFile is the format of a shared contacts file.
+type contactsFile struct {
+	Email       []string `yaml:"email"`
+	ContactsRef string   `yaml:"contactsRef"`
+}
+
+// resolveContactsRef returns the resource mapping data with the contacts
+// referenced by contactsRef merged into its contacts. Emails declared in the
+// mapping take precedence and are listed first, followed by the emails of the
+// referenced files in the order they are referenced. Duplicated emails are
+// dropped and cyclic references are rejected.
+//
+// The data is returned as is if it doesn't use contactsRef.
+func resolveContactsRef(path string, data []byte) ([]byte, error) {
+	m := map[string]any{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		// Leave reporting the invalid yaml to the unmarshalling of the mapping.
+		return data, nil //nolint:nilerr
+	}
+	ref, ok := m[contactsRefKey]
+	if !ok {
+		return data, nil
+	}
+	refPath, ok := ref.(string)
+	if !ok || refPath == "" {
+		return nil, fmt.Errorf("%s must be a non-empty string, got %v", contactsRefKey, ref)
+	}
+
+	var emails []string
+	if contacts, ok := m["contacts"].(map[string]any); ok {
+		if list, ok := contacts["email"].([]any); ok {
+			for _, e := range list {
+				emails = append(emails, fmt.Sprint(e))
+			}
+		}
+	}
+
+	chain, err := absPath(path)
+	if err != nil {
+		return nil, err
+	}
+	refEmails, err := loadContacts(filepath.Join(filepath.Dir(path), refPath), []string{chain})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range refEmails {
+		if !slices.Contains(emails, e) {
+			emails = append(emails, e)
+		}
+	}
+
+	m["contacts"] = map[string]any{"email": emails}
+	delete(m, contactsRefKey)
+
+	// JSON is valid YAML, so the result can be unmarshalled as YAML.
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal resolved mapping: %w", err)
+	}
+	return b, nil
+}
+
+// loadContacts loads the emails of the contacts file and the files it
+// references. chain holds the files referencing it to detect cycles.
+func loadContacts(path string, chain []string) ([]string, error) {
+	p, err := absPath(path)
+	if err != nil {
+		return nil, err
+	}
+	chain = append(chain, p)
+	if slices.Contains(chain[:len(chain)-1], p) {
+		return nil, fmt.Errorf("cyclic %s: %s", contactsRefKey, strings.Join(chain, " -> "))
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contacts file %q: %w", path, err)
+	}
+	var c contactsFile
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal contacts file %q: %w", path, err)
+	}
+
+	emails := c.Email
+	if c.ContactsRef != "" {
+		refEmails, err := loadContacts(filepath.Join(filepath.Dir(p), c.ContactsRef), chain)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, refEmails...)
+	}
+	return emails, nil
+}
+
+func absPath(path string) (string, error) {
+	p, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path of %q: %w", path, err)
+	}
+	return p, nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/abcxyz/pkg/protoutil"
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+func TestResolveContactsRef(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		files        map[string]string
+		wantContacts *v1alpha1.Contacts
+		wantErr      string
+	}{
+		{
+			name: "no_contacts_ref",
+			files: map[string]string{
+				"mapping/m.yaml": `
+resource:
+  provider: gcp
+  name: //storage.googleapis.com/test-bucket
+contacts:
+  email:
+    - owner@example.com
+`,
+			},
+			wantContacts: &v1alpha1.Contacts{Email: []string{"owner@example.com"}},
+		},
+		{
+			name: "valid_include",
+			files: map[string]string{
+				"mapping/m.yaml": `
+resource:
+  provider: gcp
+  name: //storage.googleapis.com/test-bucket
+contacts:
+  email:
+    - owner@example.com
+    - team@example.com
+contactsRef: ../contacts/team.yaml
+`,
+				"contacts/team.yaml": `
+email:
+  - team@example.com
+  - lead@example.com
+contactsRef: org.yaml
+`,
+				"contacts/org.yaml": `
+email:
+  - org@example.com
+`,
+			},
+			wantContacts: &v1alpha1.Contacts{Email: []string{
+				"owner@example.com",
+				"team@example.com",
+				"lead@example.com",
+				"org@example.com",
+			}},
+		},
+		{
+			name: "include_without_inline_contacts",
+			files: map[string]string{
+				"mapping/m.yaml": `
+resource:
+  provider: gcp
+  name: //storage.googleapis.com/test-bucket
+contactsRef: ../contacts/team.yaml
+`,
+				"contacts/team.yaml": `
+email:
+  - team@example.com
+`,
+			},
+			wantContacts: &v1alpha1.Contacts{Email: []string{"team@example.com"}},
+		},
+		{
+			name: "cyclic_include",
+			files: map[string]string{
+				"mapping/m.yaml": `
+resource:
+  provider: gcp
+  name: //storage.googleapis.com/test-bucket
+contactsRef: ../contacts/a.yaml
+`,
+				"contacts/a.yaml": `
+email:
+  - a@example.com
+contactsRef: b.yaml
+`,
+				"contacts/b.yaml": `
+email:
+  - b@example.com
+contactsRef: a.yaml
+`,
+			},
+			wantErr: "cyclic contactsRef",
+		},
+		{
+			name: "local_emails_take_precedence",
+			files: map[string]string{
+				"mapping/m.yaml": `
+resource:
+  provider: gcp
+  name: //storage.googleapis.com/test-bucket
+contacts:
+  email:
+    - b@example.com
+    - a@example.com
+contactsRef: ../contacts/team.yaml
+`,
+				"contacts/team.yaml": `
+email:
+  - a@example.com
+  - c@example.com
+  - b@example.com
+`,
+			},
+			wantContacts: &v1alpha1.Contacts{Email: []string{
+				"b@example.com",
+				"a@example.com",
+				"c@example.com",
+			}},
+		},
+		{
+			name: "self_include",
+			files: map[string]string{
+				"mapping/m.yaml": `
+resource:
+  provider: gcp
+  name: //storage.googleapis.com/test-bucket
+contactsRef: ../contacts/a.yaml
+`,
+				"contacts/a.yaml": `
+email:
+  - a@example.com
+contactsRef: ./a.yaml
+`,
+			},
+			wantErr: "cyclic contactsRef",
+		},
+		{
+			name: "include_of_the_mapping",
+			files: map[string]string{
+				"mapping/m.yaml": `
+resource:
+  provider: gcp
+  name: //storage.googleapis.com/test-bucket
+contactsRef: ../contacts/a.yaml
+`,
+				"contacts/a.yaml": `
+email:
+  - a@example.com
+contactsRef: ../mapping/m.yaml
+`,
+			},
+			wantErr: "cyclic contactsRef",
+		},
+		{
+			name: "missing_contacts_file",
+			files: map[string]string{
+				"mapping/m.yaml": `
+resource:
+  provider: gcp
+  name: //storage.googleapis.com/test-bucket
+contactsRef: ../contacts/missing.yaml
+`,
+			},
+			wantErr: "failed to read contacts file",
+		},
+		{
+			name: "invalid_contacts_ref",
+			files: map[string]string{
+				"mapping/m.yaml": `
+resource:
+  provider: gcp
+  name: //storage.googleapis.com/test-bucket
+contactsRef:
+  - a.yaml
+`,
+			},
+			wantErr: "contactsRef must be a non-empty string",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			td := t.TempDir()
+			for name, data := range tc.files {
+				p := filepath.Join(td, name)
+				if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(data), 0o600); err != nil {
+					t.Fatalf("failed to write data to file %s: %v", name, err)
+				}
+			}
+
+			path := filepath.Join(td, "mapping/m.yaml")
+			got, err := resolveContactsRef(path, []byte(tc.files["mapping/m.yaml"]))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			var m v1alpha1.ResourceMapping
+			if err := protoutil.FromYAML(got, &m); err != nil {
+				t.Fatalf("failed to unmarshal resolved mapping: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantContacts, m.GetContacts(), protocmp.Transform()); diff != "" {
+				t.Errorf("contacts got diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
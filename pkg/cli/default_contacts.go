@@ -0,0 +1,81 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/mail"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadDefaultContacts loads the default contacts file which maps ancestors
+// to contact emails:
+//
+//	folders/123:
+//	  - team@example.com
+//	organizations/456:
+//	  - security@example.com
+func loadDefaultContacts(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read default contacts file %q: %w", path, err)
+	}
+	var defaults map[string][]string
+	if err := yaml.Unmarshal(data, &defaults); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal default contacts file %q: %w", path, err)
+	}
+
+	var merr error
+	for _, ancestor := range slices.Sorted(maps.Keys(defaults)) {
+		emails := defaults[ancestor]
+		if err := validateAncestor(ancestor); err != nil {
+			merr = errors.Join(merr, err)
+		}
+		if len(emails) == 0 {
+			merr = errors.Join(merr, fmt.Errorf("ancestor %q has no contacts", ancestor))
+		}
+		for _, e := range emails {
+			if _, err := mail.ParseAddress(e); err != nil {
+				merr = errors.Join(merr, fmt.Errorf("ancestor %q has invalid contact %q: %w", ancestor, e, err))
+			}
+		}
+	}
+	if merr != nil {
+		return nil, fmt.Errorf("invalid default contacts file %q: %w", path, merr)
+	}
+	return defaults, nil
+}
+
+// validateAncestor checks the ancestor is in one of the formats
+// "projects/{PROJECT_NUMBER}", "folders/{FOLDER_NUMBER}" or
+// "organizations/{ORGANIZATION_NUMBER}".
+func validateAncestor(ancestor string) error {
+	kind, id, ok := strings.Cut(ancestor, "/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return fmt.Errorf("invalid ancestor %q", ancestor)
+	}
+	switch kind {
+	case "projects", "folders", "organizations":
+		return nil
+	default:
+		return fmt.Errorf("invalid ancestor %q", ancestor)
+	}
+}
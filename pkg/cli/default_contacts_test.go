@@ -0,0 +1,98 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestLoadDefaultContacts(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		content string
+		want    map[string][]string
+		wantErr string
+	}{
+		{
+			name: "success",
+			content: `
+folders/123:
+  - team@example.com
+  - oncall@example.com
+organizations/456:
+  - security@example.com
+`,
+			want: map[string][]string{
+				"folders/123":       {"team@example.com", "oncall@example.com"},
+				"organizations/456": {"security@example.com"},
+			},
+		},
+		{
+			name:    "invalid_yaml",
+			content: `folders/123: team@example.com`,
+			wantErr: "failed to unmarshal default contacts file",
+		},
+		{
+			name: "invalid_ancestor",
+			content: `
+buckets/foo:
+  - team@example.com
+`,
+			wantErr: `invalid ancestor "buckets/foo"`,
+		},
+		{
+			name: "no_contacts",
+			content: `
+folders/123: []
+`,
+			wantErr: `ancestor "folders/123" has no contacts`,
+		},
+		{
+			name: "invalid_email",
+			content: `
+folders/123:
+  - not-an-email
+`,
+			wantErr: `ancestor "folders/123" has invalid contact "not-an-email"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "default-contacts.yaml")
+			if err := os.WriteFile(path, []byte(tc.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := loadDefaultContacts(path)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("loadDefaultContacts got diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
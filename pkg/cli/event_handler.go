@@ -0,0 +1,127 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/abcxyz/pkg/multicloser"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+// newHandlerMessengers returns the success messenger of the event handler and
+// the options of its other messengers. The events are written to the local
+// output file, stdout or else published to the configured topics with
+// pubsubClient, which isn't used otherwise. The returned closer closes the
+// file or stops the topics.
+func newHandlerMessengers(ctx context.Context, cfg *server.HandlerConfig, pubsubClient *pubsub.Client) (server.Messenger, []server.Option, *multicloser.Closer, error) {
+	var closer *multicloser.Closer
+
+	switch {
+	case cfg.LocalOutputFile != "":
+		fileMessenger, err := server.OpenFileMessenger(cfg.LocalOutputFile)
+		if err != nil {
+			return nil, nil, closer, err //nolint:wrapcheck // Already describes the file.
+		}
+		closer = multicloser.Append(closer, fileMessenger.Close)
+		return fileMessenger, []server.Option{server.WithFailureMessenger(fileMessenger)}, closer, nil
+	case cfg.Sink == server.SinkStdout:
+		stdoutMessenger := server.NewStdoutMessenger()
+		return stdoutMessenger, []server.Option{server.WithFailureMessenger(stdoutMessenger)}, closer, nil
+	}
+
+	var opts []server.Option
+	successTopic := pubsubClient.Topic(cfg.SuccessTopicID)
+	successMessenger := server.NewPubSubMessenger(successTopic, cfg.PubSubMessengerOptions()...)
+	closer = multicloser.Append(closer, successTopic.Stop)
+	selfTestTopics := []*pubsub.Topic{successTopic}
+
+	if cfg.DualWriteTopicID != "" {
+		dualWriteTopic := pubsubClient.Topic(cfg.DualWriteTopicID)
+		closer = multicloser.Append(closer, dualWriteTopic.Stop)
+		selfTestTopics = append(selfTestTopics, dualWriteTopic)
+		opts = append(opts, server.WithDualWriteMessenger(server.NewPubSubMessenger(dualWriteTopic, cfg.PubSubMessengerOptions()...)))
+	}
+
+	// Failure topic is optional for policy service, failure events are
+	// dropped when it's not configured unless they're logged. The mapping
+	// config requires it.
+	if cfg.FailureTopicID != "" {
+		failureTopic := pubsubClient.Topic(cfg.FailureTopicID)
+		closer = multicloser.Append(closer, failureTopic.Stop)
+		selfTestTopics = append(selfTestTopics, failureTopic)
+		opts = append(opts, server.WithFailureMessenger(server.NewPubSubMessenger(failureTopic, cfg.PubSubMessengerOptions()...)))
+	} else if cfg.LogFailureEvents {
+		opts = append(opts, server.WithFailureLogger(nil))
+	}
+
+	if cfg.IndexTopicID != "" {
+		indexTopic := pubsubClient.Topic(cfg.IndexTopicID)
+		closer = multicloser.Append(closer, indexTopic.Stop)
+		opts = append(opts, server.WithIndexMessenger(server.NewPubSubMessenger(indexTopic)))
+	}
+
+	if cfg.PublishSelfTest {
+		if err := server.VerifyPublish(ctx, selfTestTopics...); err != nil {
+			return nil, nil, closer, fmt.Errorf("publish self-test failed: %w", err)
+		}
+	}
+	return successMessenger, opts, closer, nil
+}
+
+// handlerOptions returns the options of the event handler which don't depend
+// on where the events are sent.
+func handlerOptions(ctx context.Context, cfg *server.HandlerConfig) ([]server.Option, error) {
+	opts := []server.Option{server.WithHandleTimeout(cfg.HandleTimeout)}
+	if cfg.FilePathFallback == server.FilePathFallbackObjectID {
+		opts = append(opts, server.WithFilePathFallback(server.ObjectIDFilePath))
+	}
+	if cfg.RateLimitQPS > 0 {
+		opts = append(opts, server.WithRateLimit(cfg.RateLimitQPS, cfg.RateLimitBurst))
+	}
+	if cfg.JSONKeyCasing == server.JSONKeyCasingSnake {
+		opts = append(opts, server.WithProtoNames())
+	}
+	if cfg.ObjectMetadataAttribute {
+		opts = append(opts, server.WithObjectMetadataAttribute(server.MaxObjectMetadataAttrBytes))
+	}
+	if cfg.SequenceAttribute {
+		opts = append(opts, server.WithSequenceAttribute())
+	}
+	if cfg.WarningsAttribute {
+		opts = append(opts, server.WithWarningsAttribute())
+	}
+	// Notifications without object metadata emit events without the GitHub
+	// provenance unless PMAP_REQUIRE_PROVENANCE is set.
+	if cfg.RequireProvenance {
+		opts = append(opts, server.WithRequireProvenance())
+	} else {
+		opts = append(opts, server.WithOptionalGitHubSource())
+	}
+	if len(cfg.StaticAttributes) > 0 {
+		opts = append(opts, server.WithStaticAttributes(cfg.StaticAttributeMap()))
+	}
+	if cfg.PushAudience != "" {
+		verifier, err := server.NewIDTokenVerifier(ctx, cfg.PushAudience)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create push verifier: %w", err)
+		}
+		opts = append(opts, server.WithPushVerifier(verifier))
+	}
+	return opts, nil
+}
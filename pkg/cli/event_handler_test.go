@@ -0,0 +1,126 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+func TestNewHandlerMessengers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	psSrv := pstest.NewServer()
+	t.Cleanup(func() { psSrv.Close() })
+	psConn, err := grpc.NewClient(psSrv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to connect to fake pubsub server: %v", err)
+	}
+	pubsubClient, err := pubsub.NewClient(ctx, "test-project", option.WithGRPCConn(psConn))
+	if err != nil {
+		t.Fatalf("failed to create pubsub client: %v", err)
+	}
+	t.Cleanup(func() { pubsubClient.Close() })
+
+	cases := []struct {
+		name          string
+		cfg           *server.HandlerConfig
+		wantMessenger string
+		wantOpts      int
+		wantErr       string
+	}{
+		{
+			name:          "local_output_file",
+			cfg:           &server.HandlerConfig{LocalOutputFile: filepath.Join(t.TempDir(), "events.jsonl")},
+			wantMessenger: "*server.FileMessenger",
+			wantOpts:      1,
+		},
+		{
+			name:    "local_output_file_missing_dir",
+			cfg:     &server.HandlerConfig{LocalOutputFile: filepath.Join(t.TempDir(), "missing", "events.jsonl")},
+			wantErr: "no such file or directory",
+		},
+		{
+			name:          "stdout",
+			cfg:           &server.HandlerConfig{Sink: server.SinkStdout},
+			wantMessenger: "*server.FileMessenger",
+			wantOpts:      1,
+		},
+		{
+			name: "pubsub_all_topics",
+			cfg: &server.HandlerConfig{
+				SuccessTopicID:   "success",
+				FailureTopicID:   "failure",
+				DualWriteTopicID: "dual-write",
+				IndexTopicID:     "index",
+			},
+			wantMessenger: "*server.PubSubMessenger",
+			wantOpts:      3,
+		},
+		{
+			name: "pubsub_log_failure_events",
+			cfg: &server.HandlerConfig{
+				SuccessTopicID:   "success",
+				LogFailureEvents: true,
+			},
+			wantMessenger: "*server.PubSubMessenger",
+			wantOpts:      1,
+		},
+		{
+			name:          "pubsub_no_failure_topic",
+			cfg:           &server.HandlerConfig{SuccessTopicID: "success"},
+			wantMessenger: "*server.PubSubMessenger",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			messenger, opts, closer, err := newHandlerMessengers(ctx, tc.cfg, pubsubClient)
+			t.Cleanup(func() {
+				if err := closer.Close(); err != nil {
+					t.Errorf("failed to close messengers: %v", err)
+				}
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			if got, want := fmt.Sprintf("%T", messenger), tc.wantMessenger; got != want {
+				t.Errorf("got success messenger %s, want %s", got, want)
+			}
+			if got, want := len(opts), tc.wantOpts; got != want {
+				t.Errorf("got %d options, want %d", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+var _ cli.Command = (*EventShowCommand)(nil)
+
+// EventShowCommand prints the events of a JSON Lines event file, e.g. written
+// by the servers with PMAP_LOCAL_OUTPUT_FILE or the stdout sink.
+type EventShowCommand struct {
+	cli.BaseCommand
+
+	flagPath     string
+	flagOutcome  string
+	flagObjectID string
+}
+
+func (c *EventShowCommand) Desc() string {
+	return `Print the events of a JSON Lines event file`
+}
+
+func (c *EventShowCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+  Print the events of a JSON Lines event file with their attributes:
+
+      pmap event show -path "/path/to/events.jsonl"
+
+  Only print the failure events of an object:
+
+      pmap event show -path "/path/to/events.jsonl" -outcome failure -object-id "dir/gh-prefix/file.yaml"
+`
+}
+
+func (c *EventShowCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+
+	// Command options
+	f := set.NewSection("COMMAND OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "path",
+		Aliases: []string{"p"},
+		Target:  &c.flagPath,
+		Example: "/path/to/events.jsonl",
+		Usage:   `The JSON Lines event file to read.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "outcome",
+		Target:  &c.flagOutcome,
+		Example: server.OutcomeFailure,
+		Usage:   `Only print the events with the outcome, all events are printed if unset.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "object-id",
+		Target:  &c.flagObjectID,
+		Example: "dir/gh-prefix/file.yaml",
+		Usage:   `Only print the events of the GCS object, all events are printed if unset.`,
+	})
+
+	return set
+}
+
+func (c *EventShowCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	if c.flagPath == "" {
+		return fmt.Errorf("path is required")
+	}
+
+	file, err := os.Open(c.flagPath)
+	if err != nil {
+		return fmt.Errorf("failed to open event file: %w", err)
+	}
+	defer file.Close()
+
+	r := server.NewEventReader(file)
+	var shown int
+	for {
+		event, attr, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read event file %q: %w", c.flagPath, err)
+		}
+		if c.flagOutcome != "" && attr[server.AttrKeyOutcome] != c.flagOutcome {
+			continue
+		}
+		if c.flagObjectID != "" && attr[server.AttrKeyObjectID] != c.flagObjectID {
+			continue
+		}
+
+		b, err := protojson.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		// protojson output isn't stable, indent it for deterministic output.
+		var out bytes.Buffer
+		if err := json.Indent(&out, b, "", "  "); err != nil {
+			return fmt.Errorf("failed to indent event: %w", err)
+		}
+		c.Outf("# %s\n%s", formatAttributes(attr), out.String())
+		shown++
+	}
+	c.Outf("Shown %d events", shown)
+	return nil
+}
+
+// formatAttributes returns the attributes as "key=value" pairs sorted by key.
+func formatAttributes(attr map[string]string) string {
+	pairs := make([]string, 0, len(attr))
+	for _, k := range slices.Sorted(maps.Keys(attr)) {
+		pairs = append(pairs, k+"="+attr[k])
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+func TestEventShowCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	td := t.TempDir()
+
+	var events []byte
+	for _, e := range []struct {
+		data string
+		attr map[string]string
+	}{
+		{
+			data: `{"githubSource":{"repoName":"test-repo","filePath":"a.yaml"}}`,
+			attr: map[string]string{server.AttrKeyOutcome: server.OutcomeSuccess, server.AttrKeyObjectID: "gh-prefix/a.yaml"},
+		},
+		{
+			data: `{"githubSource":{"repoName":"test-repo","filePath":"b.yaml"}}`,
+			attr: map[string]string{server.AttrKeyOutcome: server.OutcomeFailure, server.AttrKeyObjectID: "gh-prefix/b.yaml"},
+		},
+		{
+			data: `{"githubSource":{"repoName":"test-repo","filePath":"a.yaml"}}`,
+			attr: map[string]string{server.AttrKeyOutcome: server.OutcomeFailure, server.AttrKeyObjectID: "gh-prefix/a.yaml"},
+		},
+	} {
+		b, err := server.MarshalEventRecord([]byte(e.data), e.attr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, b...)
+	}
+	eventsFile := filepath.Join(td, "events.jsonl")
+	// The partial trailing line of an interrupted write is ignored.
+	if err := os.WriteFile(eventsFile, append(events, `{"data":{"gith`...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	corruptFile := filepath.Join(td, "corrupt.jsonl")
+	if err := os.WriteFile(corruptFile, append([]byte("not json\n"), events...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		args   []string
+		expOut string
+		expErr string
+	}{
+		{
+			name:   "unexpected_args",
+			args:   []string{"foo"},
+			expErr: `unexpected arguments: [foo]`,
+		},
+		{
+			name:   "missing_path",
+			args:   []string{},
+			expErr: `path is required`,
+		},
+		{
+			name:   "missing_file",
+			args:   []string{"-path", filepath.Join(td, "missing.jsonl")},
+			expErr: `failed to open event file`,
+		},
+		{
+			name:   "corrupt_line",
+			args:   []string{"-path", corruptFile},
+			expErr: `line 1: failed to unmarshal event record`,
+		},
+		{
+			name: "all_events",
+			args: []string{"-path", eventsFile},
+			expOut: `
+# objectId=gh-prefix/a.yaml pmapOutcome=success
+{
+  "githubSource": {
+    "repoName": "test-repo",
+    "filePath": "a.yaml"
+  }
+}
+# objectId=gh-prefix/b.yaml pmapOutcome=failure
+{
+  "githubSource": {
+    "repoName": "test-repo",
+    "filePath": "b.yaml"
+  }
+}
+# objectId=gh-prefix/a.yaml pmapOutcome=failure
+{
+  "githubSource": {
+    "repoName": "test-repo",
+    "filePath": "a.yaml"
+  }
+}
+Shown 3 events`,
+		},
+		{
+			name: "filtered",
+			args: []string{"-path", eventsFile, "-outcome", server.OutcomeFailure, "-object-id", "gh-prefix/a.yaml"},
+			expOut: `
+# objectId=gh-prefix/a.yaml pmapOutcome=failure
+{
+  "githubSource": {
+    "repoName": "test-repo",
+    "filePath": "a.yaml"
+  }
+}
+Shown 1 events`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd EventShowCommand
+			_, stdout, _ := cmd.Pipe()
+
+			err := cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(strings.TrimSpace(tc.expOut), strings.TrimSpace(stdout.String())); diff != "" {
+				t.Errorf("output: diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
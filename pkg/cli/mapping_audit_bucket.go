@@ -0,0 +1,168 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+var _ cli.Command = (*MappingAuditBucketCommand)(nil)
+
+// MappingAuditBucketCommand validates the resource mapping objects already
+// uploaded to a GCS bucket, without publishing anything.
+type MappingAuditBucketCommand struct {
+	cli.BaseCommand
+
+	flagBucket string
+	flagPrefix string
+
+	validation mappingValidationFlags
+
+	// testStorageClient is used to inject a fake GCS client in tests.
+	testStorageClient *storage.Client
+}
+
+func (c *MappingAuditBucketCommand) Desc() string {
+	return `Validate the resource mapping objects of a GCS bucket`
+}
+
+func (c *MappingAuditBucketCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+  Download and validate the resource mapping objects of a GCS bucket, and
+  report the objects which fail the validation:
+
+      pmap mapping audit-bucket -bucket "my-bucket" -prefix "mapping/"
+
+  Nothing is published, it fails when any object is invalid.
+`
+}
+
+func (c *MappingAuditBucketCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+
+	// Command options
+	f := set.NewSection("COMMAND OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "bucket",
+		Target:  &c.flagBucket,
+		Example: "my-bucket",
+		Usage:   `The GCS bucket to audit.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "prefix",
+		Target:  &c.flagPrefix,
+		Example: "mapping/",
+		Usage:   `The prefix of the object names to audit, all the objects are audited by default.`,
+	})
+
+	c.validation.register(f)
+
+	return set
+}
+
+func (c *MappingAuditBucketCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	if c.flagBucket == "" {
+		return fmt.Errorf("bucket is required")
+	}
+	if err := c.validation.validate(); err != nil {
+		return err
+	}
+
+	client := c.testStorageClient
+	if client == nil {
+		var err error
+		client, err = storage.NewClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create the storage client: %w", err)
+		}
+		defer client.Close()
+	}
+	store := server.NewGCSObjectStore(client)
+
+	var total int
+	var failed []string
+	it := client.Bucket(c.flagBucket).Objects(ctx, &storage.Query{Prefix: c.flagPrefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list objects in bucket %q: %w", c.flagBucket, err)
+		}
+		// Folder placeholders have no content.
+		if strings.HasSuffix(attrs.Name, "/") {
+			continue
+		}
+
+		total++
+		if err := c.auditObject(ctx, store, attrs.Name); err != nil {
+			failed = append(failed, attrs.Name)
+			c.Outf("FAIL %s: %s", attrs.Name, err)
+		}
+	}
+
+	c.Outf("Audited %d objects in bucket %q: %d passed, %d failed", total, c.flagBucket, total-len(failed), len(failed))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d objects failed the validation: %q", len(failed), total, failed)
+	}
+	return nil
+}
+
+// auditObject downloads the object and validates it as a resource mapping the
+// same way as mapping validate. Objects over the size limit of the server are
+// rejected.
+func (c *MappingAuditBucketCommand) auditObject(ctx context.Context, store *server.GCSObjectStore, name string) error {
+	r, err := store.NewObjectReader(ctx, c.flagBucket, name)
+	if err != nil {
+		return fmt.Errorf("failed to read object: %w", err)
+	}
+	defer r.Close()
+
+	// Read one byte over the limit to tell oversized objects apart.
+	data, err := io.ReadAll(io.LimitReader(r, server.DefaultMaxObjectSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read object: %w", err)
+	}
+	if len(data) > server.DefaultMaxObjectSize {
+		return fmt.Errorf("object exceeds max size %d", server.DefaultMaxObjectSize)
+	}
+
+	_, err = parseResourceMapping(data, c.validation.validateOptions()...)
+	return err
+}
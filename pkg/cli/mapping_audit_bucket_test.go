@@ -0,0 +1,153 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+func TestMappingAuditBucketCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	validMapping := []byte(`
+resource:
+  provider: gcp
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contacts:
+  email:
+    - pmap@example.com
+`)
+	objects := map[string]*fakeObject{
+		"mapping/":                     {},
+		"mapping/gh-prefix/valid.yaml": {data: validMapping},
+		"mapping/gh-prefix/no_name.yaml": {data: []byte(`
+resource:
+  provider: gcp
+contacts:
+  email:
+    - pmap@example.com
+`)},
+		"mapping/gh-prefix/malformed.yaml": {data: []byte(`resource: [`)},
+		"other/valid.yaml":                 {data: validMapping},
+		// Valid YAML padded with a comment over the size limit.
+		"large/valid.yaml": {data: append(append([]byte{}, validMapping...),
+			"#"+strings.Repeat(" ", server.DefaultMaxObjectSize)...)},
+	}
+
+	cases := []struct {
+		name   string
+		args   []string
+		expErr string
+		expOut string
+	}{
+		{
+			name:   "unexpected_args",
+			args:   []string{"foo"},
+			expErr: `unexpected arguments: [foo]`,
+		},
+		{
+			name:   "missing_bucket",
+			args:   []string{},
+			expErr: `bucket is required`,
+		},
+		{
+			name: "all_valid",
+			args: []string{"-bucket", testBucket, "-prefix", "other/"},
+			expOut: `
+Audited 1 objects in bucket "test-bucket": 1 passed, 0 failed`,
+		},
+		{
+			name:   "mixed",
+			args:   []string{"-bucket", testBucket, "-prefix", "mapping/"},
+			expErr: `2 of 3 objects failed the validation: ["mapping/gh-prefix/malformed.yaml" "mapping/gh-prefix/no_name.yaml"]`,
+			expOut: `
+FAIL mapping/gh-prefix/malformed.yaml: failed to unmarshal yaml to ResourceMapping
+FAIL mapping/gh-prefix/no_name.yaml: empty resource name
+Audited 3 objects in bucket "test-bucket": 1 passed, 2 failed`,
+		},
+		{
+			name:   "whole_bucket",
+			args:   []string{"-bucket", testBucket},
+			expErr: `3 of 5 objects failed the validation`,
+		},
+		{
+			name:   "object_too_large",
+			args:   []string{"-bucket", testBucket, "-prefix", "large/"},
+			expErr: `1 of 1 objects failed the validation: ["large/valid.yaml"]`,
+			expOut: `
+FAIL large/valid.yaml: object exceeds max size 25000000
+Audited 1 objects in bucket "test-bucket": 0 passed, 1 failed`,
+		},
+		{
+			name:   "required_annotation_keys",
+			args:   []string{"-bucket", testBucket, "-prefix", "other/", "-required-annotation-keys", "dataClassification"},
+			expErr: `1 of 1 objects failed the validation: ["other/valid.yaml"]`,
+		},
+		{
+			name:   "invalid_annotation_key_casing",
+			args:   []string{"-bucket", testBucket, "-annotation-key-casing", "kebab"},
+			expErr: `annotation-key-casing must be one of [lowerCamel snake], got "kebab"`,
+		},
+		{
+			name: "no_objects",
+			args: []string{"-bucket", testBucket, "-prefix", "missing/"},
+			expOut: `
+Audited 0 objects in bucket "test-bucket": 0 passed, 0 failed`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := MappingAuditBucketCommand{
+				testStorageClient: newFakeStorageClient(t, objects),
+			}
+			_, stdout, _ := cmd.Pipe()
+
+			err := cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if tc.expOut == "" {
+				return
+			}
+			// The failure reasons are truncated before their details, which
+			// is enough to tell them apart.
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+				if name, reason, ok := strings.Cut(line, ": "); ok && strings.HasPrefix(line, "FAIL ") {
+					reason, _, _ = strings.Cut(reason, ":")
+					line = name + ": " + reason
+				}
+				got = append(got, line)
+			}
+			if diff := cmp.Diff(strings.TrimSpace(tc.expOut), strings.Join(got, "\n")); diff != "" {
+				t.Errorf("output: diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/protoutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+var _ cli.Command = (*MappingCheckDuplicatesCommand)(nil)
+
+type MappingCheckDuplicatesCommand struct {
+	cli.BaseCommand
+
+	flagPath string
+}
+
+func (c *MappingCheckDuplicatesCommand) Desc() string {
+	return `Check that no resource is mapped in more than one file in the given path`
+}
+
+func (c *MappingCheckDuplicatesCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+  Check that no resource name and subscope is mapped in more than one resource
+  mapping YAML file in the given path:
+
+      pmap mapping check-duplicates -path "/path/to/dir"
+`
+}
+
+func (c *MappingCheckDuplicatesCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+
+	// Command options
+	f := set.NewSection("COMMAND OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "path",
+		Target:  &c.flagPath,
+		Example: "/path/to/dir",
+		Usage:   `The path of resource mapping files.`,
+	})
+
+	return set
+}
+
+func (c *MappingCheckDuplicatesCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	if c.flagPath == "" {
+		return fmt.Errorf("path is required")
+	}
+
+	return c.checkDuplicates()
+}
+
+// mappedResource identifies the resource of a mapping, the subscope is
+// normalized so the qualifier order doesn't matter.
+type mappedResource struct {
+	name     string
+	subscope string
+}
+
+// checkDuplicates reports the resources mapped in more than one file, the
+// files of each resource are listed in path order.
+func (c *MappingCheckDuplicatesCommand) checkDuplicates() error {
+	dir := c.flagPath
+	files, err := fetchExtractedYAMLFiles(dir)
+	if err != nil {
+		return fmt.Errorf("failed to fetch extracted files in dir %s: %w", dir, err)
+	}
+
+	var checkErrs error
+	var resources []mappedResource
+	resourceFiles := make(map[mappedResource][]string)
+	for _, file := range files {
+		originFile := strings.TrimPrefix(file, dir+string(os.PathSeparator))
+		data, err := os.ReadFile(file)
+		if err != nil {
+			checkErrs = errors.Join(checkErrs, fmt.Errorf("failed to read file from %q, %w", originFile, err))
+			continue
+		}
+
+		data, err = resolveContactsRef(file, data)
+		if err != nil {
+			checkErrs = errors.Join(checkErrs, fmt.Errorf("file %q: failed to resolve %s: %w", originFile, contactsRefKey, err))
+			continue
+		}
+
+		var resourceMapping v1alpha1.ResourceMapping
+		if err := protoutil.FromYAML(data, &resourceMapping); err != nil {
+			checkErrs = errors.Join(checkErrs,
+				fmt.Errorf("file %q: failed to unmarshal yaml to ResourceMapping: %w", originFile, err))
+			continue
+		}
+
+		subscope, err := v1alpha1.NormalizeSubscope(resourceMapping.GetResource().GetSubscope())
+		if err != nil {
+			checkErrs = errors.Join(checkErrs, fmt.Errorf("file %q: %w", originFile, err))
+			continue
+		}
+		r := mappedResource{name: resourceMapping.GetResource().GetName(), subscope: subscope}
+		if _, ok := resourceFiles[r]; !ok {
+			resources = append(resources, r)
+		}
+		resourceFiles[r] = append(resourceFiles[r], originFile)
+	}
+
+	for _, r := range resources {
+		if fs := resourceFiles[r]; len(fs) > 1 {
+			checkErrs = errors.Join(checkErrs, fmt.Errorf("resource %q with subscope %q is mapped in multiple files: %s",
+				r.name, r.subscope, strings.Join(fs, ", ")))
+		}
+	}
+
+	if checkErrs == nil {
+		c.Outf("No duplicate resource mappings found")
+	}
+	return checkErrs
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestMappingCheckDuplicatesCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	td := t.TempDir()
+
+	mapping := func(name, subscope string) []byte {
+		return []byte(`
+resource:
+    provider: gcp
+    name: ` + name + `
+    subscope: "` + subscope + `"
+contacts:
+    email:
+        - pmap@example.com
+`)
+	}
+	const (
+		topic        = "//pubsub.googleapis.com/projects/test-project/topics/test-topic"
+		subscription = "//pubsub.googleapis.com/projects/test-project/subscriptions/test-subscription"
+	)
+
+	cases := []struct {
+		name      string
+		args      []string
+		dir       string
+		fileDatas map[string][]byte
+		expOut    string
+		expErr    string
+	}{
+		{
+			name:   "unexpected_args",
+			args:   []string{"foo"},
+			expErr: `unexpected arguments: [foo]`,
+		},
+		{
+			name:   "missing_path",
+			args:   []string{},
+			expErr: `path is required`,
+		},
+		{
+			name: "invalid_yaml",
+			dir:  "dir_invalid_yaml",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+		foo
+		`),
+			},
+			args:   []string{"-path", filepath.Join(td, "dir_invalid_yaml")},
+			expErr: `file "file1.yaml": failed to unmarshal yaml to ResourceMapping`,
+		},
+		{
+			name: "unique_resources",
+			dir:  "dir_unique_resources",
+			fileDatas: map[string][]byte{
+				"file1.yaml":     mapping(topic, ""),
+				"file2.yml":      mapping(subscription, ""),
+				"sub/file3.yaml": mapping(topic, "?a=b"),
+				"file4.txt":      mapping(topic, ""),
+			},
+			args:   []string{"-path", filepath.Join(td, "dir_unique_resources")},
+			expOut: "No duplicate resource mappings found",
+		},
+		{
+			name: "duplicate_resources",
+			dir:  "dir_duplicate_resources",
+			fileDatas: map[string][]byte{
+				"file1.yaml":     mapping(topic, ""),
+				"file2.yml":      mapping(subscription, ""),
+				"sub/file3.yaml": mapping(topic, ""),
+				"sub/file4.yaml": mapping(subscription, ""),
+				"sub/file5.yaml": mapping(topic, ""),
+			},
+			args: []string{"-path", filepath.Join(td, "dir_duplicate_resources")},
+			expErr: `resource "` + topic + `" with subscope "" is mapped in multiple files: file1.yaml, sub/file3.yaml, sub/file5.yaml` + "\n" +
+				`resource "` + subscription + `" with subscope "" is mapped in multiple files: file2.yml, sub/file4.yaml`,
+		},
+		{
+			name: "duplicate_normalized_subscopes",
+			dir:  "dir_duplicate_normalized_subscopes",
+			fileDatas: map[string][]byte{
+				"file1.yaml": mapping(topic, "?b=2&a=1"),
+				"file2.yaml": mapping(topic, "?a=1&b=2"),
+			},
+			args:   []string{"-path", filepath.Join(td, "dir_duplicate_normalized_subscopes")},
+			expErr: `resource "` + topic + `" with subscope "?a=1&b=2" is mapped in multiple files: file1.yaml, file2.yaml`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			for name, data := range tc.fileDatas {
+				path := filepath.Join(td, tc.dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0o600); err != nil {
+					t.Fatalf("failed to write data to file %s: %v", name, err)
+				}
+			}
+
+			var cmd MappingCheckDuplicatesCommand
+			_, stdout, _ := cmd.Pipe()
+
+			err := cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(strings.TrimSpace(tc.expOut), strings.TrimSpace(stdout.String())); diff != "" {
+				t.Errorf("output: diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	asset "cloud.google.com/go/asset/apiv1"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/protoutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/mapping/processors"
+)
+
+var _ cli.Command = (*MappingCoverageCommand)(nil)
+
+type MappingCoverageCommand struct {
+	cli.BaseCommand
+
+	flagPath       string
+	flagScope      string
+	flagAssetTypes []string
+
+	// testAssetClient is used to inject a fake Asset Inventory client in tests.
+	testAssetClient *asset.Client
+}
+
+func (c *MappingCoverageCommand) Desc() string {
+	return `Report the resources in a scope with and without resource mappings`
+}
+
+func (c *MappingCoverageCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+  Report the resources in the scope which are covered by a valid resource
+  mapping with contacts in the given path, and the ones which are not:
+
+      pmap mapping coverage -path "/path/to/dir" -scope "projects/my-project"
+
+  Only report the resources of some asset types:
+
+      pmap mapping coverage -path "/path/to/dir" -scope "folders/123" -asset-types "storage.googleapis.com/Bucket"
+`
+}
+
+func (c *MappingCoverageCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+
+	// Command options
+	f := set.NewSection("COMMAND OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "path",
+		Target:  &c.flagPath,
+		Example: "/path/to/dir",
+		Usage:   `The path of resource mapping files.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "scope",
+		Target:  &c.flagScope,
+		Example: "projects/test-project-id",
+		Usage:   `The scope whose resources are listed in Cloud Asset Inventory.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "asset-types",
+		Target:  &c.flagAssetTypes,
+		Example: "storage.googleapis.com/Bucket,bigquery.googleapis.com/Dataset",
+		Usage:   `The asset types of the resources to report, all resources are reported if unset.`,
+	})
+
+	return set
+}
+
+func (c *MappingCoverageCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	if c.flagPath == "" {
+		return fmt.Errorf("path is required")
+	}
+	if c.flagScope == "" {
+		return fmt.Errorf("scope is required")
+	}
+
+	client := c.testAssetClient
+	if client == nil {
+		var err error
+		client, err = asset.NewClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create the assetClient: %w", err)
+		}
+		defer client.Close()
+	}
+
+	p, err := processors.NewAssetInventoryProcessor(ctx, client, c.flagScope)
+	if err != nil {
+		return fmt.Errorf("failed to create assetInventoryProcessor: %w", err)
+	}
+	resources, err := p.ListResources(ctx, c.flagScope, c.flagAssetTypes...)
+	if err != nil {
+		return fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	covered, err := c.coveredResources()
+	if err != nil {
+		return err
+	}
+	c.report(resources, covered)
+	return nil
+}
+
+// coveredResources returns the names of the resources which have a valid
+// mapping with contacts. Invalid mappings are reported as warnings, they don't
+// cover their resources.
+func (c *MappingCoverageCommand) coveredResources() (map[string]bool, error) {
+	dir := c.flagPath
+	files, err := fetchExtractedYAMLFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch extracted files in dir %s: %w", dir, err)
+	}
+
+	covered := make(map[string]bool, len(files))
+	for _, file := range files {
+		originFile := strings.TrimPrefix(file, dir+string(os.PathSeparator))
+		data, err := os.ReadFile(file)
+		if err != nil {
+			c.Errf("warning: file %q: failed to read file: %s", originFile, err)
+			continue
+		}
+
+		data, err = resolveContactsRef(file, data)
+		if err != nil {
+			c.Errf("warning: file %q: failed to resolve %s: %s", originFile, contactsRefKey, err)
+			continue
+		}
+
+		var resourceMapping v1alpha1.ResourceMapping
+		if err := protoutil.FromYAML(data, &resourceMapping); err != nil {
+			c.Errf("warning: file %q: failed to unmarshal yaml to ResourceMapping: %s", originFile, err)
+			continue
+		}
+		if err := v1alpha1.ValidateResourceMapping(&resourceMapping); err != nil {
+			c.Errf("warning: file %q: %s", originFile, err)
+			continue
+		}
+		if len(resourceMapping.GetContacts().GetEmail()) == 0 {
+			c.Errf("warning: file %q: no contacts", originFile)
+			continue
+		}
+		covered[resourceMapping.GetResource().GetName()] = true
+	}
+	return covered, nil
+}
+
+// report prints the number of covered resources and lists the uncovered ones.
+func (c *MappingCoverageCommand) report(resources []string, covered map[string]bool) {
+	if len(resources) == 0 {
+		c.Outf("No resources found in scope %q", c.flagScope)
+		return
+	}
+
+	var uncovered []string
+	for _, r := range resources {
+		if !covered[r] {
+			uncovered = append(uncovered, r)
+		}
+	}
+	n := len(resources) - len(uncovered)
+	c.Outf("Covered resources: %d/%d (%.1f%%)", n, len(resources), float64(n)*100/float64(len(resources)))
+	if len(uncovered) == 0 {
+		return
+	}
+	c.Outf("Uncovered resources:")
+	for _, r := range uncovered {
+		c.Outf("  %s", r)
+	}
+}
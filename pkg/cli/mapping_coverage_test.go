@@ -0,0 +1,181 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	asset "cloud.google.com/go/asset/apiv1"
+	"cloud.google.com/go/asset/apiv1/assetpb"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/internal/testhelper"
+)
+
+func TestMappingCoverageCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	td := t.TempDir()
+
+	files := map[string]string{
+		"topic.yaml": `
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contacts:
+    email:
+        - pmap@example.com
+`,
+		// Mappings without contacts don't cover their resources.
+		"bucket.yaml": `
+resource:
+    provider: gcp
+    name: //storage.googleapis.com/test-bucket
+`,
+		"invalid.yaml": `
+resource:
+    provider: gcp
+    name: //storage.googleapis.com/other-bucket
+contacts:
+    email:
+        - invalid
+`,
+		// Mappings of resources outside the scope are ignored.
+		"outside.yaml": `
+resource:
+    provider: gcp
+    name: //storage.googleapis.com/outside-bucket
+contacts:
+    email:
+        - pmap@example.com
+`,
+	}
+	dir := filepath.Join(td, "mappings")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatalf("failed to write data to file %s: %v", name, err)
+		}
+	}
+
+	cases := []struct {
+		name      string
+		args      []string
+		resources map[string]bool
+		expOut    string
+		expStderr string
+		expErr    string
+	}{
+		{
+			name: "partial_coverage",
+			args: []string{"-path", dir, "-scope", "projects/test-project"},
+			resources: map[string]bool{
+				"//pubsub.googleapis.com/projects/test-project/topics/test-topic": true,
+				"//storage.googleapis.com/test-bucket":                            true,
+				"//storage.googleapis.com/other-bucket":                           true,
+			},
+			expOut: `
+Covered resources: 1/3 (33.3%)
+Uncovered resources:
+  //storage.googleapis.com/other-bucket
+  //storage.googleapis.com/test-bucket
+`,
+			expStderr: `
+warning: file "bucket.yaml": no contacts
+warning: file "invalid.yaml": invalid owner: mail: missing '@' or angle-addr
+`,
+		},
+		{
+			name: "full_coverage",
+			args: []string{"-path", dir, "-scope", "projects/test-project"},
+			resources: map[string]bool{
+				"//pubsub.googleapis.com/projects/test-project/topics/test-topic": true,
+			},
+			expOut: `Covered resources: 1/1 (100.0%)`,
+			expStderr: `
+warning: file "bucket.yaml": no contacts
+warning: file "invalid.yaml": invalid owner: mail: missing '@' or angle-addr
+`,
+		},
+		{
+			name:   "no_resources",
+			args:   []string{"-path", dir, "-scope", "projects/test-project"},
+			expOut: `No resources found in scope "projects/test-project"`,
+			expStderr: `
+warning: file "bucket.yaml": no contacts
+warning: file "invalid.yaml": invalid owner: mail: missing '@' or angle-addr
+`,
+		},
+		{
+			name:   "missing_path",
+			args:   []string{"-scope", "projects/test-project"},
+			expErr: "path is required",
+		},
+		{
+			name:   "missing_scope",
+			args:   []string{"-path", dir},
+			expErr: "scope is required",
+		},
+		{
+			name:   "invalid_scope",
+			args:   []string{"-path", dir, "-scope", "buckets/test-bucket"},
+			expErr: "failed to list resources: invalid resource scope: buckets/test-bucket",
+		},
+		{
+			name:   "unexpected_args",
+			args:   []string{"foo"},
+			expErr: "unexpected arguments: [foo]",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &fakeAssetInventoryServer{existingResources: tc.resources})
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+
+			cmd := MappingCoverageCommand{testAssetClient: fakeAssetClient}
+			_, stdout, stderr := cmd.Pipe()
+
+			err = cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(strings.TrimSpace(tc.expOut), strings.TrimSpace(stdout.String())); diff != "" {
+				t.Errorf("output: diff (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(strings.TrimSpace(tc.expStderr), strings.TrimSpace(stderr.String())); diff != "" {
+				t.Errorf("stderr: diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
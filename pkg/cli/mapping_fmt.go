@@ -0,0 +1,320 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/protoutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+var _ cli.Command = (*MappingFmtCommand)(nil)
+
+type MappingFmtCommand struct {
+	cli.BaseCommand
+
+	flagPath  string
+	flagCheck bool
+}
+
+func (c *MappingFmtCommand) Desc() string {
+	return `Rewrite the resource mapping files in the given path in the canonical format`
+}
+
+func (c *MappingFmtCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+  Rewrite the resource mapping YAML files in the given path in the canonical
+  format: fields in a stable order, normalized subscope and sorted contacts.
+  Comments are kept with the fields they annotate:
+
+      pmap mapping fmt -path "/path/to/dir"
+
+  Check that the files are in the canonical format without rewriting them:
+
+      pmap mapping fmt -path "/path/to/dir" -check
+`
+}
+
+func (c *MappingFmtCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+
+	// Command options
+	f := set.NewSection("COMMAND OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "path",
+		Target:  &c.flagPath,
+		Example: "/path/to/dir",
+		Usage:   `The path of resource mapping files.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "check",
+		Target:  &c.flagCheck,
+		Default: false,
+		Usage:   `Whether to fail if any file isn't in the canonical format instead of rewriting it.`,
+	})
+
+	return set
+}
+
+func (c *MappingFmtCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	if c.flagPath == "" {
+		return fmt.Errorf("path is required")
+	}
+
+	return c.format()
+}
+
+// format rewrites the files not in the canonical format, or reports them in
+// check mode.
+func (c *MappingFmtCommand) format() error {
+	dir := c.flagPath
+	files, err := fetchExtractedYAMLFiles(dir)
+	if err != nil {
+		return fmt.Errorf("failed to fetch extracted files in dir %s: %w", dir, err)
+	}
+
+	var fmtErrs error
+	var unformatted []string
+	for _, file := range files {
+		originFile := strings.TrimPrefix(file, dir+string(os.PathSeparator))
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmtErrs = errors.Join(fmtErrs, fmt.Errorf("failed to read file from %q, %w", originFile, err))
+			continue
+		}
+
+		formatted, err := canonicalMapping(data)
+		if err != nil {
+			fmtErrs = errors.Join(fmtErrs, fmt.Errorf("file %q: %w", originFile, err))
+			continue
+		}
+		if bytes.Equal(data, formatted) {
+			continue
+		}
+		unformatted = append(unformatted, originFile)
+		if c.flagCheck {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			fmtErrs = errors.Join(fmtErrs, fmt.Errorf("failed to stat file %q: %w", originFile, err))
+			continue
+		}
+		if err := os.WriteFile(file, formatted, info.Mode().Perm()); err != nil {
+			fmtErrs = errors.Join(fmtErrs, fmt.Errorf("failed to write file %q: %w", originFile, err))
+			continue
+		}
+		c.Outf("Formatted %s", originFile)
+	}
+
+	if c.flagCheck && len(unformatted) > 0 {
+		fmtErrs = errors.Join(fmtErrs, fmt.Errorf("files are not in the canonical format, run pmap mapping fmt: %s",
+			strings.Join(unformatted, ", ")))
+	}
+	if fmtErrs == nil && len(unformatted) == 0 {
+		c.Outf("All files are in the canonical format")
+	}
+	return fmtErrs
+}
+
+// canonicalMapping returns the canonical YAML of the resource mapping data.
+// The fields are in the proto field order and the annotation keys are sorted,
+// the subscope is normalized and the contacts are sorted. The keys of the
+// original YAML are reordered in place so their comments are kept. The
+// contactsRef field is kept as is after the mapping fields.
+func canonicalMapping(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml: %w", err)
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		// Nothing to reorder, e.g. an empty file.
+		if err := protoutil.FromYAML(data, &v1alpha1.ResourceMapping{}); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal yaml to ResourceMapping: %w", err)
+		}
+		return data, nil
+	}
+	root := doc.Content[0]
+
+	// Validate the mapping without the contactsRef field, which isn't part of
+	// the proto.
+	stripped := *root
+	stripped.Content = nil
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != contactsRefKey {
+			stripped.Content = append(stripped.Content, root.Content[i], root.Content[i+1])
+		}
+	}
+	b, err := yaml.Marshal(&stripped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal yaml: %w", err)
+	}
+	var m v1alpha1.ResourceMapping
+	if err := protoutil.FromYAML(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml to ResourceMapping: %w", err)
+	}
+
+	sortMessageNode(root, m.ProtoReflect().Descriptor())
+	resource := mappingValue(root, "resource")
+	if subscope := mappingValue(resource, "subscope"); subscope != nil && subscope.Value != "" {
+		normalized, err := v1alpha1.NormalizeSubscope(subscope.Value)
+		if err != nil {
+			return nil, err //nolint:wrapcheck // Already describes the subscope.
+		}
+		subscope.Value = normalized
+	}
+	if email := mappingValue(mappingValue(root, "contacts"), "email"); email != nil {
+		slices.SortStableFunc(email.Content, func(a, b *yaml.Node) int {
+			return strings.Compare(a.Value, b.Value)
+		})
+	}
+	resetStyle(root)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to encode canonical yaml: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode canonical yaml: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// sortMessageNode orders the keys of the mapping node n in the field order of
+// the message md, the same order protojson writes them in, and renames them to
+// their JSON names. Unknown keys such as contactsRef are kept in their order
+// after the fields. The keys of struct fields are sorted by name.
+func sortMessageNode(n *yaml.Node, md protoreflect.MessageDescriptor) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return
+	}
+	if md.FullName() == structName {
+		sortStructNode(n)
+		return
+	}
+
+	field := func(key string) protoreflect.FieldDescriptor {
+		if fd := md.Fields().ByJSONName(key); fd != nil {
+			return fd
+		}
+		return md.Fields().ByTextName(key)
+	}
+	index := func(key string) int {
+		if fd := field(key); fd != nil {
+			return fd.Index()
+		}
+		return md.Fields().Len()
+	}
+	sortPairs(n, func(a, b *yaml.Node) int {
+		return cmp.Compare(index(a.Value), index(b.Value))
+	})
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		fd := field(n.Content[i].Value)
+		if fd == nil {
+			continue
+		}
+		n.Content[i].Value = fd.JSONName()
+		if fd.Kind() != protoreflect.MessageKind || fd.IsMap() {
+			continue
+		}
+		value := n.Content[i+1]
+		if !fd.IsList() {
+			sortMessageNode(value, fd.Message())
+			continue
+		}
+		for _, elem := range value.Content {
+			sortMessageNode(elem, fd.Message())
+		}
+	}
+}
+
+// structName is the full name of the struct message of the annotations.
+var structName = (&structpb.Struct{}).ProtoReflect().Descriptor().FullName()
+
+// sortStructNode sorts the keys of the mappings in the struct node n by name.
+func sortStructNode(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		sortPairs(n, func(a, b *yaml.Node) int {
+			return strings.Compare(a.Value, b.Value)
+		})
+	}
+	for _, c := range n.Content {
+		sortStructNode(c)
+	}
+}
+
+// sortPairs stably sorts the key value pairs of the mapping node n by their
+// keys.
+func sortPairs(n *yaml.Node, cmpKeys func(a, b *yaml.Node) int) {
+	pairs := slices.Collect(slices.Chunk(n.Content, 2))
+	slices.SortStableFunc(pairs, func(a, b []*yaml.Node) int {
+		return cmpKeys(a[0], b[0])
+	})
+	n.Content = slices.Concat(pairs...)
+}
+
+// mappingValue returns the value of the key in the mapping node n, or nil if
+// it's missing.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// resetStyle drops the flow and quoting styles of the node and its children so
+// it's encoded in the block style, strings are only quoted where needed. The
+// comments are kept.
+func resetStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		resetStyle(c)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestMappingFmtCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	td := t.TempDir()
+
+	unformatted := []byte(`contacts:
+    email:
+        - z@example.com
+        - a@example.com
+annotations:
+    zeta: "123"
+    alpha: {b: 1, a: [x, "y: z"]}
+resource:
+    subscope: "parent/foo?b=2&a=1"
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+`)
+	formatted := []byte(`resource:
+  provider: gcp
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  subscope: parent/foo?a=1&b=2
+contacts:
+  email:
+    - a@example.com
+    - z@example.com
+annotations:
+  alpha:
+    a:
+      - x
+      - 'y: z'
+    b: 1
+  zeta: "123"
+`)
+	withContactsRef := []byte(`contactsRef: ../contacts.yaml
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+`)
+	formattedWithContactsRef := []byte(`resource:
+  provider: gcp
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contactsRef: ../contacts.yaml
+`)
+
+	withComments := []byte(`# Owned by the pmap team.
+
+# The contacts are paged.
+contacts:
+  email:
+    - z@example.com # Secondary.
+    # Primary.
+    - a@example.com
+annotations:
+  zeta: "123" # Kept as a string.
+  alpha: 1
+resource:
+  # Normalized.
+  subscope: "parent/foo?b=2&a=1"
+  provider: gcp
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contactsRef: ../contacts.yaml # Shared contacts.
+# Trailing comment.
+`)
+	formattedWithComments := []byte(`# Owned by the pmap team.
+
+resource:
+  provider: gcp
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  # Normalized.
+  subscope: parent/foo?a=1&b=2
+# The contacts are paged.
+contacts:
+  email:
+    # Primary.
+    - a@example.com
+    - z@example.com # Secondary.
+annotations:
+  alpha: 1
+  zeta: "123" # Kept as a string.
+contactsRef: ../contacts.yaml # Shared contacts.
+# Trailing comment.
+`)
+
+	cases := []struct {
+		name      string
+		args      []string
+		dir       string
+		fileDatas map[string][]byte
+		expFiles  map[string][]byte
+		expOut    string
+		expErr    string
+	}{
+		{
+			name:   "unexpected_args",
+			args:   []string{"foo"},
+			expErr: `unexpected arguments: [foo]`,
+		},
+		{
+			name:   "missing_path",
+			args:   []string{},
+			expErr: `path is required`,
+		},
+		{
+			name: "format",
+			dir:  "dir_format",
+			fileDatas: map[string][]byte{
+				"file1.yaml":     unformatted,
+				"file2.yaml":     formatted,
+				"sub/file3.yml":  withContactsRef,
+				"file4.txt":      unformatted,
+				"sub/file5.yaml": formattedWithContactsRef,
+				"file6.yaml":     withComments,
+			},
+			args: []string{"-path", filepath.Join(td, "dir_format")},
+			expFiles: map[string][]byte{
+				"file1.yaml":     formatted,
+				"file2.yaml":     formatted,
+				"sub/file3.yml":  formattedWithContactsRef,
+				"file4.txt":      unformatted,
+				"sub/file5.yaml": formattedWithContactsRef,
+				"file6.yaml":     formattedWithComments,
+			},
+			expOut: "Formatted file1.yaml\nFormatted file6.yaml\nFormatted sub/file3.yml",
+		},
+		{
+			name: "check_formatted",
+			dir:  "dir_check_formatted",
+			fileDatas: map[string][]byte{
+				"file1.yaml":     formatted,
+				"sub/file2.yaml": formattedWithContactsRef,
+				"file3.yaml":     formattedWithComments,
+			},
+			args:   []string{"-path", filepath.Join(td, "dir_check_formatted"), "-check"},
+			expOut: "All files are in the canonical format",
+		},
+		{
+			name: "check_unformatted",
+			dir:  "dir_check_unformatted",
+			fileDatas: map[string][]byte{
+				"file1.yaml":    unformatted,
+				"file2.yaml":    formatted,
+				"sub/file3.yml": withContactsRef,
+			},
+			args:   []string{"-path", filepath.Join(td, "dir_check_unformatted"), "-check"},
+			expErr: "files are not in the canonical format, run pmap mapping fmt: file1.yaml, sub/file3.yml",
+			// Files are left as is in check mode.
+			expFiles: map[string][]byte{
+				"file1.yaml":    unformatted,
+				"file2.yaml":    formatted,
+				"sub/file3.yml": withContactsRef,
+			},
+		},
+		{
+			name: "invalid_mapping",
+			dir:  "dir_invalid_mapping",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`unknown: field`),
+				"file2.yaml": unformatted,
+			},
+			args:   []string{"-path", filepath.Join(td, "dir_invalid_mapping")},
+			expErr: `file "file1.yaml": failed to unmarshal yaml to ResourceMapping`,
+			expFiles: map[string][]byte{
+				"file1.yaml": []byte(`unknown: field`),
+				"file2.yaml": formatted,
+			},
+			expOut: "Formatted file2.yaml",
+		},
+		{
+			name: "invalid_subscope",
+			dir:  "dir_invalid_subscope",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+  provider: gcp
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  subscope: "foo?a=%zz"
+`),
+			},
+			args:   []string{"-path", filepath.Join(td, "dir_invalid_subscope")},
+			expErr: `file "file1.yaml": failed to parse qualifier string`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			for name, data := range tc.fileDatas {
+				path := filepath.Join(td, tc.dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0o600); err != nil {
+					t.Fatalf("failed to write data to file %s: %v", name, err)
+				}
+			}
+
+			var cmd MappingFmtCommand
+			_, stdout, _ := cmd.Pipe()
+
+			err := cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(strings.TrimSpace(tc.expOut), strings.TrimSpace(stdout.String())); diff != "" {
+				t.Errorf("output: diff (-want, +got):\n%s", diff)
+			}
+			for name, want := range tc.expFiles {
+				got, err := os.ReadFile(filepath.Join(td, tc.dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(string(want), string(got)); diff != "" {
+					t.Errorf("file %s: diff (-want, +got):\n%s", name, diff)
+				}
+			}
+		})
+	}
+}
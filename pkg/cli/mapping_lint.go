@@ -0,0 +1,48 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+// personalEmailDomains are email domains of personal accounts, which are
+// discouraged as resource contacts.
+var personalEmailDomains = []string{
+	"gmail.com",
+	"googlemail.com",
+	"hotmail.com",
+	"outlook.com",
+	"yahoo.com",
+}
+
+// lintResourceMapping returns warnings for a valid ResourceMapping that
+// doesn't follow best practices. Warnings are not fatal unless -Werror is set.
+func lintResourceMapping(m *v1alpha1.ResourceMapping) []string {
+	var warnings []string
+	for _, e := range m.GetContacts().GetEmail() {
+		_, domain, _ := strings.Cut(e, "@")
+		for _, d := range personalEmailDomains {
+			if strings.EqualFold(domain, d) {
+				warnings = append(warnings, fmt.Sprintf("contact %q uses a personal email domain", e))
+				break
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+func TestLintResourceMapping(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		mapping      *v1alpha1.ResourceMapping
+		wantWarnings []string
+	}{
+		{
+			name: "no_warnings",
+			mapping: &v1alpha1.ResourceMapping{
+				Contacts: &v1alpha1.Contacts{Email: []string{"pmap@example.com"}},
+			},
+		},
+		{
+			name: "personal_email_domain",
+			mapping: &v1alpha1.ResourceMapping{
+				Contacts: &v1alpha1.Contacts{Email: []string{"pmap@example.com", "pmap@Gmail.com"}},
+			},
+			wantWarnings: []string{`contact "pmap@Gmail.com" uses a personal email domain`},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := lintResourceMapping(tc.mapping)
+			if diff := cmp.Diff(tc.wantWarnings, got); diff != "" {
+				t.Errorf("lintResourceMapping got diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
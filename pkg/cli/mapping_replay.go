@@ -0,0 +1,297 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	asset "cloud.google.com/go/asset/apiv1"
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"github.com/sethvargo/go-retry"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/multicloser"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+var _ cli.Command = (*MappingReplayCommand)(nil)
+
+// MappingReplayCommand reprocesses the GCS object of a failure event in
+// BigQuery with a freshly configured mapping handler.
+type MappingReplayCommand struct {
+	cli.BaseCommand
+
+	cfg *server.MappingHandlerConfig
+
+	flagObjectID     string
+	flagGeneration   string
+	flagDatasetID    string
+	flagFailureTable string
+
+	// The following are used to inject fakes in tests.
+	testFailureEntry  func(ctx context.Context, objectID, generation string) (*replayFailureEntry, error)
+	testPubSubClient  *pubsub.Client
+	testAssetClient   *asset.Client
+	testStorageClient *storage.Client
+}
+
+func (c *MappingReplayCommand) Desc() string {
+	return `Replay a failure event from BigQuery through the mapping pipeline`
+}
+
+func (c *MappingReplayCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+  Reprocess the GCS object of the latest failure event of the given object,
+  after the cause of the failure is fixed. The event is published to the
+  configured topics the same way as the mapping server does:
+
+      pmap mapping replay -object-id "mapping/dir/file.yaml" -dataset-id "pmap"
+
+  The failure event is looked up by its objectId attribute, and the
+  objectGeneration attribute when -generation is set. It must include the
+  bucketId attribute of the object.
+`
+}
+
+func (c *MappingReplayCommand) Flags() *cli.FlagSet {
+	c.cfg = &server.MappingHandlerConfig{}
+	set := c.NewFlagSet()
+	c.cfg.ToFlags(set)
+
+	f := set.NewSection("REPLAY OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "object-id",
+		Target:  &c.flagObjectID,
+		Example: "mapping/dir/file.yaml",
+		Usage:   `The GCS object of the failure event to replay.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "generation",
+		Target:  &c.flagGeneration,
+		Example: "1700000000000000",
+		Usage: `The generation of the GCS object of the failure event to replay, ` +
+			`defaults to the latest failure event of the object.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "dataset-id",
+		Target:  &c.flagDatasetID,
+		EnvVar:  "PMAP_BIGQUERY_DATASET_ID",
+		Example: "pmap",
+		Usage:   `The BigQuery dataset of the failure table, in the PROJECT_ID project.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "failure-table",
+		Target:  &c.flagFailureTable,
+		EnvVar:  "PMAP_BIGQUERY_FAILURE_TABLE",
+		Default: "mapping-failure",
+		Usage:   `The BigQuery table of the mapping failure events.`,
+	})
+
+	return set
+}
+
+func (c *MappingReplayCommand) Run(ctx context.Context, args []string) error {
+	logger := logging.FromContext(ctx)
+
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %q", args)
+	}
+
+	if c.flagObjectID == "" {
+		return fmt.Errorf("object-id is required")
+	}
+	if err := c.cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid mapping configuration: %w", err)
+	}
+
+	var closer *multicloser.Closer
+	defer func() {
+		if err := closer.Close(); err != nil {
+			logger.ErrorContext(ctx, "failed to close", "error", err)
+		}
+	}()
+
+	failureEntry := c.testFailureEntry
+	if failureEntry == nil {
+		if c.flagDatasetID == "" {
+			return fmt.Errorf("dataset-id is required")
+		}
+		bqClient, err := bigquery.NewClient(ctx, c.cfg.ProjectID)
+		if err != nil {
+			return fmt.Errorf("failed to create bigquery client: %w", err)
+		}
+		closer = multicloser.Append(closer, bqClient.Close)
+		failureEntry = func(ctx context.Context, objectID, generation string) (*replayFailureEntry, error) {
+			return c.queryFailureEntry(ctx, bqClient, objectID, generation)
+		}
+	}
+
+	entry, err := failureEntry(ctx, c.flagObjectID, c.flagGeneration)
+	if err != nil {
+		return fmt.Errorf("failed to get failure event of object %q: %w", c.flagObjectID, err)
+	}
+
+	var attr map[string]string
+	if err := json.Unmarshal([]byte(entry.Attributes), &attr); err != nil {
+		return fmt.Errorf("failed to unmarshal failure event attributes: %w", err)
+	}
+	bucketID, objectID := attr[server.AttrKeyBucketID], attr[server.AttrKeyObjectID]
+	if bucketID == "" || objectID == "" {
+		return fmt.Errorf("failure event of object %q has no object reference", c.flagObjectID)
+	}
+
+	storageClient := c.testStorageClient
+	if storageClient == nil {
+		storageClient, err = storage.NewClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create the storage client: %w", err)
+		}
+		closer = multicloser.Append(closer, storageClient.Close)
+	}
+	store := server.NewGCSObjectStore(storageClient)
+
+	pubsubClient := c.testPubSubClient
+	if pubsubClient == nil && c.cfg.UsesPubSub() {
+		pubsubClient, err = pubsub.NewClient(ctx, c.cfg.ProjectID)
+		if err != nil {
+			return fmt.Errorf("failed to create pubsub client: %w", err)
+		}
+		closer = multicloser.Append(closer, pubsubClient.Close)
+	}
+
+	assetClient := c.testAssetClient
+	if assetClient == nil {
+		assetClient, err = asset.NewClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create the assetClient: %w", err)
+		}
+		closer = multicloser.Append(closer, assetClient.Close)
+	}
+
+	handler, handlerCloser, err := newMappingHandler(ctx, c.cfg, pubsubClient, assetClient,
+		server.WithObjectStore(store))
+	closer = multicloser.Append(closer, handlerCloser.Close)
+	if err != nil {
+		return err
+	}
+
+	// Rebuild the GCS notification so the provenance is parsed from the
+	// current object metadata.
+	metadata, err := store.ObjectMetadata(ctx, bucketID, objectID)
+	if err != nil {
+		return fmt.Errorf("failed to get object %q in bucket %q: %w", objectID, bucketID, err)
+	}
+	data, err := json.Marshal(map[string]any{"metadata": metadata})
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification payload: %w", err)
+	}
+
+	result, err := handler.HandleResult(ctx, pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			server.AttrKeyBucketID: bucketID,
+			server.AttrKeyObjectID: objectID,
+			"payloadFormat":        "JSON_API_V1",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replay object %q in bucket %q: %w", objectID, bucketID, err)
+	}
+	if result.Outcome == server.OutcomeSkipped {
+		c.Outf("Skipped object %q in bucket %q: %s", objectID, bucketID, result.SkipReason)
+		return nil
+	}
+	if result.Outcome != server.OutcomeSuccess {
+		return fmt.Errorf("replayed object %q in bucket %q failed again: %s",
+			objectID, bucketID, result.Attributes[server.AttrKeyProcessErr])
+	}
+
+	c.Outf("Replayed object %q in bucket %q successfully", objectID, bucketID)
+	return nil
+}
+
+// replayFailureEntry is the row of a failure event in the failure table. The
+// data of a failure event may have no payload, e.g. when the object couldn't be
+// parsed, so the entry is only identified by its attributes.
+type replayFailureEntry struct {
+	Data       string
+	Attributes string
+}
+
+// failureEntryQuery returns the query of the latest failure event of the given
+// object in table, and of the given generation if it's not empty.
+func failureEntryQuery(table, objectID, generation string) (string, []bigquery.QueryParameter) {
+	queryString := fmt.Sprintf("SELECT data, attributes FROM `%s`", table)
+	queryString += fmt.Sprintf(` WHERE JSON_VALUE(attributes.%s) = ?`, server.AttrKeyObjectID)
+	params := []bigquery.QueryParameter{{Value: objectID}}
+	if generation != "" {
+		queryString += fmt.Sprintf(` AND JSON_VALUE(attributes.%s) = ?`, server.AttrKeyObjectGeneration)
+		params = append(params, bigquery.QueryParameter{Value: generation})
+	}
+	queryString += ` ORDER BY publish_time DESC LIMIT 1`
+	return queryString, params
+}
+
+// queryFailureEntry returns the latest failure event of the given object and
+// generation.
+func (c *MappingReplayCommand) queryFailureEntry(ctx context.Context, bqClient *bigquery.Client, objectID, generation string) (*replayFailureEntry, error) {
+	table := fmt.Sprintf("%s.%s.%s", c.cfg.ProjectID, c.flagDatasetID, c.flagFailureTable)
+	queryString, params := failureEntryQuery(table, objectID, generation)
+	bqQuery := bqClient.Query(queryString)
+	bqQuery.Parameters = params
+
+	// The entry is expected to exist already, only retry transient errors.
+	backoff := retry.WithMaxRetries(2, retry.NewConstant(time.Second))
+	var entry replayFailureEntry
+	if err := retry.Do(ctx, backoff, func(ctx context.Context) error {
+		job, err := bqQuery.Run(ctx)
+		if err != nil {
+			return retry.RetryableError(fmt.Errorf("failed to run query: %w", err))
+		}
+		if status, err := job.Wait(ctx); err != nil {
+			return retry.RetryableError(fmt.Errorf("failed to wait for query: %w", err))
+		} else if status.Err() != nil {
+			return retry.RetryableError(fmt.Errorf("query failed: %w", status.Err()))
+		}
+		it, err := job.Read(ctx)
+		if err != nil {
+			return retry.RetryableError(fmt.Errorf("failed to read query result: %w", err))
+		}
+		if err := it.Next(&entry); err != nil {
+			return retry.RetryableError(fmt.Errorf("failed to read first entry: %w", err))
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to query failure table: %w", err)
+	}
+	return &entry, nil
+}
@@ -0,0 +1,272 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	asset "cloud.google.com/go/asset/apiv1"
+	"cloud.google.com/go/asset/apiv1/assetpb"
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/internal/testhelper"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+func TestMappingReplayCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	const (
+		testProject           = "test-project"
+		testSuccessTopic      = "test-success-topic"
+		testFailureTopic      = "test-failure-topic"
+		testReplayObject      = "mapping/gh-prefix/dir1/file.yaml"
+		testGeneration        = "1700000000000000"
+		existingResource      = "//pubsub.googleapis.com/projects/test-project/topics/test-topic"
+		missingResource       = "//pubsub.googleapis.com/projects/test-project/topics/missing-topic"
+		testFailureAttrFormat = `{"bucketId": %q, "objectId": %q, "ProcessErr": "failed to process object"}`
+	)
+
+	mappingData := func(name string) []byte {
+		return []byte(fmt.Sprintf(`
+resource:
+  provider: gcp
+  name: %s
+contacts:
+  email:
+    - pmap@example.com
+`, name))
+	}
+
+	defaultArgs := []string{
+		"-object-id", testReplayObject,
+		"-generation", testGeneration,
+		"-project-id", testProject,
+		"-success-topic-id", testSuccessTopic,
+		"-failure-topic-id", testFailureTopic,
+		"-default-resource-scope", "projects/test-project",
+	}
+
+	cases := []struct {
+		name         string
+		args         []string
+		failureEntry *replayFailureEntry
+		failureErr   error
+		objectData   []byte
+		expOut       string
+		expErr       string
+		wantTopic    string
+		wantOutcome  string
+	}{
+		{
+			name:   "unexpected_args",
+			args:   []string{"foo"},
+			expErr: `unexpected arguments: ["foo"]`,
+		},
+		{
+			name:   "missing_object_id",
+			args:   []string{},
+			expErr: `object-id is required`,
+		},
+		{
+			name:   "invalid_config",
+			args:   []string{"-object-id", testReplayObject},
+			expErr: `invalid mapping configuration: PROJECT_ID is empty and requires a value`,
+		},
+		{
+			name:       "failure_event_not_found",
+			args:       defaultArgs,
+			failureErr: fmt.Errorf("no more items in iterator"),
+			expErr:     `failed to get failure event of object "mapping/gh-prefix/dir1/file.yaml": no more items in iterator`,
+		},
+		{
+			name: "no_object_reference",
+			args: defaultArgs,
+			failureEntry: &replayFailureEntry{
+				Attributes: `{"ProcessErr": "failed to process object"}`,
+			},
+			expErr: `failure event of object "mapping/gh-prefix/dir1/file.yaml" has no object reference`,
+		},
+		{
+			name: "replay_succeeds",
+			args: defaultArgs,
+			failureEntry: &replayFailureEntry{
+				Attributes: fmt.Sprintf(testFailureAttrFormat, testBucket, testReplayObject),
+			},
+			objectData:  mappingData(existingResource),
+			expOut:      `Replayed object "mapping/gh-prefix/dir1/file.yaml" in bucket "test-bucket" successfully`,
+			wantTopic:   testSuccessTopic,
+			wantOutcome: server.OutcomeSuccess,
+		},
+		{
+			name: "replay_parse_failure_without_payload",
+			args: defaultArgs,
+			failureEntry: &replayFailureEntry{
+				Data:       `{"metadata": {}}`,
+				Attributes: fmt.Sprintf(testFailureAttrFormat, testBucket, testReplayObject),
+			},
+			objectData:  mappingData(existingResource),
+			expOut:      `Replayed object "mapping/gh-prefix/dir1/file.yaml" in bucket "test-bucket" successfully`,
+			wantTopic:   testSuccessTopic,
+			wantOutcome: server.OutcomeSuccess,
+		},
+		{
+			name: "replay_fails_again",
+			args: defaultArgs,
+			failureEntry: &replayFailureEntry{
+				Attributes: fmt.Sprintf(testFailureAttrFormat, testBucket, testReplayObject),
+			},
+			objectData:  mappingData(missingResource),
+			expErr:      `replayed object "mapping/gh-prefix/dir1/file.yaml" in bucket "test-bucket" failed again`,
+			wantTopic:   testFailureTopic,
+			wantOutcome: server.OutcomeFailure,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Setup fake Pub/Sub server and client with the topics.
+			psSrv := pstest.NewServer()
+			t.Cleanup(func() { psSrv.Close() })
+			psConn, err := grpc.NewClient(psSrv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatalf("failed to connect to fake pubsub server: %v", err)
+			}
+			pubsubClient, err := pubsub.NewClient(ctx, testProject, option.WithGRPCConn(psConn))
+			if err != nil {
+				t.Fatalf("failed to create pubsub client: %v", err)
+			}
+			t.Cleanup(func() { pubsubClient.Close() })
+			for _, topic := range []string{testSuccessTopic, testFailureTopic} {
+				if _, err := pubsubClient.CreateTopic(ctx, topic); err != nil {
+					t.Fatalf("failed to create topic %s: %v", topic, err)
+				}
+			}
+
+			// Setup fake Asset Inventory server and client.
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &fakeAssetInventoryServer{
+					existingResources: map[string]bool{existingResource: true},
+				})
+			})
+			assetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+
+			cmd := MappingReplayCommand{
+				testFailureEntry: func(_ context.Context, objectID, generation string) (*replayFailureEntry, error) {
+					if objectID != testReplayObject {
+						return nil, fmt.Errorf("got object %q, want %q", objectID, testReplayObject)
+					}
+					if generation != testGeneration {
+						return nil, fmt.Errorf("got generation %q, want %q", generation, testGeneration)
+					}
+					return tc.failureEntry, tc.failureErr
+				},
+				testPubSubClient: pubsubClient,
+				testAssetClient:  assetClient,
+				testStorageClient: newFakeStorageClient(t, map[string]*fakeObject{
+					testReplayObject: {
+						metadata: testProvenanceMetadata(),
+						data:     tc.objectData,
+					},
+				}),
+			}
+			_, stdout, _ := cmd.Pipe()
+
+			err = cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(strings.TrimSpace(tc.expOut), strings.TrimSpace(stdout.String())); diff != "" {
+				t.Errorf("output: diff (-want, +got):\n%s", diff)
+			}
+
+			msgs := psSrv.Messages()
+			if tc.wantTopic == "" {
+				if len(msgs) != 0 {
+					t.Errorf("got %d published messages, want none", len(msgs))
+				}
+				return
+			}
+			if got, want := len(msgs), 1; got != want {
+				t.Fatalf("got %d published messages, want %d", got, want)
+			}
+			if got, want := msgs[0].Topic, fmt.Sprintf("projects/%s/topics/%s", testProject, tc.wantTopic); got != want {
+				t.Errorf("published message got topic %q, want %q", got, want)
+			}
+			if got, want := msgs[0].Attributes[server.AttrKeyOutcome], tc.wantOutcome; got != want {
+				t.Errorf("published message got outcome %q, want %q", got, want)
+			}
+			if got, want := msgs[0].Attributes[server.AttrKeyObjectID], testReplayObject; got != want {
+				t.Errorf("published message got object ID %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFailureEntryQuery(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		generation string
+		wantQuery  string
+		wantParams []bigquery.QueryParameter
+	}{
+		{
+			name:       "object",
+			wantQuery:  "SELECT data, attributes FROM `p.d.t` WHERE JSON_VALUE(attributes.objectId) = ? ORDER BY publish_time DESC LIMIT 1",
+			wantParams: []bigquery.QueryParameter{{Value: "dir/file.yaml"}},
+		},
+		{
+			name:       "object_generation",
+			generation: "1700000000000000",
+			wantQuery: "SELECT data, attributes FROM `p.d.t` WHERE JSON_VALUE(attributes.objectId) = ?" +
+				" AND JSON_VALUE(attributes.objectGeneration) = ? ORDER BY publish_time DESC LIMIT 1",
+			wantParams: []bigquery.QueryParameter{{Value: "dir/file.yaml"}, {Value: "1700000000000000"}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			gotQuery, gotParams := failureEntryQuery("p.d.t", "dir/file.yaml", tc.generation)
+			if got, want := gotQuery, tc.wantQuery; got != want {
+				t.Errorf("got query %q, want %q", got, want)
+			}
+			if diff := cmp.Diff(tc.wantParams, gotParams); diff != "" {
+				t.Errorf("params: diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
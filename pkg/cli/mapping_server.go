@@ -18,6 +18,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 
 	asset "cloud.google.com/go/asset/apiv1"
 	"cloud.google.com/go/pubsub"
@@ -94,19 +96,24 @@ func (c *MappingServerCommand) RunUnstarted(ctx context.Context, args []string)
 	if err := c.cfg.Validate(); err != nil {
 		return nil, nil, closer, fmt.Errorf("invalid mapping configuration: %w", err)
 	}
-	logger.DebugContext(ctx, "loaded configuration", "config", c.cfg)
-
-	pubsubClient, err := pubsub.NewClient(ctx, c.cfg.ProjectID)
-	if err != nil {
-		return nil, nil, closer, fmt.Errorf("failed to create pubsub client: %w", err)
+	// Processor names are checked here as the config doesn't know the
+	// processors, fail before any client is created.
+	if _, err := disabledMappingProcessors(c.cfg); err != nil {
+		return nil, nil, closer, fmt.Errorf("invalid mapping configuration: %w", err)
 	}
-	closer = multicloser.Append(closer, pubsubClient.Close)
+	logger.InfoContext(ctx, "loaded configuration", "config", c.cfg)
 
-	successTopic := pubsubClient.Topic(c.cfg.SuccessTopicID)
-	successMessenger := server.NewPubSubMessenger(successTopic)
-	failureTopic := pubsubClient.Topic(c.cfg.FailureTopicID)
-	failureMessenger := server.NewPubSubMessenger(failureTopic)
-	closer = multicloser.Append(closer, successTopic.Stop, failureTopic.Stop)
+	// The Pub/Sub client is left nil when the events are written to stdout
+	// or a local file.
+	var pubsubClient *pubsub.Client
+	if c.cfg.UsesPubSub() {
+		var err error
+		pubsubClient, err = pubsub.NewClient(ctx, c.cfg.ProjectID)
+		if err != nil {
+			return nil, nil, closer, fmt.Errorf("failed to create pubsub client: %w", err)
+		}
+		closer = multicloser.Append(closer, pubsubClient.Close)
+	}
 
 	assetClient, err := asset.NewClient(ctx)
 	if err != nil {
@@ -114,23 +121,183 @@ func (c *MappingServerCommand) RunUnstarted(ctx context.Context, args []string)
 	}
 	closer = multicloser.Append(closer, assetClient.Close)
 
-	processor, err := processors.NewAssetInventoryProcessor(ctx, assetClient, c.cfg.DefaultResourceScope)
+	handler, handlerCloser, err := newMappingHandler(ctx, c.cfg, pubsubClient, assetClient)
+	closer = multicloser.Append(closer, handlerCloser.Close)
+	if err != nil {
+		return nil, nil, closer, err
+	}
+
+	srv, err := serving.New(c.cfg.Port)
+	if err != nil {
+		return nil, nil, closer, fmt.Errorf("failed to create serving infrastructure: %w", err)
+	}
+
+	return srv, handler.HTTPHandler(), closer, nil
+}
+
+// newMappingHandler creates the mapping event handler which publishes to the
+// configured topics, or writes to stdout or a local file in which case
+// pubsubClient isn't used. The returned closer stops the topics or closes the
+// file.
+func newMappingHandler(ctx context.Context, cfg *server.MappingHandlerConfig, pubsubClient *pubsub.Client, assetClient *asset.Client, extraOpts ...server.Option) (*server.EventHandler[v1alpha1.ResourceMapping, *v1alpha1.ResourceMapping], *multicloser.Closer, error) {
+	successMessenger, opts, closer, err := newHandlerMessengers(ctx, &cfg.HandlerConfig, pubsubClient)
 	if err != nil {
-		return nil, nil, closer, fmt.Errorf("failed to create assetInventoryProcessor: %w", err)
+		return nil, closer, err
+	}
+
+	cfgOpts, err := mappingHandlerOptions(ctx, cfg)
+	if err != nil {
+		return nil, closer, err
+	}
+	opts = append(opts, cfgOpts...)
+	opts = append(opts, extraOpts...)
+
+	ps, err := newMappingProcessors(ctx, cfg, assetClient)
+	if err != nil {
+		return nil, closer, err
 	}
 
 	handler, err := server.NewHandler(ctx,
-		[]server.Processor[*v1alpha1.ResourceMapping]{processor},
+		ps,
 		successMessenger,
-		server.WithFailureMessenger(failureMessenger))
+		opts...)
 	if err != nil {
-		return nil, nil, closer, fmt.Errorf("server.NewHandler: %w", err)
+		return nil, closer, fmt.Errorf("server.NewHandler: %w", err)
 	}
+	closer = multicloser.Append(closer, handler.Cleanup)
+	return handler, closer, nil
+}
 
-	srv, err := serving.New(c.cfg.Port)
+// mappingHandlerOptions returns the options of the mapping event handler
+// which don't depend on where the events are sent.
+func mappingHandlerOptions(ctx context.Context, cfg *server.MappingHandlerConfig) ([]server.Option, error) {
+	opts, err := handlerOptions(ctx, &cfg.HandlerConfig)
 	if err != nil {
-		return nil, nil, closer, fmt.Errorf("failed to create serving infrastructure: %w", err)
+		return nil, err
+	}
+	if cfg.DropEmptyAnnotations {
+		opts = append(opts, server.WithDropEmptyAnnotations())
 	}
+	if len(cfg.ResourceProviders) > 0 {
+		opts = append(opts, server.WithResourceProviders(cfg.ResourceProviders...))
+	}
+	return opts, nil
+}
 
-	return srv, handler.HTTPHandler(), closer, nil
+// mappingProcessorNames are the names of the built-in processors of the
+// mapping server which can be disabled.
+var mappingProcessorNames = []string{
+	processors.AnnotationKeyCasingProcessorName,
+	processors.AnnotationSchemaProcessorName,
+	processors.AssetInventoryProcessorName,
+	processors.DefaultContactsProcessorName,
+	processors.ObjectUpdateTimeProcessorName,
+	processors.ResidencyProcessorName,
+	processors.StrictProviderProcessorName,
+}
+
+// disabledMappingProcessors returns the set of the disabled processor names,
+// it fails on names of unknown processors.
+func disabledMappingProcessors(cfg *server.MappingHandlerConfig) (map[string]bool, error) {
+	disabled := make(map[string]bool, len(cfg.DisabledProcessors))
+	for _, n := range cfg.DisabledProcessors {
+		n = strings.TrimSpace(n)
+		if !slices.Contains(mappingProcessorNames, n) {
+			return nil, fmt.Errorf("PMAP_MAPPING_DISABLED_PROCESSORS: %s is not one of the allowed values: %v", n, mappingProcessorNames)
+		}
+		disabled[n] = true
+	}
+	return disabled, nil
+}
+
+// newMappingProcessors creates the processors of the mapping event handler in
+// the order they run, leaving out the disabled ones.
+func newMappingProcessors(ctx context.Context, cfg *server.MappingHandlerConfig, assetClient *asset.Client) ([]server.Processor[*v1alpha1.ResourceMapping], error) {
+	disabled, err := disabledMappingProcessors(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The asset client is closed by the caller.
+	processorOpts := []processors.Option{
+		processors.WithReservedAnnotationPrefix(cfg.ReservedAnnotationPrefix),
+		processors.WithOwnedClient(false),
+	}
+	if cfg.IAMSearchNonFatal {
+		processorOpts = append(processorOpts, processors.WithNonFatalIAMSearch())
+	}
+	if cfg.MaxIAMPolicies > 0 {
+		processorOpts = append(processorOpts, processors.WithMaxIAMPolicies(cfg.MaxIAMPolicies))
+	}
+	if cfg.BestEffortVerification {
+		processorOpts = append(processorOpts, processors.WithBestEffortVerification())
+	}
+	if cfg.RequestStats {
+		processorOpts = append(processorOpts, processors.WithRequestStats())
+	}
+	if cfg.AncestorNames {
+		processorOpts = append(processorOpts, processors.WithAncestorNames(processors.NewAssetInventoryNameResolver(assetClient)))
+	}
+	if len(cfg.AllowedServices) > 0 {
+		processorOpts = append(processorOpts, processors.WithAllowedServices(cfg.AllowedServices...))
+	}
+	scopes := cfg.DefaultResourceScopes()
+	processorOpts = append(processorOpts, processors.WithAdditionalResourceScopes(scopes[1:]...))
+
+	var ps []server.Processor[*v1alpha1.ResourceMapping]
+	if !disabled[processors.AssetInventoryProcessorName] {
+		processor, err := processors.NewAssetInventoryProcessor(ctx, assetClient, scopes[0], processorOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create assetInventoryProcessor: %w", err)
+		}
+		ps = append(ps, processor)
+	}
+	if cfg.DefaultContactsFile != "" && !disabled[processors.DefaultContactsProcessorName] {
+		defaults, err := loadDefaultContacts(cfg.DefaultContactsFile)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, processors.NewDefaultContactsProcessor(defaults, cfg.ReservedAnnotationPrefix))
+	}
+	if cfg.ResidencyFile != "" && !disabled[processors.ResidencyProcessorName] {
+		residencies, err := loadResidencies(cfg.ResidencyFile)
+		if err != nil {
+			return nil, err
+		}
+		residencyProcessor, err := processors.NewResidencyProcessor(residencies, cfg.ReservedAnnotationPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create residencyProcessor: %w", err)
+		}
+		ps = append(ps, residencyProcessor)
+	}
+	if cfg.ObjectUpdateTime && !disabled[processors.ObjectUpdateTimeProcessorName] {
+		ps = append(ps, processors.NewObjectUpdateTimeProcessor(cfg.ReservedAnnotationPrefix))
+	}
+	if cfg.AnnotationSchemaFile != "" && !disabled[processors.AnnotationSchemaProcessorName] {
+		schema, err := loadAnnotationSchema(cfg.AnnotationSchemaFile)
+		if err != nil {
+			return nil, err
+		}
+		schemaProcessor, err := processors.NewAnnotationSchemaProcessor(schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create annotationSchemaProcessor: %w", err)
+		}
+		// Reject violations before any enrichment.
+		ps = append([]server.Processor[*v1alpha1.ResourceMapping]{schemaProcessor}, ps...)
+	}
+	if cfg.AnnotationKeyCasing != "" && !disabled[processors.AnnotationKeyCasingProcessorName] {
+		casingProcessor, err := processors.NewAnnotationKeyCasingProcessor(
+			v1alpha1.KeyCasing(cfg.AnnotationKeyCasing), cfg.RewriteAnnotationKeys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create annotationKeyCasingProcessor: %w", err)
+		}
+		// Canonicalize the keys before the schema is checked against them.
+		ps = append([]server.Processor[*v1alpha1.ResourceMapping]{casingProcessor}, ps...)
+	}
+	if cfg.StrictProvider && !disabled[processors.StrictProviderProcessorName] {
+		// Reject unsupported providers before any enrichment.
+		ps = append([]server.Processor[*v1alpha1.ResourceMapping]{processors.NewStrictProviderProcessor(ps...)}, ps...)
+	}
+
+	return ps, nil
 }
@@ -18,11 +18,29 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	asset "cloud.google.com/go/asset/apiv1"
+	"cloud.google.com/go/asset/apiv1/assetpb"
+	"cloud.google.com/go/pubsub"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/testing/protocmp"
 
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/internal/testhelper"
+	"github.com/abcxyz/pmap/pkg/mapping/processors"
+	"github.com/abcxyz/pmap/pkg/server"
 )
 
 func TestMappingServerCommand(t *testing.T) {
@@ -87,6 +105,17 @@ func TestMappingServerCommand(t *testing.T) {
 			},
 			expErr: `invalid mapping configuration: PMAP_FAILURE_TOPIC_ID is empty and require a value`,
 		},
+		{
+			name: "invalid_disabled_processors",
+			env: map[string]string{
+				"PROJECT_ID":                          "test_project",
+				"PMAP_SUCCESS_TOPIC_ID":               "test_success_topic",
+				"PMAP_FAILURE_TOPIC_ID":               "test_failure_topic",
+				"PMAP_MAPPING_DEFAULT_RESOURCE_SCOPE": "projects/pmap-ci",
+				"PMAP_MAPPING_DISABLED_PROCESSORS":    "AssetInventoryProcessor,FooProcessor",
+			},
+			expErr: `invalid mapping configuration: PMAP_MAPPING_DISABLED_PROCESSORS: FooProcessor is not one of the allowed values`,
+		},
 	}
 
 	for _, tc := range cases {
@@ -122,3 +151,213 @@ func TestMappingServerCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestNewMappingProcessors(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	residencyFile := filepath.Join(t.TempDir(), "residency.yaml")
+	if err := os.WriteFile(residencyFile, []byte("EU:\n  - europe\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		cfg     *server.MappingHandlerConfig
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "all_enabled",
+			cfg: &server.MappingHandlerConfig{
+				DefaultResourceScope: "projects/pmap-ci",
+				ResidencyFile:        residencyFile,
+				StrictProvider:       true,
+				ObjectUpdateTime:     true,
+			},
+			want: []string{
+				processors.StrictProviderProcessorName,
+				processors.AssetInventoryProcessorName,
+				processors.ResidencyProcessorName,
+				processors.ObjectUpdateTimeProcessorName,
+			},
+		},
+		{
+			name: "residency_disabled",
+			cfg: &server.MappingHandlerConfig{
+				DefaultResourceScope: "projects/pmap-ci",
+				ResidencyFile:        residencyFile,
+				DisabledProcessors:   []string{processors.ResidencyProcessorName},
+			},
+			want: []string{processors.AssetInventoryProcessorName},
+		},
+		{
+			name: "asset_inventory_disabled",
+			cfg: &server.MappingHandlerConfig{
+				DefaultResourceScope: "projects/pmap-ci",
+				StrictProvider:       true,
+				DisabledProcessors:   []string{processors.AssetInventoryProcessorName},
+			},
+			want: []string{processors.StrictProviderProcessorName},
+		},
+		{
+			name: "all_disabled",
+			cfg: &server.MappingHandlerConfig{
+				DefaultResourceScope: "projects/pmap-ci",
+				ResidencyFile:        residencyFile,
+				DisabledProcessors: []string{
+					processors.AssetInventoryProcessorName,
+					" " + processors.ResidencyProcessorName,
+				},
+			},
+		},
+		{
+			name: "unknown_processor",
+			cfg: &server.MappingHandlerConfig{
+				DefaultResourceScope: "projects/pmap-ci",
+				DisabledProcessors:   []string{"FooProcessor"},
+			},
+			wantErr: `PMAP_MAPPING_DISABLED_PROCESSORS: FooProcessor is not one of the allowed values`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn, err := grpc.NewClient("localhost:0", grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatalf("failed to create grpc client: %v", err)
+			}
+			assetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("failed to create asset client: %v", err)
+			}
+			t.Cleanup(func() {
+				if err := assetClient.Close(); err != nil {
+					t.Logf("failed to close asset client: %v", err)
+				}
+			})
+
+			ps, err := newMappingProcessors(ctx, tc.cfg, assetClient)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			var got []string
+			for _, p := range ps {
+				if n, ok := p.(server.NamedProcessor); ok {
+					got = append(got, n.Name())
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("newMappingProcessors got processors diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+// Ensure the built-in processors can run concurrently, run with -race.
+func TestNewMappingProcessors_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	const (
+		testObject       = "mapping/gh-prefix/dir1/file.yaml"
+		existingResource = "//pubsub.googleapis.com/projects/test-project/topics/test-topic"
+	)
+
+	td := t.TempDir()
+	files := map[string]string{
+		"residency.yaml":        "EU:\n  - europe\n",
+		"default_contacts.yaml": "organizations/456:\n  - security@example.com\n",
+		"schema.yaml":           "data_classification:\n  enum: [public, internal]\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(td, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &server.MappingHandlerConfig{
+		DefaultResourceScope:  "projects/pmap-ci",
+		ResidencyFile:         filepath.Join(td, "residency.yaml"),
+		DefaultContactsFile:   filepath.Join(td, "default_contacts.yaml"),
+		AnnotationSchemaFile:  filepath.Join(td, "schema.yaml"),
+		AnnotationKeyCasing:   string(v1alpha1.KeyCasingSnake),
+		RewriteAnnotationKeys: true,
+		StrictProvider:        true,
+		ObjectUpdateTime:      true,
+	}
+
+	_, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+		assetpb.RegisterAssetServiceServer(s, &fakeAssetInventoryServer{
+			existingResources: map[string]bool{existingResource: true},
+		})
+	})
+	assetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("failed to create asset client: %v", err)
+	}
+	storageClient := newFakeStorageClient(t, map[string]*fakeObject{
+		testObject: {
+			metadata: testProvenanceMetadata(),
+			data: []byte(`
+resource:
+  provider: gcp
+  name: ` + existingResource + `
+contacts:
+  email:
+    - pmap@example.com
+annotations:
+  dataClassification: internal
+`),
+		},
+	})
+	data, err := json.Marshal(map[string]any{"metadata": testProvenanceMetadata()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			server.AttrKeyBucketID: testBucket,
+			server.AttrKeyObjectID: testObject,
+			"payloadFormat":        "JSON_API_V1",
+		},
+	}
+
+	// handle processes the object with the processors run up to n at once.
+	handle := func(n int) *server.Result {
+		t.Helper()
+
+		ps, err := newMappingProcessors(ctx, cfg, assetClient)
+		if err != nil {
+			t.Fatalf("newMappingProcessors got unexpected error: %v", err)
+		}
+		h, err := server.NewHandler(ctx, ps, server.NewFileMessenger(io.Discard),
+			server.WithStorageClient(storageClient),
+			server.WithClock(func() time.Time { return time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC) }),
+			server.WithConcurrentProcessors(n))
+		if err != nil {
+			t.Fatalf("failed to create event handler: %v", err)
+		}
+		result, err := h.HandleResult(ctx, msg)
+		if err != nil {
+			t.Fatalf("HandleResult got unexpected error: %v", err)
+		}
+		if got, want := result.Outcome, server.OutcomeSuccess; got != want {
+			t.Fatalf("HandleResult got outcome %q, want %q: %s", got, want, result.Attributes[server.AttrKeyProcessErr])
+		}
+		return result
+	}
+
+	want := handle(1)
+	for range 10 {
+		got := handle(8)
+		if diff := cmp.Diff(want.Event, got.Event, protocmp.Transform()); diff != "" {
+			t.Fatalf("concurrent processors got event diff (-want, +got):\n%s", diff)
+		}
+	}
+}
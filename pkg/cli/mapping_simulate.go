@@ -0,0 +1,200 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	asset "cloud.google.com/go/asset/apiv1"
+	"cloud.google.com/go/pubsub"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+var _ cli.Command = (*MappingSimulateCommand)(nil)
+
+// simulateBucketID is the bucket the simulated notification refers to.
+const simulateBucketID = "local"
+
+// MappingSimulateCommand runs a local mapping file through the mapping
+// pipeline and prints the event it produces, without GCS or Pub/Sub.
+type MappingSimulateCommand struct {
+	cli.BaseCommand
+
+	cfg *server.MappingHandlerConfig
+
+	flagFile string
+
+	// testAssetClient is used to inject a fake in tests.
+	testAssetClient *asset.Client
+}
+
+func (c *MappingSimulateCommand) Desc() string {
+	return `Simulate the mapping pipeline on a local file`
+}
+
+func (c *MappingSimulateCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+  Run the mapping file through the processors the mapping server is configured
+  with, and print the event it would produce:
+
+      pmap mapping simulate -file "mapping.yaml" -default-resource-scope "projects/my-project"
+
+  The file is never uploaded and the event is never published, but the asset
+  inventory is queried unless the processor is disabled with:
+
+      -disabled-processors "AssetInventoryProcessor"
+
+  The event has no GitHub provenance as the file has no object metadata.
+`
+}
+
+func (c *MappingSimulateCommand) Flags() *cli.FlagSet {
+	c.cfg = &server.MappingHandlerConfig{}
+	set := c.NewFlagSet()
+	c.cfg.ToFlags(set)
+
+	f := set.NewSection("SIMULATE OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "file",
+		Target:  &c.flagFile,
+		Example: "mapping.yaml",
+		Usage:   `The local mapping file to simulate, decoded as JSON for the .json extension and as YAML otherwise.`,
+	})
+
+	return set
+}
+
+func (c *MappingSimulateCommand) Run(ctx context.Context, args []string) error {
+	logger := logging.FromContext(ctx)
+
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %q", args)
+	}
+
+	if c.flagFile == "" {
+		return fmt.Errorf("file is required")
+	}
+	// Nothing is published, so the Pub/Sub configuration isn't required.
+	if c.cfg.LocalOutputFile == "" {
+		c.cfg.Sink = server.SinkStdout
+	}
+	if err := c.cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid mapping configuration: %w", err)
+	}
+	if _, err := disabledMappingProcessors(c.cfg); err != nil {
+		return fmt.Errorf("invalid mapping configuration: %w", err)
+	}
+
+	data, err := os.ReadFile(c.flagFile)
+	if err != nil {
+		return fmt.Errorf("failed to read file %q: %w", c.flagFile, err)
+	}
+
+	assetClient := c.testAssetClient
+	if assetClient == nil {
+		assetClient, err = asset.NewClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create the assetClient: %w", err)
+		}
+		defer func() {
+			if err := assetClient.Close(); err != nil {
+				logger.ErrorContext(ctx, "failed to close", "error", err)
+			}
+		}()
+	}
+
+	ps, err := newMappingProcessors(ctx, c.cfg, assetClient)
+	if err != nil {
+		return err
+	}
+	opts, err := mappingHandlerOptions(ctx, c.cfg)
+	if err != nil {
+		return err
+	}
+	msgr := &recordMessenger{}
+	opts = append(opts,
+		server.WithObjectStore(&localObjectStore{data: data}),
+		server.WithFailureMessenger(msgr))
+	handler, err := server.NewHandler(ctx, ps, msgr, opts...)
+	if err != nil {
+		return fmt.Errorf("server.NewHandler: %w", err)
+	}
+
+	result, err := handler.HandleResult(ctx, pubsub.Message{
+		Attributes: map[string]string{
+			server.AttrKeyBucketID: simulateBucketID,
+			server.AttrKeyObjectID: c.flagFile,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to simulate file %q: %w", c.flagFile, err)
+	}
+
+	if msgr.data != nil {
+		var out bytes.Buffer
+		if err := json.Indent(&out, msgr.data, "", "  "); err != nil {
+			return fmt.Errorf("failed to indent event: %w", err)
+		}
+		c.Outf("%s", out.String())
+	}
+	if result.Outcome == server.OutcomeSkipped {
+		c.Outf("Skipped file %q: %s", c.flagFile, result.SkipReason)
+		return nil
+	}
+	if result.Outcome != server.OutcomeSuccess {
+		return fmt.Errorf("simulated file %q failed: %s", c.flagFile, result.Attributes[server.AttrKeyProcessErr])
+	}
+	return nil
+}
+
+// localObjectStore is a [server.ObjectStore] serving the same data for every
+// object, which has no metadata.
+type localObjectStore struct {
+	data []byte
+}
+
+func (s *localObjectStore) NewObjectReader(_ context.Context, _, _ string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(s.data)), nil
+}
+
+func (s *localObjectStore) ObjectMetadata(_ context.Context, _, _ string) (map[string]string, error) {
+	return nil, nil
+}
+
+// recordMessenger is a [server.Messenger] keeping the last event sent to it.
+type recordMessenger struct {
+	data []byte
+}
+
+func (m *recordMessenger) Send(_ context.Context, data []byte, _ map[string]string) error {
+	m.data = data
+	return nil
+}
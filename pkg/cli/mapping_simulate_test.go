@@ -0,0 +1,232 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	asset "cloud.google.com/go/asset/apiv1"
+	"cloud.google.com/go/asset/apiv1/assetpb"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/internal/testhelper"
+)
+
+func TestMappingSimulateCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	td := t.TempDir()
+
+	const existingResource = "//pubsub.googleapis.com/projects/test-project/topics/test-topic"
+
+	files := map[string]string{
+		"existing.yaml": `
+resource:
+  provider: gcp
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contacts:
+  email:
+    - pmap@example.com
+annotations:
+  location: global
+`,
+		"existing.json": `{
+  "resource": {"provider": "gcp", "name": "//pubsub.googleapis.com/projects/test-project/topics/test-topic"},
+  "contacts": {"email": ["pmap@example.com"]}
+}`,
+		"missing.yaml": `
+resource:
+  provider: gcp
+  name: //pubsub.googleapis.com/projects/test-project/topics/missing-topic
+contacts:
+  email:
+    - pmap@example.com
+`,
+		"invalid.yaml": `resource: [`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(td, name), []byte(data), 0o600); err != nil {
+			t.Fatalf("failed to write file %s: %v", name, err)
+		}
+	}
+
+	defaultArgs := func(file string) []string {
+		return []string{"-file", filepath.Join(td, file), "-default-resource-scope", "projects/test-project"}
+	}
+
+	cases := []struct {
+		name    string
+		args    []string
+		expErr  string
+		wantOut string
+	}{
+		{
+			name:   "unexpected_args",
+			args:   []string{"foo"},
+			expErr: `unexpected arguments: ["foo"]`,
+		},
+		{
+			name:   "missing_file_flag",
+			args:   []string{},
+			expErr: `file is required`,
+		},
+		{
+			name:   "invalid_config",
+			args:   []string{"-file", filepath.Join(td, "existing.yaml")},
+			expErr: `invalid mapping configuration: PMAP_MAPPING_DEFAULT_RESOURCE_SCOPE is empty`,
+		},
+		{
+			name:   "unknown_disabled_processor",
+			args:   append(defaultArgs("existing.yaml"), "-disabled-processors", "FooProcessor"),
+			expErr: `invalid mapping configuration: PMAP_MAPPING_DISABLED_PROCESSORS: FooProcessor is not one of the allowed values`,
+		},
+		{
+			name:   "file_not_found",
+			args:   defaultArgs("not_found.yaml"),
+			expErr: `failed to read file`,
+		},
+		{
+			name: "yaml_file",
+			args: defaultArgs("existing.yaml"),
+			wantOut: `{
+  "payload": {
+    "@type": "type.googleapis.com/abcxyz.pmap.ResourceMapping",
+    "resource": {
+      "provider": "gcp",
+      "name": "//pubsub.googleapis.com/projects/test-project/topics/test-topic"
+    },
+    "contacts": {"email": ["pmap@example.com"]},
+    "annotations": {
+      "location": "global",
+      "assetInfo": {},
+      "service": "pubsub.googleapis.com"
+    }
+  },
+  "type": "abcxyz.pmap.ResourceMapping"
+}`,
+		},
+		{
+			name: "json_file",
+			args: defaultArgs("existing.json"),
+			wantOut: `{
+  "payload": {
+    "@type": "type.googleapis.com/abcxyz.pmap.ResourceMapping",
+    "resource": {
+      "provider": "gcp",
+      "name": "//pubsub.googleapis.com/projects/test-project/topics/test-topic"
+    },
+    "contacts": {"email": ["pmap@example.com"]},
+    "annotations": {
+      "assetInfo": {},
+      "service": "pubsub.googleapis.com"
+    }
+  },
+  "type": "abcxyz.pmap.ResourceMapping"
+}`,
+		},
+		{
+			name:   "missing_resource",
+			args:   defaultArgs("missing.yaml"),
+			expErr: `failed: failed to process object`,
+			wantOut: `{
+  "payload": {
+    "@type": "type.googleapis.com/abcxyz.pmap.ResourceMapping",
+    "resource": {
+      "provider": "gcp",
+      "name": "//pubsub.googleapis.com/projects/test-project/topics/missing-topic"
+    },
+    "contacts": {"email": ["pmap@example.com"]}
+  },
+  "type": "abcxyz.pmap.ResourceMapping"
+}`,
+		},
+		{
+			name: "asset_inventory_disabled",
+			args: append(defaultArgs("missing.yaml"), "-disabled-processors", "AssetInventoryProcessor"),
+			wantOut: `{
+  "payload": {
+    "@type": "type.googleapis.com/abcxyz.pmap.ResourceMapping",
+    "resource": {
+      "provider": "gcp",
+      "name": "//pubsub.googleapis.com/projects/test-project/topics/missing-topic"
+    },
+    "contacts": {"email": ["pmap@example.com"]}
+  },
+  "type": "abcxyz.pmap.ResourceMapping"
+}`,
+		},
+		{
+			name:   "invalid_file",
+			args:   defaultArgs("invalid.yaml"),
+			expErr: `failed: pmap process err: failed to unmarshal object yaml`,
+			wantOut: `{
+  "type": "abcxyz.pmap.ResourceMapping"
+}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Setup fake Asset Inventory server and client.
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &fakeAssetInventoryServer{
+					existingResources: map[string]bool{existingResource: true},
+				})
+			})
+			assetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+
+			cmd := MappingSimulateCommand{testAssetClient: assetClient}
+			_, stdout, _ := cmd.Pipe()
+
+			err = cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			if tc.wantOut == "" {
+				if got := stdout.String(); got != "" {
+					t.Errorf("got output %q, want none", got)
+				}
+				return
+			}
+			// The event timestamp is the current time.
+			var got, want map[string]any
+			if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+				t.Fatalf("failed to unmarshal output %q: %v", stdout.String(), err)
+			}
+			delete(got, "timestamp")
+			if err := json.Unmarshal([]byte(tc.wantOut), &want); err != nil {
+				t.Fatalf("failed to unmarshal want output: %v", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("output: diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
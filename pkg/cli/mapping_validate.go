@@ -20,11 +20,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
+	asset "cloud.google.com/go/asset/apiv1"
+
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/protoutil"
 	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/mapping/processors"
 )
 
 var _ cli.Command = (*MappingValidateCommand)(nil)
@@ -32,7 +36,17 @@ var _ cli.Command = (*MappingValidateCommand)(nil)
 type MappingValidateCommand struct {
 	cli.BaseCommand
 
-	flagPath string
+	flagPath                 string
+	flagOnline               bool
+	flagDefaultResourceScope string
+	flagVerbose              bool
+	flagWerror               bool
+	flagManifest             string
+
+	validation mappingValidationFlags
+
+	// testAssetClient is used to inject a fake Asset Inventory client in tests.
+	testAssetClient *asset.Client
 }
 
 func (c *MappingValidateCommand) Desc() string {
@@ -46,6 +60,14 @@ Usage: {{ COMMAND }} [options]
   Validate resource mapping YAML files that exists in the given path:
 
       pmap mapping validate -path "/path/to/file"
+
+  Additionally validate the resources exist in Cloud Asset Inventory:
+
+      pmap mapping validate -path "/path/to/file" -online -default-resource-scope "projects/my-project"
+
+  Skip the files unchanged since the last successful validation:
+
+      pmap mapping validate -path "/path/to/file" -manifest "/path/to/manifest.json"
 `
 }
 
@@ -62,6 +84,46 @@ func (c *MappingValidateCommand) Flags() *cli.FlagSet {
 		Usage:   `The path of resource mapping files.`,
 	})
 
+	f.BoolVar(&cli.BoolVar{
+		Name:    "verbose",
+		Aliases: []string{"v"},
+		Target:  &c.flagVerbose,
+		Default: false,
+		Usage:   `Whether to print the files being processed.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "Werror",
+		Target:  &c.flagWerror,
+		Default: false,
+		Usage:   `Whether to treat warnings as errors.`,
+	})
+
+	c.validation.register(f)
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "online",
+		Target:  &c.flagOnline,
+		Default: false,
+		Usage:   `Whether to validate the resources exist in Cloud Asset Inventory.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "default-resource-scope",
+		Target:  &c.flagDefaultResourceScope,
+		Example: "projects/test-project-id",
+		Usage: `The default scope to search for resources when validating online, ` +
+			`a comma separated list is searched in order. Required when -online is set.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "manifest",
+		Target:  &c.flagManifest,
+		Example: "/path/to/manifest.json",
+		Usage: `The file recording the hashes of the validated files, files unchanged since the last ` +
+			`successful validation with the same options are skipped. It's updated after a successful validation.`,
+	})
+
 	return set
 }
 
@@ -79,47 +141,235 @@ func (c *MappingValidateCommand) Run(ctx context.Context, args []string) error {
 		return fmt.Errorf("path is required")
 	}
 
-	return c.validateResourceMappings()
+	if err := c.validation.validate(); err != nil {
+		return err
+	}
+
+	var p *processors.AssetInventoryProcessor
+	if c.flagOnline {
+		if c.flagDefaultResourceScope == "" {
+			return fmt.Errorf("default-resource-scope is required when online is set")
+		}
+
+		client := c.testAssetClient
+		if client == nil {
+			var err error
+			client, err = asset.NewClient(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to create the assetClient: %w", err)
+			}
+			defer client.Close()
+		}
+
+		var err error
+		scopes := strings.Split(c.flagDefaultResourceScope, ",")
+		for i, s := range scopes {
+			scopes[i] = strings.TrimSpace(s)
+		}
+		p, err = processors.NewAssetInventoryProcessor(ctx, client, scopes[0],
+			processors.WithAdditionalResourceScopes(scopes[1:]...))
+		if err != nil {
+			return fmt.Errorf("failed to create assetInventoryProcessor: %w", err)
+		}
+	}
+
+	return c.validateResourceMappings(ctx, p)
 }
 
-func (c *MappingValidateCommand) validateResourceMappings() error {
+// validateResourceMappings validates the resource mapping files, the resources
+// existence is also validated when the processor p is not nil.
+func (c *MappingValidateCommand) validateResourceMappings(ctx context.Context, p *processors.AssetInventoryProcessor) error {
 	dir := c.flagPath
 	files, err := fetchExtractedYAMLFiles(dir)
 	if err != nil {
 		return fmt.Errorf("failed to fetch extracted files in dir %s: %w", dir, err)
 	}
+
+	// The prior manifest is ignored when the options changed, since the
+	// unchanged files may not pass the validation anymore.
+	var prior, next *validationManifest
+	if c.flagManifest != "" {
+		prior, err = loadValidationManifest(c.flagManifest)
+		if err != nil {
+			return err
+		}
+		next = &validationManifest{Options: c.manifestOptions(), Files: make(map[string]string, len(files))}
+		if prior.Options != next.Options {
+			prior.Files = nil
+		}
+	}
+
+	validateOpts := c.validation.validateOptions()
+
 	var checkErrs error
 	for _, file := range files {
 		// In pmap check.yml workflow, a temp directory will be created to store all
 		// the changed yaml files. Removing the temp directory to avoid the
 		// confusion in the error msgs of pmap check.yml workflow.
 		originFile := strings.TrimPrefix(file, dir+string(os.PathSeparator))
-		// TODO(#64) Enable verbosity conctrol for pmap cli
-		// By default, we probably don't want to output such messages.
-		c.Outf("processing file %q", originFile)
+		if c.flagVerbose {
+			c.Outf("processing file %q", originFile)
+		}
 		data, err := os.ReadFile(file)
 		if err != nil {
 			checkErrs = errors.Join(checkErrs, fmt.Errorf("failed to read file from %q, %w", originFile, err))
 			continue
 		}
 
-		var resourceMapping v1alpha1.ResourceMapping
-		if err := protoutil.FromYAML(data, &resourceMapping); err != nil {
-			checkErrs = errors.Join(checkErrs,
-				fmt.Errorf("file %q: failed to unmarshal yaml to ResourceMapping: %w", originFile, err))
+		data, err = resolveContactsRef(file, data)
+		if err != nil {
+			checkErrs = errors.Join(checkErrs, fmt.Errorf("file %q: failed to resolve %s: %w", originFile, contactsRefKey, err))
 			continue
 		}
-		if err := v1alpha1.ValidateResourceMapping(&resourceMapping); err != nil {
+
+		// The resolved data is hashed so changes of the referenced contacts
+		// files are validated too.
+		if next != nil {
+			hash := manifestHash(data)
+			next.Files[originFile] = hash
+			if prior.Files[originFile] == hash {
+				if c.flagVerbose {
+					c.Outf("skipping unchanged file %q", originFile)
+				}
+				continue
+			}
+		}
+
+		resourceMapping, err := parseResourceMapping(data, validateOpts...)
+		if err != nil {
 			checkErrs = errors.Join(checkErrs, fmt.Errorf("file %q: %w", originFile, err))
 			continue
 		}
+		for _, w := range lintResourceMapping(resourceMapping) {
+			if c.flagWerror {
+				checkErrs = errors.Join(checkErrs, fmt.Errorf("file %q: %s", originFile, w))
+				continue
+			}
+			c.Errf("warning: file %q: %s", originFile, w)
+		}
+		if p != nil {
+			if err := p.ValidateExistence(ctx, resourceMapping); err != nil {
+				if processors.IsResourceNotFound(err) {
+					checkErrs = errors.Join(checkErrs, fmt.Errorf("file %q: resource does not exist: %w", originFile, err))
+				} else {
+					checkErrs = errors.Join(checkErrs, fmt.Errorf("file %q: failed to check resource existence: %w", originFile, err))
+				}
+				continue
+			}
+		}
+	}
+	if checkErrs != nil {
+		return checkErrs
+	}
+	if next != nil {
+		if err := next.write(c.flagManifest); err != nil {
+			return err
+		}
+	}
+	c.Outf("Validation passed")
+	return nil
+}
+
+// mappingValidationFlags are the flags of the resource mapping validation,
+// shared by the commands validating resource mappings.
+type mappingValidationFlags struct {
+	reservedPrefix      string
+	requiredAnnotations []string
+	annotationKeyCasing string
+	maxContacts         int
+	qualifierKeys       []string
+}
+
+// register adds the validation flags to the section.
+func (v *mappingValidationFlags) register(f *cli.FlagSection) {
+	f.StringVar(&cli.StringVar{
+		Name:    "reserved-annotation-prefix",
+		Target:  &v.reservedPrefix,
+		EnvVar:  "PMAP_MAPPING_RESERVED_ANNOTATION_PREFIX",
+		Example: "sys.",
+		Usage:   `The annotation key prefix reserved for system-injected annotations. User annotations starting with it are rejected.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "required-annotation-keys",
+		Target:  &v.requiredAnnotations,
+		EnvVar:  "PMAP_MAPPING_REQUIRED_ANNOTATION_KEYS",
+		Example: "dataClassification,retention",
+		Usage:   `The annotation keys every resource mapping must have, none are required if unset.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "annotation-key-casing",
+		Target:  &v.annotationKeyCasing,
+		EnvVar:  "PMAP_MAPPING_ANNOTATION_KEY_CASING",
+		Example: "lowerCamel",
+		Usage:   `The casing of the annotation keys, one of "lowerCamel" or "snake". Keys are not checked if unset.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "max-contacts",
+		Target:  &v.maxContacts,
+		EnvVar:  "PMAP_MAPPING_MAX_CONTACTS",
+		Default: v1alpha1.DefaultMaxContacts,
+		Usage:   `The maximum number of contact emails of a resource mapping, 0 means no limit.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "allowed-qualifier-keys",
+		Target:  &v.qualifierKeys,
+		EnvVar:  "PMAP_MAPPING_ALLOWED_QUALIFIER_KEYS",
+		Example: "region,shard",
+		Usage:   `The keys the subscope qualifiers are allowed to use, any key is allowed if unset.`,
+	})
+}
+
+// validate checks the values of the validation flags.
+func (v *mappingValidationFlags) validate() error {
+	switch v1alpha1.KeyCasing(v.annotationKeyCasing) {
+	case "", v1alpha1.KeyCasingLowerCamel, v1alpha1.KeyCasingSnake:
+		return nil
+	default:
+		return fmt.Errorf("annotation-key-casing must be one of [%s %s], got %q",
+			v1alpha1.KeyCasingLowerCamel, v1alpha1.KeyCasingSnake, v.annotationKeyCasing)
 	}
-	if checkErrs == nil {
-		c.Outf("Validation passed")
+}
+
+// validateOptions returns the options of [parseResourceMapping].
+func (v *mappingValidationFlags) validateOptions() []v1alpha1.ValidateOption {
+	validators := []v1alpha1.Validator{v1alpha1.RequiredAnnotationKeys(v.requiredAnnotations...)}
+	if v.annotationKeyCasing != "" {
+		validators = append(validators, v1alpha1.AnnotationKeyCasing(v1alpha1.KeyCasing(v.annotationKeyCasing)))
+	}
+	return []v1alpha1.ValidateOption{
+		v1alpha1.WithReservedAnnotationPrefix(v.reservedPrefix),
+		v1alpha1.WithMaxContacts(v.maxContacts),
+		v1alpha1.WithAllowedQualifierKeys(v.qualifierKeys...),
+		v1alpha1.WithValidators(validators...),
 	}
-	return checkErrs
 }
 
+// parseResourceMapping unmarshals the YAML data of a resource mapping and
+// validates it with the options.
+func parseResourceMapping(data []byte, opts ...v1alpha1.ValidateOption) (*v1alpha1.ResourceMapping, error) {
+	var resourceMapping v1alpha1.ResourceMapping
+	if err := protoutil.FromYAML(data, &resourceMapping); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml to ResourceMapping: %w", err)
+	}
+	if err := v1alpha1.ValidateResourceMapping(&resourceMapping, opts...); err != nil {
+		return nil, err //nolint:wrapcheck // Reported with the file name.
+	}
+	return &resourceMapping, nil
+}
+
+// manifestOptions fingerprints the options files are validated with.
+func (c *MappingValidateCommand) manifestOptions() string {
+	return fmt.Sprintf("online=%t defaultResourceScope=%q Werror=%t reservedAnnotationPrefix=%q requiredAnnotationKeys=%q annotationKeyCasing=%q maxContacts=%d allowedQualifierKeys=%q",
+		c.flagOnline, c.flagDefaultResourceScope, c.flagWerror, c.validation.reservedPrefix, c.validation.requiredAnnotations,
+		c.validation.annotationKeyCasing, c.validation.maxContacts, c.validation.qualifierKeys)
+}
+
+// fetchExtractedYAMLFiles returns the yaml files in localDir sorted by path,
+// so validation errors are reported in the same order on every platform.
 func fetchExtractedYAMLFiles(localDir string) ([]string, error) {
 	var files []string
 	if err := filepath.WalkDir(localDir, func(path string, entry os.DirEntry, err error) error {
@@ -137,5 +387,8 @@ func fetchExtractedYAMLFiles(localDir string) ([]string, error) {
 	}); err != nil {
 		return nil, fmt.Errorf("failed to walk the directory %s: %w", localDir, err)
 	}
+	// WalkDir sorts the entries of each directory, which doesn't sort the
+	// paths, e.g. "a/b.yaml" is walked before "a-b.yaml".
+	slices.Sort(files)
 	return files, nil
 }
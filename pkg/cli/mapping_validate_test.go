@@ -16,15 +16,25 @@ package cli
 
 import (
 	"context"
+	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
+	asset "cloud.google.com/go/asset/apiv1"
+	"cloud.google.com/go/asset/apiv1/assetpb"
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/internal/testhelper"
 )
 
 func TestNewValidateCmd(t *testing.T) {
@@ -62,6 +72,67 @@ func TestNewValidateCmd(t *testing.T) {
 			args:   []string{"-path", filepath.Join(td, "dir_invalid_yaml")},
 			expErr: "file \"file1.yaml\": failed to unmarshal yaml to ResourceMapping",
 		},
+		{
+			name: "duplicate_yaml_keys",
+			dir:  "dir_duplicate_yaml_keys",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contacts:
+    email:
+        - pmap@example.com
+annotations:
+    location: global
+    location: us
+`),
+			},
+			args:   []string{"-path", filepath.Join(td, "dir_duplicate_yaml_keys")},
+			expErr: `file "file1.yaml": failed to unmarshal yaml to ResourceMapping: failed to unmarshal yaml: yaml: unmarshal errors:` + "\n" + `  line 10: mapping key "location" already defined at line 9`,
+		},
+		{
+			name: "contacts_ref_include",
+			dir:  "dir_contacts_ref_include",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contactsRef: team.contacts
+`),
+				"team.contacts": []byte(`
+email:
+  - pmap@example.com
+`),
+			},
+			args:   []string{"-path", filepath.Join(td, "dir_contacts_ref_include")},
+			expOut: "Validation passed",
+		},
+		{
+			name: "contacts_ref_cycle",
+			dir:  "dir_contacts_ref_cycle",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contactsRef: a.contacts
+`),
+				"a.contacts": []byte(`
+email:
+  - a@example.com
+contactsRef: b.contacts
+`),
+				"b.contacts": []byte(`
+email:
+  - b@example.com
+contactsRef: a.contacts
+`),
+			},
+			args:   []string{"-path", filepath.Join(td, "dir_contacts_ref_cycle")},
+			expErr: `file "file1.yaml": failed to resolve contactsRef: cyclic contactsRef`,
+		},
 		{
 			name: "valid_contents",
 			fileDatas: map[string][]byte{
@@ -107,6 +178,157 @@ annotations:
 			},
 			dir:    "dir_valid_contents",
 			args:   []string{"-path", filepath.Join(td, "dir_valid_contents")},
+			expOut: "Validation passed",
+		},
+		{
+			name: "warning_passes_by_default",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contacts:
+    email:
+        - pmap@gmail.com
+`),
+			},
+			dir:    "dir_warning_default",
+			args:   []string{"-path", filepath.Join(td, "dir_warning_default")},
+			expOut: "Validation passed",
+		},
+		{
+			name: "warning_fails_with_werror",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contacts:
+    email:
+        - pmap@gmail.com
+`),
+			},
+			dir:    "dir_warning_werror",
+			args:   []string{"-path", filepath.Join(td, "dir_warning_werror"), "-Werror"},
+			expErr: `file "file1.yaml": contact "pmap@gmail.com" uses a personal email domain`,
+		},
+		{
+			name: "reserved_annotation_prefix",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contacts:
+    email:
+        - pmap@example.com
+annotations:
+    sys.location: global
+`),
+			},
+			dir:    "dir_reserved_annotation_prefix",
+			args:   []string{"-path", filepath.Join(td, "dir_reserved_annotation_prefix"), "-reserved-annotation-prefix", "sys."},
+			expErr: `file "file1.yaml": annotation key "sys.location" uses reserved prefix "sys."`,
+		},
+		{
+			name: "required_annotation_keys",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contacts:
+    email:
+        - pmap@example.com
+annotations:
+    retention: 30d
+`),
+			},
+			dir:    "dir_required_annotation_keys",
+			args:   []string{"-path", filepath.Join(td, "dir_required_annotation_keys"), "-required-annotation-keys", "retention,dataClassification"},
+			expErr: `file "file1.yaml": required annotation key "dataClassification" is missing`,
+		},
+		{
+			name: "annotation_key_casing",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contacts:
+    email:
+        - pmap@example.com
+annotations:
+    Env: prod
+    dataClassification: internal
+`),
+			},
+			dir:    "dir_annotation_key_casing",
+			args:   []string{"-path", filepath.Join(td, "dir_annotation_key_casing"), "-annotation-key-casing", "lowerCamel"},
+			expErr: `file "file1.yaml": annotation key "Env" is not lowerCamel, want "env"`,
+		},
+		{
+			name: "max_contacts",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contacts:
+    email:
+        - pmap@example.com
+        - pmap-2@example.com
+`),
+			},
+			dir:    "dir_max_contacts",
+			args:   []string{"-path", filepath.Join(td, "dir_max_contacts"), "-max-contacts", "1"},
+			expErr: `file "file1.yaml": too many contacts: got 2, want at most 1`,
+		},
+		{
+			name: "allowed_qualifier_keys",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+    subscope: parent/foo?region=us&zone=a
+contacts:
+    email:
+        - pmap@example.com
+`),
+			},
+			dir:    "dir_allowed_qualifier_keys",
+			args:   []string{"-path", filepath.Join(td, "dir_allowed_qualifier_keys"), "-allowed-qualifier-keys", "region,shard"},
+			expErr: `file "file1.yaml": subscope validation failed: qualifier key "zone" is not one of the allowed keys: [region shard]`,
+		},
+		{
+			name:   "invalid_annotation_key_casing",
+			dir:    "dir_invalid_annotation_key_casing",
+			args:   []string{"-path", filepath.Join(td, "dir_invalid_annotation_key_casing"), "-annotation-key-casing", "kebab"},
+			expErr: `annotation-key-casing must be one of [lowerCamel snake], got "kebab"`,
+		},
+		{
+			name: "valid_contents_verbose",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+contacts:
+    email:
+        - pmap@example.com
+`),
+				"file2.yml": []byte(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/subscriptions/test-subsriptions
+contacts:
+    email:
+        - pmap@example.com
+`),
+			},
+			dir:    "dir_valid_contents_verbose",
+			args:   []string{"-path", filepath.Join(td, "dir_valid_contents_verbose"), "-v"},
 			expOut: "processing file \"file1.yaml\"\nprocessing file \"file2.yml\"\nValidation passed",
 		},
 	}
@@ -148,3 +370,349 @@ annotations:
 		})
 	}
 }
+
+func TestNewValidateCmd_ErrorOrder(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	td := t.TempDir()
+
+	// Written in reverse order, "a/b.yaml" is walked before "a-b.yaml".
+	files := []string{"z.yaml", filepath.Join("a", "b.yaml"), "a-b.yaml"}
+	if err := os.MkdirAll(filepath.Join(td, "a"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(td, f), []byte("foo"), 0o600); err != nil {
+			t.Fatalf("failed to write data to file %s: %v", f, err)
+		}
+	}
+
+	var cmd MappingValidateCommand
+	cmd.Pipe()
+	err := cmd.Run(ctx, []string{"-path", td})
+	if err == nil {
+		t.Fatal("Run got no error, want validation errors")
+	}
+
+	var got []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if rest, ok := strings.CutPrefix(line, `file "`); ok {
+			f, _, _ := strings.Cut(rest, `"`)
+			got = append(got, f)
+		}
+	}
+	want := []string{"a-b.yaml", filepath.Join("a", "b.yaml"), "z.yaml"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Run got errors order diff (-want, +got): %v", diff)
+	}
+}
+
+func TestFetchExtractedYAMLFiles(t *testing.T) {
+	t.Parallel()
+
+	td := t.TempDir()
+	for _, f := range []string{"z.yml", filepath.Join("a", "b.yaml"), "a-b.yaml", "notes.txt"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(td, f)), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(td, f), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := fetchExtractedYAMLFiles(td)
+	if err != nil {
+		t.Fatalf("fetchExtractedYAMLFiles got unexpected error: %v", err)
+	}
+	want := []string{
+		filepath.Join(td, "a-b.yaml"),
+		filepath.Join(td, "a", "b.yaml"),
+		filepath.Join(td, "z.yml"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("fetchExtractedYAMLFiles got diff (-want, +got): %v", diff)
+	}
+}
+
+type fakeAssetInventoryServer struct {
+	assetpb.UnimplementedAssetServiceServer
+
+	existingResources map[string]bool
+	// searchErr is returned by the resource searches when set.
+	searchErr error
+}
+
+// SearchAllResources returns the existing resource matching the name query,
+// or all the existing resources sorted by name for listing searches without a
+// query.
+func (s *fakeAssetInventoryServer) SearchAllResources(_ context.Context, req *assetpb.SearchAllResourcesRequest) (*assetpb.SearchAllResourcesResponse, error) {
+	if s.searchErr != nil {
+		return nil, s.searchErr
+	}
+	resp := &assetpb.SearchAllResourcesResponse{}
+	if req.GetQuery() == "" {
+		for _, name := range slices.Sorted(maps.Keys(s.existingResources)) {
+			resp.Results = append(resp.Results, &assetpb.ResourceSearchResult{Name: name})
+		}
+		return resp, nil
+	}
+	name := strings.TrimPrefix(req.GetQuery(), "name=")
+	if s.existingResources[name] {
+		resp.Results = []*assetpb.ResourceSearchResult{{Name: name}}
+	}
+	return resp, nil
+}
+
+func (s *fakeAssetInventoryServer) SearchAllIamPolicies(context.Context, *assetpb.SearchAllIamPoliciesRequest) (*assetpb.SearchAllIamPoliciesResponse, error) {
+	return &assetpb.SearchAllIamPoliciesResponse{}, nil
+}
+
+func TestNewValidateCmd_Online(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	td := t.TempDir()
+
+	fileData := func(name string) []byte {
+		return []byte(fmt.Sprintf(`
+resource:
+    provider: gcp
+    name: %s
+contacts:
+    email:
+        - pmap@example.com
+`, name))
+	}
+
+	cases := []struct {
+		name      string
+		args      []string
+		dir       string
+		fileDatas map[string][]byte
+		searchErr error
+		expOut    string
+		expErr    string
+	}{
+		{
+			name:   "missing_default_resource_scope",
+			args:   []string{"-path", td, "-online"},
+			expErr: "default-resource-scope is required when online is set",
+		},
+		{
+			name: "existing_resources",
+			dir:  "dir_existing_resources",
+			fileDatas: map[string][]byte{
+				"file1.yaml": fileData("//pubsub.googleapis.com/projects/test-project/topics/test-topic"),
+				"file2.yaml": fileData("//storage.googleapis.com/test-bucket"),
+			},
+			args: []string{
+				"-path", filepath.Join(td, "dir_existing_resources"),
+				"-online", "-default-resource-scope", "projects/test-project",
+			},
+			expOut: "Validation passed",
+		},
+		{
+			name: "missing_resource",
+			dir:  "dir_missing_resource",
+			fileDatas: map[string][]byte{
+				"file1.yaml": fileData("//pubsub.googleapis.com/projects/test-project/topics/missing-topic"),
+			},
+			args: []string{
+				"-path", filepath.Join(td, "dir_missing_resource"),
+				"-online", "-default-resource-scope", "projects/test-project",
+			},
+			expErr: `file "file1.yaml": resource does not exist: pmap process err: failed to get single matched resource "//pubsub.googleapis.com/projects/test-project/topics/missing-topic" in resourceScope "projects/test-project": 0 matched resources found`,
+		},
+		{
+			name: "search_permission_denied",
+			dir:  "dir_search_permission_denied",
+			fileDatas: map[string][]byte{
+				"file1.yaml": fileData("//pubsub.googleapis.com/projects/test-project/topics/test-topic"),
+			},
+			searchErr: status.Error(codes.PermissionDenied, "caller does not have permission"),
+			args: []string{
+				"-path", filepath.Join(td, "dir_search_permission_denied"),
+				"-online", "-default-resource-scope", "projects/test-project",
+			},
+			expErr: `file "file1.yaml": failed to check resource existence: pmap process err: failed to get single matched resource "//pubsub.googleapis.com/projects/test-project/topics/test-topic" in resourceScope "projects/test-project": failed to search resources: rpc error: code = PermissionDenied desc = caller does not have permission`,
+		},
+		{
+			name: "non_gcp_resource_skipped",
+			dir:  "dir_non_gcp_resource",
+			fileDatas: map[string][]byte{
+				"file1.yaml": []byte(`
+resource:
+    provider: aws
+    name: arn:aws:s3:::test-bucket
+contacts:
+    email:
+        - pmap@example.com
+`),
+			},
+			args: []string{
+				"-path", filepath.Join(td, "dir_non_gcp_resource"),
+				"-online", "-default-resource-scope", "projects/test-project",
+			},
+			expOut: "Validation passed",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.dir != "" && tc.fileDatas != nil {
+				if err := os.MkdirAll(filepath.Join(td, tc.dir), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				for name, data := range tc.fileDatas {
+					if err := os.WriteFile(filepath.Join(td, tc.dir, name), data, 0o600); err != nil {
+						t.Fatalf("failed to write data to file %s: %v", name, err)
+					}
+				}
+			}
+
+			// Setup fake Asset Inventory server and client.
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &fakeAssetInventoryServer{
+					existingResources: map[string]bool{
+						"//pubsub.googleapis.com/projects/test-project/topics/test-topic": true,
+						"//storage.googleapis.com/test-bucket":                            true,
+					},
+					searchErr: tc.searchErr,
+				})
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+
+			cmd := MappingValidateCommand{testAssetClient: fakeAssetClient}
+			_, stdout, _ := cmd.Pipe()
+
+			err = cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(strings.TrimSpace(tc.expOut), strings.TrimSpace(stdout.String())); diff != "" {
+				t.Errorf("output: diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewValidateCmd_Manifest(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	td := t.TempDir()
+	dir := filepath.Join(td, "mappings")
+	manifest := filepath.Join(td, "manifest.json")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	mapping := func(topic string) []byte {
+		return []byte(fmt.Sprintf(`
+resource:
+    provider: gcp
+    name: //pubsub.googleapis.com/projects/test-project/topics/%s
+contacts:
+    email:
+        - pmap@example.com
+`, topic))
+	}
+	writeFile := func(name string, data []byte) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("failed to write data to file %s: %v", name, err)
+		}
+	}
+	readManifest := func() string {
+		t.Helper()
+		b, err := os.ReadFile(manifest)
+		if err != nil {
+			t.Fatalf("failed to read manifest: %v", err)
+		}
+		return string(b)
+	}
+
+	// The steps share the directory and the manifest, so they run in order.
+	steps := []struct {
+		name      string
+		fileDatas map[string][]byte
+		extraArgs []string
+		expOut    string
+		expErr    string
+		// expManifestUnchanged checks the failed validation left the
+		// manifest of the previous step.
+		expManifestUnchanged bool
+	}{
+		{
+			name: "first_run_validates_all",
+			fileDatas: map[string][]byte{
+				"file1.yaml": mapping("topic1"),
+				"file2.yaml": mapping("topic2"),
+			},
+			expOut: "processing file \"file1.yaml\"\nprocessing file \"file2.yaml\"\nValidation passed",
+		},
+		{
+			name: "unchanged_files_skipped",
+			expOut: "processing file \"file1.yaml\"\nskipping unchanged file \"file1.yaml\"\n" +
+				"processing file \"file2.yaml\"\nskipping unchanged file \"file2.yaml\"\nValidation passed",
+		},
+		{
+			name: "changed_file_revalidated",
+			fileDatas: map[string][]byte{
+				"file2.yaml": []byte("foo"),
+			},
+			expOut:               "processing file \"file1.yaml\"\nskipping unchanged file \"file1.yaml\"\nprocessing file \"file2.yaml\"",
+			expErr:               `file "file2.yaml": failed to unmarshal yaml to ResourceMapping`,
+			expManifestUnchanged: true,
+		},
+		{
+			name: "fixed_file_revalidated",
+			fileDatas: map[string][]byte{
+				"file2.yaml": mapping("topic3"),
+			},
+			expOut: "processing file \"file1.yaml\"\nskipping unchanged file \"file1.yaml\"\n" +
+				"processing file \"file2.yaml\"\nValidation passed",
+		},
+		{
+			name:                 "changed_options_revalidate_all",
+			extraArgs:            []string{"-required-annotation-keys", "retention"},
+			expOut:               "processing file \"file1.yaml\"\nprocessing file \"file2.yaml\"",
+			expErr:               `file "file1.yaml": required annotation key "retention" is missing`,
+			expManifestUnchanged: true,
+		},
+	}
+
+	var prevManifest string
+	for _, step := range steps {
+		for name, data := range step.fileDatas {
+			writeFile(name, data)
+		}
+
+		var cmd MappingValidateCommand
+		_, stdout, _ := cmd.Pipe()
+
+		args := append([]string{"-path", dir, "-manifest", manifest, "-v"}, step.extraArgs...)
+		err := cmd.Run(ctx, args)
+		if diff := testutil.DiffErrString(err, step.expErr); diff != "" {
+			t.Fatalf("%s: %s", step.name, diff)
+		}
+		if diff := cmp.Diff(strings.TrimSpace(step.expOut), strings.TrimSpace(stdout.String())); diff != "" {
+			t.Errorf("%s: output: diff (-want, +got):\n%s", step.name, diff)
+		}
+
+		gotManifest := readManifest()
+		if step.expManifestUnchanged && gotManifest != prevManifest {
+			t.Errorf("%s: manifest got updated to %s, want unchanged %s", step.name, gotManifest, prevManifest)
+		}
+		prevManifest = gotManifest
+	}
+}
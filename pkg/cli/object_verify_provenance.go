@@ -0,0 +1,186 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+// requiredProvenanceKeys are the metadata keys the reusable workflow sets on
+// the uploaded objects.
+var requiredProvenanceKeys = []string{
+	server.MetadataKeyGitHubCommit,
+	server.MetadataKeyGitHubRepo,
+	server.MetadataKeyWorkflow,
+	server.MetadataKeyWorkflowSha,
+	server.MetadataKeyWorkflowTriggeredTimestamp,
+	server.MetadataKeyWorkflowRunID,
+	server.MetadataKeyWorkflowRunAttempt,
+}
+
+var (
+	gitSHARegexp    = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	githubRepoRegex = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+)
+
+var _ cli.Command = (*ObjectVerifyProvenanceCommand)(nil)
+
+// ObjectVerifyProvenanceCommand verifies the GitHub provenance metadata of a
+// GCS object uploaded by the reusable workflow.
+type ObjectVerifyProvenanceCommand struct {
+	cli.BaseCommand
+
+	flagBucket string
+	flagObject string
+
+	// testStorageClient is used to inject a fake GCS client in tests.
+	testStorageClient *storage.Client
+}
+
+func (c *ObjectVerifyProvenanceCommand) Desc() string {
+	return `Verify the GitHub provenance metadata of an uploaded GCS object`
+}
+
+func (c *ObjectVerifyProvenanceCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+  Verify the GitHub provenance metadata set by the reusable workflow on an
+  uploaded GCS object:
+
+      pmap object verify-provenance -bucket "my-bucket" -object "path/gh-prefix/dir/file.yaml"
+`
+}
+
+func (c *ObjectVerifyProvenanceCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+
+	// Command options
+	f := set.NewSection("COMMAND OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "bucket",
+		Target:  &c.flagBucket,
+		Example: "my-bucket",
+		Usage:   `The GCS bucket of the object.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "object",
+		Target:  &c.flagObject,
+		Example: "path/gh-prefix/dir/file.yaml",
+		Usage:   `The GCS object name.`,
+	})
+
+	return set
+}
+
+func (c *ObjectVerifyProvenanceCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	if c.flagBucket == "" {
+		return fmt.Errorf("bucket is required")
+	}
+	if c.flagObject == "" {
+		return fmt.Errorf("object is required")
+	}
+
+	client := c.testStorageClient
+	if client == nil {
+		var err error
+		client, err = storage.NewClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create the storage client: %w", err)
+		}
+		defer client.Close()
+	}
+
+	metadata, err := server.NewGCSObjectStore(client).ObjectMetadata(ctx, c.flagBucket, c.flagObject)
+	if err != nil {
+		return fmt.Errorf("failed to get object %q in bucket %q: %w", c.flagObject, c.flagBucket, err)
+	}
+
+	src, err := server.ParseGitHubSource(ctx, metadata, map[string]string{
+		"bucketId": c.flagBucket,
+		"objectId": c.flagObject,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to parse provenance: %w", err)
+	}
+
+	if err := verifyProvenance(metadata, src); err != nil {
+		return fmt.Errorf("invalid provenance for object %q: %w", c.flagObject, err)
+	}
+
+	c.Outf("Provenance verified: repo %q, commit %q, file %q",
+		src.GetRepoName(), src.GetCommit(), src.GetFilePath())
+	return nil
+}
+
+// verifyProvenance checks all required metadata keys are present and well
+// formed, and the parsed provenance includes the file path.
+func verifyProvenance(metadata map[string]string, src *v1alpha1.GitHubSource) (retErr error) {
+	for _, k := range requiredProvenanceKeys {
+		if metadata[k] == "" {
+			retErr = errors.Join(retErr, fmt.Errorf("missing metadata %q", k))
+		}
+	}
+	if retErr != nil {
+		return retErr
+	}
+
+	if v := metadata[server.MetadataKeyGitHubCommit]; !gitSHARegexp.MatchString(v) {
+		retErr = errors.Join(retErr, fmt.Errorf("metadata %q must be a 40 character git SHA, got %q", server.MetadataKeyGitHubCommit, v))
+	}
+	if v := metadata[server.MetadataKeyWorkflowSha]; !gitSHARegexp.MatchString(v) {
+		retErr = errors.Join(retErr, fmt.Errorf("metadata %q must be a 40 character git SHA, got %q", server.MetadataKeyWorkflowSha, v))
+	}
+	if v := metadata[server.MetadataKeyGitHubRepo]; !githubRepoRegex.MatchString(v) {
+		retErr = errors.Join(retErr, fmt.Errorf("metadata %q must be in the format owner/repo, got %q", server.MetadataKeyGitHubRepo, v))
+	}
+	if v := metadata[server.MetadataKeyWorkflowRunID]; !isPositiveInt(v) {
+		retErr = errors.Join(retErr, fmt.Errorf("metadata %q must be a positive integer, got %q", server.MetadataKeyWorkflowRunID, v))
+	}
+	if v := metadata[server.MetadataKeyWorkflowRunAttempt]; !isPositiveInt(v) {
+		retErr = errors.Join(retErr, fmt.Errorf("metadata %q must be a positive integer, got %q", server.MetadataKeyWorkflowRunAttempt, v))
+	}
+	if strings.TrimSpace(src.GetFilePath()) == "" {
+		retErr = errors.Join(retErr, fmt.Errorf("object name must contain %q followed by the file path", server.GCSPathSeparatorKey))
+	}
+	return retErr
+}
+
+func isPositiveInt(s string) bool {
+	i, err := strconv.ParseInt(s, 10, 64)
+	return err == nil && i > 0
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const (
+	testBucket = "test-bucket"
+	testObject = "mapping/gh-prefix/dir1/file.yaml"
+)
+
+func testProvenanceMetadata() map[string]string {
+	return map[string]string{
+		"github-commit":                       "0123456789abcdef0123456789abcdef01234567",
+		"github-repo":                         "abcxyz/pmap",
+		"github-workflow":                     "snapshot",
+		"github-workflow-sha":                 "89abcdef0123456789abcdef0123456789abcdef",
+		"github-workflow-triggered-timestamp": "2023-04-25T17:44:57+00:00",
+		"github-run-id":                       "5050509831",
+		"github-run-attempt":                  "1",
+	}
+}
+
+func TestObjectVerifyProvenanceCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	cases := []struct {
+		name     string
+		args     []string
+		metadata map[string]string
+		expOut   string
+		expErr   string
+	}{
+		{
+			name:   "unexpected_args",
+			args:   []string{"foo"},
+			expErr: `unexpected arguments: [foo]`,
+		},
+		{
+			name:   "missing_bucket",
+			args:   []string{"-object", testObject},
+			expErr: `bucket is required`,
+		},
+		{
+			name:   "missing_object",
+			args:   []string{"-bucket", testBucket},
+			expErr: `object is required`,
+		},
+		{
+			name:     "success",
+			args:     []string{"-bucket", testBucket, "-object", testObject},
+			metadata: testProvenanceMetadata(),
+			expOut:   `Provenance verified: repo "abcxyz/pmap", commit "0123456789abcdef0123456789abcdef01234567", file "dir1/file.yaml"`,
+		},
+		{
+			name:   "object_not_found",
+			args:   []string{"-bucket", testBucket, "-object", "mapping/gh-prefix/missing.yaml"},
+			expErr: `failed to get object "mapping/gh-prefix/missing.yaml" in bucket "test-bucket"`,
+		},
+		{
+			name: "missing_metadata",
+			args: []string{"-bucket", testBucket, "-object", testObject},
+			metadata: func() map[string]string {
+				m := testProvenanceMetadata()
+				delete(m, "github-run-id")
+				return m
+			}(),
+			expErr: `missing metadata "github-run-id"`,
+		},
+		{
+			name: "malformed_commit",
+			args: []string{"-bucket", testBucket, "-object", testObject},
+			metadata: func() map[string]string {
+				m := testProvenanceMetadata()
+				m["github-commit"] = "abc"
+				return m
+			}(),
+			expErr: `metadata "github-commit" must be a 40 character git SHA, got "abc"`,
+		},
+		{
+			name: "malformed_run_attempt",
+			args: []string{"-bucket", testBucket, "-object", testObject},
+			metadata: func() map[string]string {
+				m := testProvenanceMetadata()
+				m["github-run-attempt"] = "first"
+				return m
+			}(),
+			expErr: `metadata "github-run-attempt" must be a positive integer, got "first"`,
+		},
+		{
+			name: "malformed_timestamp",
+			args: []string{"-bucket", testBucket, "-object", testObject},
+			metadata: func() map[string]string {
+				m := testProvenanceMetadata()
+				m["github-workflow-triggered-timestamp"] = "yesterday"
+				return m
+			}(),
+			expErr: `failed to parse provenance: failed to parse date`,
+		},
+		{
+			name:     "missing_separator",
+			args:     []string{"-bucket", testBucket, "-object", "mapping/dir1/file.yaml"},
+			metadata: testProvenanceMetadata(),
+			expErr:   `object name must contain "/gh-prefix/" followed by the file path`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			objects := map[string]*fakeObject{}
+			if tc.metadata != nil {
+				for _, arg := range tc.args {
+					if strings.HasPrefix(arg, "mapping/") {
+						objects[arg] = &fakeObject{metadata: maps.Clone(tc.metadata)}
+					}
+				}
+			}
+
+			cmd := ObjectVerifyProvenanceCommand{
+				testStorageClient: newFakeStorageClient(t, objects),
+			}
+			_, stdout, _ := cmd.Pipe()
+
+			err := cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(strings.TrimSpace(tc.expOut), strings.TrimSpace(stdout.String())); diff != "" {
+				t.Errorf("output: diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// fakeObject is a GCS object served by newFakeStorageClient.
+type fakeObject struct {
+	metadata map[string]string
+	data     []byte
+}
+
+// newFakeStorageClient creates a GCS client backed by a fake server serving
+// the given objects in testBucket.
+func newFakeStorageClient(tb testing.TB, objects map[string]*fakeObject) *storage.Client {
+	tb.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Objects are listed and object attrs are read with the JSON API, and
+		// object data is read with the XML API.
+		if r.URL.Path == "/b/"+testBucket+"/o" {
+			prefix := r.URL.Query().Get("prefix")
+			items := []map[string]any{}
+			for _, name := range slices.Sorted(maps.Keys(objects)) {
+				if strings.HasPrefix(name, prefix) {
+					items = append(items, map[string]any{"bucket": testBucket, "name": name})
+				}
+			}
+			if err := json.NewEncoder(w).Encode(map[string]any{"items": items}); err != nil {
+				tb.Errorf("failed to write object list: %v", err)
+			}
+			return
+		}
+		if name, ok := strings.CutPrefix(r.URL.Path, "/b/"+testBucket+"/o/"); ok {
+			obj, found := objects[name]
+			if !found {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			if err := json.NewEncoder(w).Encode(map[string]any{
+				"bucket":   testBucket,
+				"name":     name,
+				"metadata": obj.metadata,
+			}); err != nil {
+				tb.Errorf("failed to write object attrs: %v", err)
+			}
+			return
+		}
+
+		name, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+		obj, found := objects[name]
+		if !ok || !found {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if _, err := w.Write(obj.data); err != nil {
+			tb.Errorf("failed to write object data: %v", err)
+		}
+	}))
+	tb.Cleanup(ts.Close)
+
+	client, err := storage.NewClient(context.Background(),
+		option.WithEndpoint(ts.URL),
+		option.WithoutAuthentication())
+	if err != nil {
+		tb.Fatalf("failed to create storage client: %v", err)
+	}
+	tb.Cleanup(func() { client.Close() })
+	return client
+}
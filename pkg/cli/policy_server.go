@@ -27,6 +27,7 @@ import (
 	"github.com/abcxyz/pkg/multicloser"
 	"github.com/abcxyz/pkg/serving"
 	"github.com/abcxyz/pmap/internal/version"
+	"github.com/abcxyz/pmap/pkg/policy/processors"
 	"github.com/abcxyz/pmap/pkg/server"
 )
 
@@ -92,22 +93,39 @@ func (c *PolicyServerCommand) RunUnstarted(ctx context.Context, args []string) (
 	if err := c.cfg.Validate(); err != nil {
 		return nil, nil, closer, fmt.Errorf("invalid configuration: %w", err)
 	}
-	logger.DebugContext(ctx, "loaded configuration", "config", c.cfg)
+	logger.InfoContext(ctx, "loaded configuration", "config", c.cfg)
+
+	// The Pub/Sub client is left nil when the events are written to stdout
+	// or a local file.
+	var pubsubClient *pubsub.Client
+	if c.cfg.UsesPubSub() {
+		var err error
+		pubsubClient, err = pubsub.NewClient(ctx, c.cfg.ProjectID)
+		if err != nil {
+			return nil, nil, closer, fmt.Errorf("failed to create pubsub client: %w", err)
+		}
+		closer = multicloser.Append(closer, pubsubClient.Close)
+	}
 
-	pubsubClient, err := pubsub.NewClient(ctx, c.cfg.ProjectID)
+	successMessenger, opts, messengersCloser, err := newHandlerMessengers(ctx, c.cfg, pubsubClient)
+	closer = multicloser.Append(closer, messengersCloser.Close)
 	if err != nil {
-		return nil, nil, closer, fmt.Errorf("failed to create pubsub client: %w", err)
+		return nil, nil, closer, err
 	}
-	closer = multicloser.Append(closer, pubsubClient.Close)
-
-	successTopic := pubsubClient.Topic(c.cfg.SuccessTopicID)
-	successMessenger := server.NewPubSubMessenger(successTopic)
-	closer = multicloser.Append(closer, successTopic.Stop)
+	cfgOpts, err := handlerOptions(ctx, c.cfg)
+	if err != nil {
+		return nil, nil, closer, err
+	}
+	opts = append(opts, cfgOpts...)
 
-	handler, err := server.NewHandler(ctx, []server.Processor[*structpb.Struct]{}, successMessenger)
+	handler, err := server.NewHandler(ctx,
+		[]server.Processor[*structpb.Struct]{processors.NewPolicyValidationProcessor()},
+		successMessenger,
+		opts...)
 	if err != nil {
 		return nil, nil, closer, fmt.Errorf("server.NewHandler: %w", err)
 	}
+	closer = multicloser.Append(closer, handler.Cleanup)
 
 	srv, err := serving.New(c.cfg.Port)
 	if err != nil {
@@ -0,0 +1,43 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadResidencies loads the residency file which maps residencies to the
+// resource locations they cover:
+//
+//	EU:
+//	  - europe
+//	  - eu
+//	US:
+//	  - us
+//	  - northamerica
+func loadResidencies(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read residency file %q: %w", path, err)
+	}
+	var residencies map[string][]string
+	if err := yaml.Unmarshal(data, &residencies); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal residency file %q: %w", path, err)
+	}
+	return residencies, nil
+}
@@ -28,20 +28,60 @@ var rootCmd = func() cli.Command {
 		Name:    "pmap",
 		Version: version.HumanVersion,
 		Commands: map[string]cli.CommandFactory{
+			"event": func() cli.Command {
+				return &cli.RootCommand{
+					Name:        "event",
+					Description: "Perform operations related to the emitted events",
+					Commands: map[string]cli.CommandFactory{
+						"show": func() cli.Command {
+							return &EventShowCommand{}
+						},
+					},
+				}
+			},
 			"mapping": func() cli.Command {
 				return &cli.RootCommand{
 					Name:        "mapping",
 					Description: "Perform operations related to the resource mapping",
 					Commands: map[string]cli.CommandFactory{
+						"audit-bucket": func() cli.Command {
+							return &MappingAuditBucketCommand{}
+						},
+						"check-duplicates": func() cli.Command {
+							return &MappingCheckDuplicatesCommand{}
+						},
+						"coverage": func() cli.Command {
+							return &MappingCoverageCommand{}
+						},
+						"fmt": func() cli.Command {
+							return &MappingFmtCommand{}
+						},
+						"replay": func() cli.Command {
+							return &MappingReplayCommand{}
+						},
 						"server": func() cli.Command {
 							return &MappingServerCommand{}
 						},
+						"simulate": func() cli.Command {
+							return &MappingSimulateCommand{}
+						},
 						"validate": func() cli.Command {
 							return &MappingValidateCommand{}
 						},
 					},
 				}
 			},
+			"object": func() cli.Command {
+				return &cli.RootCommand{
+					Name:        "object",
+					Description: "Perform operations related to the uploaded GCS objects",
+					Commands: map[string]cli.CommandFactory{
+						"verify-provenance": func() cli.Command {
+							return &ObjectVerifyProvenanceCommand{}
+						},
+					},
+				}
+			},
 			"policy": func() cli.Command {
 				return &cli.RootCommand{
 					Name:        "policy",
@@ -53,6 +93,17 @@ var rootCmd = func() cli.Command {
 					},
 				}
 			},
+			"schema": func() cli.Command {
+				return &cli.RootCommand{
+					Name:        "schema",
+					Description: "Perform operations related to the pmap contracts",
+					Commands: map[string]cli.CommandFactory{
+						"descriptor": func() cli.Command {
+							return &SchemaDescriptorCommand{}
+						},
+					},
+				}
+			},
 		},
 	}
 }
@@ -25,8 +25,11 @@ func TestRootCommand_Help(t *testing.T) {
 	exp := `
 Usage: pmap COMMAND
 
+  event      Perform operations related to the emitted events
   mapping    Perform operations related to the resource mapping
+  object     Perform operations related to the uploaded GCS objects
   policy     Perform operations related to the policies
+  schema     Perform operations related to the pmap contracts
 `
 
 	cmd := rootCmd()
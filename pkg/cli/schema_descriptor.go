@@ -0,0 +1,127 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+var _ cli.Command = (*SchemaDescriptorCommand)(nil)
+
+// SchemaDescriptorCommand writes the FileDescriptorSet of the v1alpha1
+// contracts, for consumers generating code in other languages.
+type SchemaDescriptorCommand struct {
+	cli.BaseCommand
+
+	flagOutput string
+}
+
+func (c *SchemaDescriptorCommand) Desc() string {
+	return `Write the serialized proto FileDescriptorSet of the pmap contracts`
+}
+
+func (c *SchemaDescriptorCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+  Write the serialized proto FileDescriptorSet of the v1alpha1 contracts,
+  including their imports, to stdout:
+
+      pmap schema descriptor > pmap.binpb
+
+  Write it to a file:
+
+      pmap schema descriptor -output "/path/to/pmap.binpb"
+`
+}
+
+func (c *SchemaDescriptorCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+
+	// Command options
+	f := set.NewSection("COMMAND OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Target:  &c.flagOutput,
+		Example: "/path/to/pmap.binpb",
+		Usage:   `The file to write the descriptor set to, it's written to stdout if unset.`,
+	})
+
+	return set
+}
+
+func (c *SchemaDescriptorCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	set := fileDescriptorSet(v1alpha1.File_pmap_event_proto, v1alpha1.File_resource_mapping_proto)
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("failed to marshal descriptor set: %w", err)
+	}
+
+	if c.flagOutput == "" {
+		if _, err := c.Stdout().Write(b); err != nil {
+			return fmt.Errorf("failed to write descriptor set: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(c.flagOutput, b, 0o600); err != nil {
+		return fmt.Errorf("failed to write descriptor set to %q: %w", c.flagOutput, err)
+	}
+	return nil
+}
+
+// fileDescriptorSet returns the descriptor set of the files and their
+// transitive imports, every file is listed after its imports like protoc
+// --include_imports does.
+func fileDescriptorSet(files ...protoreflect.FileDescriptor) *descriptorpb.FileDescriptorSet {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, fd := range files {
+		add(fd)
+	}
+	return set
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestSchemaDescriptorCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	td := t.TempDir()
+
+	cases := []struct {
+		name   string
+		args   []string
+		output string
+		expErr string
+	}{
+		{
+			name:   "unexpected_args",
+			args:   []string{"foo"},
+			expErr: `unexpected arguments: [foo]`,
+		},
+		{
+			name: "stdout",
+		},
+		{
+			name:   "output_file",
+			args:   []string{"-output", filepath.Join(td, "pmap.binpb")},
+			output: filepath.Join(td, "pmap.binpb"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd SchemaDescriptorCommand
+			_, stdout, _ := cmd.Pipe()
+
+			err := cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			b := stdout.Bytes()
+			if tc.output != "" {
+				if len(b) != 0 {
+					t.Errorf("Run got unexpected stdout when writing to a file: %q", b)
+				}
+				b, err = os.ReadFile(tc.output)
+				if err != nil {
+					t.Fatalf("failed to read output: %v", err)
+				}
+			}
+
+			var set descriptorpb.FileDescriptorSet
+			if err := proto.Unmarshal(b, &set); err != nil {
+				t.Fatalf("failed to unmarshal descriptor set: %v", err)
+			}
+			// The set is self-contained, every import is included.
+			files, err := protodesc.NewFiles(&set)
+			if err != nil {
+				t.Fatalf("failed to build files from descriptor set: %v", err)
+			}
+			for _, name := range []protoreflect.FullName{
+				"abcxyz.pmap.PmapEvent",
+				"abcxyz.pmap.GitHubSource",
+				"abcxyz.pmap.ResourceMapping",
+				"abcxyz.pmap.Resource",
+				"abcxyz.pmap.Contacts",
+			} {
+				d, err := files.FindDescriptorByName(name)
+				if err != nil {
+					t.Errorf("descriptor set has no message %q: %v", name, err)
+					continue
+				}
+				if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+					t.Errorf("descriptor %q got %T, want a message", name, d)
+				}
+			}
+		})
+	}
+}
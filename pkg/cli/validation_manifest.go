@@ -0,0 +1,76 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// validationManifest records the hashes of the resource mapping files of a
+// successful validation, so the files unchanged since are skipped by the
+// following validations.
+type validationManifest struct {
+	// Options fingerprints the validation options, the files are validated
+	// again when the options change.
+	Options string `json:"options"`
+
+	// Files are the hex encoded SHA-256 hashes of the files keyed by their
+	// path relative to the validated directory.
+	Files map[string]string `json:"files"`
+}
+
+// loadValidationManifest reads the manifest at path, an empty manifest is
+// returned if the file doesn't exist yet.
+func loadValidationManifest(path string) (*validationManifest, error) {
+	m := &validationManifest{Files: make(map[string]string)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %q: %w", path, err)
+	}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %q: %w", path, err)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]string)
+	}
+	return m, nil
+}
+
+// write writes the manifest to path, replacing the previous manifest.
+func (m *validationManifest) write(path string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write manifest %q: %w", path, err)
+	}
+	return nil
+}
+
+// manifestHash returns the hash of the file data recorded in the manifest.
+func manifestHash(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestLoadValidationManifest(t *testing.T) {
+	t.Parallel()
+
+	td := t.TempDir()
+
+	cases := []struct {
+		name     string
+		fileData []byte
+		want     *validationManifest
+		wantErr  string
+	}{
+		{
+			name: "missing_file",
+			want: &validationManifest{Files: map[string]string{}},
+		},
+		{
+			name:     "valid_manifest",
+			fileData: []byte(`{"options": "online=false", "files": {"file1.yaml": "abc"}}`),
+			want: &validationManifest{
+				Options: "online=false",
+				Files:   map[string]string{"file1.yaml": "abc"},
+			},
+		},
+		{
+			name:     "no_files",
+			fileData: []byte(`{"options": "online=false"}`),
+			want:     &validationManifest{Options: "online=false", Files: map[string]string{}},
+		},
+		{
+			name:     "invalid_json",
+			fileData: []byte(`foo`),
+			wantErr:  "failed to parse manifest",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(td, tc.name+".json")
+			if tc.fileData != nil {
+				if err := os.WriteFile(path, tc.fileData, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := loadValidationManifest(path)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("loadValidationManifest got diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestValidationManifest_Write(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	want := &validationManifest{
+		Options: "online=false",
+		Files:   map[string]string{"file1.yaml": manifestHash([]byte("foo"))},
+	}
+	if err := want.write(path); err != nil {
+		t.Fatalf("write got unexpected error: %v", err)
+	}
+
+	got, err := loadValidationManifest(path)
+	if err != nil {
+		t.Fatalf("loadValidationManifest got unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("loadValidationManifest got diff (-want, +got): %v", diff)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+// AnnotationKeyCasingProcessorName is the name of the
+// AnnotationKeyCasingProcessor.
+const AnnotationKeyCasingProcessorName = "AnnotationKeyCasingProcessor"
+
+// AnnotationKeyCasingProcessor enforces the casing of the annotation keys, so
+// queries don't need to match keys like "Env" and "env". Non-canonical keys
+// are either rejected or rewritten to their canonical form.
+type AnnotationKeyCasingProcessor struct {
+	casing  v1alpha1.KeyCasing
+	rewrite bool
+}
+
+// NewAnnotationKeyCasingProcessor creates a new AnnotationKeyCasingProcessor
+// with the casing. Non-canonical keys are rewritten when rewrite is true and
+// rejected otherwise.
+func NewAnnotationKeyCasingProcessor(casing v1alpha1.KeyCasing, rewrite bool) (*AnnotationKeyCasingProcessor, error) {
+	if _, err := casing.Canonical(""); err != nil {
+		return nil, fmt.Errorf("invalid annotation key casing: %w", err)
+	}
+	return &AnnotationKeyCasingProcessor{casing: casing, rewrite: rewrite}, nil
+}
+
+// Name returns the name of the processor other processors can depend on.
+func (p *AnnotationKeyCasingProcessor) Name() string {
+	return AnnotationKeyCasingProcessorName
+}
+
+// Process rejects or rewrites the non-canonical annotation keys. A user facing
+// error is returned when rewriting would merge keys, e.g. "Env" and "env".
+func (p *AnnotationKeyCasingProcessor) Process(ctx context.Context, resourceMapping *v1alpha1.ResourceMapping) error {
+	l := server.PayloadLock(ctx)
+	l.Lock()
+	defer l.Unlock()
+
+	if !p.rewrite {
+		if err := v1alpha1.AnnotationKeyCasing(p.casing)(resourceMapping); err != nil {
+			return pmaperrors.New("annotation keys violate the casing: %v", err)
+		}
+		return nil
+	}
+
+	fields := resourceMapping.GetAnnotations().GetFields()
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// Keys are visited in order so the reported conflict is deterministic.
+	origKeys := make(map[string]string, len(fields))
+	rewritten := make(map[string]*structpb.Value, len(fields))
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		canonical, err := p.casing.Canonical(k)
+		if err != nil {
+			return fmt.Errorf("failed to canonicalize annotation key %q: %w", k, err)
+		}
+		if orig, ok := origKeys[canonical]; ok {
+			return pmaperrors.New("annotation keys %q and %q are both %q in %s", orig, k, canonical, p.casing)
+		}
+		origKeys[canonical] = k
+		rewritten[canonical] = fields[k]
+	}
+	resourceMapping.Annotations.Fields = rewritten
+	return nil
+}
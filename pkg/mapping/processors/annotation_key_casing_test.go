@@ -0,0 +1,149 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+)
+
+func TestAnnotationKeyCasingProcessor_Process(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name            string
+		casing          v1alpha1.KeyCasing
+		rewrite         bool
+		annotations     map[string]any
+		wantAnnotations map[string]any
+		wantErr         string
+	}{
+		{
+			name:   "reject_canonical_keys",
+			casing: v1alpha1.KeyCasingLowerCamel,
+			annotations: map[string]any{
+				"env":                "prod",
+				"dataClassification": "internal",
+			},
+			wantAnnotations: map[string]any{
+				"env":                "prod",
+				"dataClassification": "internal",
+			},
+		},
+		{
+			name:   "reject_non_canonical_keys",
+			casing: v1alpha1.KeyCasingLowerCamel,
+			annotations: map[string]any{
+				"Env":                 "prod",
+				"data_classification": "internal",
+			},
+			wantAnnotations: map[string]any{
+				"Env":                 "prod",
+				"data_classification": "internal",
+			},
+			wantErr: `annotation key "Env" is not lowerCamel, want "env"` + "\n" +
+				`annotation key "data_classification" is not lowerCamel, want "dataClassification"`,
+		},
+		{
+			name:    "rewrite_non_canonical_keys",
+			casing:  v1alpha1.KeyCasingLowerCamel,
+			rewrite: true,
+			annotations: map[string]any{
+				"Env":                 "prod",
+				"data_classification": "internal",
+				"location":            map[string]any{"Region": "us"},
+			},
+			wantAnnotations: map[string]any{
+				"env":                "prod",
+				"dataClassification": "internal",
+				"location":           map[string]any{"Region": "us"},
+			},
+		},
+		{
+			name:    "rewrite_to_snake",
+			casing:  v1alpha1.KeyCasingSnake,
+			rewrite: true,
+			annotations: map[string]any{
+				"dataClassification": "internal",
+			},
+			wantAnnotations: map[string]any{
+				"data_classification": "internal",
+			},
+		},
+		{
+			name:    "rewrite_conflicting_keys",
+			casing:  v1alpha1.KeyCasingLowerCamel,
+			rewrite: true,
+			annotations: map[string]any{
+				"Env": "prod",
+				"env": "dev",
+			},
+			wantAnnotations: map[string]any{
+				"Env": "prod",
+				"env": "dev",
+			},
+			wantErr: `annotation keys "Env" and "env" are both "env" in lowerCamel`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := NewAnnotationKeyCasingProcessor(tc.casing, tc.rewrite)
+			if err != nil {
+				t.Fatalf("failed to create AnnotationKeyCasingProcessor: %v", err)
+			}
+			annotations, err := structpb.NewStruct(tc.annotations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := &v1alpha1.ResourceMapping{
+				Resource:    &v1alpha1.Resource{Provider: "gcp", Name: "//storage.googleapis.com/test-bucket"},
+				Annotations: annotations,
+			}
+
+			err = p.Process(context.Background(), m)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil && !pmaperrors.Is(err) {
+				t.Errorf("Process got error %v, want a pmaperrors error", err)
+			}
+			if diff := cmp.Diff(tc.wantAnnotations, m.GetAnnotations().AsMap()); diff != "" {
+				t.Errorf("Process got unexpected annotations (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewAnnotationKeyCasingProcessor(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewAnnotationKeyCasingProcessor(v1alpha1.KeyCasingSnake, false); err != nil {
+		t.Errorf("NewAnnotationKeyCasingProcessor got unexpected error: %v", err)
+	}
+	_, err := NewAnnotationKeyCasingProcessor("kebab", true)
+	if diff := testutil.DiffErrString(err, `invalid annotation key casing: unknown key casing "kebab"`); diff != "" {
+		t.Error(diff)
+	}
+}
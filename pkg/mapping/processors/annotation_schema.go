@@ -0,0 +1,154 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+// AnnotationSchemaProcessorName is the name of the AnnotationSchemaProcessor.
+const AnnotationSchemaProcessorName = "AnnotationSchemaProcessor"
+
+// annotationValidatorNames are the processors validating the user annotations,
+// the processors injecting annotations run after them.
+var annotationValidatorNames = []string{AnnotationKeyCasingProcessorName, AnnotationSchemaProcessorName}
+
+// AnnotationConstraint constrains the value of an annotation, the value must
+// satisfy all the set constraints. Strings, numbers and booleans are compared
+// by their string form, e.g. "30" or "true".
+type AnnotationConstraint struct {
+	// Enum are the allowed values, any value is allowed when it's empty.
+	Enum []string `yaml:"enum"`
+
+	// Pattern is the regular expression the whole value must match, any value
+	// is allowed when it's empty.
+	Pattern string `yaml:"pattern"`
+}
+
+// AnnotationSchemaProcessor validates the values of the annotations with
+// constraints, e.g. that "dataClassification" is one of the classifications
+// of the organization. Annotations without constraints and missing
+// annotations are not validated.
+type AnnotationSchemaProcessor struct {
+	constraints map[string]*annotationConstraint
+}
+
+// annotationConstraint is the compiled AnnotationConstraint.
+type annotationConstraint struct {
+	enum []string
+	// pattern is anchored to match the whole value, rawPattern is the
+	// configured pattern reported in errors.
+	pattern    *regexp.Regexp
+	rawPattern string
+}
+
+// NewAnnotationSchemaProcessor creates a new AnnotationSchemaProcessor with the
+// constraints keyed by annotation key.
+func NewAnnotationSchemaProcessor(constraints map[string]AnnotationConstraint) (*AnnotationSchemaProcessor, error) {
+	p := &AnnotationSchemaProcessor{constraints: make(map[string]*annotationConstraint, len(constraints))}
+	for k, c := range constraints {
+		if k == "" {
+			return nil, fmt.Errorf("annotation key cannot be empty")
+		}
+		compiled := &annotationConstraint{enum: slices.Clone(c.Enum)}
+		if c.Pattern != "" {
+			re, err := regexp.Compile(`^(?:` + c.Pattern + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern of annotation %q: %w", k, err)
+			}
+			compiled.pattern, compiled.rawPattern = re, c.Pattern
+		}
+		p.constraints[k] = compiled
+	}
+	return p, nil
+}
+
+// Name returns the name of the processor other processors can depend on.
+func (p *AnnotationSchemaProcessor) Name() string {
+	return AnnotationSchemaProcessorName
+}
+
+// RunsAfter returns the processors which must run before when they're
+// configured, the keys are validated once rewritten to their casing.
+func (p *AnnotationSchemaProcessor) RunsAfter() []string {
+	return []string{AnnotationKeyCasingProcessorName}
+}
+
+// Process returns a user facing error listing the annotations whose values
+// violate their constraints.
+func (p *AnnotationSchemaProcessor) Process(ctx context.Context, resourceMapping *v1alpha1.ResourceMapping) error {
+	l := server.PayloadLock(ctx)
+	l.Lock()
+	defer l.Unlock()
+
+	fields := resourceMapping.GetAnnotations().GetFields()
+
+	var merr error
+	for _, k := range slices.Sorted(maps.Keys(p.constraints)) {
+		v, ok := fields[k]
+		if !ok {
+			continue
+		}
+		if err := p.constraints[k].validate(v); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("annotation %q: %w", k, err))
+		}
+	}
+	if merr != nil {
+		return pmaperrors.New("annotations violate the schema: %v", merr)
+	}
+	return nil
+}
+
+// validate checks the value satisfies the constraint.
+func (c *annotationConstraint) validate(v *structpb.Value) error {
+	s, ok := scalarString(v)
+	if !ok {
+		return fmt.Errorf("value must be a string, number or boolean")
+	}
+	if len(c.enum) > 0 && !slices.Contains(c.enum, s) {
+		return fmt.Errorf("value %q is not one of %q", s, c.enum)
+	}
+	if c.pattern != nil && !c.pattern.MatchString(s) {
+		return fmt.Errorf("value %q does not match pattern %q", s, c.rawPattern)
+	}
+	return nil
+}
+
+// scalarString returns the string form of the scalar value, ok is false for
+// nulls, lists and structs.
+func scalarString(v *structpb.Value) (string, bool) {
+	switch k := v.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		return k.StringValue, true
+	case *structpb.Value_NumberValue:
+		return strconv.FormatFloat(k.NumberValue, 'f', -1, 64), true
+	case *structpb.Value_BoolValue:
+		return strconv.FormatBool(k.BoolValue), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+)
+
+func TestAnnotationSchemaProcessor_Process(t *testing.T) {
+	t.Parallel()
+
+	constraints := map[string]AnnotationConstraint{
+		"dataClassification": {Enum: []string{"public", "internal", "confidential"}},
+		"owner":              {Pattern: `team-[a-z]+`},
+		"retentionDays":      {Enum: []string{"30", "90"}},
+	}
+
+	cases := []struct {
+		name        string
+		annotations map[string]any
+		wantErr     string
+	}{
+		{
+			name: "enum_passing",
+			annotations: map[string]any{
+				"dataClassification": "internal",
+			},
+		},
+		{
+			name: "enum_failing",
+			annotations: map[string]any{
+				"dataClassification": "secret",
+			},
+			wantErr: `annotation "dataClassification": value "secret" is not one of ["public" "internal" "confidential"]`,
+		},
+		{
+			name: "number_enum_passing",
+			annotations: map[string]any{
+				"retentionDays": 30,
+			},
+		},
+		{
+			name: "pattern_passing",
+			annotations: map[string]any{
+				"owner": "team-pmap",
+			},
+		},
+		{
+			name: "pattern_not_fully_matched",
+			annotations: map[string]any{
+				"owner": "team-pmap-2",
+			},
+			wantErr: `annotation "owner": value "team-pmap-2" does not match pattern "team-[a-z]+"`,
+		},
+		{
+			name: "non_scalar_value",
+			annotations: map[string]any{
+				"dataClassification": []any{"public"},
+			},
+			wantErr: `annotation "dataClassification": value must be a string, number or boolean`,
+		},
+		{
+			name: "unconstrained_and_missing_annotations",
+			annotations: map[string]any{
+				"location": "us",
+			},
+		},
+		{
+			name: "multiple_violations",
+			annotations: map[string]any{
+				"dataClassification": "secret",
+				"owner":              "pmap",
+			},
+			wantErr: `annotation "dataClassification": value "secret" is not one of ["public" "internal" "confidential"]` + "\n" +
+				`annotation "owner": value "pmap" does not match pattern "team-[a-z]+"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := NewAnnotationSchemaProcessor(constraints)
+			if err != nil {
+				t.Fatalf("failed to create AnnotationSchemaProcessor: %v", err)
+			}
+			annotations, err := structpb.NewStruct(tc.annotations)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = p.Process(context.Background(), &v1alpha1.ResourceMapping{
+				Resource:    &v1alpha1.Resource{Provider: "gcp", Name: "//storage.googleapis.com/test-bucket"},
+				Annotations: annotations,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil && !pmaperrors.Is(err) {
+				t.Errorf("Process got error %v, want a pmaperrors error", err)
+			}
+		})
+	}
+}
+
+func TestNewAnnotationSchemaProcessor(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		constraints map[string]AnnotationConstraint
+		wantErr     string
+	}{
+		{
+			name:        "valid",
+			constraints: map[string]AnnotationConstraint{"owner": {Pattern: `team-[a-z]+`}},
+		},
+		{
+			name:        "empty_key",
+			constraints: map[string]AnnotationConstraint{"": {Enum: []string{"public"}}},
+			wantErr:     "annotation key cannot be empty",
+		},
+		{
+			name:        "invalid_pattern",
+			constraints: map[string]AnnotationConstraint{"owner": {Pattern: `team-[`}},
+			wantErr:     `invalid pattern of annotation "owner"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewAnnotationSchemaProcessor(tc.constraints)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -19,25 +19,43 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	asset "cloud.google.com/go/asset/apiv1"
 	"cloud.google.com/go/asset/apiv1/assetpb"
 	"google.golang.org/api/iterator"
 	v1 "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // "cloud.google.com/go/asset/apiv1" still uses v1.Policy(deprecated).
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/protoutil"
 	"github.com/abcxyz/pmap/apis/v1alpha1"
 	"github.com/abcxyz/pmap/pkg/pmaperrors"
+	"github.com/abcxyz/pmap/pkg/server"
 )
 
 const (
 	gcpProvider = "gcp"
 	pageSize    = 3
+
+	// listPageSize is the page size of listing all resources in a scope, which
+	// is the maximum Asset Inventory allows.
+	listPageSize = 500
 )
 
+// AssetInventoryProcessorName is the name of the AssetInventoryProcessor.
+const AssetInventoryProcessorName = "AssetInventoryProcessor"
+
+var _ server.StoppableProcessor[*v1alpha1.ResourceMapping] = (*AssetInventoryProcessor)(nil)
+
 // AssetInventoryProcessor is the Cloud Asset Inventory validation and enrichment processor.
 type AssetInventoryProcessor struct {
 	// defaultResourceScope is used when there is no project found in the ResourceMapping.Resource.Name
@@ -45,11 +63,209 @@ type AssetInventoryProcessor struct {
 	// See format and example here: https://cloud.google.com/asset-inventory/docs/reference/rest/v1/TopLevel/searchAllResources#path-parameters
 	defaultResourceScope string
 	client               *asset.Client
+
+	// additionalResourceScopes are searched in order after the
+	// defaultResourceScope when the resource is not found in it.
+	additionalResourceScopes []string
+
+	// reservedAnnotationPrefix namespaces the annotations injected by the
+	// processor, e.g. "sys." results in "sys.assetInfo".
+	reservedAnnotationPrefix string
+
+	// iamSearchNonFatal keeps the resource derived annotations when the IAM
+	// policies search fails.
+	iamSearchNonFatal bool
+
+	// bestEffortVerification marks the resources not found in Asset
+	// Inventory as unverified instead of failing the processing.
+	bestEffortVerification bool
+
+	// maxIAMPolicies caps the number of IAM policies annotated, 0 means no
+	// limit.
+	maxIAMPolicies int
+
+	// requestStats attaches the Asset Inventory search round-trips and the
+	// elapsed time to the injected annotations.
+	requestStats bool
+
+	// ancestorNameResolver resolves the ancestors display names, nil disables
+	// the "ancestorNames" annotation.
+	ancestorNameResolver AncestorNameResolver
+
+	// allowedServices are the service hosts resources are allowed to belong
+	// to, all services are allowed when it's empty.
+	allowedServices []string
+
+	// sharedClient leaves the client open on Stop as it's owned by the
+	// caller.
+	sharedClient bool
+
+	// stopCtx is canceled by Stop to cancel the in-flight searches.
+	stopCtx  context.Context //nolint:containedctx // Canceled on Stop.
+	stop     context.CancelFunc
+	stopOnce sync.Once
+	stopErr  error
 }
 
+// AncestorNameResolver resolves an ancestor such as "folders/123" to its
+// display name.
+type AncestorNameResolver interface {
+	ResolveName(ctx context.Context, ancestor string) (string, error)
+}
+
+// AnnotationKeySubscope is the annotation key of the normalized subscope of
+// the resource, so enriched mappings of sub-resources of the same resource are
+// distinguishable. It's injected under the reserved annotation prefix.
+const AnnotationKeySubscope = "subscope"
+
+// AnnotationKeyService is the annotation key of the service host of the
+// resource name, e.g. "storage.googleapis.com", so mappings of the same
+// provider are distinguishable by service. It's injected under the reserved
+// annotation prefix.
+const AnnotationKeyService = "service"
+
+// AnnotationKeyAliases is the annotation key of the prior names of the
+// resource, so the history of a renamed resource can be followed by querying
+// the annotation for its prior names. It's injected under the reserved
+// annotation prefix when the resource has aliases.
+const AnnotationKeyAliases = "aliases"
+
+// AnnotationKeyAssetVerified is the annotation key marking that the resource
+// wasn't found in Asset Inventory in best-effort verification mode, it's set
+// to false instead of the "assetInfo" annotation. It's injected under the
+// reserved annotation prefix.
+const AnnotationKeyAssetVerified = "assetVerified"
+
+// AnnotationKeyIAMPoliciesUnavailable is the Asset Inventory annotation key
+// marking that the IAM policies are omitted because the search failed.
+const AnnotationKeyIAMPoliciesUnavailable = "iamPoliciesUnavailable"
+
+// AnnotationKeyIAMPoliciesTruncated is the Asset Inventory annotation key
+// marking that the IAM policies beyond the limit are omitted, see
+// [WithMaxIAMPolicies].
+const AnnotationKeyIAMPoliciesTruncated = "iamPoliciesTruncated"
+
+const (
+	// AnnotationKeySearchRequests is the Asset Inventory annotation key of the
+	// number of search RPC round-trips, resource and IAM policy pages included.
+	AnnotationKeySearchRequests = "searchRequests"
+
+	// AnnotationKeySearchDuration is the Asset Inventory annotation key of the
+	// time spent validating and enriching the resource, e.g. "1.5s".
+	AnnotationKeySearchDuration = "searchDuration"
+)
+
 // Option is the option to set up a AssetInventoryProcessor.
 type Option func(p *AssetInventoryProcessor) (*AssetInventoryProcessor, error)
 
+// WithReservedAnnotationPrefix injects the Asset Inventory annotations under
+// the given reserved prefix so they can't collide with user annotations.
+func WithReservedAnnotationPrefix(prefix string) Option {
+	return func(p *AssetInventoryProcessor) (*AssetInventoryProcessor, error) {
+		p.reservedAnnotationPrefix = prefix
+		return p, nil
+	}
+}
+
+// WithAdditionalResourceScopes sets the resource scopes searched in order
+// when the resource is not found in the default resource scope, for resources
+// that could live in one of several projects, folders or organizations. The
+// first scope with a matching resource is used.
+func WithAdditionalResourceScopes(scopes ...string) Option {
+	return func(p *AssetInventoryProcessor) (*AssetInventoryProcessor, error) {
+		for _, s := range scopes {
+			if err := validateScope(s); err != nil {
+				return nil, err
+			}
+		}
+		p.additionalResourceScopes = scopes
+		return p, nil
+	}
+}
+
+// WithNonFatalIAMSearch treats IAM policies search failures as non-fatal. The
+// resource derived annotations are kept, "iamPolicies" is omitted and the
+// "iamPoliciesUnavailable" annotation is set instead. By default any IAM
+// policies search failure fails the processing.
+func WithNonFatalIAMSearch() Option {
+	return func(p *AssetInventoryProcessor) (*AssetInventoryProcessor, error) {
+		p.iamSearchNonFatal = true
+		return p, nil
+	}
+}
+
+// WithMaxIAMPolicies caps the number of IAM policies annotated, so the
+// events of resources with a huge number of policies stay publishable. The
+// search stops at the limit, the policies beyond it are omitted and the
+// "iamPoliciesTruncated" annotation is set. 0 means no limit, which is the
+// default.
+func WithMaxIAMPolicies(n int) Option {
+	return func(p *AssetInventoryProcessor) (*AssetInventoryProcessor, error) {
+		if n < 0 {
+			return nil, fmt.Errorf("max IAM policies cannot be negative: %d", n)
+		}
+		p.maxIAMPolicies = n
+		return p, nil
+	}
+}
+
+// WithBestEffortVerification treats the resources not found in Asset
+// Inventory as unverified instead of invalid. The ResourceMapping is kept
+// without the "assetInfo" enrichment and the "assetVerified" annotation is set
+// to false instead. By default a resource not found fails the processing.
+func WithBestEffortVerification() Option {
+	return func(p *AssetInventoryProcessor) (*AssetInventoryProcessor, error) {
+		p.bestEffortVerification = true
+		return p, nil
+	}
+}
+
+// WithRequestStats attaches the number of Asset Inventory search round-trips
+// and the elapsed time to the "assetInfo" annotation, to help tune quota and
+// diagnose slow mappings.
+func WithRequestStats() Option {
+	return func(p *AssetInventoryProcessor) (*AssetInventoryProcessor, error) {
+		p.requestStats = true
+		return p, nil
+	}
+}
+
+// WithAncestorNames annotates the display names of the ancestors as
+// "ancestorNames", in the same order as "ancestors". It costs a call to the
+// resolver per ancestor.
+func WithAncestorNames(r AncestorNameResolver) Option {
+	return func(p *AssetInventoryProcessor) (*AssetInventoryProcessor, error) {
+		p.ancestorNameResolver = r
+		return p, nil
+	}
+}
+
+// WithAllowedServices rejects the ResourceMappings whose resource name service
+// host isn't one of the given services, e.g. "storage.googleapis.com". All
+// services are allowed by default.
+func WithAllowedServices(services ...string) Option {
+	return func(p *AssetInventoryProcessor) (*AssetInventoryProcessor, error) {
+		for _, s := range services {
+			if err := validateServiceHost(s); err != nil {
+				return nil, err
+			}
+		}
+		p.allowedServices = services
+		return p, nil
+	}
+}
+
+// WithOwnedClient sets whether the processor owns the asset client, in which
+// case Stop closes it. Pass false when the client is shared, e.g. by the
+// processors of several handlers, so it's closed by its creator instead. The
+// processor owns the client by default.
+func WithOwnedClient(owned bool) Option {
+	return func(p *AssetInventoryProcessor) (*AssetInventoryProcessor, error) {
+		p.sharedClient = !owned
+		return p, nil
+	}
+}
+
 // NewAssetInventoryProcessor creates a new AssetInventoryProcessor with the given options.
 // Need defaultResourceScope because resources such as GCS bucket won't include Project info in its resource name.
 // See details: https://cloud.google.com/asset-inventory/docs/resource-name-format.
@@ -64,40 +280,118 @@ func NewAssetInventoryProcessor(ctx context.Context, client *asset.Client, defau
 	}
 
 	p.client = client
+	p.stopCtx, p.stop = context.WithCancel(context.Background())
 	return p, nil
 }
 
+// Stop cancels the in-flight Asset Inventory searches and closes the asset
+// client unless it's shared, see [WithOwnedClient]. Process calls fail once the
+// processor is stopped.
+func (p *AssetInventoryProcessor) Stop() error {
+	p.stopOnce.Do(func() {
+		p.stop()
+		if p.sharedClient {
+			return
+		}
+		if err := p.client.Close(); err != nil {
+			p.stopErr = fmt.Errorf("failed to close asset client: %w", err)
+		}
+	})
+	return p.stopErr
+}
+
+// withStop returns a copy of ctx which is canceled when the processor is
+// stopped.
+func (p *AssetInventoryProcessor) withStop(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stopAfter := context.AfterFunc(p.stopCtx, cancel)
+	return ctx, func() {
+		stopAfter()
+		cancel()
+	}
+}
+
+// Name returns the name of the processor other processors can depend on.
+func (p *AssetInventoryProcessor) Name() string {
+	return AssetInventoryProcessorName
+}
+
+// RunsAfter returns the processors which must run before when they're
+// configured, so they only validate the user annotations.
+func (p *AssetInventoryProcessor) RunsAfter() []string {
+	return slices.Clone(annotationValidatorNames)
+}
+
+// Providers returns the resource providers the processor enriches.
+func (p *AssetInventoryProcessor) Providers() []string {
+	return []string{gcpProvider}
+}
+
 // Process validates the existence of resource associated with ResourceMapping,
 // and enriches ResourceMapping with additional annotations such location, ancestors, etc.
 // based on info fetched from Asset Inventory.
 func (p *AssetInventoryProcessor) Process(ctx context.Context, resourceMapping *v1alpha1.ResourceMapping) error {
 	logger := logging.FromContext(ctx).With("logger", fmt.Sprintf("%T", p))
 
-	if resourceMapping.GetResource().GetProvider() != gcpProvider {
+	// The payload lock isn't held during the lookups, so the resource is
+	// copied and the annotations are only merged at the end.
+	l := server.PayloadLock(ctx)
+	l.Lock()
+	resource, _ := proto.Clone(resourceMapping.GetResource()).(*v1alpha1.Resource)
+	l.Unlock()
+
+	if resource.GetProvider() != gcpProvider {
 		// Skip non-GCP ResourceMapping
 		logger.DebugContext(ctx, "skipping unsupported resource provider",
-			"got", resourceMapping.GetResource().GetProvider(),
+			"got", resource.GetProvider(),
 			"want", gcpProvider)
 		return nil
 	}
 
-	resourceName := resourceMapping.GetResource().GetName()
+	ctx, cancel := p.withStop(ctx)
+	defer cancel()
 
-	resourceScope, err := parseScope(resourceName)
+	resourceName := resource.GetName()
+
+	service, err := p.resolveService(resourceName)
 	if err != nil {
-		return pmaperrors.New("failed to parse project: %v", err)
+		return err
 	}
-	// Need defaultResourceScope because resources such as GCS bucket won't include Project info in its resource name.
-	// See details: https://cloud.google.com/asset-inventory/docs/resource-name-format.
-	if resourceScope == "" {
-		resourceScope = p.defaultResourceScope
+
+	resourceScopes, err := p.resolveScopes(ctx, resourceName)
+	if err != nil {
+		return err
 	}
 
-	additionalAnnos, err := p.validateAndEnrich(ctx, resourceScope, resourceName)
+	additionalAnnos, err := p.validateAndEnrich(ctx, resourceScopes, resourceName)
+	if err != nil && p.stopCtx.Err() != nil {
+		// Don't report the canceled searches as user facing errors.
+		return fmt.Errorf("processor stopped while processing resource %q: %w", resourceName, p.stopCtx.Err())
+	}
 	if err != nil {
-		return fmt.Errorf("failed to validate and enrich with resource %q in resourceScope %q: %w", resourceName, resourceScope, err)
+		return fmt.Errorf("failed to validate and enrich with resource %q in resourceScope %q: %w", resourceName, strings.Join(resourceScopes, ","), err)
 	}
+	additionalAnnos.Fields[v1alpha1.ReservedAnnotationKey(p.reservedAnnotationPrefix, AnnotationKeyService)] = structpb.NewStringValue(service)
 
+	if subscope := resource.GetSubscope(); subscope != "" {
+		normalized, err := v1alpha1.NormalizeSubscope(subscope)
+		if err != nil {
+			return pmaperrors.New("invalid subscope of resource %q: %v", resourceName, err)
+		}
+		additionalAnnos.Fields[v1alpha1.ReservedAnnotationKey(p.reservedAnnotationPrefix, AnnotationKeySubscope)] = structpb.NewStringValue(normalized)
+	}
+
+	if aliases := resource.GetAliases(); len(aliases) > 0 {
+		values := make([]*structpb.Value, 0, len(aliases))
+		for _, a := range aliases {
+			values = append(values, structpb.NewStringValue(a))
+		}
+		additionalAnnos.Fields[v1alpha1.ReservedAnnotationKey(p.reservedAnnotationPrefix, AnnotationKeyAliases)] = structpb.NewListValue(
+			&structpb.ListValue{Values: values})
+	}
+
+	l.Lock()
+	defer l.Unlock()
 	mergedAnnos, err := mergeAnnotations(resourceMapping.GetAnnotations(), additionalAnnos)
 	if err != nil {
 		return err
@@ -107,18 +401,167 @@ func (p *AssetInventoryProcessor) Process(ctx context.Context, resourceMapping *
 	return nil
 }
 
+// ValidateExistence validates the existence of resource associated with
+// ResourceMapping in Asset Inventory without enriching the ResourceMapping.
+// Use [IsResourceNotFound] to tell a missing resource from a failed search.
+func (p *AssetInventoryProcessor) ValidateExistence(ctx context.Context, resourceMapping *v1alpha1.ResourceMapping) error {
+	if resourceMapping.GetResource().GetProvider() != gcpProvider {
+		return nil
+	}
+
+	ctx, cancel := p.withStop(ctx)
+	defer cancel()
+
+	resourceName := resourceMapping.GetResource().GetName()
+
+	if _, err := p.resolveService(resourceName); err != nil {
+		return err
+	}
+
+	resourceScopes, err := p.resolveScopes(ctx, resourceName)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := p.findResource(ctx, resourceScopes, resourceName, nil); err != nil {
+		if isQuotaError(err) {
+			return fmt.Errorf("failed to validate resource %q in resourceScope %q: %w", resourceName, strings.Join(resourceScopes, ","), withRetryAfter(err))
+		}
+		return pmaperrors.New("failed to get single matched resource %q in resourceScope %q: %w", resourceName, strings.Join(resourceScopes, ","), err)
+	}
+	return nil
+}
+
+// IsResourceNotFound returns whether the error of
+// [AssetInventoryProcessor.ValidateExistence] is
+// because the resource doesn't exist, rather than e.g. a permission or network
+// error of the search.
+func IsResourceNotFound(err error) bool {
+	return errors.Is(err, errNoMatchedResource) || status.Code(err) == codes.NotFound
+}
+
+// ListResources returns the names of the resources in the scope, e.g.
+// "projects/my-project", in search order without duplicates. Only resources
+// of the given asset types, e.g. "storage.googleapis.com/Bucket", are listed
+// if any is given, and only resources of the allowed services if configured.
+func (p *AssetInventoryProcessor) ListResources(ctx context.Context, scope string, assetTypes ...string) ([]string, error) {
+	if err := validateScope(scope); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := p.withStop(ctx)
+	defer cancel()
+
+	it := p.client.SearchAllResources(ctx, &assetpb.SearchAllResourcesRequest{
+		Scope:      scope,
+		AssetTypes: assetTypes,
+		PageSize:   listPageSize,
+	})
+	var names []string
+	seen := make(map[string]struct{})
+	for {
+		result, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to search resources in scope %q: %w", scope, withRetryAfter(err))
+		}
+		name := result.GetName()
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		if len(p.allowedServices) > 0 {
+			if _, err := p.resolveService(name); err != nil {
+				continue
+			}
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// resolveService returns the service host of the resource name, a user facing
+// error is returned if the name is malformed or the service isn't allowed.
+func (p *AssetInventoryProcessor) resolveService(resourceName string) (string, error) {
+	service, err := parseServiceHost(resourceName)
+	if err != nil {
+		return "", pmaperrors.New("invalid resource name: %v", err)
+	}
+	if len(p.allowedServices) > 0 && !slices.Contains(p.allowedServices, service) {
+		return "", pmaperrors.New("service %q of resource %q is not allowed, allowed services: %q", service, resourceName, p.allowedServices)
+	}
+	return service, nil
+}
+
+// resolveScopes returns the resource scopes to search the resource in, in
+// order.
+func (p *AssetInventoryProcessor) resolveScopes(ctx context.Context, resourceName string) ([]string, error) {
+	logger := logging.FromContext(ctx).With("logger", fmt.Sprintf("%T", p))
+
+	resourceScope, err := parseScope(resourceName)
+	if err != nil {
+		return nil, pmaperrors.New("failed to parse project: %v", err)
+	}
+	if resourceScope != "" {
+		return []string{resourceScope}, nil
+	}
+
+	// The uploader may override the default resource scope with object metadata.
+	if s := server.ObjectMetadataFromContext(ctx)[server.MetadataKeyResourceScope]; s != "" {
+		if err := validateScope(s); err != nil {
+			return nil, pmaperrors.New("invalid %s metadata: %v", server.MetadataKeyResourceScope, err)
+		}
+		logger.DebugContext(ctx, "overriding default resource scope",
+			"default", p.defaultResourceScope,
+			"override", s)
+		return []string{s}, nil
+	}
+
+	// Need defaultResourceScope because resources such as GCS bucket won't include Project info in its resource name.
+	// See details: https://cloud.google.com/asset-inventory/docs/resource-name-format.
+	return append([]string{p.defaultResourceScope}, p.additionalResourceScopes...), nil
+}
+
+// findResource returns the single matched resource in the first resource
+// scope it's found in, and that scope. The next scope is only searched when
+// no resource matches.
+func (p *AssetInventoryProcessor) findResource(ctx context.Context, resourceScopes []string, resourceName string, stats *searchStats) (*assetpb.ResourceSearchResult, string, error) {
+	for _, resourceScope := range resourceScopes {
+		resource, err := getSingleResource(ctx, p.client, newResourceSearchRequest(resourceScope, resourceName), stats)
+		if errors.Is(err, errNoMatchedResource) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return resource, resourceScope, nil
+	}
+	return nil, "", errNoMatchedResource
+}
+
 // validateAndEnrich validates the existence of resource associated with ResourceMapping,
 // and return additional annotations such location, ancestors, etc.
 // based on info fetched from Asset Inventory.
-func (p *AssetInventoryProcessor) validateAndEnrich(ctx context.Context, resourceScope, resourceName string) (*structpb.Struct, error) {
-	resourceSearchQuery := fmt.Sprintf("name=%s", resourceName)
-	resourceSearchReq := &assetpb.SearchAllResourcesRequest{
-		Scope:    resourceScope,
-		Query:    resourceSearchQuery,
-		PageSize: pageSize,
+func (p *AssetInventoryProcessor) validateAndEnrich(ctx context.Context, resourceScopes []string, resourceName string) (*structpb.Struct, error) {
+	start := time.Now()
+	stats := &searchStats{}
+
+	resource, resourceScope, err := p.findResource(ctx, resourceScopes, resourceName, stats)
+	if p.bestEffortVerification && errors.Is(err, errNoMatchedResource) {
+		logging.FromContext(ctx).WarnContext(ctx, "resource not found, marking it as unverified",
+			"resource", resourceName,
+			"resourceScopes", resourceScopes)
+		return &structpb.Struct{Fields: map[string]*structpb.Value{
+			v1alpha1.ReservedAnnotationKey(p.reservedAnnotationPrefix, AnnotationKeyAssetVerified): structpb.NewBoolValue(false),
+		}}, nil
 	}
-	resource, err := p.getSingleResource(ctx, resourceSearchReq)
 	if err != nil {
+		// Quota errors are retried instead of reported to the user.
+		if isQuotaError(err) {
+			return nil, withRetryAfter(err)
+		}
 		return nil, pmaperrors.New("failed to get single matched resource: %v", err)
 	}
 
@@ -134,18 +577,43 @@ func (p *AssetInventoryProcessor) validateAndEnrich(ctx context.Context, resourc
 		ancestors = append(ancestors, v)
 	}
 
+	var ancestorNames []string
+	if p.ancestorNameResolver != nil {
+		for _, a := range ancestors {
+			name, err := p.ancestorNameResolver.ResolveName(ctx, a)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve name of ancestor %q: %w", a, withRetryAfter(err))
+			}
+			ancestorNames = append(ancestorNames, name)
+		}
+	}
+
 	iamSearchQuery := fmt.Sprintf("resource=%s", resourceName)
 	iamSearchReq := &assetpb.SearchAllIamPoliciesRequest{
 		Scope: resourceScope,
 		Query: iamSearchQuery,
 	}
 
-	iamPolicies, err := p.getIAMPolicies(ctx, iamSearchReq)
+	assetInventoryAnnos := map[string]any{}
+
+	iamPolicies, truncated, err := p.getIAMPolicies(ctx, iamSearchReq, stats)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get IAM policies with query %q resourceScope %q: %w", iamSearchQuery, resourceScope, err)
+		if !p.iamSearchNonFatal {
+			return nil, fmt.Errorf("failed to get IAM policies with query %q resourceScope %q: %w", iamSearchQuery, resourceScope, withRetryAfter(err))
+		}
+		logging.FromContext(ctx).WarnContext(ctx, "failed to get IAM policies, omitting them from annotations",
+			"query", iamSearchQuery,
+			"resourceScope", resourceScope,
+			"error", err)
+		assetInventoryAnnos[AnnotationKeyIAMPoliciesUnavailable] = true
+	}
+	if truncated {
+		logging.FromContext(ctx).WarnContext(ctx, "too many IAM policies, truncating them in annotations",
+			"resource", resourceName,
+			"max", p.maxIAMPolicies)
+		server.AddWarning(ctx, "IAM policies of resource %q truncated to %d", resourceName, p.maxIAMPolicies)
+		assetInventoryAnnos[AnnotationKeyIAMPoliciesTruncated] = true
 	}
-
-	assetInventoryAnnos := map[string]any{}
 
 	tags := resource.GetTags()
 	tagKeys := make([]string, 0, len(tags))
@@ -158,6 +626,9 @@ func (p *AssetInventoryProcessor) validateAndEnrich(ctx context.Context, resourc
 	if len(ancestors) != 0 {
 		assetInventoryAnnos["ancestors"] = ancestors
 	}
+	if len(ancestorNames) != 0 {
+		assetInventoryAnnos["ancestorNames"] = ancestorNames
+	}
 	if resource.GetLocation() != "" {
 		assetInventoryAnnos["location"] = resource.GetLocation()
 	}
@@ -176,9 +647,13 @@ func (p *AssetInventoryProcessor) validateAndEnrich(ctx context.Context, resourc
 	if len(iamPolicies) > 0 {
 		assetInventoryAnnos["iamPolicies"] = iamPolicies
 	}
+	if p.requestStats {
+		assetInventoryAnnos[AnnotationKeySearchRequests] = stats.requests
+		assetInventoryAnnos[AnnotationKeySearchDuration] = time.Since(start).String()
+	}
 
 	annotations := map[string]any{}
-	annotations[v1alpha1.AnnotationKeyAssetInfo] = assetInventoryAnnos
+	annotations[v1alpha1.ReservedAnnotationKey(p.reservedAnnotationPrefix, v1alpha1.AnnotationKeyAssetInfo)] = assetInventoryAnnos
 
 	assetInventorySpb, err := protoutil.ToProtoStruct(annotations)
 	if err != nil {
@@ -188,34 +663,54 @@ func (p *AssetInventoryProcessor) validateAndEnrich(ctx context.Context, resourc
 	return assetInventorySpb, nil
 }
 
-// getIAMPolicies get all IAM policies.
+// getIAMPolicies get all IAM policies, up to maxIAMPolicies if set in which
+// case truncated reports whether there are more. The search stops at the
+// first policy beyond the limit.
 //
 //nolint:staticcheck // see import.
-func (p *AssetInventoryProcessor) getIAMPolicies(ctx context.Context, req *assetpb.SearchAllIamPoliciesRequest) ([]*v1.Policy, error) {
+func (p *AssetInventoryProcessor) getIAMPolicies(ctx context.Context, req *assetpb.SearchAllIamPoliciesRequest, stats *searchStats) ([]*v1.Policy, bool, error) {
 	iamPolicySearchResultIt := p.client.SearchAllIamPolicies(ctx, req)
 	//nolint:staticcheck // see import.
 	var iamPolicies []*v1.Policy
 	for {
 		iamPolicySearchResult, err := iamPolicySearchResultIt.Next()
+		stats.observe(iamPolicySearchResultIt.Response)
 		if errors.Is(err, iterator.Done) {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to search IAM policies: %w", err)
+			return nil, false, fmt.Errorf("failed to search IAM policies: %w", err)
+		}
+		if p.maxIAMPolicies > 0 && len(iamPolicies) == p.maxIAMPolicies {
+			return iamPolicies, true, nil
 		}
 
 		iamPolicies = append(iamPolicies, iamPolicySearchResult.GetPolicy())
 	}
-	return iamPolicies, nil
+	return iamPolicies, false, nil
 }
 
+// newResourceSearchRequest returns the request to search the resource with the
+// given name in the resourceScope.
+func newResourceSearchRequest(resourceScope, resourceName string) *assetpb.SearchAllResourcesRequest {
+	return &assetpb.SearchAllResourcesRequest{
+		Scope:    resourceScope,
+		Query:    fmt.Sprintf("name=%s", resourceName),
+		PageSize: pageSize,
+	}
+}
+
+// errNoMatchedResource is returned when no resource matches the search.
+var errNoMatchedResource = errors.New("0 matched resources found, expected 1 matched resource")
+
 // getSingleResource get the single matched resource in Cloud Asset Inventory,
 // returns error if 0 matched resource or multiple matched resources are found.
-func (p *AssetInventoryProcessor) getSingleResource(ctx context.Context, req *assetpb.SearchAllResourcesRequest) (*assetpb.ResourceSearchResult, error) {
-	resourceSearchResultIt := p.client.SearchAllResources(ctx, req)
+func getSingleResource(ctx context.Context, client *asset.Client, req *assetpb.SearchAllResourcesRequest, stats *searchStats) (*assetpb.ResourceSearchResult, error) {
+	resourceSearchResultIt := client.SearchAllResources(ctx, req)
 	var resources []*assetpb.ResourceSearchResult
 	for {
 		result, err := resourceSearchResultIt.Next()
+		stats.observe(resourceSearchResultIt.Response)
 		if errors.Is(err, iterator.Done) {
 			break
 		}
@@ -224,12 +719,77 @@ func (p *AssetInventoryProcessor) getSingleResource(ctx context.Context, req *as
 		}
 		resources = append(resources, result)
 	}
+	if len(resources) == 0 {
+		return nil, errNoMatchedResource
+	}
 	if got, want := len(resources), 1; got != want {
 		return nil, fmt.Errorf("%d matched resources found, expected %d matched resource", got, want)
 	}
 	return resources[0], nil
 }
 
+// isQuotaError returns whether the error is an Asset Inventory quota error.
+func isQuotaError(err error) bool {
+	st, ok := status.FromError(err)
+	return ok && st.Code() == codes.ResourceExhausted
+}
+
+// withRetryAfter wraps the Asset Inventory quota error carrying a retry delay
+// in a [server.RetryAfterError] so the message is redelivered after the
+// delay. Other errors are returned as is.
+func withRetryAfter(err error) error {
+	if !isQuotaError(err) {
+		return err
+	}
+	st, _ := status.FromError(err)
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok && ri.GetRetryDelay() != nil {
+			return &server.RetryAfterError{Err: err, RetryAfter: ri.GetRetryDelay().AsDuration()}
+		}
+	}
+	return err
+}
+
+// AssetInventoryNameResolver resolves the ancestors display names with
+// Cloud Asset Inventory.
+type AssetInventoryNameResolver struct {
+	client *asset.Client
+}
+
+// NewAssetInventoryNameResolver creates a new AssetInventoryNameResolver.
+// The caller must be granted 'roles/cloudasset.viewer' on the ancestors.
+func NewAssetInventoryNameResolver(client *asset.Client) *AssetInventoryNameResolver {
+	return &AssetInventoryNameResolver{client: client}
+}
+
+// ResolveName returns the display name of the project, folder or
+// organization, e.g. "folders/123".
+func (r *AssetInventoryNameResolver) ResolveName(ctx context.Context, ancestor string) (string, error) {
+	resource, err := getSingleResource(ctx, r.client,
+		newResourceSearchRequest(ancestor, "//cloudresourcemanager.googleapis.com/"+ancestor), nil)
+	if err != nil {
+		return "", err
+	}
+	return resource.GetDisplayName(), nil
+}
+
+// searchStats counts the search RPC round-trips of the Asset Inventory
+// iterators. A nil searchStats ignores all observations.
+type searchStats struct {
+	requests     int
+	lastResponse any
+}
+
+// observe records the raw response of an iterator after a Next call. The
+// iterator replaces its response on every page fetched.
+func (s *searchStats) observe(resp any) {
+	if s == nil || resp == nil || resp == s.lastResponse {
+		return
+	}
+	s.requests++
+	s.lastResponse = resp
+}
+
 // mergeAnnotations merges two annotations represented by structpb.Struct,
 // if there is any field conflict, the field value in annos2 will override the field value in annos1.
 func mergeAnnotations(annos1, annos2 *structpb.Struct) (*structpb.Struct, error) {
@@ -272,3 +832,47 @@ func parseScope(resourceName string) (string, error) {
 	}
 	return fmt.Sprintf("%s/%s", scopePrefix, scope), nil
 }
+
+// serviceHostRegexp matches the service hosts of the full resource names,
+// e.g. "storage.googleapis.com".
+var serviceHostRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]*\.googleapis\.com$`)
+
+// parseServiceHost gets the service host from the full resource name, e.g.
+// "storage.googleapis.com" from "//storage.googleapis.com/test-bucket".
+// See https://cloud.google.com/asset-inventory/docs/resource-name-format.
+func parseServiceHost(resourceName string) (string, error) {
+	rest, ok := strings.CutPrefix(resourceName, "//")
+	if !ok {
+		return "", fmt.Errorf("%q is not a full resource name starting with \"//\"", resourceName)
+	}
+	host, _, _ := strings.Cut(rest, "/")
+	if err := validateServiceHost(host); err != nil {
+		return "", fmt.Errorf("resource %q: %w", resourceName, err)
+	}
+	return host, nil
+}
+
+// validateServiceHost checks the service host is in the format
+// "{SERVICE}.googleapis.com".
+func validateServiceHost(host string) error {
+	if !serviceHostRegexp.MatchString(host) {
+		return fmt.Errorf("invalid service host %q, expected format {SERVICE}.googleapis.com", host)
+	}
+	return nil
+}
+
+// validateScope checks the scope is in one of the formats
+// "projects/{PROJECT_ID}", "folders/{FOLDER_NUMBER}" or
+// "organizations/{ORGANIZATION_NUMBER}".
+func validateScope(scope string) error {
+	s := strings.Split(scope, "/")
+	if len(s) != 2 || s[1] == "" {
+		return fmt.Errorf("invalid resource scope: %s", scope)
+	}
+	switch s[0] {
+	case "projects", "folders", "organizations":
+		return nil
+	default:
+		return fmt.Errorf("invalid resource scope: %s", scope)
+	}
+}
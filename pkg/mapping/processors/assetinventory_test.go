@@ -16,20 +16,32 @@ package processors
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	asset "cloud.google.com/go/asset/apiv1"
 	"cloud.google.com/go/asset/apiv1/assetpb"
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	v1 "google.golang.org/genproto/googleapis/iam/v1" //nolint:staticcheck // "cloud.google.com/go/asset/apiv1" still uses v1.Policy(deprecated).
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/abcxyz/pkg/testutil"
 	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/internal/testhelper"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+	"github.com/abcxyz/pmap/pkg/server"
 )
 
 func TestParseProject(t *testing.T) {
@@ -74,6 +86,67 @@ func TestParseProject(t *testing.T) {
 	}
 }
 
+func TestParseServiceHost(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		resourceName  string
+		wantService   string
+		wantErrSubstr string
+	}{
+		{
+			name:         "storage",
+			resourceName: "//storage.googleapis.com/test-bucket",
+			wantService:  "storage.googleapis.com",
+		},
+		{
+			name:         "pubsub",
+			resourceName: "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+			wantService:  "pubsub.googleapis.com",
+		},
+		{
+			name:         "artifactregistry",
+			resourceName: "//artifactregistry.googleapis.com/projects/test-project/locations/us/repositories/test-repo",
+			wantService:  "artifactregistry.googleapis.com",
+		},
+		{
+			name:          "relative_resource_name",
+			resourceName:  "projects/test-project/topics/test-topic",
+			wantErrSubstr: `"projects/test-project/topics/test-topic" is not a full resource name starting with "//"`,
+		},
+		{
+			name:          "non_googleapis_host",
+			resourceName:  "//storage.example.com/test-bucket",
+			wantErrSubstr: `invalid service host "storage.example.com"`,
+		},
+		{
+			name:          "empty_service",
+			resourceName:  "//.googleapis.com/test-bucket",
+			wantErrSubstr: `invalid service host ".googleapis.com"`,
+		},
+		{
+			name:          "empty_host",
+			resourceName:  "///test-bucket",
+			wantErrSubstr: `invalid service host ""`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			gotService, gotErr := parseServiceHost(tc.resourceName)
+			if diff := testutil.DiffErrString(gotErr, tc.wantErrSubstr); diff != "" {
+				t.Errorf("parseServiceHost(%q) got unexpected error substring: %v", tc.resourceName, diff)
+			}
+			if diff := cmp.Diff(tc.wantService, gotService); diff != "" {
+				t.Errorf("parseServiceHost(%q) got diff (-want, +got): %v", tc.resourceName, diff)
+			}
+		})
+	}
+}
+
 type fakeAssetInventoryServer struct {
 	assetpb.UnimplementedAssetServiceServer
 
@@ -81,9 +154,12 @@ type fakeAssetInventoryServer struct {
 	searchAllIamPoliciesData *assetpb.SearchAllIamPoliciesResponse
 	searchAllResourcesErr    error
 	searchAllIamPoliciesErr  error
+
+	gotResourcesScope string
 }
 
-func (s *fakeAssetInventoryServer) SearchAllResources(context.Context, *assetpb.SearchAllResourcesRequest) (*assetpb.SearchAllResourcesResponse, error) {
+func (s *fakeAssetInventoryServer) SearchAllResources(_ context.Context, req *assetpb.SearchAllResourcesRequest) (*assetpb.SearchAllResourcesResponse, error) {
+	s.gotResourcesScope = req.GetScope()
 	return s.searchAllResourcesData, s.searchAllResourcesErr
 }
 
@@ -97,6 +173,7 @@ func TestProcessor_UpdatedProcess(t *testing.T) {
 	cases := []struct {
 		name                string
 		server              *fakeAssetInventoryServer
+		opts                []Option
 		resourceMapping     *v1alpha1.ResourceMapping
 		wantResourceMapping *v1alpha1.ResourceMapping
 		wantErrSubstr       string
@@ -156,7 +233,8 @@ func TestProcessor_UpdatedProcess(t *testing.T) {
 				Contacts: &v1alpha1.Contacts{Email: []string{"pmap@example.com"}},
 				Annotations: &structpb.Struct{
 					Fields: map[string]*structpb.Value{
-						"custom_key": structpb.NewStringValue("test-key"),
+						"custom_key":         structpb.NewStringValue("test-key"),
+						AnnotationKeyService: structpb.NewStringValue("pubsub.googleapis.com"),
 						v1alpha1.AnnotationKeyAssetInfo: structpb.NewStructValue(&structpb.Struct{
 							Fields: map[string]*structpb.Value{
 								"ancestors": structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue("organizations/0"), structpb.NewStringValue("folders/0"), structpb.NewStringValue("folders/1"), structpb.NewStringValue("projects/0")}}),
@@ -279,6 +357,76 @@ func TestProcessor_UpdatedProcess(t *testing.T) {
 			},
 			wantErrSubstr: "encountered error during iam policies search: Internal Server Error",
 		},
+		{
+			name: "non_fatal_iam_policies_search_err",
+			server: &fakeAssetInventoryServer{
+				searchAllResourcesData: &assetpb.SearchAllResourcesResponse{
+					Results: []*assetpb.ResourceSearchResult{{
+						Name:         "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+						AssetType:    "pubsub.googleapis.com/Topic",
+						Project:      "projects/0",
+						Organization: "organizations/0",
+						Labels:       map[string]string{"env": "dev"},
+						Location:     "global",
+					}},
+				},
+				searchAllIamPoliciesErr: fmt.Errorf("encountered error during iam policies search: Deadline Exceeded"),
+			},
+			opts: []Option{WithNonFatalIAMSearch()},
+			resourceMapping: &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &v1alpha1.Contacts{Email: []string{"pmap@example.com"}},
+			},
+			wantResourceMapping: &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &v1alpha1.Contacts{Email: []string{"pmap@example.com"}},
+				Annotations: &structpb.Struct{
+					Fields: map[string]*structpb.Value{
+						AnnotationKeyService: structpb.NewStringValue("pubsub.googleapis.com"),
+						v1alpha1.AnnotationKeyAssetInfo: structpb.NewStructValue(&structpb.Struct{
+							Fields: map[string]*structpb.Value{
+								"ancestors": structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue("organizations/0"), structpb.NewStringValue("projects/0")}}),
+								"labels": structpb.NewStructValue(&structpb.Struct{
+									Fields: map[string]*structpb.Value{
+										"env": structpb.NewStringValue("dev"),
+									},
+								}),
+								"location":                          structpb.NewStringValue("global"),
+								AnnotationKeyIAMPoliciesUnavailable: structpb.NewBoolValue(true),
+							},
+						}),
+					},
+				},
+			},
+		},
+		{
+			name: "non_fatal_iam_search_still_fails_on_resources_search_err",
+			server: &fakeAssetInventoryServer{
+				searchAllResourcesErr: fmt.Errorf("encountered error during resources search: Internal Server Error"),
+			},
+			opts: []Option{WithNonFatalIAMSearch()},
+			resourceMapping: &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &v1alpha1.Contacts{Email: []string{"pmap@example.com"}},
+			},
+			wantResourceMapping: &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{
+					Provider: "gcp",
+					Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				},
+				Contacts: &v1alpha1.Contacts{Email: []string{"pmap@example.com"}},
+			},
+			wantErrSubstr: "encountered error during resources search: Internal Server Error",
+		},
 	}
 
 	for _, tc := range cases {
@@ -288,7 +436,7 @@ func TestProcessor_UpdatedProcess(t *testing.T) {
 			ctx := context.Background()
 
 			// Setup fake Asset Inventory server.
-			addr, conn := testutil.FakeGRPCServer(t, func(s *grpc.Server) {
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
 				assetpb.RegisterAssetServiceServer(s, tc.server)
 			})
 
@@ -297,7 +445,7 @@ func TestProcessor_UpdatedProcess(t *testing.T) {
 			if err != nil {
 				t.Fatalf("creating client for fake at %q: %v", addr, err)
 			}
-			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project")
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project", tc.opts...)
 			if err != nil {
 				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
 			}
@@ -314,3 +462,1313 @@ func TestProcessor_UpdatedProcess(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessor_ResourceScopeOverride(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		resourceName  string
+		metadata      map[string]string
+		wantScope     string
+		wantErrSubstr string
+	}{
+		{
+			name:         "default_scope",
+			resourceName: "//storage.googleapis.com/test-bucket",
+			wantScope:    "projects/fake-project",
+		},
+		{
+			name:         "metadata_override",
+			resourceName: "//storage.googleapis.com/test-bucket",
+			metadata:     map[string]string{server.MetadataKeyResourceScope: "folders/123"},
+			wantScope:    "folders/123",
+		},
+		{
+			name:         "resource_name_scope_wins",
+			resourceName: "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+			metadata:     map[string]string{server.MetadataKeyResourceScope: "folders/123"},
+			wantScope:    "projects/test-project",
+		},
+		{
+			name:          "invalid_metadata_override",
+			resourceName:  "//storage.googleapis.com/test-bucket",
+			metadata:      map[string]string{server.MetadataKeyResourceScope: "buckets/123"},
+			wantErrSubstr: "invalid resource-scope metadata: invalid resource scope: buckets/123",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := server.WithObjectMetadata(context.Background(), tc.metadata)
+
+			fakeServer := &fakeAssetInventoryServer{
+				searchAllResourcesData: &assetpb.SearchAllResourcesResponse{
+					Results: []*assetpb.ResourceSearchResult{{Name: tc.resourceName}},
+				},
+				searchAllIamPoliciesData: &assetpb.SearchAllIamPoliciesResponse{},
+			}
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, fakeServer)
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project")
+			if err != nil {
+				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+			}
+
+			gotErr := p.Process(ctx, &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{Provider: "gcp", Name: tc.resourceName},
+			})
+			if diff := testutil.DiffErrString(gotErr, tc.wantErrSubstr); diff != "" {
+				t.Errorf("Process(%+v) got unexpected error substring: %v", tc.name, diff)
+			}
+			if gotErr != nil && !pmaperrors.Is(gotErr) {
+				t.Errorf("Process(%+v) got error %v, want a pmaperrors error", tc.name, gotErr)
+			}
+			if diff := cmp.Diff(tc.wantScope, fakeServer.gotResourcesScope); diff != "" {
+				t.Errorf("Process(%+v) got scope diff (-want, +got): %v", tc.name, diff)
+			}
+		})
+	}
+}
+
+func TestProcessor_ReservedAnnotationPrefix(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	resourceName := "//pubsub.googleapis.com/projects/test-project/topics/test-topic"
+
+	addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+		assetpb.RegisterAssetServiceServer(s, &fakeAssetInventoryServer{
+			searchAllResourcesData: &assetpb.SearchAllResourcesResponse{
+				Results: []*assetpb.ResourceSearchResult{{Name: resourceName, Location: "global"}},
+			},
+			searchAllIamPoliciesData: &assetpb.SearchAllIamPoliciesResponse{},
+		})
+	})
+	fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("creating client for fake at %q: %v", addr, err)
+	}
+	p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project",
+		WithReservedAnnotationPrefix("sys."))
+	if err != nil {
+		t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+	}
+
+	got := &v1alpha1.ResourceMapping{
+		Resource: &v1alpha1.Resource{Provider: "gcp", Name: resourceName},
+		Annotations: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"assetInfo": structpb.NewStringValue("user"),
+		}},
+	}
+	if err := p.Process(ctx, got); err != nil {
+		t.Fatalf("Process got unexpected error: %v", err)
+	}
+
+	want := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"assetInfo": structpb.NewStringValue("user"),
+		"sys.assetInfo": structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"location": structpb.NewStringValue("global"),
+		}}),
+
+		"sys.service": structpb.NewStringValue("pubsub.googleapis.com"),
+	}}
+	if diff := cmp.Diff(want, got.GetAnnotations(), protocmp.Transform()); diff != "" {
+		t.Errorf("Process got annotations diff (-want, +got): %v", diff)
+	}
+}
+
+func TestProcessor_Subscope(t *testing.T) {
+	t.Parallel()
+
+	resourceName := "//storage.googleapis.com/test-bucket"
+
+	cases := []struct {
+		name     string
+		prefix   string
+		subscope string
+		wantKey  string
+		want     string
+		wantErr  string
+	}{
+		{
+			name: "no_subscope",
+		},
+		{
+			name:     "normalized_subscope",
+			subscope: "parent/foo?key2=value2&key1=value1",
+			wantKey:  "subscope",
+			want:     "parent/foo?key1=value1&key2=value2",
+		},
+		{
+			name:     "subscope_with_reserved_prefix",
+			prefix:   "sys.",
+			subscope: "parent/foo?key1=value1",
+			wantKey:  "sys.subscope",
+			want:     "parent/foo?key1=value1",
+		},
+		{
+			name:     "invalid_subscope",
+			subscope: "parent/foo?key1=%zz",
+			wantErr:  `invalid subscope of resource "//storage.googleapis.com/test-bucket"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &fakeAssetInventoryServer{
+					searchAllResourcesData: &assetpb.SearchAllResourcesResponse{
+						Results: []*assetpb.ResourceSearchResult{{Name: resourceName, Location: "us"}},
+					},
+					searchAllIamPoliciesData: &assetpb.SearchAllIamPoliciesResponse{},
+				})
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project",
+				WithReservedAnnotationPrefix(tc.prefix))
+			if err != nil {
+				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+			}
+
+			m := &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{Provider: "gcp", Name: resourceName, Subscope: tc.subscope},
+			}
+			err = p.Process(ctx, m)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			fields := m.GetAnnotations().GetFields()
+			if tc.wantKey == "" {
+				if _, ok := fields[v1alpha1.ReservedAnnotationKey(tc.prefix, AnnotationKeySubscope)]; ok {
+					t.Errorf("Process got unexpected subscope annotation: %v", fields)
+				}
+				return
+			}
+			if got := fields[tc.wantKey].GetStringValue(); got != tc.want {
+				t.Errorf("Process got subscope annotation %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProcessor_Aliases(t *testing.T) {
+	t.Parallel()
+
+	resourceName := "//storage.googleapis.com/test-bucket"
+
+	cases := []struct {
+		name    string
+		prefix  string
+		aliases []string
+		wantKey string
+		want    []any
+	}{
+		{
+			name: "no_aliases",
+		},
+		{
+			name:    "aliases",
+			aliases: []string{"//storage.googleapis.com/old-bucket", "//storage.googleapis.com/older-bucket"},
+			wantKey: "aliases",
+			want:    []any{"//storage.googleapis.com/old-bucket", "//storage.googleapis.com/older-bucket"},
+		},
+		{
+			name:    "aliases_with_reserved_prefix",
+			prefix:  "sys.",
+			aliases: []string{"//storage.googleapis.com/old-bucket"},
+			wantKey: "sys.aliases",
+			want:    []any{"//storage.googleapis.com/old-bucket"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &fakeAssetInventoryServer{
+					searchAllResourcesData: &assetpb.SearchAllResourcesResponse{
+						Results: []*assetpb.ResourceSearchResult{{Name: resourceName, Location: "us"}},
+					},
+					searchAllIamPoliciesData: &assetpb.SearchAllIamPoliciesResponse{},
+				})
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project",
+				WithReservedAnnotationPrefix(tc.prefix))
+			if err != nil {
+				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+			}
+
+			m := &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{Provider: "gcp", Name: resourceName, Aliases: tc.aliases},
+			}
+			if err := p.Process(ctx, m); err != nil {
+				t.Fatalf("Process got unexpected error: %v", err)
+			}
+
+			fields := m.GetAnnotations().GetFields()
+			if tc.wantKey == "" {
+				if _, ok := fields[v1alpha1.ReservedAnnotationKey(tc.prefix, AnnotationKeyAliases)]; ok {
+					t.Errorf("Process got unexpected aliases annotation: %v", fields)
+				}
+				return
+			}
+			if diff := cmp.Diff(tc.want, fields[tc.wantKey].GetListValue().AsSlice()); diff != "" {
+				t.Errorf("Process got aliases annotation diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestProcessor_BestEffortVerification(t *testing.T) {
+	t.Parallel()
+
+	resourceName := "//storage.googleapis.com/test-bucket"
+
+	cases := []struct {
+		name          string
+		prefix        string
+		opts          []Option
+		results       []*assetpb.ResourceSearchResult
+		wantVerified  *structpb.Value
+		wantAssetInfo bool
+		wantErrSubstr string
+	}{
+		{
+			name:          "found",
+			opts:          []Option{WithBestEffortVerification()},
+			results:       []*assetpb.ResourceSearchResult{{Name: resourceName, Location: "us"}},
+			wantAssetInfo: true,
+		},
+		{
+			name:         "not_found",
+			opts:         []Option{WithBestEffortVerification()},
+			wantVerified: structpb.NewBoolValue(false),
+		},
+		{
+			name:         "not_found_with_reserved_prefix",
+			prefix:       "sys.",
+			opts:         []Option{WithBestEffortVerification()},
+			wantVerified: structpb.NewBoolValue(false),
+		},
+		{
+			name:          "not_found_without_best_effort",
+			wantErrSubstr: "0 matched resources found, expected 1 matched resource",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &fakeAssetInventoryServer{
+					searchAllResourcesData: &assetpb.SearchAllResourcesResponse{
+						Results: tc.results,
+					},
+					searchAllIamPoliciesData: &assetpb.SearchAllIamPoliciesResponse{},
+				})
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			opts := append([]Option{WithReservedAnnotationPrefix(tc.prefix)}, tc.opts...)
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project", opts...)
+			if err != nil {
+				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+			}
+
+			m := &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{Provider: "gcp", Name: resourceName},
+			}
+			err = p.Process(ctx, m)
+			if diff := testutil.DiffErrString(err, tc.wantErrSubstr); diff != "" {
+				t.Fatalf("Process got unexpected error substring: %v", diff)
+			}
+			if err != nil {
+				return
+			}
+
+			fields := m.GetAnnotations().GetFields()
+			if diff := cmp.Diff(tc.wantVerified, fields[tc.prefix+AnnotationKeyAssetVerified], protocmp.Transform()); diff != "" {
+				t.Errorf("Process got assetVerified annotation diff (-want, +got): %v", diff)
+			}
+			if _, got := fields[tc.prefix+v1alpha1.AnnotationKeyAssetInfo]; got != tc.wantAssetInfo {
+				t.Errorf("Process got assetInfo annotation %t, want %t", got, tc.wantAssetInfo)
+			}
+			if got, want := fields[tc.prefix+AnnotationKeyService].GetStringValue(), "storage.googleapis.com"; got != want {
+				t.Errorf("Process got service annotation %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestProcessor_AllowedServices(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name            string
+		resourceName    string
+		allowedServices []string
+		wantService     string
+		wantErr         string
+	}{
+		{
+			name:         "storage_all_allowed",
+			resourceName: "//storage.googleapis.com/test-bucket",
+			wantService:  "storage.googleapis.com",
+		},
+		{
+			name:            "pubsub_allowed",
+			resourceName:    "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+			allowedServices: []string{"storage.googleapis.com", "pubsub.googleapis.com"},
+			wantService:     "pubsub.googleapis.com",
+		},
+		{
+			name:            "artifactregistry_not_allowed",
+			resourceName:    "//artifactregistry.googleapis.com/projects/test-project/locations/us/repositories/test-repo",
+			allowedServices: []string{"storage.googleapis.com", "pubsub.googleapis.com"},
+			wantErr: `service "artifactregistry.googleapis.com" of resource ` +
+				`"//artifactregistry.googleapis.com/projects/test-project/locations/us/repositories/test-repo" is not allowed`,
+		},
+		{
+			name:         "invalid_resource_name",
+			resourceName: "//storage.example.com/test-bucket",
+			wantErr:      `invalid resource name: resource "//storage.example.com/test-bucket": invalid service host`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &fakeAssetInventoryServer{
+					searchAllResourcesData: &assetpb.SearchAllResourcesResponse{
+						Results: []*assetpb.ResourceSearchResult{{Name: tc.resourceName, Location: "us"}},
+					},
+					searchAllIamPoliciesData: &assetpb.SearchAllIamPoliciesResponse{},
+				})
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project",
+				WithReservedAnnotationPrefix("sys."),
+				WithAllowedServices(tc.allowedServices...))
+			if err != nil {
+				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+			}
+
+			m := &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{Provider: "gcp", Name: tc.resourceName},
+			}
+			err = p.ValidateExistence(ctx, m)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatalf("ValidateExistence: %s", diff)
+			}
+			err = p.Process(ctx, m)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				if !pmaperrors.Is(err) {
+					t.Errorf("Process got error %v, want user facing error", err)
+				}
+				return
+			}
+
+			if got := m.GetAnnotations().GetFields()["sys.service"].GetStringValue(); got != tc.wantService {
+				t.Errorf("Process got service annotation %q, want %q", got, tc.wantService)
+			}
+		})
+	}
+}
+
+func TestProcessor_MaxIAMPolicies(t *testing.T) {
+	t.Parallel()
+
+	resourceName := "//pubsub.googleapis.com/projects/test-project/topics/test-topic"
+	policy := func(role string) *assetpb.IamPolicySearchResult {
+		return &assetpb.IamPolicySearchResult{Policy: &v1.Policy{Bindings: []*v1.Binding{{Role: role}}}}
+	}
+	iamPoliciesPages := [][]*assetpb.IamPolicySearchResult{
+		{policy("roles/a"), policy("roles/b")},
+		{policy("roles/c")},
+		{policy("roles/d")},
+	}
+
+	cases := []struct {
+		name          string
+		opts          []Option
+		wantRoles     []string
+		wantTruncated bool
+		wantRequests  float64
+	}{
+		{
+			name:         "no_limit",
+			opts:         []Option{WithRequestStats()},
+			wantRoles:    []string{"roles/a", "roles/b", "roles/c", "roles/d"},
+			wantRequests: 4,
+		},
+		{
+			name:          "within_page",
+			opts:          []Option{WithRequestStats(), WithMaxIAMPolicies(1)},
+			wantRoles:     []string{"roles/a"},
+			wantTruncated: true,
+			wantRequests:  2,
+		},
+		{
+			name:          "across_pages",
+			opts:          []Option{WithRequestStats(), WithMaxIAMPolicies(3)},
+			wantRoles:     []string{"roles/a", "roles/b", "roles/c"},
+			wantTruncated: true,
+			wantRequests:  4,
+		},
+		{
+			name:         "at_limit",
+			opts:         []Option{WithRequestStats(), WithMaxIAMPolicies(4)},
+			wantRoles:    []string{"roles/a", "roles/b", "roles/c", "roles/d"},
+			wantRequests: 4,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &pagedFakeAssetInventoryServer{
+					resourcesPages:   [][]*assetpb.ResourceSearchResult{{{Name: resourceName}}},
+					iamPoliciesPages: iamPoliciesPages,
+				})
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project", tc.opts...)
+			if err != nil {
+				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+			}
+
+			m := &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{Provider: "gcp", Name: resourceName},
+			}
+			if err := p.Process(ctx, m); err != nil {
+				t.Fatalf("Process got unexpected error: %v", err)
+			}
+
+			assetInfo := m.GetAnnotations().GetFields()[v1alpha1.AnnotationKeyAssetInfo].GetStructValue().GetFields()
+			var gotRoles []string
+			for _, policy := range assetInfo["iamPolicies"].GetListValue().GetValues() {
+				for _, binding := range policy.GetStructValue().GetFields()["bindings"].GetListValue().GetValues() {
+					gotRoles = append(gotRoles, binding.GetStructValue().GetFields()["role"].GetStringValue())
+				}
+			}
+			if diff := cmp.Diff(tc.wantRoles, gotRoles); diff != "" {
+				t.Errorf("Process got IAM policy roles diff (-want, +got): %v", diff)
+			}
+			if got := assetInfo[AnnotationKeyIAMPoliciesTruncated].GetBoolValue(); got != tc.wantTruncated {
+				t.Errorf("Process got %s %t, want %t", AnnotationKeyIAMPoliciesTruncated, got, tc.wantTruncated)
+			}
+			if got, want := assetInfo[AnnotationKeySearchRequests].GetNumberValue(), tc.wantRequests; got != want {
+				t.Errorf("Process got %s %v, want %v", AnnotationKeySearchRequests, got, want)
+			}
+		})
+	}
+}
+
+func TestWithMaxIAMPolicies(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewAssetInventoryProcessor(context.Background(), nil, "projects/fake-project",
+		WithMaxIAMPolicies(-1))
+	if diff := testutil.DiffErrString(err, `max IAM policies cannot be negative: -1`); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestWithAllowedServices(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewAssetInventoryProcessor(context.Background(), nil, "projects/fake-project",
+		WithAllowedServices("storage.googleapis.com", "storage"))
+	if diff := testutil.DiffErrString(err, `invalid service host "storage"`); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// pagedFakeAssetInventoryServer serves the search results one page per
+// request, the page token being the index of the page.
+type pagedFakeAssetInventoryServer struct {
+	assetpb.UnimplementedAssetServiceServer
+
+	resourcesPages   [][]*assetpb.ResourceSearchResult
+	iamPoliciesPages [][]*assetpb.IamPolicySearchResult
+}
+
+func (s *pagedFakeAssetInventoryServer) SearchAllResources(_ context.Context, req *assetpb.SearchAllResourcesRequest) (*assetpb.SearchAllResourcesResponse, error) {
+	i, next, err := fakePage(req.GetPageToken(), len(s.resourcesPages))
+	if err != nil {
+		return nil, err
+	}
+	return &assetpb.SearchAllResourcesResponse{Results: s.resourcesPages[i], NextPageToken: next}, nil
+}
+
+func (s *pagedFakeAssetInventoryServer) SearchAllIamPolicies(_ context.Context, req *assetpb.SearchAllIamPoliciesRequest) (*assetpb.SearchAllIamPoliciesResponse, error) {
+	i, next, err := fakePage(req.GetPageToken(), len(s.iamPoliciesPages))
+	if err != nil {
+		return nil, err
+	}
+	return &assetpb.SearchAllIamPoliciesResponse{Results: s.iamPoliciesPages[i], NextPageToken: next}, nil
+}
+
+// fakePage returns the page index of the token and the token of the next
+// page, empty for the last page.
+func fakePage(token string, pages int) (int, string, error) {
+	i := 0
+	if token != "" {
+		var err error
+		if i, err = strconv.Atoi(token); err != nil {
+			return 0, "", fmt.Errorf("invalid page token %q: %w", token, err)
+		}
+	}
+	if i >= pages {
+		return 0, "", fmt.Errorf("page %d out of range", i)
+	}
+	if i+1 == pages {
+		return i, "", nil
+	}
+	return i, strconv.Itoa(i + 1), nil
+}
+
+func TestProcessor_RequestStats(t *testing.T) {
+	t.Parallel()
+
+	resourceName := "//pubsub.googleapis.com/projects/test-project/topics/test-topic"
+
+	cases := []struct {
+		name             string
+		opts             []Option
+		resourcesPages   [][]*assetpb.ResourceSearchResult
+		iamPoliciesPages [][]*assetpb.IamPolicySearchResult
+		wantStats        bool
+		wantRequests     float64
+	}{
+		{
+			name: "single_pages",
+			opts: []Option{WithRequestStats()},
+			resourcesPages: [][]*assetpb.ResourceSearchResult{
+				{{Name: resourceName}},
+			},
+			iamPoliciesPages: [][]*assetpb.IamPolicySearchResult{
+				{{Policy: &v1.Policy{}}},
+			},
+			wantStats:    true,
+			wantRequests: 2,
+		},
+		{
+			name: "multiple_pages",
+			opts: []Option{WithRequestStats()},
+			resourcesPages: [][]*assetpb.ResourceSearchResult{
+				{{Name: resourceName}},
+				{},
+			},
+			iamPoliciesPages: [][]*assetpb.IamPolicySearchResult{
+				{{Policy: &v1.Policy{}}},
+				{{Policy: &v1.Policy{}}},
+				{{Policy: &v1.Policy{}}},
+			},
+			wantStats:    true,
+			wantRequests: 5,
+		},
+		{
+			name: "disabled",
+			resourcesPages: [][]*assetpb.ResourceSearchResult{
+				{{Name: resourceName}},
+				{},
+			},
+			iamPoliciesPages: [][]*assetpb.IamPolicySearchResult{
+				{{Policy: &v1.Policy{}}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &pagedFakeAssetInventoryServer{
+					resourcesPages:   tc.resourcesPages,
+					iamPoliciesPages: tc.iamPoliciesPages,
+				})
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project", tc.opts...)
+			if err != nil {
+				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+			}
+
+			m := &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{Provider: "gcp", Name: resourceName},
+			}
+			if err := p.Process(ctx, m); err != nil {
+				t.Fatalf("Process got unexpected error: %v", err)
+			}
+
+			assetInfo := m.GetAnnotations().GetFields()[v1alpha1.AnnotationKeyAssetInfo].GetStructValue().GetFields()
+			requests, gotRequests := assetInfo[AnnotationKeySearchRequests]
+			duration, gotDuration := assetInfo[AnnotationKeySearchDuration]
+			if !tc.wantStats {
+				if gotRequests || gotDuration {
+					t.Errorf("Process got unexpected request stats: %v, %v", requests, duration)
+				}
+				return
+			}
+
+			if got, want := requests.GetNumberValue(), tc.wantRequests; got != want {
+				t.Errorf("Process got %s %v, want %v", AnnotationKeySearchRequests, got, want)
+			}
+			if _, err := time.ParseDuration(duration.GetStringValue()); err != nil {
+				t.Errorf("Process got invalid %s %q: %v", AnnotationKeySearchDuration, duration.GetStringValue(), err)
+			}
+		})
+	}
+}
+
+type fakeAncestorNameResolver struct {
+	names map[string]string
+}
+
+func (r *fakeAncestorNameResolver) ResolveName(_ context.Context, ancestor string) (string, error) {
+	name, ok := r.names[ancestor]
+	if !ok {
+		return "", fmt.Errorf("ancestor %q not found", ancestor)
+	}
+	return name, nil
+}
+
+func TestProcessor_AncestorNames(t *testing.T) {
+	t.Parallel()
+
+	resourceName := "//pubsub.googleapis.com/projects/test-project/topics/test-topic"
+	resolver := &fakeAncestorNameResolver{names: map[string]string{
+		"organizations/456": "example.com",
+		"folders/123":       "Engineering",
+		"projects/111":      "Test Project",
+	}}
+
+	cases := []struct {
+		name    string
+		opts    []Option
+		folders []string
+		want    []any
+		wantErr string
+	}{
+		{
+			name:    "resolved",
+			opts:    []Option{WithAncestorNames(resolver)},
+			folders: []string{"folders/123"},
+			want:    []any{"example.com", "Engineering", "Test Project"},
+		},
+		{
+			name:    "disabled",
+			folders: []string{"folders/123"},
+		},
+		{
+			name:    "unknown_ancestor",
+			opts:    []Option{WithAncestorNames(resolver)},
+			folders: []string{"folders/999"},
+			wantErr: `failed to resolve name of ancestor "folders/999": ancestor "folders/999" not found`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &fakeAssetInventoryServer{
+					searchAllResourcesData: &assetpb.SearchAllResourcesResponse{
+						Results: []*assetpb.ResourceSearchResult{{
+							Name:         resourceName,
+							Organization: "organizations/456",
+							Folders:      tc.folders,
+							Project:      "projects/111",
+						}},
+					},
+					searchAllIamPoliciesData: &assetpb.SearchAllIamPoliciesResponse{},
+				})
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project", tc.opts...)
+			if err != nil {
+				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+			}
+
+			m := &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{Provider: "gcp", Name: resourceName},
+			}
+			err = p.Process(ctx, m)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			assetInfo := m.GetAnnotations().GetFields()[v1alpha1.AnnotationKeyAssetInfo].GetStructValue().AsMap()
+			got, _ := assetInfo["ancestorNames"].([]any)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Process got ancestorNames diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestAssetInventoryNameResolver_ResolveName(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fakeServer := &fakeAssetInventoryServer{
+		searchAllResourcesData: &assetpb.SearchAllResourcesResponse{
+			Results: []*assetpb.ResourceSearchResult{{
+				Name:        "//cloudresourcemanager.googleapis.com/folders/123",
+				DisplayName: "Engineering",
+			}},
+		},
+	}
+	addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+		assetpb.RegisterAssetServiceServer(s, fakeServer)
+	})
+	fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("creating client for fake at %q: %v", addr, err)
+	}
+
+	got, err := NewAssetInventoryNameResolver(fakeAssetClient).ResolveName(ctx, "folders/123")
+	if err != nil {
+		t.Fatalf("ResolveName got unexpected error: %v", err)
+	}
+	if want := "Engineering"; got != want {
+		t.Errorf("ResolveName got %q, want %q", got, want)
+	}
+	if diff := cmp.Diff("folders/123", fakeServer.gotResourcesScope); diff != "" {
+		t.Errorf("ResolveName got scope diff (-want, +got): %v", diff)
+	}
+}
+
+func TestProcessor_ListResources(t *testing.T) {
+	t.Parallel()
+
+	results := []*assetpb.ResourceSearchResult{
+		{Name: "//pubsub.googleapis.com/projects/test-project/topics/test-topic"},
+		{Name: "//storage.googleapis.com/test-bucket"},
+		{Name: "//pubsub.googleapis.com/projects/test-project/topics/test-topic"},
+	}
+
+	cases := []struct {
+		name      string
+		server    *fakeAssetInventoryServer
+		opts      []Option
+		scope     string
+		wantNames []string
+		wantErr   string
+	}{
+		{
+			name: "dedupes_resources",
+			server: &fakeAssetInventoryServer{
+				searchAllResourcesData: &assetpb.SearchAllResourcesResponse{Results: results},
+			},
+			scope: "projects/test-project",
+			wantNames: []string{
+				"//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				"//storage.googleapis.com/test-bucket",
+			},
+		},
+		{
+			name: "allowed_services",
+			server: &fakeAssetInventoryServer{
+				searchAllResourcesData: &assetpb.SearchAllResourcesResponse{Results: results},
+			},
+			opts:      []Option{WithAllowedServices("storage.googleapis.com")},
+			scope:     "folders/123",
+			wantNames: []string{"//storage.googleapis.com/test-bucket"},
+		},
+		{
+			name:    "invalid_scope",
+			server:  &fakeAssetInventoryServer{},
+			scope:   "buckets/test-bucket",
+			wantErr: "invalid resource scope: buckets/test-bucket",
+		},
+		{
+			name: "search_error",
+			server: &fakeAssetInventoryServer{
+				searchAllResourcesErr: fmt.Errorf("search failed"),
+			},
+			scope:   "projects/test-project",
+			wantErr: `failed to search resources in scope "projects/test-project"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, tc.server)
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/test-project", tc.opts...)
+			if err != nil {
+				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+			}
+
+			got, err := p.ListResources(ctx, tc.scope)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tc.wantNames, got); diff != "" {
+				t.Errorf("ListResources got diff (-want, +got): %v", diff)
+			}
+			if err == nil && tc.server.gotResourcesScope != tc.scope {
+				t.Errorf("ListResources searched scope %q, want %q", tc.server.gotResourcesScope, tc.scope)
+			}
+		})
+	}
+}
+
+// blockingAssetInventoryServer blocks the searches until they're canceled.
+type blockingAssetInventoryServer struct {
+	assetpb.UnimplementedAssetServiceServer
+
+	started chan struct{}
+}
+
+func (s *blockingAssetInventoryServer) SearchAllResources(ctx context.Context, _ *assetpb.SearchAllResourcesRequest) (*assetpb.SearchAllResourcesResponse, error) {
+	close(s.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestProcessor_Stop(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fakeServer := &blockingAssetInventoryServer{started: make(chan struct{})}
+	addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+		assetpb.RegisterAssetServiceServer(s, fakeServer)
+	})
+	fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("creating client for fake at %q: %v", addr, err)
+	}
+	p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project")
+	if err != nil {
+		t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- p.Process(ctx, &v1alpha1.ResourceMapping{
+			Resource: &v1alpha1.Resource{
+				Provider: "gcp",
+				Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+			},
+		})
+	}()
+
+	select {
+	case <-fakeServer.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the search to start")
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Errorf("Stop got unexpected error: %v", err)
+	}
+
+	select {
+	case err := <-errCh:
+		if diff := testutil.DiffErrString(err, "processor stopped while processing resource"); diff != "" {
+			t.Error(diff)
+		}
+		if pmaperrors.Is(err) {
+			t.Errorf("Process got user facing error %v, want non user facing error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Process to return after Stop")
+	}
+
+	// Stop is idempotent.
+	if err := p.Stop(); err != nil {
+		t.Errorf("second Stop got unexpected error: %v", err)
+	}
+}
+
+func TestProcessor_StopOwnedClient(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		opts           []Option
+		wantClientOpen bool
+	}{
+		{
+			name: "owned_by_default",
+		},
+		{
+			name: "owned",
+			opts: []Option{WithOwnedClient(true)},
+		},
+		{
+			name:           "shared",
+			opts:           []Option{WithOwnedClient(false)},
+			wantClientOpen: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, &scopedFakeAssetInventoryServer{})
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project", tc.opts...)
+			if err != nil {
+				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+			}
+
+			if err := p.Stop(); err != nil {
+				t.Errorf("Stop got unexpected error: %v", err)
+			}
+
+			// A closed client fails the searches.
+			_, err = fakeAssetClient.SearchAllResources(ctx, &assetpb.SearchAllResourcesRequest{Scope: "projects/fake-project"}).Next()
+			if gotOpen := errors.Is(err, iterator.Done); gotOpen != tc.wantClientOpen {
+				t.Errorf("client open after Stop got %t (search error: %v), want %t", gotOpen, err, tc.wantClientOpen)
+			}
+		})
+	}
+}
+
+// scopedFakeAssetInventoryServer serves the resources found in each scope and
+// records the searched scopes.
+type scopedFakeAssetInventoryServer struct {
+	assetpb.UnimplementedAssetServiceServer
+
+	resources map[string][]*assetpb.ResourceSearchResult
+
+	mu                  sync.Mutex
+	gotResourcesScopes  []string
+	gotIAMPoliciesScope string
+}
+
+func (s *scopedFakeAssetInventoryServer) SearchAllResources(_ context.Context, req *assetpb.SearchAllResourcesRequest) (*assetpb.SearchAllResourcesResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gotResourcesScopes = append(s.gotResourcesScopes, req.GetScope())
+	return &assetpb.SearchAllResourcesResponse{Results: s.resources[req.GetScope()]}, nil
+}
+
+func (s *scopedFakeAssetInventoryServer) SearchAllIamPolicies(_ context.Context, req *assetpb.SearchAllIamPoliciesRequest) (*assetpb.SearchAllIamPoliciesResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gotIAMPoliciesScope = req.GetScope()
+	return &assetpb.SearchAllIamPoliciesResponse{}, nil
+}
+
+func TestProcessor_AdditionalResourceScopes(t *testing.T) {
+	t.Parallel()
+
+	resourceName := "//storage.googleapis.com/test-bucket"
+
+	cases := []struct {
+		name                string
+		additionalScopes    []string
+		resources           map[string][]*assetpb.ResourceSearchResult
+		wantResourcesScopes []string
+		wantIAMScope        string
+		wantLocation        string
+		wantNewErr          string
+		wantErr             string
+	}{
+		{
+			name:             "first_scope_hit",
+			additionalScopes: []string{"folders/123"},
+			resources: map[string][]*assetpb.ResourceSearchResult{
+				"projects/default-project": {{Name: resourceName, Location: "us"}},
+				"folders/123":              {{Name: resourceName, Location: "eu"}},
+			},
+			wantResourcesScopes: []string{"projects/default-project"},
+			wantIAMScope:        "projects/default-project",
+			wantLocation:        "us",
+		},
+		{
+			name:             "first_scope_miss_second_scope_hit",
+			additionalScopes: []string{"folders/123", "organizations/456"},
+			resources: map[string][]*assetpb.ResourceSearchResult{
+				"folders/123": {{Name: resourceName, Location: "eu"}},
+			},
+			wantResourcesScopes: []string{"projects/default-project", "folders/123"},
+			wantIAMScope:        "folders/123",
+			wantLocation:        "eu",
+		},
+		{
+			name:                "all_scopes_miss",
+			additionalScopes:    []string{"folders/123", "organizations/456"},
+			wantResourcesScopes: []string{"projects/default-project", "folders/123", "organizations/456"},
+			wantErr:             `failed to validate and enrich with resource "//storage.googleapis.com/test-bucket" in resourceScope "projects/default-project,folders/123,organizations/456": pmap process err: failed to get single matched resource: 0 matched resources found, expected 1 matched resource`,
+		},
+		{
+			name:             "multiple_matches_in_first_scope",
+			additionalScopes: []string{"folders/123"},
+			resources: map[string][]*assetpb.ResourceSearchResult{
+				"projects/default-project": {{Name: resourceName}, {Name: resourceName}},
+				"folders/123":              {{Name: resourceName}},
+			},
+			wantResourcesScopes: []string{"projects/default-project"},
+			wantErr:             "2 matched resources found, expected 1 matched resource",
+		},
+		{
+			name:             "invalid_additional_scope",
+			additionalScopes: []string{"buckets/foo"},
+			wantNewErr:       "invalid resource scope: buckets/foo",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			fakeServer := &scopedFakeAssetInventoryServer{resources: tc.resources}
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, fakeServer)
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/default-project",
+				WithAdditionalResourceScopes(tc.additionalScopes...))
+			if diff := testutil.DiffErrString(err, tc.wantNewErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			m := &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{Provider: "gcp", Name: resourceName},
+			}
+			err = p.Process(ctx, m)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			if diff := cmp.Diff(tc.wantResourcesScopes, fakeServer.gotResourcesScopes); diff != "" {
+				t.Errorf("Process got searched scopes diff (-want, +got): %v", diff)
+			}
+			if diff := cmp.Diff(tc.wantIAMScope, fakeServer.gotIAMPoliciesScope); diff != "" {
+				t.Errorf("Process got IAM policies scope diff (-want, +got): %v", diff)
+			}
+			if err != nil {
+				return
+			}
+			assetInfo := m.GetAnnotations().GetFields()[v1alpha1.AnnotationKeyAssetInfo].GetStructValue()
+			if got := assetInfo.GetFields()["location"].GetStringValue(); got != tc.wantLocation {
+				t.Errorf("Process got location %q, want %q", got, tc.wantLocation)
+			}
+		})
+	}
+}
+
+func TestProcessor_QuotaError(t *testing.T) {
+	t.Parallel()
+
+	resourceName := "//pubsub.googleapis.com/projects/test-project/topics/test-topic"
+
+	quotaErr := func(t *testing.T, retryDelay time.Duration) error {
+		t.Helper()
+		st := status.New(codes.ResourceExhausted, "quota exceeded")
+		if retryDelay == 0 {
+			return st.Err()
+		}
+		st, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)})
+		if err != nil {
+			t.Fatalf("failed to add retry info: %v", err)
+		}
+		return st.Err()
+	}
+
+	cases := []struct {
+		name           string
+		resourcesDelay time.Duration
+		resourcesQuota bool
+		iamDelay       time.Duration
+		iamQuota       bool
+		wantRetryAfter time.Duration
+		wantErr        string
+	}{
+		{
+			name:           "resources_quota_with_retry_delay",
+			resourcesQuota: true,
+			resourcesDelay: 30 * time.Second,
+			wantRetryAfter: 30 * time.Second,
+			wantErr:        "quota exceeded",
+		},
+		{
+			name:           "resources_quota_without_retry_delay",
+			resourcesQuota: true,
+			wantErr:        "quota exceeded",
+		},
+		{
+			name:           "iam_policies_quota_with_retry_delay",
+			iamQuota:       true,
+			iamDelay:       1500 * time.Millisecond,
+			wantRetryAfter: 1500 * time.Millisecond,
+			wantErr:        "failed to get IAM policies",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			fakeServer := &fakeAssetInventoryServer{
+				searchAllResourcesData: &assetpb.SearchAllResourcesResponse{
+					Results: []*assetpb.ResourceSearchResult{{Name: resourceName}},
+				},
+				searchAllIamPoliciesData: &assetpb.SearchAllIamPoliciesResponse{},
+			}
+			if tc.resourcesQuota {
+				fakeServer.searchAllResourcesErr = quotaErr(t, tc.resourcesDelay)
+			}
+			if tc.iamQuota {
+				fakeServer.searchAllIamPoliciesErr = quotaErr(t, tc.iamDelay)
+			}
+			addr, conn := testhelper.FakeGRPCServer(t, func(s *grpc.Server) {
+				assetpb.RegisterAssetServiceServer(s, fakeServer)
+			})
+			fakeAssetClient, err := asset.NewClient(ctx, option.WithGRPCConn(conn))
+			if err != nil {
+				t.Fatalf("creating client for fake at %q: %v", addr, err)
+			}
+			p, err := NewAssetInventoryProcessor(ctx, fakeAssetClient, "projects/fake-project")
+			if err != nil {
+				t.Fatalf("failed to create AssetInventoryProcessor: %v", err)
+			}
+
+			err = p.Process(ctx, &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{Provider: "gcp", Name: resourceName},
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if pmaperrors.Is(err) {
+				t.Errorf("Process got user facing error %v, want retryable error", err)
+			}
+
+			var gotRetryAfter time.Duration
+			var rerr *server.RetryAfterError
+			if errors.As(err, &rerr) {
+				gotRetryAfter = rerr.RetryAfter
+			}
+			if gotRetryAfter != tc.wantRetryAfter {
+				t.Errorf("Process got retry after %s, want %s", gotRetryAfter, tc.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestIsResourceNotFound(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "no_matched_resource",
+			err:  pmaperrors.New("failed to get single matched resource: %w", errNoMatchedResource),
+			want: true,
+		},
+		{
+			name: "not_found_status",
+			err:  fmt.Errorf("failed to search: %w", status.Error(codes.NotFound, "scope not found")),
+			want: true,
+		},
+		{
+			name: "permission_denied",
+			err:  pmaperrors.New("failed to get single matched resource: %w", status.Error(codes.PermissionDenied, "denied")),
+		},
+		{
+			name: "other_error",
+			err:  fmt.Errorf("connection refused"),
+		},
+		{
+			name: "nil",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := IsResourceNotFound(tc.err); got != tc.want {
+				t.Errorf("IsResourceNotFound(%v) got %t, want %t", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+// DefaultContactsProcessorName is the name of the DefaultContactsProcessor.
+const DefaultContactsProcessorName = "DefaultContactsProcessor"
+
+// AnnotationKeyContactsInheritedFrom is the annotation key recording the
+// ancestor the contacts are inherited from, e.g. "folders/123".
+const AnnotationKeyContactsInheritedFrom = "contactsInheritedFrom"
+
+// DefaultContactsProcessor injects the default contacts of the resource
+// ancestors into ResourceMappings without contacts. It relies on the ancestors
+// annotated by the AssetInventoryProcessor.
+type DefaultContactsProcessor struct {
+	// defaults are the contact emails keyed by ancestor as reported by Asset
+	// Inventory, e.g. "projects/123456", "folders/123" or "organizations/456".
+	defaults map[string][]string
+
+	// reservedAnnotationPrefix must match the prefix of the
+	// AssetInventoryProcessor, the inherited annotation is injected under it.
+	reservedAnnotationPrefix string
+}
+
+// NewDefaultContactsProcessor creates a new DefaultContactsProcessor with the
+// default contacts keyed by ancestor. The reservedAnnotationPrefix must be the
+// one the AssetInventoryProcessor is configured with.
+func NewDefaultContactsProcessor(defaults map[string][]string, reservedAnnotationPrefix string) *DefaultContactsProcessor {
+	return &DefaultContactsProcessor{
+		defaults:                 defaults,
+		reservedAnnotationPrefix: reservedAnnotationPrefix,
+	}
+}
+
+// Name returns the name of the processor other processors can depend on.
+func (p *DefaultContactsProcessor) Name() string {
+	return DefaultContactsProcessorName
+}
+
+// DependsOn returns the processors which must run before, the ancestors are
+// annotated by the AssetInventoryProcessor.
+func (p *DefaultContactsProcessor) DependsOn() []string {
+	return []string{AssetInventoryProcessorName}
+}
+
+// RunsAfter returns the processors which must run before when they're
+// configured, so they only validate the user annotations.
+func (p *DefaultContactsProcessor) RunsAfter() []string {
+	return slices.Clone(annotationValidatorNames)
+}
+
+// Process injects the default contacts of the most specific ancestor when the
+// ResourceMapping has no contacts, and records the ancestor in the
+// "contactsInheritedFrom" annotation. The project is the most specific
+// ancestor, followed by the folders in the order reported by Asset Inventory,
+// then the organization. ResourceMappings with contacts are left as is.
+func (p *DefaultContactsProcessor) Process(ctx context.Context, resourceMapping *v1alpha1.ResourceMapping) error {
+	logger := logging.FromContext(ctx).With("logger", fmt.Sprintf("%T", p))
+
+	l := server.PayloadLock(ctx)
+	l.Lock()
+	defer l.Unlock()
+
+	if len(resourceMapping.GetContacts().GetEmail()) > 0 {
+		return nil
+	}
+
+	assetInfoKey := v1alpha1.ReservedAnnotationKey(p.reservedAnnotationPrefix, v1alpha1.AnnotationKeyAssetInfo)
+	assetInfo := resourceMapping.GetAnnotations().GetFields()[assetInfoKey].GetStructValue()
+	var ancestors []string
+	for _, v := range assetInfo.GetFields()["ancestors"].GetListValue().GetValues() {
+		ancestors = append(ancestors, v.GetStringValue())
+	}
+
+	ancestor, emails := p.lookup(ancestors)
+	if ancestor == "" {
+		logger.DebugContext(ctx, "no default contacts found for ancestors",
+			"ancestors", ancestors)
+		return nil
+	}
+
+	resourceMapping.Contacts = &v1alpha1.Contacts{Email: slices.Clone(emails)}
+	if resourceMapping.GetAnnotations() == nil {
+		resourceMapping.Annotations = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+	}
+	inheritedKey := v1alpha1.ReservedAnnotationKey(p.reservedAnnotationPrefix, AnnotationKeyContactsInheritedFrom)
+	resourceMapping.Annotations.Fields[inheritedKey] = structpb.NewStringValue(ancestor)
+	return nil
+}
+
+// lookup returns the most specific ancestor with default contacts and its
+// contacts, the ancestor is empty if none is found.
+func (p *DefaultContactsProcessor) lookup(ancestors []string) (string, []string) {
+	ordered := slices.Clone(ancestors)
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		return ancestorRank(a) - ancestorRank(b)
+	})
+	for _, a := range ordered {
+		if emails := p.defaults[a]; len(emails) > 0 {
+			return a, emails
+		}
+	}
+	return "", nil
+}
+
+// ancestorRank ranks the ancestors from the most specific to the least.
+func ancestorRank(ancestor string) int {
+	switch {
+	case strings.HasPrefix(ancestor, "projects/"):
+		return 0
+	case strings.HasPrefix(ancestor, "folders/"):
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+func TestDefaultContactsProcessor_Process(t *testing.T) {
+	t.Parallel()
+
+	defaults := map[string][]string{
+		"organizations/456": {"org@example.com"},
+		"folders/123":       {"folder@example.com"},
+		"folders/789":       {"parent-folder@example.com"},
+		"projects/111":      {"project@example.com"},
+	}
+
+	assetInfo := func(prefix string, ancestors ...string) *structpb.Struct {
+		return &structpb.Struct{Fields: map[string]*structpb.Value{
+			prefix + v1alpha1.AnnotationKeyAssetInfo: structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+				"ancestors": structpb.NewListValue(&structpb.ListValue{Values: func() []*structpb.Value {
+					var vs []*structpb.Value
+					for _, a := range ancestors {
+						vs = append(vs, structpb.NewStringValue(a))
+					}
+					return vs
+				}()}),
+			}}),
+		}}
+	}
+	withInherited := func(s *structpb.Struct, key, ancestor string) *structpb.Struct {
+		s.Fields[key] = structpb.NewStringValue(ancestor)
+		return s
+	}
+
+	cases := []struct {
+		name   string
+		prefix string
+		input  *v1alpha1.ResourceMapping
+		want   *v1alpha1.ResourceMapping
+	}{
+		{
+			name: "contacts_present",
+			input: &v1alpha1.ResourceMapping{
+				Contacts:    &v1alpha1.Contacts{Email: []string{"owner@example.com"}},
+				Annotations: assetInfo("", "organizations/456", "folders/123", "projects/111"),
+			},
+			want: &v1alpha1.ResourceMapping{
+				Contacts:    &v1alpha1.Contacts{Email: []string{"owner@example.com"}},
+				Annotations: assetInfo("", "organizations/456", "folders/123", "projects/111"),
+			},
+		},
+		{
+			name: "inherit_from_project",
+			input: &v1alpha1.ResourceMapping{
+				Annotations: assetInfo("", "organizations/456", "folders/123", "projects/111"),
+			},
+			want: &v1alpha1.ResourceMapping{
+				Contacts: &v1alpha1.Contacts{Email: []string{"project@example.com"}},
+				Annotations: withInherited(assetInfo("", "organizations/456", "folders/123", "projects/111"),
+					AnnotationKeyContactsInheritedFrom, "projects/111"),
+			},
+		},
+		{
+			name: "inherit_from_closest_folder",
+			input: &v1alpha1.ResourceMapping{
+				Contacts:    &v1alpha1.Contacts{},
+				Annotations: assetInfo("", "organizations/456", "folders/123", "folders/789", "projects/222"),
+			},
+			want: &v1alpha1.ResourceMapping{
+				Contacts: &v1alpha1.Contacts{Email: []string{"folder@example.com"}},
+				Annotations: withInherited(assetInfo("", "organizations/456", "folders/123", "folders/789", "projects/222"),
+					AnnotationKeyContactsInheritedFrom, "folders/123"),
+			},
+		},
+		{
+			name: "inherit_from_organization",
+			input: &v1alpha1.ResourceMapping{
+				Annotations: assetInfo("", "organizations/456", "projects/222"),
+			},
+			want: &v1alpha1.ResourceMapping{
+				Contacts: &v1alpha1.Contacts{Email: []string{"org@example.com"}},
+				Annotations: withInherited(assetInfo("", "organizations/456", "projects/222"),
+					AnnotationKeyContactsInheritedFrom, "organizations/456"),
+			},
+		},
+		{
+			name:   "inherit_with_reserved_prefix",
+			prefix: "sys.",
+			input: &v1alpha1.ResourceMapping{
+				Annotations: assetInfo("sys.", "organizations/456"),
+			},
+			want: &v1alpha1.ResourceMapping{
+				Contacts: &v1alpha1.Contacts{Email: []string{"org@example.com"}},
+				Annotations: withInherited(assetInfo("sys.", "organizations/456"),
+					"sys."+AnnotationKeyContactsInheritedFrom, "organizations/456"),
+			},
+		},
+		{
+			name: "no_matching_ancestor",
+			input: &v1alpha1.ResourceMapping{
+				Annotations: assetInfo("", "organizations/999"),
+			},
+			want: &v1alpha1.ResourceMapping{
+				Annotations: assetInfo("", "organizations/999"),
+			},
+		},
+		{
+			name:  "no_ancestors",
+			input: &v1alpha1.ResourceMapping{},
+			want:  &v1alpha1.ResourceMapping{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := NewDefaultContactsProcessor(defaults, tc.prefix)
+			if err := p.Process(context.Background(), tc.input); err != nil {
+				t.Fatalf("Process got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, tc.input, protocmp.Transform()); diff != "" {
+				t.Errorf("Process got diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"slices"
+
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+// StrictProviderProcessorName is the name of the StrictProviderProcessor.
+const StrictProviderProcessorName = "StrictProviderProcessor"
+
+// ProviderProcessor is the interface to enrichment processors that only
+// process ResourceMappings of some resource providers, e.g. "gcp".
+type ProviderProcessor interface {
+	Providers() []string
+}
+
+// StrictProviderProcessor rejects ResourceMappings whose resource provider
+// isn't supported by any of the configured enrichment processors, which would
+// otherwise be passed through un-enriched.
+type StrictProviderProcessor struct {
+	providers []string
+}
+
+// NewStrictProviderProcessor creates a new StrictProviderProcessor supporting
+// the providers of the given processors. Processors that don't implement
+// ProviderProcessor are ignored.
+func NewStrictProviderProcessor(ps ...server.Processor[*v1alpha1.ResourceMapping]) *StrictProviderProcessor {
+	var providers []string
+	for _, p := range ps {
+		pp, ok := p.(ProviderProcessor)
+		if !ok {
+			continue
+		}
+		for _, provider := range pp.Providers() {
+			if !slices.Contains(providers, provider) {
+				providers = append(providers, provider)
+			}
+		}
+	}
+	slices.Sort(providers)
+	return &StrictProviderProcessor{providers: providers}
+}
+
+// Name returns the name of the processor other processors can depend on.
+func (p *StrictProviderProcessor) Name() string {
+	return StrictProviderProcessorName
+}
+
+// Process returns a user facing error if no processor supports the resource
+// provider of the ResourceMapping.
+func (p *StrictProviderProcessor) Process(ctx context.Context, resourceMapping *v1alpha1.ResourceMapping) error {
+	l := server.PayloadLock(ctx)
+	l.Lock()
+	defer l.Unlock()
+
+	provider := resourceMapping.GetResource().GetProvider()
+	if !slices.Contains(p.providers, provider) {
+		return pmaperrors.New("no processor supports resource provider %q, supported providers: %q", provider, p.providers)
+	}
+	return nil
+}
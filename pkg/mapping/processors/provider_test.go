@@ -0,0 +1,80 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+)
+
+func TestStrictProviderProcessor_Process(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		provider string
+		wantErr  string
+	}{
+		{
+			name:     "matched_provider",
+			provider: "gcp",
+		},
+		{
+			name:     "unmatched_provider",
+			provider: "aws",
+			wantErr:  `no processor supports resource provider "aws", supported providers: ["gcp"]`,
+		},
+		{
+			name:    "missing_provider",
+			wantErr: `no processor supports resource provider "", supported providers: ["gcp"]`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := NewStrictProviderProcessor(
+				&AssetInventoryProcessor{},
+				NewDefaultContactsProcessor(nil, ""),
+			)
+			err := p.Process(context.Background(), &v1alpha1.ResourceMapping{
+				Resource: &v1alpha1.Resource{Provider: tc.provider, Name: "//pubsub.googleapis.com/projects/test-project/topics/test-topic"},
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil && !pmaperrors.Is(err) {
+				t.Errorf("Process got error %v, want user facing error", err)
+			}
+		})
+	}
+}
+
+func TestStrictProviderProcessor_NoProviders(t *testing.T) {
+	t.Parallel()
+
+	p := NewStrictProviderProcessor()
+	err := p.Process(context.Background(), &v1alpha1.ResourceMapping{
+		Resource: &v1alpha1.Resource{Provider: "gcp"},
+	})
+	if diff := testutil.DiffErrString(err, `no processor supports resource provider "gcp", supported providers: []`); diff != "" {
+		t.Fatal(diff)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+// ResidencyProcessorName is the name of the ResidencyProcessor.
+const ResidencyProcessorName = "ResidencyProcessor"
+
+// AnnotationKeyResidency is the annotation key of the data residency of the
+// resource, e.g. "EU".
+const AnnotationKeyResidency = "residency"
+
+// ResidencyUnknown is the residency of the resources whose location isn't
+// mapped to any residency.
+const ResidencyUnknown = "unknown"
+
+// ResidencyProcessor annotates ResourceMappings with the data residency of
+// their resource location. It relies on the location annotated by the
+// AssetInventoryProcessor.
+type ResidencyProcessor struct {
+	// residencies are the residencies keyed by lower case location.
+	residencies map[string]string
+
+	// reservedAnnotationPrefix must match the prefix of the
+	// AssetInventoryProcessor, the residency annotation is injected under it.
+	reservedAnnotationPrefix string
+}
+
+// NewResidencyProcessor creates a new ResidencyProcessor with the locations
+// of each residency, e.g. {"EU": ["europe", "eu"]}. A location matches the
+// resource locations equal to it or starting with it followed by a "-", so
+// "europe" matches "europe-west1", locations are case insensitive. The
+// reservedAnnotationPrefix must be the one the AssetInventoryProcessor is
+// configured with.
+func NewResidencyProcessor(residencies map[string][]string, reservedAnnotationPrefix string) (*ResidencyProcessor, error) {
+	byLocation := make(map[string]string)
+	for _, residency := range slices.Sorted(maps.Keys(residencies)) {
+		if residency == "" {
+			return nil, fmt.Errorf("empty residency")
+		}
+		for _, l := range residencies[residency] {
+			l = strings.ToLower(l)
+			if l == "" {
+				return nil, fmt.Errorf("residency %q has an empty location", residency)
+			}
+			if other, ok := byLocation[l]; ok {
+				return nil, fmt.Errorf("location %q is mapped to both %q and %q", l, other, residency)
+			}
+			byLocation[l] = residency
+		}
+	}
+	return &ResidencyProcessor{
+		residencies:              byLocation,
+		reservedAnnotationPrefix: reservedAnnotationPrefix,
+	}, nil
+}
+
+// Name returns the name of the processor other processors can depend on.
+func (p *ResidencyProcessor) Name() string {
+	return ResidencyProcessorName
+}
+
+// DependsOn returns the processors which must run before, the location is
+// annotated by the AssetInventoryProcessor.
+func (p *ResidencyProcessor) DependsOn() []string {
+	return []string{AssetInventoryProcessorName}
+}
+
+// RunsAfter returns the processors which must run before when they're
+// configured, so they only validate the user annotations.
+func (p *ResidencyProcessor) RunsAfter() []string {
+	return slices.Clone(annotationValidatorNames)
+}
+
+// Process injects the residency of the resource location in the "residency"
+// annotation. It fails closed, the residency is "unknown" when the resource
+// has no location or its location isn't mapped.
+func (p *ResidencyProcessor) Process(ctx context.Context, resourceMapping *v1alpha1.ResourceMapping) error {
+	logger := logging.FromContext(ctx).With("logger", fmt.Sprintf("%T", p))
+
+	l := server.PayloadLock(ctx)
+	l.Lock()
+	defer l.Unlock()
+
+	assetInfoKey := v1alpha1.ReservedAnnotationKey(p.reservedAnnotationPrefix, v1alpha1.AnnotationKeyAssetInfo)
+	assetInfo := resourceMapping.GetAnnotations().GetFields()[assetInfoKey].GetStructValue()
+	location := assetInfo.GetFields()["location"].GetStringValue()
+
+	residency := p.lookup(location)
+	if residency == "" {
+		logger.WarnContext(ctx, "no residency found for location, falling back to unknown",
+			"resource", resourceMapping.GetResource().GetName(),
+			"location", location)
+		residency = ResidencyUnknown
+	}
+
+	if resourceMapping.GetAnnotations() == nil {
+		resourceMapping.Annotations = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+	}
+	residencyKey := v1alpha1.ReservedAnnotationKey(p.reservedAnnotationPrefix, AnnotationKeyResidency)
+	resourceMapping.Annotations.Fields[residencyKey] = structpb.NewStringValue(residency)
+	return nil
+}
+
+// lookup returns the residency of the location, the exact location is
+// preferred over its prefixes, e.g. "us-central1" over "us". It's empty if
+// none is found.
+func (p *ResidencyProcessor) lookup(location string) string {
+	l := strings.ToLower(location)
+	for l != "" {
+		if r, ok := p.residencies[l]; ok {
+			return r
+		}
+		i := strings.LastIndex(l, "-")
+		if i < 0 {
+			break
+		}
+		l = l[:i]
+	}
+	return ""
+}
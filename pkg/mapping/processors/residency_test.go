@@ -0,0 +1,183 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+func TestNewResidencyProcessor(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		residencies map[string][]string
+		wantErr     string
+	}{
+		{
+			name: "success",
+			residencies: map[string][]string{
+				"EU": {"europe", "eu"},
+				"US": {"us"},
+			},
+		},
+		{
+			name:        "empty_residency",
+			residencies: map[string][]string{"": {"us"}},
+			wantErr:     "empty residency",
+		},
+		{
+			name:        "empty_location",
+			residencies: map[string][]string{"US": {""}},
+			wantErr:     `residency "US" has an empty location`,
+		},
+		{
+			name: "duplicate_location",
+			residencies: map[string][]string{
+				"EU": {"europe"},
+				"US": {"us", "Europe"},
+			},
+			wantErr: `location "europe" is mapped to both "EU" and "US"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewResidencyProcessor(tc.residencies, "")
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Errorf("NewResidencyProcessor got unexpected error substring: %v", diff)
+			}
+		})
+	}
+}
+
+func TestResidencyProcessor_Process(t *testing.T) {
+	t.Parallel()
+
+	residencies := map[string][]string{
+		"EU":   {"europe", "eu"},
+		"US":   {"us", "northamerica"},
+		"APAC": {"asia", "australia"},
+		"CH":   {"europe-west6"},
+	}
+
+	assetInfo := func(prefix, location string) *structpb.Struct {
+		info := &structpb.Struct{Fields: map[string]*structpb.Value{}}
+		if location != "" {
+			info.Fields["location"] = structpb.NewStringValue(location)
+		}
+		return &structpb.Struct{Fields: map[string]*structpb.Value{
+			prefix + v1alpha1.AnnotationKeyAssetInfo: structpb.NewStructValue(info),
+		}}
+	}
+	withResidency := func(s *structpb.Struct, key, residency string) *structpb.Struct {
+		s.Fields[key] = structpb.NewStringValue(residency)
+		return s
+	}
+
+	cases := []struct {
+		name   string
+		prefix string
+		input  *v1alpha1.ResourceMapping
+		want   *v1alpha1.ResourceMapping
+	}{
+		{
+			name:  "region",
+			input: &v1alpha1.ResourceMapping{Annotations: assetInfo("", "europe-west1")},
+			want: &v1alpha1.ResourceMapping{
+				Annotations: withResidency(assetInfo("", "europe-west1"), AnnotationKeyResidency, "EU"),
+			},
+		},
+		{
+			name:  "zone",
+			input: &v1alpha1.ResourceMapping{Annotations: assetInfo("", "us-central1-a")},
+			want: &v1alpha1.ResourceMapping{
+				Annotations: withResidency(assetInfo("", "us-central1-a"), AnnotationKeyResidency, "US"),
+			},
+		},
+		{
+			name:  "multi_region_case_insensitive",
+			input: &v1alpha1.ResourceMapping{Annotations: assetInfo("", "EU")},
+			want: &v1alpha1.ResourceMapping{
+				Annotations: withResidency(assetInfo("", "EU"), AnnotationKeyResidency, "EU"),
+			},
+		},
+		{
+			name:  "exact_location_preferred",
+			input: &v1alpha1.ResourceMapping{Annotations: assetInfo("", "europe-west6")},
+			want: &v1alpha1.ResourceMapping{
+				Annotations: withResidency(assetInfo("", "europe-west6"), AnnotationKeyResidency, "CH"),
+			},
+		},
+		{
+			name:   "reserved_prefix",
+			prefix: "sys.",
+			input:  &v1alpha1.ResourceMapping{Annotations: assetInfo("sys.", "asia-east1")},
+			want: &v1alpha1.ResourceMapping{
+				Annotations: withResidency(assetInfo("sys.", "asia-east1"), "sys."+AnnotationKeyResidency, "APAC"),
+			},
+		},
+		{
+			name:  "unknown_location",
+			input: &v1alpha1.ResourceMapping{Annotations: assetInfo("", "me-central1")},
+			want: &v1alpha1.ResourceMapping{
+				Annotations: withResidency(assetInfo("", "me-central1"), AnnotationKeyResidency, ResidencyUnknown),
+			},
+		},
+		{
+			name:  "global_location",
+			input: &v1alpha1.ResourceMapping{Annotations: assetInfo("", "global")},
+			want: &v1alpha1.ResourceMapping{
+				Annotations: withResidency(assetInfo("", "global"), AnnotationKeyResidency, ResidencyUnknown),
+			},
+		},
+		{
+			name:  "no_location",
+			input: &v1alpha1.ResourceMapping{},
+			want: &v1alpha1.ResourceMapping{
+				Annotations: &structpb.Struct{Fields: map[string]*structpb.Value{
+					AnnotationKeyResidency: structpb.NewStringValue(ResidencyUnknown),
+				}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := NewResidencyProcessor(residencies, tc.prefix)
+			if err != nil {
+				t.Fatalf("NewResidencyProcessor got unexpected error: %v", err)
+			}
+			if err := p.Process(context.Background(), tc.input); err != nil {
+				t.Fatalf("Process got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, tc.input, protocmp.Transform()); diff != "" {
+				t.Errorf("Process got unexpected diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+// ObjectUpdateTimeProcessorName is the name of the ObjectUpdateTimeProcessor.
+const ObjectUpdateTimeProcessorName = "ObjectUpdateTimeProcessor"
+
+// AnnotationKeyObjectUpdateTime is the annotation key of the time the GCS
+// object of the ResourceMapping was last updated, e.g.
+// "2023-04-25T17:44:57.123Z".
+const AnnotationKeyObjectUpdateTime = "objectUpdateTime"
+
+// ObjectUpdateTimeProcessor annotates ResourceMappings with the update time
+// of their GCS object, which the handler takes from the notification.
+type ObjectUpdateTimeProcessor struct {
+	reservedAnnotationPrefix string
+}
+
+// NewObjectUpdateTimeProcessor creates a new ObjectUpdateTimeProcessor which
+// injects the annotation under the reservedAnnotationPrefix.
+func NewObjectUpdateTimeProcessor(reservedAnnotationPrefix string) *ObjectUpdateTimeProcessor {
+	return &ObjectUpdateTimeProcessor{reservedAnnotationPrefix: reservedAnnotationPrefix}
+}
+
+// Name returns the name of the processor other processors can depend on.
+func (p *ObjectUpdateTimeProcessor) Name() string {
+	return ObjectUpdateTimeProcessorName
+}
+
+// RunsAfter returns the processors which must run before when they're
+// configured, so they only validate the user annotations.
+func (p *ObjectUpdateTimeProcessor) RunsAfter() []string {
+	return slices.Clone(annotationValidatorNames)
+}
+
+// Process injects the object update time in UTC RFC 3339 format in the
+// "objectUpdateTime" annotation. ResourceMappings are left as is when the
+// notification has no update time.
+func (p *ObjectUpdateTimeProcessor) Process(ctx context.Context, resourceMapping *v1alpha1.ResourceMapping) error {
+	logger := logging.FromContext(ctx).With("logger", fmt.Sprintf("%T", p))
+
+	l := server.PayloadLock(ctx)
+	l.Lock()
+	defer l.Unlock()
+
+	t, ok := server.ObjectUpdateTimeFromContext(ctx)
+	if !ok {
+		logger.DebugContext(ctx, "notification has no object update time",
+			"resource", resourceMapping.GetResource().GetName())
+		return nil
+	}
+
+	if resourceMapping.GetAnnotations() == nil {
+		resourceMapping.Annotations = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+	}
+	key := v1alpha1.ReservedAnnotationKey(p.reservedAnnotationPrefix, AnnotationKeyObjectUpdateTime)
+	resourceMapping.Annotations.Fields[key] = structpb.NewStringValue(t.UTC().Format(time.RFC3339Nano))
+	return nil
+}
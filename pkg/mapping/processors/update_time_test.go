@@ -0,0 +1,93 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+func TestObjectUpdateTimeProcessor_Process(t *testing.T) {
+	t.Parallel()
+
+	updated := time.Date(2023, time.April, 25, 17, 44, 57, 123_000_000, time.FixedZone("PDT", -7*60*60))
+
+	cases := []struct {
+		name            string
+		updateTime      *time.Time
+		prefix          string
+		resourceMapping *v1alpha1.ResourceMapping
+		want            *v1alpha1.ResourceMapping
+	}{
+		{
+			name:            "update_time",
+			updateTime:      &updated,
+			resourceMapping: &v1alpha1.ResourceMapping{},
+			want: &v1alpha1.ResourceMapping{
+				Annotations: &structpb.Struct{Fields: map[string]*structpb.Value{
+					AnnotationKeyObjectUpdateTime: structpb.NewStringValue("2023-04-26T00:44:57.123Z"),
+				}},
+			},
+		},
+		{
+			name:       "reserved_prefix",
+			updateTime: &updated,
+			prefix:     "sys.",
+			resourceMapping: &v1alpha1.ResourceMapping{
+				Annotations: &structpb.Struct{Fields: map[string]*structpb.Value{
+					"env": structpb.NewStringValue("dev"),
+				}},
+			},
+			want: &v1alpha1.ResourceMapping{
+				Annotations: &structpb.Struct{Fields: map[string]*structpb.Value{
+					"env":                  structpb.NewStringValue("dev"),
+					"sys.objectUpdateTime": structpb.NewStringValue("2023-04-26T00:44:57.123Z"),
+				}},
+			},
+		},
+		{
+			name:            "no_update_time",
+			resourceMapping: &v1alpha1.ResourceMapping{},
+			want:            &v1alpha1.ResourceMapping{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if tc.updateTime != nil {
+				ctx = server.WithObjectUpdateTime(ctx, *tc.updateTime)
+			}
+
+			p := NewObjectUpdateTimeProcessor(tc.prefix)
+			if err := p.Process(ctx, tc.resourceMapping); err != nil {
+				t.Fatalf("Process got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, tc.resourceMapping, protocmp.Transform()); diff != "" {
+				t.Errorf("Process got diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
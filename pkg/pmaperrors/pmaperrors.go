@@ -38,7 +38,9 @@ func Wrap(err error) error {
 	return &processError{err}
 }
 
-// Is checks if a error is of type processError.
+// Is checks if a error is of type processError. Joined errors, e.g. from
+// [errors.Join], are user facing if any of the joined errors is, so a user
+// facing error isn't lost when it's combined with an internal error.
 func Is(err error) bool {
 	var rerr *processError
 	return errors.As(err, &rerr)
@@ -0,0 +1,85 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pmaperrors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIs(t *testing.T) {
+	t.Parallel()
+
+	userErr := New("invalid resource name %q", "foo")
+	internalErr := errors.New("failed to search resources")
+
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "nil",
+			err:  nil,
+			want: false,
+		},
+		{
+			name: "user_facing",
+			err:  userErr,
+			want: true,
+		},
+		{
+			name: "internal",
+			err:  internalErr,
+			want: false,
+		},
+		{
+			name: "wrapped_user_facing",
+			err:  fmt.Errorf("failed to process object: %w", userErr),
+			want: true,
+		},
+		{
+			name: "joined_user_facing_and_internal",
+			err:  errors.Join(userErr, internalErr),
+			want: true,
+		},
+		{
+			name: "joined_internal_and_user_facing",
+			err:  errors.Join(internalErr, fmt.Errorf("processor: %w", userErr)),
+			want: true,
+		},
+		{
+			name: "nested_joined_user_facing",
+			err:  fmt.Errorf("failed to process object: %w", errors.Join(internalErr, errors.Join(internalErr, userErr))),
+			want: true,
+		},
+		{
+			name: "joined_internal",
+			err:  errors.Join(internalErr, errors.New("failed to marshal event")),
+			want: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := Is(tc.err); got != tc.want {
+				t.Errorf("Is(%v) got %t, want %t", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package processors provides essential processors for pmap policies.
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+	"github.com/abcxyz/pmap/pkg/server"
+)
+
+const (
+	// FieldKeyPolicyID is the key of the policy ID field in a policy payload.
+	FieldKeyPolicyID = "policy_id"
+	// FieldKeyDeletionTimeline is the key of the deletion timeline field in a
+	// policy payload.
+	FieldKeyDeletionTimeline = "deletion_timeline"
+)
+
+// requiredFields are the fields every policy payload must contain.
+var requiredFields = []string{
+	FieldKeyPolicyID,
+	FieldKeyDeletionTimeline,
+}
+
+// PolicyValidationProcessor validates that policy payloads contain all the
+// required fields.
+type PolicyValidationProcessor struct{}
+
+// NewPolicyValidationProcessor creates a new PolicyValidationProcessor.
+func NewPolicyValidationProcessor() *PolicyValidationProcessor {
+	return &PolicyValidationProcessor{}
+}
+
+// Process validates the policy payload. Missing or empty required fields are
+// returned as a user facing error.
+func (p *PolicyValidationProcessor) Process(ctx context.Context, policy *structpb.Struct) error {
+	logger := logging.FromContext(ctx).With("logger", fmt.Sprintf("%T", p))
+
+	l := server.PayloadLock(ctx)
+	l.Lock()
+	defer l.Unlock()
+
+	var vErr error
+	for _, k := range requiredFields {
+		v, ok := policy.GetFields()[k]
+		if !ok || isEmptyValue(v) {
+			vErr = errors.Join(vErr, fmt.Errorf("missing required field %q", k))
+		}
+	}
+	if vErr != nil {
+		logger.DebugContext(ctx, "policy validation failed", "error", vErr)
+		return pmaperrors.New("invalid policy: %w", vErr)
+	}
+	return nil
+}
+
+// isEmptyValue reports whether the given value is null or holds an empty
+// string, list or struct.
+func isEmptyValue(v *structpb.Value) bool {
+	switch k := v.GetKind().(type) {
+	case nil, *structpb.Value_NullValue:
+		return true
+	case *structpb.Value_StringValue:
+		return k.StringValue == ""
+	case *structpb.Value_ListValue:
+		return len(k.ListValue.GetValues()) == 0
+	case *structpb.Value_StructValue:
+		return len(k.StructValue.GetFields()) == 0
+	default:
+		return false
+	}
+}
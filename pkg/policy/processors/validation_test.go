@@ -0,0 +1,100 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package processors
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+)
+
+func TestPolicyValidationProcessor_Process(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		policy        *structpb.Struct
+		wantErrSubstr string
+	}{
+		{
+			name: "success",
+			policy: &structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"policy_id": structpb.NewStringValue("fake-policy-123"),
+					"deletion_timeline": structpb.NewListValue(&structpb.ListValue{
+						Values: []*structpb.Value{structpb.NewStringValue("356 days")},
+					}),
+				},
+			},
+		},
+		{
+			name: "missing_policy_id",
+			policy: &structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"deletion_timeline": structpb.NewListValue(&structpb.ListValue{
+						Values: []*structpb.Value{structpb.NewStringValue("356 days")},
+					}),
+				},
+			},
+			wantErrSubstr: `missing required field "policy_id"`,
+		},
+		{
+			name: "empty_policy_id",
+			policy: &structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"policy_id": structpb.NewStringValue(""),
+					"deletion_timeline": structpb.NewListValue(&structpb.ListValue{
+						Values: []*structpb.Value{structpb.NewStringValue("356 days")},
+					}),
+				},
+			},
+			wantErrSubstr: `missing required field "policy_id"`,
+		},
+		{
+			name: "empty_deletion_timeline",
+			policy: &structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"policy_id":         structpb.NewStringValue("fake-policy-123"),
+					"deletion_timeline": structpb.NewListValue(&structpb.ListValue{}),
+				},
+			},
+			wantErrSubstr: `missing required field "deletion_timeline"`,
+		},
+		{
+			name:          "empty_policy",
+			policy:        &structpb.Struct{},
+			wantErrSubstr: "missing required field \"policy_id\"\nmissing required field \"deletion_timeline\"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := NewPolicyValidationProcessor()
+			gotErr := p.Process(context.Background(), tc.policy)
+			if diff := testutil.DiffErrString(gotErr, tc.wantErrSubstr); diff != "" {
+				t.Errorf("Process(%+v) got unexpected error substring: %v", tc.name, diff)
+			}
+			if gotErr != nil && !pmaperrors.Is(gotErr) {
+				t.Errorf("Process(%+v) got error %v, want a pmaperrors error", tc.name, gotErr)
+			}
+		})
+	}
+}
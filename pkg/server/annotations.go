@@ -0,0 +1,60 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// annotationsGetter is implemented by payloads with annotations such as
+// [v1alpha1.ResourceMapping].
+type annotationsGetter interface {
+	GetAnnotations() *structpb.Struct
+}
+
+// dropEmptyValues recursively removes the empty structs and lists from the
+// struct, including the ones which are only empty once their own empty values
+// are removed, e.g. "assetInfo: {iamPolicies: []}". The struct itself is kept
+// even if it ends up empty.
+func dropEmptyValues(s *structpb.Struct) {
+	for k, v := range s.GetFields() {
+		if isEmptyAfterDrop(v) {
+			delete(s.Fields, k)
+		}
+	}
+}
+
+// isEmptyAfterDrop removes the empty values nested in v and returns whether v
+// is an empty struct or list afterwards.
+func isEmptyAfterDrop(v *structpb.Value) bool {
+	switch k := v.GetKind().(type) {
+	case *structpb.Value_StructValue:
+		dropEmptyValues(k.StructValue)
+		return len(k.StructValue.GetFields()) == 0
+	case *structpb.Value_ListValue:
+		values := k.ListValue.GetValues()[:0]
+		for _, e := range k.ListValue.GetValues() {
+			if !isEmptyAfterDrop(e) {
+				values = append(values, e)
+			}
+		}
+		if k.ListValue != nil {
+			k.ListValue.Values = values
+		}
+		return len(values) == 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestDropEmptyValues(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   map[string]any
+		want map[string]any
+	}{
+		{
+			name: "no_empty_values",
+			in: map[string]any{
+				"a": "b",
+				"c": map[string]any{"d": 1.0},
+				"e": []any{"f"},
+			},
+			want: map[string]any{
+				"a": "b",
+				"c": map[string]any{"d": 1.0},
+				"e": []any{"f"},
+			},
+		},
+		{
+			name: "empty_struct_and_list",
+			in: map[string]any{
+				"a": "b",
+				"c": map[string]any{},
+				"e": []any{},
+			},
+			want: map[string]any{"a": "b"},
+		},
+		{
+			name: "nested_empty_values",
+			in: map[string]any{
+				"assetInfo": map[string]any{
+					"iamPolicies": []any{},
+					"ancestors":   map[string]any{"projects": []any{map[string]any{}}},
+				},
+				"labels": map[string]any{"env": "prod", "owners": []any{}},
+			},
+			want: map[string]any{
+				"labels": map[string]any{"env": "prod"},
+			},
+		},
+		{
+			name: "empty_list_elements",
+			in: map[string]any{
+				"tags": []any{map[string]any{}, "team", []any{}, map[string]any{"a": []any{}}},
+			},
+			want: map[string]any{
+				"tags": []any{"team"},
+			},
+		},
+		{
+			name: "keeps_zero_scalars",
+			in: map[string]any{
+				"a": "",
+				"b": 0.0,
+				"c": false,
+				"d": nil,
+			},
+			want: map[string]any{
+				"a": "",
+				"b": 0.0,
+				"c": false,
+				"d": nil,
+			},
+		},
+		{
+			name: "all_empty",
+			in: map[string]any{
+				"a": map[string]any{"b": []any{}},
+			},
+			want: map[string]any{},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := structpb.NewStruct(tc.in)
+			if err != nil {
+				t.Fatalf("failed to create struct: %v", err)
+			}
+			dropEmptyValues(s)
+			if diff := cmp.Diff(tc.want, s.AsMap()); diff != "" {
+				t.Errorf("dropEmptyValues got unexpected diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestDropEmptyValues_Nil(t *testing.T) {
+	t.Parallel()
+
+	// The payloads without annotations have a nil struct.
+	dropEmptyValues(nil)
+}
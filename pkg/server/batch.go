@@ -0,0 +1,111 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// FlushMessenger is a [Messenger] buffering the events, which are only
+// guaranteed to be sent once Flush returns. [EventHandler.Cleanup] flushes
+// the messengers of the handler.
+type FlushMessenger interface {
+	Messenger
+
+	// Flush waits for the buffered events to be sent and returns the errors
+	// of the events which failed.
+	Flush(ctx context.Context) error
+}
+
+var _ FlushMessenger = (*BatchMessenger)(nil)
+
+// BatchMessenger implements the FlushMessenger interface for Google Cloud
+// PubSub, meant for high throughput backfills. Unlike the [PubSubMessenger],
+// Send doesn't wait for the event to be published, the events are published
+// in the background in batches as large as Pub/Sub allows. The publish errors
+// are returned by Flush, so a failed event is not redelivered by the handler.
+//
+// It must not be used behind the push handler of [EventHandler.HTTPHandler]:
+// Send returns nil before the event is published, so the notification is
+// acked and lost when the publish fails.
+type BatchMessenger struct {
+	messenger *PubSubMessenger
+
+	mu      sync.Mutex
+	pending []*pendingPublish
+}
+
+// pendingPublish is an event published in the background.
+type pendingPublish struct {
+	objectID string
+	result   *pubsub.PublishResult
+}
+
+// NewBatchMessenger creates a new instance of the BatchMessenger. It
+// configures the topic to publish batches of up to
+// [pubsub.MaxPublishRequestCount] messages and [pubsub.MaxPublishRequestBytes]
+// bytes, so it must be done before the topic is used.
+func NewBatchMessenger(topic *pubsub.Topic, opts ...PubSubMessengerOption) *BatchMessenger {
+	topic.PublishSettings.CountThreshold = pubsub.MaxPublishRequestCount
+	topic.PublishSettings.ByteThreshold = pubsub.MaxPublishRequestBytes
+	return &BatchMessenger{messenger: NewPubSubMessenger(topic, opts...)}
+}
+
+// Send publishes the event in the background, it only fails when the event
+// can't be published at all, e.g. it's over the Pub/Sub size limits.
+func (b *BatchMessenger) Send(ctx context.Context, data []byte, attr map[string]string) error {
+	m, err := b.messenger.newMessage(data, attr)
+	if err != nil {
+		return err
+	}
+
+	// The publish outlives the request, don't cancel it along with ctx.
+	result := b.messenger.topic.Publish(context.WithoutCancel(ctx), m)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, &pendingPublish{objectID: attr[AttrKeyObjectID], result: result})
+	return nil
+}
+
+// Flush waits for the events sent so far to be published, and returns the
+// joined errors of the events which failed to be published.
+func (b *BatchMessenger) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var merr error
+	for _, p := range pending {
+		if _, err := p.result.Get(ctx); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("pubsub failed to publish message of object %q: %w", p.objectID, err))
+		}
+	}
+	logging.FromContext(ctx).InfoContext(ctx, "flushed messages",
+		"topic", b.messenger.topic.String(),
+		"count", len(pending))
+	return merr
+}
@@ -0,0 +1,196 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestBatchMessenger_Flush(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name               string
+		pubSubServerOption pstest.ServerReactorOption
+		events             int
+		wantErr            string
+		wantPublished      int
+	}{
+		{
+			name:          "all_published",
+			events:        25,
+			wantPublished: 25,
+		},
+		{
+			name: "nothing_sent",
+		},
+		{
+			name:               "publish_error",
+			pubSubServerOption: pstest.WithErrorInjection("Publish", codes.NotFound, injectedPublishError),
+			events:             2,
+			wantErr:            `pubsub failed to publish message of object "object-1"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			svr, testTopic := testNewPubSubServerTopic(ctx, t, tc.pubSubServerOption)
+
+			m := NewBatchMessenger(testTopic)
+			want := make([]string, 0, tc.events)
+			for i := range tc.events {
+				data := fmt.Sprintf(`{"id":%d}`, i)
+				want = append(want, data)
+				if err := m.Send(ctx, []byte(data), map[string]string{AttrKeyObjectID: fmt.Sprintf("object-%d", i)}); err != nil {
+					t.Fatalf("Send got unexpected error: %v", err)
+				}
+			}
+
+			err := m.Flush(ctx)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+
+			got := make([]string, 0, len(svr.Messages()))
+			for _, msg := range svr.Messages() {
+				got = append(got, string(msg.Data))
+			}
+			if len(got) != tc.wantPublished {
+				t.Fatalf("got %d published messages, want %d", len(got), tc.wantPublished)
+			}
+			slices.Sort(got)
+			slices.Sort(want)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("published data diff (-want, +got): %v", diff)
+			}
+
+			// The published events are not flushed again.
+			if err := m.Flush(ctx); err != nil {
+				t.Errorf("second Flush got unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestBatchMessenger_SendOversized(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	_, testTopic := testNewPubSubServerTopic(ctx, t)
+
+	err := NewBatchMessenger(testTopic).Send(ctx, make([]byte, MaxTopicDataBytes+1), nil)
+	if diff := testutil.DiffErrString(err, "exceed max size allowed"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestEventHandler_CleanupFlushesMessengers(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name               string
+		pubSubServerOption pstest.ServerReactorOption
+		wantErr            string
+		wantPublished      int
+	}{
+		{
+			name:          "flushed",
+			wantPublished: 1,
+		},
+		{
+			name:               "flush_error",
+			pubSubServerOption: pstest.WithErrorInjection("Publish", codes.NotFound, injectedPublishError),
+			wantErr:            "failed to flush messenger",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			svr, testTopic := testNewPubSubServerTopic(ctx, t, tc.pubSubServerOption)
+
+			h, err := NewHandler(ctx, []Processor[*structpb.Struct]{&testProcessor{}}, NewBatchMessenger(testTopic),
+				WithObjectStore(&testObjectStore{data: map[string][]byte{"foo/bar": []byte(`foo: bar`)}}),
+				WithOptionalGitHubSource())
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+			if err := h.Handle(ctx, pubsub.Message{
+				Attributes: map[string]string{AttrKeyBucketID: "foo", AttrKeyObjectID: "bar"},
+			}); err != nil {
+				t.Fatalf("Handle got unexpected error: %v", err)
+			}
+
+			err = h.Cleanup()
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+			if got := len(svr.Messages()); got != tc.wantPublished {
+				t.Errorf("got %d published messages, want %d", got, tc.wantPublished)
+			}
+		})
+	}
+}
+
+// testDeadlineMessenger is a FlushMessenger recording the deadline of the
+// flush context.
+type testDeadlineMessenger struct {
+	testRawMessenger
+
+	hasDeadline bool
+}
+
+func (m *testDeadlineMessenger) Flush(ctx context.Context) error {
+	_, m.hasDeadline = ctx.Deadline()
+	return nil
+}
+
+func TestEventHandler_CleanupFlushDeadline(t *testing.T) {
+	t.Parallel()
+
+	m := &testDeadlineMessenger{}
+	h, err := NewHandler(context.Background(), []Processor[*structpb.Struct]{}, m, WithObjectStore(&testObjectStore{}))
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+	if err := h.Cleanup(); err != nil {
+		t.Fatalf("Cleanup got unexpected error: %v", err)
+	}
+	if !m.hasDeadline {
+		t.Errorf("Cleanup flushed without a deadline, want one")
+	}
+}
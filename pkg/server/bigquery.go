@@ -0,0 +1,112 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/uuid"
+)
+
+// BigQuerySubscriptionName is the value of the subscription_name column of the
+// rows inserted by the [BigQueryMessenger], which has no Pub/Sub subscription.
+const BigQuerySubscriptionName = "pmap-bigquery-messenger"
+
+// bigQueryInserter inserts rows into a BigQuery table, it's implemented by
+// [bigquery.Inserter].
+type bigQueryInserter interface {
+	Put(ctx context.Context, src any) error
+}
+
+// BigQueryMessenger implements the Messenger interface by streaming the events
+// directly into a BigQuery table, for deployments which don't need Pub/Sub.
+// The table has the schema of the tables written by the Pub/Sub BigQuery
+// subscriptions: the event data is inserted in the data column and the
+// attributes as a JSON object in the attributes column. As there is no
+// subscription, the message_id column is a random UUID, the publish_time
+// column is the insert time and the subscription_name column is
+// [BigQuerySubscriptionName].
+type BigQueryMessenger struct {
+	inserter bigQueryInserter
+	now      func() time.Time
+}
+
+// NewBigQueryMessenger creates a new instance of the BigQueryMessenger
+// inserting the events into the table of the client's project, formatted as
+// "<dataset>.<table>".
+func NewBigQueryMessenger(client *bigquery.Client, table string) (*BigQueryMessenger, error) {
+	if client == nil {
+		return nil, fmt.Errorf("bigquery client cannot be nil")
+	}
+	datasetID, tableID, ok := strings.Cut(table, ".")
+	if !ok || datasetID == "" || tableID == "" || strings.Contains(tableID, ".") {
+		return nil, fmt.Errorf("bigquery table must be formatted as <dataset>.<table>: %q", table)
+	}
+	return &BigQueryMessenger{
+		inserter: client.Dataset(datasetID).Table(tableID).Inserter(),
+		now:      time.Now,
+	}, nil
+}
+
+// Send inserts the event into the table as a single row.
+func (m *BigQueryMessenger) Send(ctx context.Context, data []byte, attr map[string]string) error {
+	// The attributes column is required, store an empty object rather than
+	// null.
+	if attr == nil {
+		attr = map[string]string{}
+	}
+	attributes, err := json.Marshal(attr)
+	if err != nil {
+		return fmt.Errorf("failed to marshal attributes: %w", err)
+	}
+
+	row := &bigQueryRow{
+		data:        string(data),
+		attributes:  string(attributes),
+		messageID:   uuid.NewString(),
+		publishTime: m.now(),
+	}
+	if err := m.inserter.Put(ctx, row); err != nil {
+		return fmt.Errorf("bigquery failed to insert event: %w", err)
+	}
+	return nil
+}
+
+// bigQueryRow is a row of the events table, see [BigQueryMessenger].
+type bigQueryRow struct {
+	data        string
+	attributes  string
+	messageID   string
+	publishTime time.Time
+}
+
+// Save implements [bigquery.ValueSaver]. The message ID is the insert ID, so
+// BigQuery deduplicates the row when the client retries the insert. It's
+// random per Send, so the events sent again for a Pub/Sub redelivery are
+// inserted again, see [WithDedupCache].
+func (r *bigQueryRow) Save() (map[string]bigquery.Value, string, error) {
+	return map[string]bigquery.Value{
+		"data":              r.data,
+		"attributes":        r.attributes,
+		"message_id":        r.messageID,
+		"publish_time":      r.publishTime,
+		"subscription_name": BigQuerySubscriptionName,
+	}, r.messageID, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"google.golang.org/api/option"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakeInserter records the rows put and fails with returnErr if set.
+type fakeInserter struct {
+	rows      []any
+	returnErr error
+}
+
+func (i *fakeInserter) Put(_ context.Context, src any) error {
+	if i.returnErr != nil {
+		return i.returnErr
+	}
+	i.rows = append(i.rows, src)
+	return nil
+}
+
+func TestBigQueryMessenger_Send(t *testing.T) {
+	t.Parallel()
+
+	publishTime := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	data := []byte(`{"type":"abcxyz.pmap.ResourceMapping"}`)
+
+	cases := []struct {
+		name           string
+		attr           map[string]string
+		insertErr      error
+		wantAttributes string
+		wantErr        string
+	}{
+		{
+			name:           "success",
+			attr:           map[string]string{AttrKeyOutcome: OutcomeSuccess, AttrKeyObjectID: "foo/bar.yaml"},
+			wantAttributes: `{"objectId":"foo/bar.yaml","pmapOutcome":"success"}`,
+		},
+		{
+			name:           "nil_attributes",
+			wantAttributes: `{}`,
+		},
+		{
+			name:      "insert_error",
+			insertErr: fmt.Errorf("injected insert error"),
+			wantErr:   "bigquery failed to insert event: injected insert error",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			inserter := &fakeInserter{returnErr: tc.insertErr}
+			m := &BigQueryMessenger{
+				inserter: inserter,
+				now:      func() time.Time { return publishTime },
+			}
+
+			err := m.Send(context.Background(), data, tc.attr)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+
+			if got, want := len(inserter.rows), 1; got != want {
+				t.Fatalf("got %d rows inserted, want %d", got, want)
+			}
+			saver, ok := inserter.rows[0].(bigquery.ValueSaver)
+			if !ok {
+				t.Fatalf("got row of type %T, want a bigquery.ValueSaver", inserter.rows[0])
+			}
+			got, insertID, err := saver.Save()
+			if err != nil {
+				t.Fatalf("failed to save row: %v", err)
+			}
+
+			if _, err := uuid.Parse(insertID); err != nil {
+				t.Errorf("got insert ID %q, want a UUID: %v", insertID, err)
+			}
+			want := map[string]bigquery.Value{
+				"data":              string(data),
+				"attributes":        tc.wantAttributes,
+				"message_id":        insertID,
+				"publish_time":      publishTime,
+				"subscription_name": BigQuerySubscriptionName,
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("inserted row (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewBigQueryMessenger(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, err := bigquery.NewClient(ctx, "test-project", option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("failed to create bigquery client: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := client.Close(); err != nil {
+			t.Logf("failed to close bigquery client: %v", err)
+		}
+	})
+
+	cases := []struct {
+		name    string
+		client  *bigquery.Client
+		table   string
+		wantErr string
+	}{
+		{
+			name:   "success",
+			client: client,
+			table:  "pmap.mapping",
+		},
+		{
+			name:    "nil_client",
+			table:   "pmap.mapping",
+			wantErr: "bigquery client cannot be nil",
+		},
+		{
+			name:    "missing_dataset",
+			client:  client,
+			table:   "mapping",
+			wantErr: `bigquery table must be formatted as <dataset>.<table>: "mapping"`,
+		},
+		{
+			name:    "empty_table",
+			client:  client,
+			table:   "pmap.",
+			wantErr: `bigquery table must be formatted as <dataset>.<table>: "pmap."`,
+		},
+		{
+			name:    "project_qualified",
+			client:  client,
+			table:   "test-project.pmap.mapping",
+			wantErr: `bigquery table must be formatted as <dataset>.<table>: "test-project.pmap.mapping"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewBigQueryMessenger(tc.client, tc.table)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -17,9 +17,12 @@ package server
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
 )
 
 // allowedScopes showes the scopes that are supported
@@ -40,8 +43,97 @@ type HandlerConfig struct {
 	SuccessTopicID string `env:"PMAP_SUCCESS_TOPIC_ID,required"`
 	// FailureTopicID is optional for policy service
 	FailureTopicID string `env:"PMAP_FAILURE_TOPIC_ID"`
+	// IndexTopicID is optional, a minimal index event is published to it
+	// for every successfully processed object when set.
+	IndexTopicID string `env:"PMAP_INDEX_TOPIC_ID"`
+	// DualWriteTopicID is optional, every success event is also published to
+	// it in the other JSON key casing than JSONKeyCasing when set, so the
+	// consumers can migrate between the casings independently.
+	DualWriteTopicID string `env:"PMAP_DUAL_WRITE_TOPIC_ID"`
+	// HandleTimeout is the maximum duration to handle an event, no timeout
+	// is enforced when it's zero.
+	HandleTimeout time.Duration `env:"PMAP_HANDLE_TIMEOUT"`
+	// FilePathFallback sets how the file path is derived for objects without
+	// the GCSPathSeparatorKey, the file path is left empty when it's empty.
+	FilePathFallback string `env:"PMAP_FILE_PATH_FALLBACK"`
+	// RateLimitQPS is the maximum number of requests served per second,
+	// requests over the limit are rejected with 429. No rate limit is
+	// enforced when it's zero.
+	RateLimitQPS float64 `env:"PMAP_RATE_LIMIT_QPS"`
+	// RateLimitBurst is the maximum number of requests served at once when
+	// RateLimitQPS is set.
+	RateLimitBurst int `env:"PMAP_RATE_LIMIT_BURST,default=1"`
+	// JSONKeyCasing sets the casing of the keys of the emitted events, the
+	// lowerCamelCase JSON names are used when it's empty.
+	JSONKeyCasing string `env:"PMAP_JSON_KEY_CASING"`
+	// ObjectMetadataAttribute attaches the complete custom metadata of the
+	// GCS object to the emitted events, truncated to fit the Pub/Sub limit.
+	ObjectMetadataAttribute bool `env:"PMAP_OBJECT_METADATA_ATTRIBUTE"`
+	// SequenceAttribute numbers the emitted events with a best-effort
+	// per-process sequence attribute.
+	SequenceAttribute bool `env:"PMAP_SEQUENCE_ATTRIBUTE"`
+	// WarningsAttribute attaches the warnings added by the processors to the
+	// success events.
+	WarningsAttribute bool `env:"PMAP_WARNINGS_ATTRIBUTE"`
+	// RequireProvenance fails notifications without object metadata, e.g.
+	// with payloadFormat NONE, instead of emitting events without the GitHub
+	// provenance.
+	RequireProvenance bool `env:"PMAP_REQUIRE_PROVENANCE"`
+	// LogFailureEvents logs the failure events at error level when no failure
+	// topic is configured instead of dropping them.
+	LogFailureEvents bool `env:"PMAP_LOG_FAILURE_EVENTS"`
+	// StaticAttributes are "key=value" attributes added to every emitted
+	// event, e.g. "deployment=prod".
+	StaticAttributes []string `env:"PMAP_STATIC_ATTRIBUTES"`
+	// Sink sets where the events are emitted, the Pub/Sub topics are used
+	// when it's empty. The project and topic IDs are ignored when the events
+	// are written to stdout.
+	Sink string `env:"PMAP_SINK"`
+	// LocalOutputFile appends the events to the file as newline delimited
+	// JSON instead of emitting them to the sink, e.g. to run the servers
+	// locally without Pub/Sub. The project and topic IDs are ignored when
+	// it's set.
+	LocalOutputFile string `env:"PMAP_LOCAL_OUTPUT_FILE"`
+	// PushAudience enables the OIDC token verification of the push requests
+	// when set, it's the audience configured on the push subscription. The
+	// verified caller is attached to the events as the publisher attribute.
+	PushAudience string `env:"PMAP_PUSH_AUDIENCE"`
+	// EventCompression compresses the events published to the success and
+	// failure topics, they're uncompressed when it's empty. Compressed events
+	// fit the Pub/Sub size limit better but consumers must decompress them,
+	// and BigQuery subscriptions such as the one replay reads from can't write
+	// them.
+	EventCompression string `env:"PMAP_EVENT_COMPRESSION"`
+	// PublishSelfTest tests the publish permission on the topics at startup
+	// to fail fast on missing publish permissions.
+	PublishSelfTest bool `env:"PMAP_PUBLISH_SELF_TEST"`
 }
 
+// FilePathFallbackObjectID uses the full object ID as the file path for
+// objects without the GCSPathSeparatorKey.
+const FilePathFallbackObjectID = "object-id"
+
+const (
+	// JSONKeyCasingCamel emits the lowerCamelCase JSON names, e.g.
+	// "githubSource". This is the default.
+	JSONKeyCasingCamel = "camel"
+	// JSONKeyCasingSnake emits the proto field names, e.g. "github_source".
+	JSONKeyCasingSnake = "snake"
+)
+
+const (
+	// SinkPubSub publishes the events to the Pub/Sub topics. This is the
+	// default.
+	SinkPubSub = "pubsub"
+	// SinkStdout writes the events to stdout as newline delimited JSON, see
+	// [NewStdoutMessenger].
+	SinkStdout = "stdout"
+)
+
+// EventCompressionGzip compresses the published events with gzip, see
+// [WithGzip].
+const EventCompressionGzip = "gzip"
+
 // MappingConfig defines the environment variables required
 // for running mapping service.
 type MappingHandlerConfig struct {
@@ -49,21 +141,171 @@ type MappingHandlerConfig struct {
 	// This is only used for global resources such as GCS bucket.
 	// Please make sure the Service Account used in the Cloud Run service for
 	// Data Mapping is granted the 'roles/cloudasset.viewer' to the corresponding
-	// scope level.
+	// scope level. A comma separated list of scopes is searched in order until
+	// the resource is found, e.g. "projects/my-project,folders/123".
 	DefaultResourceScope string `env:"PMAP_MAPPING_DEFAULT_RESOURCE_SCOPE,required"`
+
+	// ReservedAnnotationPrefix is the annotation key prefix reserved for
+	// annotations injected by processors, e.g. "sys.". Empty means injected
+	// annotations are not namespaced.
+	ReservedAnnotationPrefix string `env:"PMAP_MAPPING_RESERVED_ANNOTATION_PREFIX"`
+
+	// IAMSearchNonFatal keeps the resource derived annotations when the IAM
+	// policies search fails instead of failing the processing.
+	IAMSearchNonFatal bool `env:"PMAP_MAPPING_IAM_SEARCH_NON_FATAL"`
+
+	// MaxIAMPolicies caps the number of IAM policies annotated, the ones
+	// beyond it are omitted. 0 means no limit.
+	MaxIAMPolicies int `env:"PMAP_MAPPING_MAX_IAM_POLICIES"`
+
+	// BestEffortVerification marks the resources not found in Asset
+	// Inventory as unverified instead of failing the processing.
+	BestEffortVerification bool `env:"PMAP_MAPPING_BEST_EFFORT_VERIFICATION"`
+
+	// RequestStats attaches the number of Asset Inventory search round-trips
+	// and the elapsed time to the injected annotations.
+	RequestStats bool `env:"PMAP_MAPPING_REQUEST_STATS"`
+
+	// DefaultContactsFile is the path of a yaml file mapping ancestors, e.g.
+	// "folders/123", to the contact emails injected into ResourceMappings
+	// without contacts. Empty means contacts are not inherited.
+	DefaultContactsFile string `env:"PMAP_MAPPING_DEFAULT_CONTACTS_FILE"`
+
+	// ResidencyFile is the path of a yaml file mapping data residencies, e.g.
+	// "EU", to the resource locations they cover. Empty means the residency
+	// is not annotated.
+	ResidencyFile string `env:"PMAP_MAPPING_RESIDENCY_FILE"`
+
+	// StrictProvider rejects ResourceMappings whose resource provider isn't
+	// supported by any enrichment processor instead of passing them through.
+	StrictProvider bool `env:"PMAP_MAPPING_STRICT_PROVIDER"`
+
+	// AncestorNames annotates the display names of the resource ancestors,
+	// at the cost of an Asset Inventory search per ancestor.
+	AncestorNames bool `env:"PMAP_MAPPING_ANCESTOR_NAMES"`
+
+	// AllowedServices are the service hosts of the GCP resource names
+	// mappings are allowed for, e.g. "storage.googleapis.com". All services
+	// are allowed when it's empty.
+	AllowedServices []string `env:"PMAP_MAPPING_ALLOWED_SERVICES"`
+
+	// ResourceProviders are the resource providers events are emitted for,
+	// e.g. "gcp". The mappings of other providers are ignored without any
+	// event. All providers are handled when it's empty.
+	ResourceProviders []string `env:"PMAP_MAPPING_RESOURCE_PROVIDERS"`
+
+	// AnnotationSchemaFile is the path of a yaml file mapping annotation keys
+	// to the enum or pattern constraints of their values. Empty means the
+	// annotation values are not constrained.
+	AnnotationSchemaFile string `env:"PMAP_MAPPING_ANNOTATION_SCHEMA_FILE"`
+
+	// AnnotationKeyCasing is the casing the annotation keys must be in, e.g.
+	// "lowerCamel". Empty means the keys are not checked.
+	AnnotationKeyCasing string `env:"PMAP_MAPPING_ANNOTATION_KEY_CASING"`
+
+	// RewriteAnnotationKeys rewrites the annotation keys not in the
+	// AnnotationKeyCasing instead of rejecting the mapping.
+	RewriteAnnotationKeys bool `env:"PMAP_MAPPING_REWRITE_ANNOTATION_KEYS"`
+
+	// DropEmptyAnnotations removes the empty structs and lists from the
+	// annotations before the events are published.
+	DropEmptyAnnotations bool `env:"PMAP_MAPPING_DROP_EMPTY_ANNOTATIONS"`
+
+	// ObjectUpdateTime annotates the time the GCS object was last updated as
+	// reported by the notification.
+	ObjectUpdateTime bool `env:"PMAP_MAPPING_OBJECT_UPDATE_TIME"`
+
+	// DisabledProcessors are the names of the built-in processors left out
+	// of the pipeline, e.g. "AssetInventoryProcessor". All the configured
+	// processors run when it's empty.
+	DisabledProcessors []string `env:"PMAP_MAPPING_DISABLED_PROCESSORS"`
 	HandlerConfig
 }
 
 // Validate validates the handler config after load.
 func (cfg *HandlerConfig) Validate() error {
-	if cfg.ProjectID == "" {
-		return fmt.Errorf("PROJECT_ID is empty and requires a value")
+	switch cfg.Sink {
+	case "", SinkPubSub, SinkStdout:
+	default:
+		return fmt.Errorf("PMAP_SINK: %s is not one of the allowed values: [%s %s]", cfg.Sink, SinkPubSub, SinkStdout)
+	}
+
+	if cfg.LocalOutputFile != "" && cfg.Sink != "" {
+		return fmt.Errorf("PMAP_LOCAL_OUTPUT_FILE and PMAP_SINK cannot be both set")
+	}
+
+	if cfg.UsesPubSub() {
+		if cfg.ProjectID == "" {
+			return fmt.Errorf("PROJECT_ID is empty and requires a value")
+		}
+
+		if cfg.SuccessTopicID == "" {
+			return fmt.Errorf("PMAP_SUCCESS_TOPIC_ID is empty and requires a value")
+		}
+	}
+
+	if cfg.HandleTimeout < 0 {
+		return fmt.Errorf("PMAP_HANDLE_TIMEOUT cannot be negative: %s", cfg.HandleTimeout)
+	}
+
+	if cfg.RateLimitQPS < 0 {
+		return fmt.Errorf("PMAP_RATE_LIMIT_QPS cannot be negative: %v", cfg.RateLimitQPS)
+	}
+
+	if cfg.RateLimitQPS > 0 && cfg.RateLimitBurst <= 0 {
+		return fmt.Errorf("PMAP_RATE_LIMIT_BURST must be positive when PMAP_RATE_LIMIT_QPS is set: %d", cfg.RateLimitBurst)
+	}
+
+	switch cfg.FilePathFallback {
+	case "", FilePathFallbackObjectID:
+	default:
+		return fmt.Errorf("PMAP_FILE_PATH_FALLBACK: %s is not one of the allowed values: [%s]", cfg.FilePathFallback, FilePathFallbackObjectID)
+	}
+
+	switch cfg.EventCompression {
+	case "", EventCompressionGzip:
+	default:
+		return fmt.Errorf("PMAP_EVENT_COMPRESSION: %s is not one of the allowed values: [%s]", cfg.EventCompression, EventCompressionGzip)
+	}
+
+	switch cfg.JSONKeyCasing {
+	case "", JSONKeyCasingCamel, JSONKeyCasingSnake:
+	default:
+		return fmt.Errorf("PMAP_JSON_KEY_CASING: %s is not one of the allowed values: [%s %s]", cfg.JSONKeyCasing, JSONKeyCasingCamel, JSONKeyCasingSnake)
+	}
+
+	for _, a := range cfg.StaticAttributes {
+		if k, _, ok := strings.Cut(a, "="); !ok || k == "" {
+			return fmt.Errorf("PMAP_STATIC_ATTRIBUTES: %s is not in the format key=value", a)
+		}
 	}
 
-	if cfg.SuccessTopicID == "" {
-		return fmt.Errorf("PMAP_SUCCESS_TOPIC_ID is empty and requires a value")
+	return nil
+}
+
+// UsesPubSub reports whether the events are published to the Pub/Sub topics,
+// i.e. they're neither written to stdout nor to a local file.
+func (cfg *HandlerConfig) UsesPubSub() bool {
+	return cfg.Sink != SinkStdout && cfg.LocalOutputFile == ""
+}
+
+// StaticAttributeMap returns the static attributes keyed by attribute key,
+// the last value wins for duplicate keys.
+func (cfg *HandlerConfig) StaticAttributeMap() map[string]string {
+	m := make(map[string]string, len(cfg.StaticAttributes))
+	for _, a := range cfg.StaticAttributes {
+		k, v, _ := strings.Cut(a, "=")
+		m[k] = v
 	}
+	return m
+}
 
+// PubSubMessengerOptions returns the options of the PubSubMessengers of the
+// success and failure topics.
+func (cfg *HandlerConfig) PubSubMessengerOptions() []PubSubMessengerOption {
+	if cfg.EventCompression == EventCompressionGzip {
+		return []PubSubMessengerOption{WithGzip()}
+	}
 	return nil
 }
 
@@ -74,25 +316,141 @@ func (cfg *MappingHandlerConfig) Validate() (retErr error) {
 	}
 
 	// For mapping server, we also require a failure topic ID.
-	if cfg.HandlerConfig.FailureTopicID == "" {
+	if cfg.HandlerConfig.UsesPubSub() && cfg.HandlerConfig.FailureTopicID == "" {
 		retErr = errors.Join(retErr, fmt.Errorf("PMAP_FAILURE_TOPIC_ID is empty and require a value for mapping service"))
 	}
+	// Success and failure events would be indistinguishable on the same topic.
+	if cfg.HandlerConfig.UsesPubSub() && cfg.FailureTopicID != "" && cfg.FailureTopicID == cfg.SuccessTopicID {
+		retErr = errors.Join(retErr, fmt.Errorf("PMAP_FAILURE_TOPIC_ID must differ from PMAP_SUCCESS_TOPIC_ID: %s", cfg.FailureTopicID))
+	}
 
 	if cfg.DefaultResourceScope == "" {
 		retErr = errors.Join(retErr, fmt.Errorf(`PMAP_MAPPING_DEFAULT_RESOURCE_SCOPE is empty, allowed values are: %v`, allowedScopes))
 	}
 
-	scope := strings.Split(cfg.DefaultResourceScope, "/")[0]
-	switch scope {
-	case "projects", "folders", "organizations":
-		break
+	switch v1alpha1.KeyCasing(cfg.AnnotationKeyCasing) {
+	case "", v1alpha1.KeyCasingLowerCamel, v1alpha1.KeyCasingSnake:
 	default:
-		retErr = errors.Join(retErr, fmt.Errorf(`PMAP_MAPPING_DEFAULT_RESOURCE_SCOPE: %s is required in one of the formats: %v`, cfg.DefaultResourceScope, allowedScopes))
+		retErr = errors.Join(retErr, fmt.Errorf("PMAP_MAPPING_ANNOTATION_KEY_CASING: %s is not one of the allowed values: [%s %s]",
+			cfg.AnnotationKeyCasing, v1alpha1.KeyCasingLowerCamel, v1alpha1.KeyCasingSnake))
+	}
+	if cfg.MaxIAMPolicies < 0 {
+		retErr = errors.Join(retErr, fmt.Errorf("PMAP_MAPPING_MAX_IAM_POLICIES cannot be negative: %d", cfg.MaxIAMPolicies))
+	}
+	if cfg.RewriteAnnotationKeys && cfg.AnnotationKeyCasing == "" {
+		retErr = errors.Join(retErr, fmt.Errorf("PMAP_MAPPING_REWRITE_ANNOTATION_KEYS requires PMAP_MAPPING_ANNOTATION_KEY_CASING"))
+	}
+
+	for _, n := range cfg.DisabledProcessors {
+		if strings.TrimSpace(n) == "" {
+			retErr = errors.Join(retErr, fmt.Errorf("PMAP_MAPPING_DISABLED_PROCESSORS cannot contain empty processor names"))
+			break
+		}
+	}
+
+	for _, s := range cfg.DefaultResourceScopes() {
+		switch strings.Split(s, "/")[0] {
+		case "projects", "folders", "organizations":
+			continue
+		default:
+			retErr = errors.Join(retErr, fmt.Errorf(`PMAP_MAPPING_DEFAULT_RESOURCE_SCOPE: %s is required in one of the formats: %v`, s, allowedScopes))
+		}
 	}
 
 	return retErr
 }
 
+// DefaultResourceScopes returns the default resource scopes in search order.
+func (cfg *MappingHandlerConfig) DefaultResourceScopes() []string {
+	if cfg.DefaultResourceScope == "" {
+		return nil
+	}
+	scopes := strings.Split(cfg.DefaultResourceScope, ",")
+	for i, s := range scopes {
+		scopes[i] = strings.TrimSpace(s)
+	}
+	return scopes
+}
+
+// redactedValue replaces sensitive values when logging the config.
+const redactedValue = "REDACTED"
+
+// LogValue implements [slog.LogValuer] to log the config with project and
+// topic IDs redacted. Empty values are kept to show what's not configured.
+func (cfg *HandlerConfig) LogValue() slog.Value {
+	return slog.GroupValue(cfg.logAttrs()...)
+}
+
+// logAttrs returns the attributes of every config field, a test fails when a
+// field is missing.
+func (cfg *HandlerConfig) logAttrs() []slog.Attr {
+	return []slog.Attr{
+		slog.String("port", cfg.Port),
+		slog.String("projectID", redact(cfg.ProjectID)),
+		slog.String("successTopicID", redact(cfg.SuccessTopicID)),
+		slog.String("failureTopicID", redact(cfg.FailureTopicID)),
+		slog.String("indexTopicID", redact(cfg.IndexTopicID)),
+		slog.String("dualWriteTopicID", redact(cfg.DualWriteTopicID)),
+		slog.Duration("handleTimeout", cfg.HandleTimeout),
+		slog.String("filePathFallback", cfg.FilePathFallback),
+		slog.Float64("rateLimitQPS", cfg.RateLimitQPS),
+		slog.Int("rateLimitBurst", cfg.RateLimitBurst),
+		slog.String("jsonKeyCasing", cfg.JSONKeyCasing),
+		slog.Bool("objectMetadataAttribute", cfg.ObjectMetadataAttribute),
+		slog.Bool("sequenceAttribute", cfg.SequenceAttribute),
+		slog.Bool("warningsAttribute", cfg.WarningsAttribute),
+		slog.Bool("requireProvenance", cfg.RequireProvenance),
+		slog.Bool("logFailureEvents", cfg.LogFailureEvents),
+		slog.String("staticAttributes", strings.Join(cfg.StaticAttributes, ",")),
+		slog.String("sink", cfg.Sink),
+		slog.String("localOutputFile", cfg.LocalOutputFile),
+		slog.String("pushAudience", cfg.PushAudience),
+		slog.String("eventCompression", cfg.EventCompression),
+		slog.Bool("publishSelfTest", cfg.PublishSelfTest),
+	}
+}
+
+// LogValue implements [slog.LogValuer] to log the config with sensitive
+// values redacted. Only the scope types of the default resource scopes are
+// kept, e.g. "projects/REDACTED,folders/REDACTED".
+func (cfg *MappingHandlerConfig) LogValue() slog.Value {
+	scopes := cfg.DefaultResourceScopes()
+	for i, s := range scopes {
+		scopes[i] = redact(s)
+		if t, _, ok := strings.Cut(s, "/"); ok {
+			scopes[i] = t + "/" + redactedValue
+		}
+	}
+	scope := strings.Join(scopes, ",")
+	return slog.GroupValue(append(cfg.HandlerConfig.logAttrs(),
+		slog.String("defaultResourceScope", scope),
+		slog.String("reservedAnnotationPrefix", cfg.ReservedAnnotationPrefix),
+		slog.Bool("iamSearchNonFatal", cfg.IAMSearchNonFatal),
+		slog.Int("maxIAMPolicies", cfg.MaxIAMPolicies),
+		slog.Bool("bestEffortVerification", cfg.BestEffortVerification),
+		slog.Bool("requestStats", cfg.RequestStats),
+		slog.String("defaultContactsFile", cfg.DefaultContactsFile),
+		slog.String("residencyFile", cfg.ResidencyFile),
+		slog.Bool("strictProvider", cfg.StrictProvider),
+		slog.Bool("ancestorNames", cfg.AncestorNames),
+		slog.String("allowedServices", strings.Join(cfg.AllowedServices, ",")),
+		slog.String("resourceProviders", strings.Join(cfg.ResourceProviders, ",")),
+		slog.String("annotationSchemaFile", cfg.AnnotationSchemaFile),
+		slog.String("annotationKeyCasing", cfg.AnnotationKeyCasing),
+		slog.Bool("rewriteAnnotationKeys", cfg.RewriteAnnotationKeys),
+		slog.Bool("dropEmptyAnnotations", cfg.DropEmptyAnnotations),
+		slog.Bool("objectUpdateTime", cfg.ObjectUpdateTime),
+		slog.String("disabledProcessors", strings.Join(cfg.DisabledProcessors, ",")))...)
+}
+
+// redact returns redactedValue for non-empty values.
+func redact(v string) string {
+	if v == "" {
+		return ""
+	}
+	return redactedValue
+}
+
 // ToFlags binds the config to the give [cli.FlagSet] and returns it.
 func (cfg *HandlerConfig) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 	// Command options
@@ -129,6 +487,159 @@ func (cfg *HandlerConfig) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 		Usage:   "The topic id which handles the resources that failed to process.",
 	})
 
+	f.StringVar(&cli.StringVar{
+		Name:    "index-topic-id",
+		Target:  &cfg.IndexTopicID,
+		EnvVar:  "PMAP_INDEX_TOPIC_ID",
+		Example: "test-index-topic",
+		Usage:   "The optional topic id which receives a minimal index event for every successfully processed resource.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "dual-write-topic-id",
+		Target:  &cfg.DualWriteTopicID,
+		EnvVar:  "PMAP_DUAL_WRITE_TOPIC_ID",
+		Example: "test-dual-write-topic",
+		Usage:   "The optional topic id which also receives the success events in the other JSON key casing than json-key-casing.",
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "handle-timeout",
+		Target:  &cfg.HandleTimeout,
+		EnvVar:  "PMAP_HANDLE_TIMEOUT",
+		Example: "5m",
+		Usage:   "The maximum duration to handle an event, including reading the object, processing and publishing. No timeout if unset.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "file-path-fallback",
+		Target:  &cfg.FilePathFallback,
+		EnvVar:  "PMAP_FILE_PATH_FALLBACK",
+		Example: FilePathFallbackObjectID,
+		Usage: fmt.Sprintf(`How to derive the file path for objects without %q. `+
+			`Set to %q to use the full object ID, the file path is left empty if unset.`, GCSPathSeparatorKey, FilePathFallbackObjectID),
+	})
+
+	f.Float64Var(&cli.Float64Var{
+		Name:    "rate-limit-qps",
+		Target:  &cfg.RateLimitQPS,
+		EnvVar:  "PMAP_RATE_LIMIT_QPS",
+		Example: "10",
+		Usage:   "The maximum number of requests served per second, requests over the limit are rejected with 429. No rate limit if unset.",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "rate-limit-burst",
+		Target:  &cfg.RateLimitBurst,
+		EnvVar:  "PMAP_RATE_LIMIT_BURST",
+		Default: 1,
+		Example: "20",
+		Usage:   "The maximum number of requests served at once when rate-limit-qps is set.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "json-key-casing",
+		Target:  &cfg.JSONKeyCasing,
+		EnvVar:  "PMAP_JSON_KEY_CASING",
+		Example: JSONKeyCasingSnake,
+		Usage: fmt.Sprintf(`The casing of the keys of the emitted events, %q for lowerCamelCase or %q for snake_case. `+
+			`Defaults to %q.`, JSONKeyCasingCamel, JSONKeyCasingSnake, JSONKeyCasingCamel),
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "object-metadata-attribute",
+		Target:  &cfg.ObjectMetadataAttribute,
+		EnvVar:  "PMAP_OBJECT_METADATA_ATTRIBUTE",
+		Default: false,
+		Usage:   fmt.Sprintf(`Whether to attach the custom metadata of the GCS object to the events as the %q attribute.`, AttrKeyObjectMetadata),
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "sequence-attribute",
+		Target:  &cfg.SequenceAttribute,
+		EnvVar:  "PMAP_SEQUENCE_ATTRIBUTE",
+		Default: false,
+		Usage:   fmt.Sprintf(`Whether to number the events with the best-effort per-process %q attribute.`, AttrKeySequence),
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "warnings-attribute",
+		Target:  &cfg.WarningsAttribute,
+		EnvVar:  "PMAP_WARNINGS_ATTRIBUTE",
+		Default: false,
+		Usage:   fmt.Sprintf(`Whether to attach the warnings of the processors to the success events as the %q attribute.`, AttrKeyWarnings),
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "require-provenance",
+		Target:  &cfg.RequireProvenance,
+		EnvVar:  "PMAP_REQUIRE_PROVENANCE",
+		Default: false,
+		Usage: `Whether to fail notifications without the object metadata, e.g. ` +
+			`with payloadFormat NONE, instead of emitting events without the GitHub provenance.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "log-failure-events",
+		Target:  &cfg.LogFailureEvents,
+		EnvVar:  "PMAP_LOG_FAILURE_EVENTS",
+		Default: false,
+		Usage:   `Whether to log the failure events at error level when no failure topic is configured.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "static-attributes",
+		Target:  &cfg.StaticAttributes,
+		EnvVar:  "PMAP_STATIC_ATTRIBUTES",
+		Example: "deployment=prod,region=us",
+		Usage:   `The comma separated key=value attributes to add to every emitted event.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "sink",
+		Target:  &cfg.Sink,
+		EnvVar:  "PMAP_SINK",
+		Example: SinkStdout,
+		Usage: fmt.Sprintf(`Where to emit the events, %q for the Pub/Sub topics or %q for newline delimited JSON `+
+			`on stdout, the project and topic IDs are ignored for %q. Defaults to %q.`, SinkPubSub, SinkStdout, SinkStdout, SinkPubSub),
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "local-output-file",
+		Target:  &cfg.LocalOutputFile,
+		EnvVar:  "PMAP_LOCAL_OUTPUT_FILE",
+		Example: "/tmp/pmap-events.jsonl",
+		Usage: `The file to append the events to as newline delimited JSON instead of emitting them to the sink, ` +
+			`e.g. to run the server locally without Pub/Sub. The project and topic IDs are ignored when it's set.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "push-audience",
+		Target:  &cfg.PushAudience,
+		EnvVar:  "PMAP_PUSH_AUDIENCE",
+		Example: "https://pmap-mapping.example.com",
+		Usage: fmt.Sprintf(`The audience of the OIDC tokens of the push subscription, the tokens are verified and `+
+			`the caller is attached to the events as the %q attribute when set.`, AttrKeyPublisher),
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "event-compression",
+		Target:  &cfg.EventCompression,
+		EnvVar:  "PMAP_EVENT_COMPRESSION",
+		Example: EventCompressionGzip,
+		Usage: fmt.Sprintf(`The compression of the events published to the success and failure topics, %q sets `+
+			`the %q attribute to %q and consumers must decompress the data. Events are uncompressed if unset.`,
+			EventCompressionGzip, AttrKeyContentEncoding, ContentEncodingGzip),
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "publish-self-test",
+		Target:  &cfg.PublishSelfTest,
+		EnvVar:  "PMAP_PUBLISH_SELF_TEST",
+		Default: false,
+		Usage:   `Whether to test the publish permission on the topics at startup, nothing is published.`,
+	})
+
 	return set
 }
 
@@ -141,8 +652,147 @@ func (cfg *MappingHandlerConfig) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 		Name:    "default-resource-scope",
 		Target:  &cfg.DefaultResourceScope,
 		EnvVar:  "PMAP_MAPPING_DEFAULT_RESOURCE_SCOPE",
-		Example: "projects/test-project-id",
-		Usage:   fmt.Sprintf(`The default scope to search for resources. Format: %v`, allowedScopes),
+		Example: "projects/test-project-id,folders/123",
+		Usage: fmt.Sprintf(`The default scope to search for resources, a comma `+
+			`separated list is searched in order until the resource is found. Format: %v`, allowedScopes),
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "reserved-annotation-prefix",
+		Target:  &cfg.ReservedAnnotationPrefix,
+		EnvVar:  "PMAP_MAPPING_RESERVED_ANNOTATION_PREFIX",
+		Example: "sys.",
+		Usage:   `The annotation key prefix under which processors inject annotations.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "iam-search-non-fatal",
+		Target:  &cfg.IAMSearchNonFatal,
+		EnvVar:  "PMAP_MAPPING_IAM_SEARCH_NON_FATAL",
+		Default: false,
+		Usage:   `Whether to keep the resource annotations and omit the IAM policies when the IAM policies search fails.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "max-iam-policies",
+		Target:  &cfg.MaxIAMPolicies,
+		EnvVar:  "PMAP_MAPPING_MAX_IAM_POLICIES",
+		Default: 0,
+		Example: "100",
+		Usage:   `The maximum number of IAM policies annotated, the ones beyond it are omitted. 0 means no limit.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "best-effort-verification",
+		Target:  &cfg.BestEffortVerification,
+		EnvVar:  "PMAP_MAPPING_BEST_EFFORT_VERIFICATION",
+		Default: false,
+		Usage:   `Whether to mark the resources not found in Asset Inventory as unverified instead of failing the mapping.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "request-stats",
+		Target:  &cfg.RequestStats,
+		EnvVar:  "PMAP_MAPPING_REQUEST_STATS",
+		Default: false,
+		Usage:   `Whether to annotate the number of Asset Inventory search requests and the elapsed time.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "default-contacts-file",
+		Target:  &cfg.DefaultContactsFile,
+		EnvVar:  "PMAP_MAPPING_DEFAULT_CONTACTS_FILE",
+		Example: "/etc/pmap/default-contacts.yaml",
+		Usage:   `The yaml file of the default contacts keyed by ancestor, e.g. "folders/123", for mappings without contacts.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "residency-file",
+		Target:  &cfg.ResidencyFile,
+		EnvVar:  "PMAP_MAPPING_RESIDENCY_FILE",
+		Example: "/etc/pmap/residency.yaml",
+		Usage:   `The yaml file of the resource locations keyed by data residency, e.g. "EU", to annotate mappings with.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "strict-provider",
+		Target:  &cfg.StrictProvider,
+		EnvVar:  "PMAP_MAPPING_STRICT_PROVIDER",
+		Default: false,
+		Usage:   `Whether to reject mappings whose resource provider isn't supported by any processor.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "ancestor-names",
+		Target:  &cfg.AncestorNames,
+		EnvVar:  "PMAP_MAPPING_ANCESTOR_NAMES",
+		Default: false,
+		Usage:   `Whether to annotate the display names of the resource ancestors.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "allowed-services",
+		Target:  &cfg.AllowedServices,
+		EnvVar:  "PMAP_MAPPING_ALLOWED_SERVICES",
+		Example: "storage.googleapis.com,pubsub.googleapis.com",
+		Usage:   `The service hosts of the GCP resource names mappings are allowed for, all services are allowed if unset.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "resource-providers",
+		Target:  &cfg.ResourceProviders,
+		EnvVar:  "PMAP_MAPPING_RESOURCE_PROVIDERS",
+		Example: "gcp",
+		Usage:   `The resource providers to emit events for, the mappings of other providers are ignored. All providers are handled if unset.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "annotation-schema-file",
+		Target:  &cfg.AnnotationSchemaFile,
+		EnvVar:  "PMAP_MAPPING_ANNOTATION_SCHEMA_FILE",
+		Example: "/etc/pmap/annotation-schema.yaml",
+		Usage:   `The yaml file of the enum or pattern constraints keyed by annotation key, mappings violating them are rejected.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "annotation-key-casing",
+		Target:  &cfg.AnnotationKeyCasing,
+		EnvVar:  "PMAP_MAPPING_ANNOTATION_KEY_CASING",
+		Example: "lowerCamel",
+		Usage:   `The casing of the annotation keys, one of "lowerCamel" or "snake". Keys are not checked if unset.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "rewrite-annotation-keys",
+		Target:  &cfg.RewriteAnnotationKeys,
+		EnvVar:  "PMAP_MAPPING_REWRITE_ANNOTATION_KEYS",
+		Default: false,
+		Usage:   `Whether to rewrite the annotation keys not in the annotation key casing instead of rejecting the mapping.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "drop-empty-annotations",
+		Target:  &cfg.DropEmptyAnnotations,
+		EnvVar:  "PMAP_MAPPING_DROP_EMPTY_ANNOTATIONS",
+		Default: false,
+		Usage:   `Whether to remove the empty structs and lists from the annotations before the events are published.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "object-update-time",
+		Target:  &cfg.ObjectUpdateTime,
+		EnvVar:  "PMAP_MAPPING_OBJECT_UPDATE_TIME",
+		Default: false,
+		Usage:   `Whether to annotate the time the GCS object was last updated as reported by the notification.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "disabled-processors",
+		Target:  &cfg.DisabledProcessors,
+		EnvVar:  "PMAP_MAPPING_DISABLED_PROCESSORS",
+		Example: "AssetInventoryProcessor,ResidencyProcessor",
+		Usage: `The comma separated names of the built-in processors to leave out of the pipeline, ` +
+			`e.g. "AssetInventoryProcessor" to skip the resource and IAM policy enrichment.`,
 	})
 	return set
 }
@@ -15,7 +15,16 @@
 package server
 
 import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+	"unicode"
+
+	"github.com/google/go-cmp/cmp"
 
 	"github.com/abcxyz/pkg/testutil"
 )
@@ -58,6 +67,139 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: `PMAP_SUCCESS_TOPIC_ID is empty and requires a value`,
 		},
+		{
+			name: "stdout_sink_without_topics",
+			cfg: &HandlerConfig{
+				Sink: SinkStdout,
+			},
+		},
+		{
+			name: "local_output_file_without_topics",
+			cfg: &HandlerConfig{
+				LocalOutputFile: "/tmp/events.jsonl",
+			},
+		},
+		{
+			name: "local_output_file_with_sink",
+			cfg: &HandlerConfig{
+				LocalOutputFile: "/tmp/events.jsonl",
+				Sink:            SinkPubSub,
+			},
+			wantErr: `PMAP_LOCAL_OUTPUT_FILE and PMAP_SINK cannot be both set`,
+		},
+		{
+			name: "invalid_sink",
+			cfg: &HandlerConfig{
+				ProjectID:      testProjectID,
+				SuccessTopicID: testSuccessTopicID,
+				Sink:           "file",
+			},
+			wantErr: `PMAP_SINK: file is not one of the allowed values: [pubsub stdout]`,
+		},
+		{
+			name: "negative_handle_timeout",
+			cfg: &HandlerConfig{
+				ProjectID:      testProjectID,
+				SuccessTopicID: testSuccessTopicID,
+				HandleTimeout:  -time.Second,
+			},
+			wantErr: `PMAP_HANDLE_TIMEOUT cannot be negative: -1s`,
+		},
+		{
+			name: "negative_rate_limit_qps",
+			cfg: &HandlerConfig{
+				ProjectID:      testProjectID,
+				SuccessTopicID: testSuccessTopicID,
+				RateLimitQPS:   -1,
+			},
+			wantErr: `PMAP_RATE_LIMIT_QPS cannot be negative: -1`,
+		},
+		{
+			name: "invalid_rate_limit_burst",
+			cfg: &HandlerConfig{
+				ProjectID:      testProjectID,
+				SuccessTopicID: testSuccessTopicID,
+				RateLimitQPS:   10,
+			},
+			wantErr: `PMAP_RATE_LIMIT_BURST must be positive when PMAP_RATE_LIMIT_QPS is set: 0`,
+		},
+		{
+			name: "file_path_fallback_object_id",
+			cfg: &HandlerConfig{
+				ProjectID:        testProjectID,
+				SuccessTopicID:   testSuccessTopicID,
+				FilePathFallback: FilePathFallbackObjectID,
+			},
+		},
+		{
+			name: "invalid_file_path_fallback",
+			cfg: &HandlerConfig{
+				ProjectID:        testProjectID,
+				SuccessTopicID:   testSuccessTopicID,
+				FilePathFallback: "basename",
+			},
+			wantErr: `PMAP_FILE_PATH_FALLBACK: basename is not one of the allowed values: [object-id]`,
+		},
+		{
+			name: "json_key_casing_snake",
+			cfg: &HandlerConfig{
+				ProjectID:      testProjectID,
+				SuccessTopicID: testSuccessTopicID,
+				JSONKeyCasing:  JSONKeyCasingSnake,
+			},
+		},
+		{
+			name: "invalid_json_key_casing",
+			cfg: &HandlerConfig{
+				ProjectID:      testProjectID,
+				SuccessTopicID: testSuccessTopicID,
+				JSONKeyCasing:  "kebab",
+			},
+			wantErr: `PMAP_JSON_KEY_CASING: kebab is not one of the allowed values: [camel snake]`,
+		},
+		{
+			name: "gzip_event_compression",
+			cfg: &HandlerConfig{
+				ProjectID:        testProjectID,
+				SuccessTopicID:   testSuccessTopicID,
+				EventCompression: EventCompressionGzip,
+			},
+		},
+		{
+			name: "invalid_event_compression",
+			cfg: &HandlerConfig{
+				ProjectID:        testProjectID,
+				SuccessTopicID:   testSuccessTopicID,
+				EventCompression: "zstd",
+			},
+			wantErr: `PMAP_EVENT_COMPRESSION: zstd is not one of the allowed values: [gzip]`,
+		},
+		{
+			name: "static_attributes",
+			cfg: &HandlerConfig{
+				ProjectID:        testProjectID,
+				SuccessTopicID:   testSuccessTopicID,
+				StaticAttributes: []string{"deployment=prod", "empty="},
+			},
+		},
+		{
+			name: "invalid_static_attribute",
+			cfg: &HandlerConfig{
+				ProjectID:        testProjectID,
+				SuccessTopicID:   testSuccessTopicID,
+				StaticAttributes: []string{"deployment=prod", "region"},
+			},
+			wantErr: `PMAP_STATIC_ATTRIBUTES: region is not in the format key=value`,
+		},
+		{
+			name: "empty_static_attribute_key",
+			cfg: &HandlerConfig{
+				ProjectID:        testProjectID,
+				SuccessTopicID:   testSuccessTopicID,
+				StaticAttributes: []string{"=prod"},
+			},
+			wantErr: `PMAP_STATIC_ATTRIBUTES: =prod is not in the format key=value`,
+		},
 	}
 
 	for _, tc := range tests {
@@ -91,6 +233,38 @@ func TestConfig_MappingValidate(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "stdout_sink_without_topics",
+			cfg: &MappingHandlerConfig{
+				DefaultResourceScope: testDefaultResourceScope,
+				HandlerConfig: HandlerConfig{
+					Sink: SinkStdout,
+				},
+			},
+		},
+		{
+			name: "identical_topic_ids",
+			cfg: &MappingHandlerConfig{
+				HandlerConfig: HandlerConfig{
+					ProjectID:      testProjectID,
+					SuccessTopicID: testSuccessTopicID,
+					FailureTopicID: testSuccessTopicID,
+				},
+				DefaultResourceScope: testDefaultResourceScope,
+			},
+			wantErr: `PMAP_FAILURE_TOPIC_ID must differ from PMAP_SUCCESS_TOPIC_ID: test-success-topic-id`,
+		},
+		{
+			name: "identical_topic_ids_stdout_sink",
+			cfg: &MappingHandlerConfig{
+				HandlerConfig: HandlerConfig{
+					Sink:           SinkStdout,
+					SuccessTopicID: testSuccessTopicID,
+					FailureTopicID: testSuccessTopicID,
+				},
+				DefaultResourceScope: testDefaultResourceScope,
+			},
+		},
 		{
 			name: "missing_project_id",
 			cfg: &MappingHandlerConfig{
@@ -147,6 +321,94 @@ func TestConfig_MappingValidate(t *testing.T) {
 			},
 			wantErr: `PMAP_MAPPING_DEFAULT_RESOURCE_SCOPE: foo/bar is required in one of the formats`,
 		},
+		{
+			name: "multiple_resource_scopes",
+			cfg: &MappingHandlerConfig{
+				HandlerConfig: HandlerConfig{
+					ProjectID:      testProjectID,
+					SuccessTopicID: testSuccessTopicID,
+					FailureTopicID: testFailureTopicID,
+				},
+				DefaultResourceScope: "projects/test-project-id, folders/123,organizations/456",
+			},
+		},
+		{
+			name: "invalid_second_resource_scope",
+			cfg: &MappingHandlerConfig{
+				HandlerConfig: HandlerConfig{
+					ProjectID:      testProjectID,
+					SuccessTopicID: testSuccessTopicID,
+					FailureTopicID: testFailureTopicID,
+				},
+				DefaultResourceScope: "projects/test-project-id,foo/bar",
+			},
+			wantErr: `PMAP_MAPPING_DEFAULT_RESOURCE_SCOPE: foo/bar is required in one of the formats`,
+		},
+		{
+			name: "rewrite_annotation_keys",
+			cfg: &MappingHandlerConfig{
+				HandlerConfig: HandlerConfig{
+					Sink: SinkStdout,
+				},
+				DefaultResourceScope:  testDefaultResourceScope,
+				AnnotationKeyCasing:   "lowerCamel",
+				RewriteAnnotationKeys: true,
+			},
+		},
+		{
+			name: "invalid_annotation_key_casing",
+			cfg: &MappingHandlerConfig{
+				HandlerConfig: HandlerConfig{
+					Sink: SinkStdout,
+				},
+				DefaultResourceScope: testDefaultResourceScope,
+				AnnotationKeyCasing:  "kebab",
+			},
+			wantErr: `PMAP_MAPPING_ANNOTATION_KEY_CASING: kebab is not one of the allowed values: [lowerCamel snake]`,
+		},
+		{
+			name: "negative_max_iam_policies",
+			cfg: &MappingHandlerConfig{
+				HandlerConfig: HandlerConfig{
+					Sink: SinkStdout,
+				},
+				DefaultResourceScope: testDefaultResourceScope,
+				MaxIAMPolicies:       -1,
+			},
+			wantErr: `PMAP_MAPPING_MAX_IAM_POLICIES cannot be negative: -1`,
+		},
+		{
+			name: "rewrite_annotation_keys_without_casing",
+			cfg: &MappingHandlerConfig{
+				HandlerConfig: HandlerConfig{
+					Sink: SinkStdout,
+				},
+				DefaultResourceScope:  testDefaultResourceScope,
+				RewriteAnnotationKeys: true,
+			},
+			wantErr: `PMAP_MAPPING_REWRITE_ANNOTATION_KEYS requires PMAP_MAPPING_ANNOTATION_KEY_CASING`,
+		},
+		{
+			name: "disabled_processors",
+			cfg: &MappingHandlerConfig{
+				HandlerConfig: HandlerConfig{
+					Sink: SinkStdout,
+				},
+				DefaultResourceScope: testDefaultResourceScope,
+				DisabledProcessors:   []string{"AssetInventoryProcessor"},
+			},
+		},
+		{
+			name: "empty_disabled_processor",
+			cfg: &MappingHandlerConfig{
+				HandlerConfig: HandlerConfig{
+					Sink: SinkStdout,
+				},
+				DefaultResourceScope: testDefaultResourceScope,
+				DisabledProcessors:   []string{"AssetInventoryProcessor", " "},
+			},
+			wantErr: `PMAP_MAPPING_DISABLED_PROCESSORS cannot contain empty processor names`,
+		},
 	}
 
 	for _, tc := range tests {
@@ -159,3 +421,185 @@ func TestConfig_MappingValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_DefaultResourceScopes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		scope string
+		want  []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "single",
+			scope: "projects/test-project-id",
+			want:  []string{"projects/test-project-id"},
+		},
+		{
+			name:  "multiple_in_order",
+			scope: "projects/test-project-id, folders/123 ,organizations/456",
+			want:  []string{"projects/test-project-id", "folders/123", "organizations/456"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := &MappingHandlerConfig{DefaultResourceScope: tc.scope}
+			if diff := cmp.Diff(tc.want, cfg.DefaultResourceScopes()); diff != "" {
+				t.Errorf("DefaultResourceScopes got diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestConfig_StaticAttributeMap(t *testing.T) {
+	t.Parallel()
+
+	cfg := &HandlerConfig{StaticAttributes: []string{"deployment=prod", "region=us", "query=a=b", "region=eu"}}
+	want := map[string]string{"deployment": "prod", "region": "eu", "query": "a=b"}
+	if diff := cmp.Diff(want, cfg.StaticAttributeMap()); diff != "" {
+		t.Errorf("StaticAttributeMap got diff (-want, +got): %v", diff)
+	}
+}
+
+func TestConfig_LogValue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  slog.LogValuer
+		want string
+	}{
+		{
+			name: "handler_config",
+			cfg: &HandlerConfig{
+				Port:           "8080",
+				ProjectID:      testProjectID,
+				SuccessTopicID: testSuccessTopicID,
+			},
+			want: `config.port=8080 config.projectID=REDACTED config.successTopicID=REDACTED config.failureTopicID="" config.indexTopicID="" config.dualWriteTopicID="" config.handleTimeout=0s config.filePathFallback="" config.rateLimitQPS=0 config.rateLimitBurst=0 config.jsonKeyCasing="" config.objectMetadataAttribute=false config.sequenceAttribute=false config.warningsAttribute=false config.requireProvenance=false config.logFailureEvents=false config.staticAttributes="" config.sink="" config.localOutputFile="" config.pushAudience="" config.eventCompression="" config.publishSelfTest=false`,
+		},
+		{
+			name: "mapping_handler_config",
+			cfg: &MappingHandlerConfig{
+				DefaultResourceScope:     testDefaultResourceScope,
+				ReservedAnnotationPrefix: "sys.",
+				HandlerConfig: HandlerConfig{
+					Port:           "8080",
+					ProjectID:      testProjectID,
+					SuccessTopicID: testSuccessTopicID,
+					FailureTopicID: testFailureTopicID,
+				},
+			},
+			want: `config.port=8080 config.projectID=REDACTED config.successTopicID=REDACTED config.failureTopicID=REDACTED config.indexTopicID="" config.dualWriteTopicID="" config.handleTimeout=0s config.filePathFallback="" config.rateLimitQPS=0 config.rateLimitBurst=0 config.jsonKeyCasing="" config.objectMetadataAttribute=false config.sequenceAttribute=false config.warningsAttribute=false config.requireProvenance=false config.logFailureEvents=false config.staticAttributes="" config.sink="" config.localOutputFile="" config.pushAudience="" config.eventCompression="" config.publishSelfTest=false config.defaultResourceScope=projects/REDACTED config.reservedAnnotationPrefix=sys. config.iamSearchNonFatal=false config.maxIAMPolicies=0 config.bestEffortVerification=false config.requestStats=false config.defaultContactsFile="" config.residencyFile="" config.strictProvider=false config.ancestorNames=false config.allowedServices="" config.resourceProviders="" config.annotationSchemaFile="" config.annotationKeyCasing="" config.rewriteAnnotationKeys=false config.dropEmptyAnnotations=false config.objectUpdateTime=false config.disabledProcessors=""`,
+		},
+		{
+			name: "mapping_handler_config_multiple_scopes",
+			cfg: &MappingHandlerConfig{
+				DefaultResourceScope: testDefaultResourceScope + ",folders/123",
+				HandlerConfig: HandlerConfig{
+					Port:           "8080",
+					ProjectID:      testProjectID,
+					SuccessTopicID: testSuccessTopicID,
+					FailureTopicID: testFailureTopicID,
+				},
+			},
+			want: `config.port=8080 config.projectID=REDACTED config.successTopicID=REDACTED config.failureTopicID=REDACTED config.indexTopicID="" config.dualWriteTopicID="" config.handleTimeout=0s config.filePathFallback="" config.rateLimitQPS=0 config.rateLimitBurst=0 config.jsonKeyCasing="" config.objectMetadataAttribute=false config.sequenceAttribute=false config.warningsAttribute=false config.requireProvenance=false config.logFailureEvents=false config.staticAttributes="" config.sink="" config.localOutputFile="" config.pushAudience="" config.eventCompression="" config.publishSelfTest=false config.defaultResourceScope=projects/REDACTED,folders/REDACTED config.reservedAnnotationPrefix="" config.iamSearchNonFatal=false config.maxIAMPolicies=0 config.bestEffortVerification=false config.requestStats=false config.defaultContactsFile="" config.residencyFile="" config.strictProvider=false config.ancestorNames=false config.allowedServices="" config.resourceProviders="" config.annotationSchemaFile="" config.annotationKeyCasing="" config.rewriteAnnotationKeys=false config.dropEmptyAnnotations=false config.objectUpdateTime=false config.disabledProcessors=""`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var b bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&b, &slog.HandlerOptions{
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					// Drop the time, level and msg to only compare the config.
+					if len(groups) == 0 && a.Key != "config" {
+						return slog.Attr{}
+					}
+					return a
+				},
+			}))
+			logger.Info("loaded configuration", "config", tc.cfg)
+
+			got := strings.TrimSpace(b.String())
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("LogValue got diff (-want, +got): %v", diff)
+			}
+			for _, sensitive := range []string{testProjectID, testSuccessTopicID, testFailureTopicID} {
+				if strings.Contains(got, sensitive) {
+					t.Errorf("LogValue got %q, want %q redacted", got, sensitive)
+				}
+			}
+		})
+	}
+}
+
+// TestConfig_LogValueAllFields guards against config fields missing from the
+// hand-written LogValue, they would silently be dropped from the logs.
+func TestConfig_LogValueAllFields(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  slog.LogValuer
+	}{
+		{
+			name: "handler_config",
+			cfg:  &HandlerConfig{},
+		},
+		{
+			name: "mapping_handler_config",
+			cfg:  &MappingHandlerConfig{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			want := logKeys(reflect.TypeOf(tc.cfg).Elem())
+			var got []string
+			for _, a := range tc.cfg.LogValue().Group() {
+				got = append(got, a.Key)
+			}
+			slices.Sort(want)
+			slices.Sort(got)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("LogValue keys got diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+// logKeys returns the expected log keys of the env fields of the config
+// struct, the field names in lowerCamelCase, e.g. "iamSearchNonFatal" for
+// IAMSearchNonFatal.
+func logKeys(typ reflect.Type) []string {
+	var keys []string
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		if f.Anonymous {
+			keys = append(keys, logKeys(f.Type)...)
+			continue
+		}
+		if _, ok := f.Tag.Lookup("env"); !ok {
+			continue
+		}
+		// Lowercase the leading initialism but the first letter of the next
+		// word, e.g. "JSONKeyCasing" to "jsonKeyCasing".
+		name := []rune(f.Name)
+		n := 1
+		for n < len(name) && unicode.IsUpper(name[n]) && (n+1 == len(name) || unicode.IsUpper(name[n+1])) {
+			n++
+		}
+		keys = append(keys, strings.ToLower(string(name[:n]))+string(name[n:]))
+	}
+	return keys
+}
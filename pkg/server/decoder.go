@@ -0,0 +1,93 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"mime"
+	"path"
+	"strings"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// PayloadDecoder decodes the GCS object bytes into the proto message.
+type PayloadDecoder func(b []byte, msg proto.Message) error
+
+const (
+	// ContentTypeYAML is the content type of YAML objects. Objects of unknown
+	// content types are decoded as YAML.
+	ContentTypeYAML = "application/yaml"
+	// ContentTypeJSON is the content type of JSON objects, which are decoded
+	// with [protojson.Unmarshal].
+	ContentTypeJSON = "application/json"
+)
+
+// extensionContentTypes are the content types of the object name extensions,
+// used when the notification has no content type with a decoder.
+var extensionContentTypes = map[string]string{
+	".yaml": ContentTypeYAML,
+	".yml":  ContentTypeYAML,
+	".json": ContentTypeJSON,
+}
+
+// defaultPayloadDecoders returns the decoders of the built-in content types.
+func defaultPayloadDecoders() map[string]PayloadDecoder {
+	return map[string]PayloadDecoder{
+		ContentTypeYAML: yamlToProto,
+		ContentTypeJSON: func(b []byte, msg proto.Message) error {
+			return protojson.Unmarshal(b, msg) //nolint:wrapcheck // Wrapped by the caller.
+		},
+	}
+}
+
+// payloadContentType returns the content type of the object in the
+// notification which has a decoder. The "contentType" of the JSON_API_V1
+// payload is used first, then the extension of the object name, it falls
+// back to [ContentTypeYAML]. GCS defaults the content type to
+// "application/octet-stream", which is why the extension is checked too.
+func payloadContentType(m pubsub.Message, decoders map[string]PayloadDecoder) string {
+	if m.Attributes["payloadFormat"] == "JSON_API_V1" {
+		if pm, err := parseNotificationPayload(m.Data); err == nil && pm.ContentType != "" {
+			if t, _, err := mime.ParseMediaType(pm.ContentType); err == nil {
+				if _, ok := decoders[t]; ok {
+					return t
+				}
+			}
+		}
+	}
+
+	ext := strings.ToLower(path.Ext(m.Attributes["objectId"]))
+	if t, ok := extensionContentTypes[ext]; ok {
+		if _, ok := decoders[t]; ok {
+			return t
+		}
+	}
+	return ContentTypeYAML
+}
+
+// contentTypeName returns the short name of the content type for the error
+// messages, e.g. "yaml" for [ContentTypeYAML].
+func contentTypeName(contentType string) string {
+	switch contentType {
+	case ContentTypeYAML:
+		return "yaml"
+	case ContentTypeJSON:
+		return "json"
+	default:
+		return contentType
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+func TestPayloadContentType(t *testing.T) {
+	t.Parallel()
+
+	decoders := defaultPayloadDecoders()
+	decoders["application/toml"] = func([]byte, proto.Message) error { return nil }
+
+	cases := []struct {
+		name string
+		msg  pubsub.Message
+		want string
+	}{
+		{
+			name: "no_extension",
+			msg:  pubsub.Message{Attributes: map[string]string{"objectId": "dir/bar"}},
+			want: ContentTypeYAML,
+		},
+		{
+			name: "yaml_extension",
+			msg:  pubsub.Message{Attributes: map[string]string{"objectId": "dir/bar.yaml"}},
+			want: ContentTypeYAML,
+		},
+		{
+			name: "json_extension",
+			msg:  pubsub.Message{Attributes: map[string]string{"objectId": "dir/bar.JSON"}},
+			want: ContentTypeJSON,
+		},
+		{
+			name: "unknown_extension",
+			msg:  pubsub.Message{Attributes: map[string]string{"objectId": "dir/bar.txt"}},
+			want: ContentTypeYAML,
+		},
+		{
+			name: "content_type",
+			msg: pubsub.Message{
+				Attributes: map[string]string{"objectId": "dir/bar", "payloadFormat": "JSON_API_V1"},
+				Data:       []byte(`{"contentType": "application/json"}`),
+			},
+			want: ContentTypeJSON,
+		},
+		{
+			name: "content_type_over_extension",
+			msg: pubsub.Message{
+				Attributes: map[string]string{"objectId": "dir/bar.yaml", "payloadFormat": "JSON_API_V1"},
+				Data:       []byte(`{"contentType": "application/toml; charset=utf-8"}`),
+			},
+			want: "application/toml",
+		},
+		{
+			name: "octet_stream_content_type",
+			msg: pubsub.Message{
+				Attributes: map[string]string{"objectId": "dir/bar.json", "payloadFormat": "JSON_API_V1"},
+				Data:       []byte(`{"contentType": "application/octet-stream"}`),
+			},
+			want: ContentTypeJSON,
+		},
+		{
+			name: "content_type_without_payload_format",
+			msg: pubsub.Message{
+				Attributes: map[string]string{"objectId": "dir/bar"},
+				Data:       []byte(`{"contentType": "application/json"}`),
+			},
+			want: ContentTypeYAML,
+		},
+		{
+			name: "invalid_payload",
+			msg: pubsub.Message{
+				Attributes: map[string]string{"objectId": "dir/bar.json", "payloadFormat": "JSON_API_V1"},
+				Data:       []byte(`}`),
+			},
+			want: ContentTypeJSON,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := payloadContentType(tc.msg, decoders); got != tc.want {
+				t.Errorf("payloadContentType got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEventHandler_WithPayloadDecoder(t *testing.T) {
+	t.Parallel()
+
+	// upperDecoder decodes "key=value" lines into a struct with upper case
+	// values.
+	upperDecoder := func(b []byte, msg proto.Message) error {
+		s, ok := msg.(*structpb.Struct)
+		if !ok {
+			return fmt.Errorf("unexpected message %T", msg)
+		}
+		s.Fields = map[string]*structpb.Value{}
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return fmt.Errorf("invalid line %q", line)
+			}
+			s.Fields[k] = structpb.NewStringValue(strings.ToUpper(v))
+		}
+		return nil
+	}
+
+	cases := []struct {
+		name        string
+		contentType string
+		decoder     PayloadDecoder
+		objectID    string
+		data        []byte
+		wantErr     string
+		want        *structpb.Struct
+		wantOutcome string
+	}{
+		{
+			name:        "custom_content_type",
+			contentType: "text/x-properties",
+			decoder:     upperDecoder,
+			objectID:    "bar.properties",
+			data:        []byte("foo=bar"),
+			want: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"foo": structpb.NewStringValue("BAR"),
+			}},
+			wantOutcome: OutcomeSuccess,
+		},
+		{
+			name:        "replace_yaml_decoder",
+			contentType: ContentTypeYAML,
+			decoder:     upperDecoder,
+			objectID:    "bar.yaml",
+			data:        []byte("foo=bar"),
+			want: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"foo": structpb.NewStringValue("BAR"),
+			}},
+			wantOutcome: OutcomeSuccess,
+		},
+		{
+			name:        "custom_decoder_error",
+			contentType: "text/x-properties",
+			decoder:     upperDecoder,
+			objectID:    "bar",
+			data:        []byte("foo"),
+			wantOutcome: OutcomeFailure,
+		},
+		{
+			name:    "empty_content_type",
+			decoder: upperDecoder,
+			wantErr: "payload decoder content type cannot be empty",
+		},
+		{
+			name:        "nil_decoder",
+			contentType: "text/x-properties",
+			wantErr:     `payload decoder of "text/x-properties" cannot be nil`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			store := &testObjectStore{data: map[string][]byte{"foo/" + tc.objectID: tc.data}}
+			h, err := NewHandler(ctx, []Processor[*structpb.Struct]{}, &testRawMessenger{},
+				WithOptionalGitHubSource(),
+				WithObjectStore(store),
+				WithPayloadDecoder(tc.contentType, tc.decoder))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			// The content type is carried by the notification payload, the
+			// extension is used otherwise.
+			result, err := h.HandleResult(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": tc.objectID, "payloadFormat": "JSON_API_V1"},
+				Data:       []byte(fmt.Sprintf(`{"contentType": %q}`, tc.contentType)),
+			})
+			if err != nil {
+				t.Fatalf("HandleResult got unexpected error: %v", err)
+			}
+			if result.Outcome != tc.wantOutcome {
+				t.Fatalf("HandleResult got outcome %q, want %q", result.Outcome, tc.wantOutcome)
+			}
+			if tc.want == nil {
+				return
+			}
+
+			got := &structpb.Struct{}
+			if err := result.Event.GetPayload().UnmarshalTo(got); err != nil {
+				t.Fatalf("failed to unmarshal event payload: %v", err)
+			}
+			if !proto.Equal(got, tc.want) {
+				t.Errorf("HandleResult got payload %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// Ensure the ResourceMapping JSON is decoded with the proto JSON names.
+func TestEventHandler_JSONResourceMapping(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := &testObjectStore{data: map[string][]byte{
+		"foo/dir/bar.json": []byte(`{
+	"resource": {"name": "//pubsub.googleapis.com/projects/test-project/topics/test-topic", "provider": "gcp"},
+	"contacts": {"email": ["pmap@example.com"]}
+}`),
+	}}
+	h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{}, &testRawMessenger{}, WithOptionalGitHubSource(), WithObjectStore(store))
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+
+	result, err := h.HandleResult(ctx, pubsub.Message{
+		Attributes: map[string]string{"bucketId": "foo", "objectId": "dir/bar.json"},
+	})
+	if err != nil {
+		t.Fatalf("HandleResult got unexpected error: %v", err)
+	}
+	if result.Outcome != OutcomeSuccess {
+		t.Fatalf("HandleResult got outcome %q, want %q", result.Outcome, OutcomeSuccess)
+	}
+
+	var got v1alpha1.ResourceMapping
+	if err := result.Event.GetPayload().UnmarshalTo(&got); err != nil {
+		t.Fatalf("failed to unmarshal event payload: %v", err)
+	}
+	if got, want := got.GetContacts().GetEmail(), []string{"pmap@example.com"}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("HandleResult got contacts %v, want %v", got, want)
+	}
+}
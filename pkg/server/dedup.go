@@ -0,0 +1,117 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SeenCache records the IDs of the Pub/Sub messages already handled, so the
+// messages redelivered by Pub/Sub are not handled again.
+type SeenCache interface {
+	// Seen reports whether the message ID was marked.
+	Seen(ctx context.Context, id string) (bool, error)
+
+	// Mark records the message ID as handled.
+	Mark(ctx context.Context, id string) error
+}
+
+// MemorySeenCache is an in-memory [SeenCache] which forgets the message IDs
+// after a TTL. It's local to the instance, so redeliveries to other
+// instances are not deduplicated.
+type MemorySeenCache struct {
+	ttl   time.Duration
+	clock func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+	// queue holds the marked IDs in expiry order, the TTL is the same for
+	// all IDs so it's the order they were marked in.
+	queue []seenEntry
+}
+
+// seenEntry is a marked ID with its expiry.
+type seenEntry struct {
+	id     string
+	expiry time.Time
+}
+
+// NewMemorySeenCache creates a [MemorySeenCache] keeping the message IDs for
+// the given TTL, which should cover the Pub/Sub redelivery window.
+func NewMemorySeenCache(ttl time.Duration) (*MemorySeenCache, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("seen cache ttl must be positive: %s", ttl)
+	}
+	return &MemorySeenCache{
+		ttl:   ttl,
+		clock: time.Now,
+		seen:  make(map[string]time.Time),
+	}, nil
+}
+
+// Seen implements [SeenCache].
+func (c *MemorySeenCache) Seen(_ context.Context, id string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiry, ok := c.seen[id]
+	return ok && c.clock().Before(expiry), nil
+}
+
+// Mark implements [SeenCache]. The expired IDs are evicted along the way,
+// from the front of the queue so only the expired IDs are visited.
+func (c *MemorySeenCache) Mark(_ context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock()
+	var n int
+	for ; n < len(c.queue) && !now.Before(c.queue[n].expiry); n++ {
+		// The ID may have been marked again since, keep the later expiry.
+		if e := c.queue[n]; c.seen[e.id].Equal(e.expiry) {
+			delete(c.seen, e.id)
+		}
+	}
+	c.queue = c.queue[n:]
+
+	expiry := now.Add(c.ttl)
+	c.seen[id] = expiry
+	c.queue = append(c.queue, seenEntry{id: id, expiry: expiry})
+	return nil
+}
+
+// skipReasonDuplicate is the reason of the messages skipped because they
+// were already handled.
+const skipReasonDuplicate = "duplicate message"
+
+// WithDedupCache returns an option to skip the Pub/Sub messages whose ID is
+// in the cache, the ID of every handled message is added to it. Messages are
+// not deduplicated by default, nor are the messages without ID.
+//
+// The cache is best effort: concurrent deliveries of the same message may
+// still both be handled, and a message is handled again when the cache
+// fails.
+func WithDedupCache(c SeenCache) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if c == nil {
+			return nil, fmt.Errorf("dedup cache cannot be nil")
+		}
+		opts.dedupCache = c
+		return opts, nil
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+type fakeSeenCache struct {
+	seen    map[string]bool
+	seenErr error
+	markErr error
+}
+
+func (c *fakeSeenCache) Seen(_ context.Context, id string) (bool, error) {
+	if c.seenErr != nil {
+		return false, c.seenErr
+	}
+	return c.seen[id], nil
+}
+
+func (c *fakeSeenCache) Mark(_ context.Context, id string) error {
+	if c.markErr != nil {
+		return c.markErr
+	}
+	c.seen[id] = true
+	return nil
+}
+
+type countMessenger struct {
+	sent int
+}
+
+func (m *countMessenger) Send(_ context.Context, _ []byte, _ map[string]string) error {
+	m.sent++
+	return nil
+}
+
+func TestEventHandler_HTTPHandlerSkipped(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name            string
+		cache           *fakeSeenCache
+		noCache         bool
+		messageIDs      []string
+		wantStatusCodes []int
+		wantBodies      []string
+		wantSent        int
+	}{
+		{
+			name:            "repeated_message_skipped",
+			cache:           &fakeSeenCache{},
+			messageIDs:      []string{"1", "1", "1"},
+			wantStatusCodes: []int{http.StatusCreated, http.StatusOK, http.StatusOK},
+			wantBodies:      []string{"OK: processed", "OK: skipped: duplicate message", "OK: skipped: duplicate message"},
+			wantSent:        1,
+		},
+		{
+			name:            "different_messages",
+			cache:           &fakeSeenCache{},
+			messageIDs:      []string{"1", "2", "1"},
+			wantStatusCodes: []int{http.StatusCreated, http.StatusCreated, http.StatusOK},
+			wantBodies:      []string{"OK: processed", "OK: processed", "OK: skipped: duplicate message"},
+			wantSent:        2,
+		},
+		{
+			name:            "no_message_id",
+			cache:           &fakeSeenCache{},
+			messageIDs:      []string{"", ""},
+			wantStatusCodes: []int{http.StatusCreated, http.StatusCreated},
+			wantSent:        2,
+		},
+		{
+			name:            "no_cache",
+			noCache:         true,
+			messageIDs:      []string{"1", "1"},
+			wantStatusCodes: []int{http.StatusCreated, http.StatusCreated},
+			wantBodies:      []string{"OK: processed", "OK: processed"},
+			wantSent:        2,
+		},
+		{
+			name:            "seen_error_handles_message",
+			cache:           &fakeSeenCache{seenErr: fmt.Errorf("cache unavailable")},
+			messageIDs:      []string{"1", "1"},
+			wantStatusCodes: []int{http.StatusCreated, http.StatusCreated},
+			wantSent:        2,
+		},
+		{
+			name:            "mark_error_ignored",
+			cache:           &fakeSeenCache{markErr: fmt.Errorf("cache unavailable")},
+			messageIDs:      []string{"1", "1"},
+			wantStatusCodes: []int{http.StatusCreated, http.StatusCreated},
+			wantSent:        2,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := []Option{
+				WithObjectStore(&testObjectStore{
+					data: map[string][]byte{"foo/bar": []byte(`foo: bar`)},
+				}),
+				WithOptionalGitHubSource(),
+			}
+			if !tc.noCache {
+				tc.cache.seen = make(map[string]bool)
+				opts = append(opts, WithDedupCache(tc.cache))
+			}
+			msgr := &countMessenger{}
+			h, err := NewHandler(context.Background(), []Processor[*structpb.Struct]{&testProcessor{}}, msgr, opts...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			gotStatusCodes := make([]int, 0, len(tc.messageIDs))
+			gotBodies := make([]string, 0, len(tc.messageIDs))
+			for _, id := range tc.messageIDs {
+				var m PubSubMessage
+				m.Message.MessageID = id
+				m.Message.Attributes = map[string]string{AttrKeyBucketID: "foo", AttrKeyObjectID: "bar"}
+				body, err := json.Marshal(m)
+				if err != nil {
+					t.Fatalf("failed to marshal message: %v", err)
+				}
+				resp := httptest.NewRecorder()
+				h.HTTPHandler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body)))
+				gotStatusCodes = append(gotStatusCodes, resp.Code)
+				gotBodies = append(gotBodies, resp.Body.String())
+			}
+			if diff := cmp.Diff(tc.wantStatusCodes, gotStatusCodes); diff != "" {
+				t.Errorf("got status codes diff (-want, +got): %v", diff)
+			}
+			if tc.wantBodies != nil {
+				if diff := cmp.Diff(tc.wantBodies, gotBodies); diff != "" {
+					t.Errorf("got bodies diff (-want, +got): %v", diff)
+				}
+			}
+			if got, want := msgr.sent, tc.wantSent; got != want {
+				t.Errorf("got %d events sent, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestMemorySeenCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	c, err := NewMemorySeenCache(time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	c.clock = func() time.Time { return now }
+
+	seen := func(id string) bool {
+		t.Helper()
+		ok, err := c.Seen(ctx, id)
+		if err != nil {
+			t.Fatalf("Seen(%q) got unexpected error: %v", id, err)
+		}
+		return ok
+	}
+
+	if seen("1") {
+		t.Errorf("Seen(1) before Mark got true, want false")
+	}
+	if err := c.Mark(ctx, "1"); err != nil {
+		t.Fatalf("Mark(1) got unexpected error: %v", err)
+	}
+	if !seen("1") {
+		t.Errorf("Seen(1) after Mark got false, want true")
+	}
+
+	now = now.Add(time.Minute)
+	if seen("1") {
+		t.Errorf("Seen(1) after the ttl got true, want false")
+	}
+	if err := c.Mark(ctx, "2"); err != nil {
+		t.Fatalf("Mark(2) got unexpected error: %v", err)
+	}
+	if got := len(c.seen); got != 1 {
+		t.Errorf("got %d cached ids after eviction, want 1", got)
+	}
+
+	// Marking an ID again extends its expiry, its earlier entry doesn't
+	// evict it.
+	now = now.Add(30 * time.Second)
+	if err := c.Mark(ctx, "2"); err != nil {
+		t.Fatalf("Mark(2) again got unexpected error: %v", err)
+	}
+	now = now.Add(30 * time.Second)
+	if err := c.Mark(ctx, "3"); err != nil {
+		t.Fatalf("Mark(3) got unexpected error: %v", err)
+	}
+	if !seen("2") {
+		t.Errorf("Seen(2) after Mark again got false, want true")
+	}
+	if got, want := len(c.queue), 2; got != want {
+		t.Errorf("got %d queued ids after eviction, want %d", got, want)
+	}
+}
+
+func TestNewMemorySeenCache(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewMemorySeenCache(0)
+	if diff := testutil.DiffErrString(err, "seen cache ttl must be positive: 0s"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestWithDedupCache(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHandler(context.Background(), []Processor[*structpb.Struct]{}, &testRawMessenger{},
+		WithOptionalGitHubSource(),
+		WithObjectStore(&testObjectStore{}), WithDedupCache(nil))
+	if diff := testutil.DiffErrString(err, "dedup cache cannot be nil"); diff != "" {
+		t.Error(diff)
+	}
+}
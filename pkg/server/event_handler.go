@@ -16,37 +16,126 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"net/http"
+	"path"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/storage"
+	"github.com/sethvargo/go-retry"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/option"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/abcxyz/pkg/logging"
-	"github.com/abcxyz/pkg/protoutil"
 	"github.com/abcxyz/pmap/apis/v1alpha1"
 	"github.com/abcxyz/pmap/pkg/pmaperrors"
 )
 
-const (
-	httpRequestSizeLimitInBytes = 256_000
-	gcsObjectSizeLimitInBytes   = 25_000_000
-)
+const httpRequestSizeLimitInBytes = 256_000
+
+// DefaultMaxObjectSize is the default size limit of the GCS objects in bytes,
+// see [WithMaxObjectSize].
+const DefaultMaxObjectSize = 25_000_000
 
 const (
 	// AttrKeyProcessErr is the attribute key for process error.
 	AttrKeyProcessErr = "ProcessErr"
+
+	// AttrKeyOutcome is the attribute key for the path that handled the
+	// event, either OutcomeSuccess or OutcomeFailure.
+	AttrKeyOutcome = "pmapOutcome"
+
+	// AttrKeySchemaVersion is the attribute key for the contract version of
+	// the event payload, e.g. "v1alpha1".
+	AttrKeySchemaVersion = "schemaVersion"
+
+	// AttrKeyBucketID, AttrKeyObjectID and AttrKeyObjectGeneration are the
+	// attribute keys for the GCS object the event was generated from, they're
+	// the same as the GCS notification attribute keys. They're set on failure
+	// events too, even if the object couldn't be parsed, so the offending
+	// object can be located from the failure event alone.
+	AttrKeyBucketID         = "bucketId"
+	AttrKeyObjectID         = "objectId"
+	AttrKeyObjectGeneration = "objectGeneration"
+
+	// AttrKeyObjectMetadata is the attribute key for the JSON encoded custom
+	// metadata of the GCS object, see [WithObjectMetadataAttribute].
+	AttrKeyObjectMetadata = "objectMetadata"
+
+	// AttrKeyObjectMetadataTruncated is the attribute key set to "true" when
+	// entries are dropped from AttrKeyObjectMetadata to fit the size limit.
+	AttrKeyObjectMetadataTruncated = "objectMetadataTruncated"
+
+	// AttrKeySequence is the attribute key for the sequence number of the
+	// event, see [WithSequenceAttribute].
+	AttrKeySequence = "pmapSequence"
+
+	// AttrKeyResourceKey is the attribute key for the [ResourceKey] of the
+	// event payload, consumers can use it to deduplicate the events of the
+	// same resource and subscope. It's not set for payloads that don't
+	// describe a resource.
+	AttrKeyResourceKey = "pmapResourceKey"
+
+	// AttrKeyPublisher is the attribute key for the verified identity which
+	// pushed the notification, see [WithPushVerifier].
+	AttrKeyPublisher = "publisher"
+
+	// AttrKeyDeleted is the attribute key set to "true" on the tombstone
+	// events of deleted objects, which have no payload.
+	AttrKeyDeleted = "pmapDeleted"
+)
+
+const (
+	// AttrKeyEventType is the GCS notification attribute key for the type of
+	// the object change, e.g. EventTypeObjectFinalize.
+	AttrKeyEventType = "eventType"
+
+	// EventTypeObjectFinalize is the event type of created or overwritten
+	// objects, EventTypeObjectDelete of deleted objects. The objects of the
+	// other event types are processed the same as finalized objects.
+	EventTypeObjectFinalize = "OBJECT_FINALIZE"
+	EventTypeObjectDelete   = "OBJECT_DELETE"
+
+	// AttrKeyOverwrittenByGeneration is the GCS notification attribute key of
+	// the generation which overwrote the object. It's set on the
+	// EventTypeObjectDelete notification of an overwritten object, which is
+	// followed by the EventTypeObjectFinalize notification of the new object.
+	AttrKeyOverwrittenByGeneration = "overwrittenByGeneration"
+)
+
+// MaxObjectMetadataAttrBytes is the maximum size of the object metadata
+// attribute, which is the Pub/Sub limit of attribute values.
+const MaxObjectMetadataAttrBytes = 1024
+
+// schemaVersionRegexp matches versioned contract packages, e.g. "v1alpha1".
+var schemaVersionRegexp = regexp.MustCompile(`^v[0-9]+((alpha|beta)[0-9]+)?$`)
+
+const (
+	// OutcomeSuccess is the outcome of events sent to the successMessenger.
+	OutcomeSuccess = "success"
+	// OutcomeFailure is the outcome of events sent to the failureMessenger.
+	OutcomeFailure = "failure"
+	// OutcomeSkipped is the outcome of notifications ignored without sending
+	// any event, e.g. see [WithResourceProviders].
+	OutcomeSkipped = "skipped"
 )
 
 // Wrap the proto message interface.
@@ -71,6 +160,29 @@ type StoppableProcessor[P proto.Message] interface {
 	Stop() error
 }
 
+// NamedProcessor is the interface to processors that have a name other
+// processors can depend on. Processors that don't implement it are named
+// after their type, e.g. "*processors.AssetInventoryProcessor".
+type NamedProcessor interface {
+	Name() string
+}
+
+// DependentProcessor is the interface to processors that depend on other
+// processors. The processors named in DependsOn must be placed before the
+// dependent processor.
+type DependentProcessor interface {
+	DependsOn() []string
+}
+
+// OrderedProcessor is the interface to processors that must run after other
+// processors when those are configured, e.g. an enrichment processor after
+// the validation of the annotations it adds to. Unlike [DependentProcessor],
+// the processors named in RunsAfter are optional, and must be placed before
+// the ordered processor when present.
+type OrderedProcessor interface {
+	RunsAfter() []string
+}
+
 // These are metadatas for GCS objects that were uploaded.
 // These customs keys are defined in snapshot-file-change
 // and snapshot-file-copy workflow.
@@ -84,8 +196,38 @@ const (
 	MetadataKeyWorkflowRunID              = "github-run-id"
 	MetadataKeyWorkflowRunAttempt         = "github-run-attempt"
 	GCSPathSeparatorKey                   = "/gh-prefix/"
+
+	// MetadataKeyResourceScope is an optional metadata key that overrides
+	// the default resource scope processors use for the object.
+	MetadataKeyResourceScope = "resource-scope"
 )
 
+// AttrKeyCloudEventsSpecVersion is the attribute key identifying CloudEvents
+// notifications in the Pub/Sub binary content mode, where every CloudEvents
+// attribute is prefixed with "ce-".
+const AttrKeyCloudEventsSpecVersion = "ce-specversion"
+
+// cloudEventsMetadataKeys are the metadata keys read from the CloudEvents
+// extension attributes, see [CloudEventsAttrKey].
+var cloudEventsMetadataKeys = []string{
+	MetadataKeyGitHubCommit,
+	MetadataKeyGitHubRepo,
+	MetadataKeyWorkflow,
+	MetadataKeyWorkflowSha,
+	MetadataKeyWorkflowTriggeredTimestamp,
+	MetadataKeyWorkflowRunID,
+	MetadataKeyWorkflowRunAttempt,
+	MetadataKeyResourceScope,
+}
+
+// CloudEventsAttrKey returns the attribute key of the CloudEvents extension
+// carrying the metadata with the given key. Extension names are lowercase
+// alphanumeric, so dashes are dropped, e.g. "ce-githubcommit" for
+// "github-commit".
+func CloudEventsAttrKey(metadataKey string) string {
+	return "ce-" + strings.ReplaceAll(metadataKey, "-", "")
+}
+
 // An interface for sending pmap event downstream.
 type Messenger interface {
 	Send(context.Context, []byte, map[string]string) error
@@ -100,19 +242,139 @@ type Messenger interface {
 // The GCS object could be any proto message type. But an instance of
 // Handler can only handle one type of proto message.
 type EventHandler[T any, P ProtoWrapper[T]] struct {
-	client           *storage.Client
+	store            ObjectStore
 	processors       []Processor[P]
 	successMessenger Messenger
 	failureMessenger Messenger
+	indexMessenger   Messenger
+	handleTimeout    time.Duration
+	filePathFallback FilePathFunc
+	rateLimiter      *rate.Limiter
+	useProtoNames    bool
+	schemaVersion    string
+	// payloadType is the full name of the payload proto message, e.g.
+	// "abcxyz.pmap.ResourceMapping".
+	payloadType string
+
+	// dualWriteMessenger receives the success events in the other JSON key
+	// casing, it's nil when events are written once.
+	dualWriteMessenger Messenger
+
+	objectMetadataLimit int
+	eventTransformer    EventTransformer
+
+	// sequence is the last sequence number, it's only incremented when
+	// withSequence is set.
+	withSequence bool
+	sequence     atomic.Uint64
+
+	requireProvenance bool
+	// optionalGitHubSource lets notifications without object metadata
+	// produce events without the GitHub provenance.
+	optionalGitHubSource bool
+
+	// dropEmptyAnnotations removes the empty structs and lists from the
+	// payload annotations before the event is marshaled.
+	dropEmptyAnnotations bool
+
+	// clock returns the time the events are stamped with.
+	clock func() time.Time
+
+	// staticAttributes are merged into the attributes of every event.
+	staticAttributes map[string]string
+
+	// pushVerifier verifies the push requests, they're not verified when
+	// it's nil.
+	pushVerifier PushVerifier
+
+	// payloadDecoders decode the objects keyed by content type.
+	payloadDecoders map[string]PayloadDecoder
+
+	// maxObjectSize is the size limit of the GCS objects in bytes.
+	maxObjectSize int64
+
+	// newReadBackoff returns the backoff of the GCS object reads, objects
+	// are read once when it's nil.
+	newReadBackoff func() retry.Backoff
+
+	// processorConcurrency is the number of processors run at once, they're
+	// run sequentially when it's at most 1.
+	processorConcurrency int
+
+	// readinessChecks are run by the readiness endpoint along with the
+	// object store check.
+	readinessChecks []func(context.Context) error
+
+	// dedupCache records the handled Pub/Sub message IDs, messages are not
+	// deduplicated when it's nil.
+	dedupCache SeenCache
+
+	// withWarnings sets the warnings added by the processors as an attribute
+	// of the success events.
+	withWarnings bool
+
+	// metrics records the metrics of the handled notifications.
+	metrics MetricsRecorder
+
+	// resourceProviders are the resource providers events are emitted for,
+	// all providers are handled when it's empty.
+	resourceProviders []string
 }
 
 // HandlerOpts available when creating an EventHandler such as GCS storage client
 // and Messenger for failure events.
 type HandlerOpts struct {
-	client           *storage.Client
-	failureMessenger Messenger
+	store ObjectStore
+	// clientOptions are used to create the GCS storage client when no client
+	// or store is set.
+	clientOptions      []option.ClientOption
+	failureMessenger   Messenger
+	indexMessenger     Messenger
+	dualWriteMessenger Messenger
+	handleTimeout      time.Duration
+	filePathFallback   FilePathFunc
+	rateLimiter        *rate.Limiter
+	useProtoNames      bool
+	// objectMetadataLimit is the size limit of the object metadata attribute,
+	// the attribute is not set when it's zero.
+	objectMetadataLimit  int
+	eventTransformer     EventTransformer
+	withSequence         bool
+	requireProvenance    bool
+	optionalGitHubSource bool
+	dropEmptyAnnotations bool
+	clock                func() time.Time
+	// failureLogger is set by WithFailureLogger, withFailureLogger is needed
+	// since a nil logger uses the context logger.
+	withFailureLogger bool
+	failureLogger     *slog.Logger
+	staticAttributes  map[string]string
+	pushVerifier      PushVerifier
+	payloadDecoders   map[string]PayloadDecoder
+	maxObjectSize     int64
+	newReadBackoff    func() retry.Backoff
+	// processorConcurrency is set by WithConcurrentProcessors.
+	processorConcurrency int
+	readinessChecks      []func(context.Context) error
+	dedupCache           SeenCache
+	withWarnings         bool
+	metrics              MetricsRecorder
+	resourceProviders    []string
 }
 
+// FilePathFunc returns the file path of the GCS object with the given ID.
+type FilePathFunc func(objectID string) string
+
+// ObjectIDFilePath is a [FilePathFunc] that uses the full object ID as the
+// file path.
+func ObjectIDFilePath(objectID string) string {
+	return objectID
+}
+
+// EventTransformer reshapes the pmap event before it's marshaled and sent
+// downstream, e.g. to drop fields a sink doesn't support.
+type EventTransformer func(event *v1alpha1.PmapEvent) error
+
 // Define your option to change HandlerOpts.
 type Option func(context.Context, *HandlerOpts) (*HandlerOpts, error)
 
@@ -120,7 +382,28 @@ type Option func(context.Context, *HandlerOpts) (*HandlerOpts, error)
 // an EventHandler.
 func WithStorageClient(client *storage.Client) Option {
 	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
-		opts.client = client
+		opts.store = NewGCSObjectStore(client)
+		return opts, nil
+	}
+}
+
+// WithObjectStore returns an option to set the store the objects are read
+// from when creating an EventHandler, e.g. a fake in tests. It replaces the
+// client set with [WithStorageClient].
+func WithObjectStore(store ObjectStore) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.store = store
+		return opts, nil
+	}
+}
+
+// WithStorageClientOptions returns an option to set the client options the
+// EventHandler creates its GCS storage client with, e.g. the endpoint of an
+// emulator or alternate credentials. They're ignored when the client or store
+// is set with [WithStorageClient] or [WithObjectStore].
+func WithStorageClientOptions(clientOpts ...option.ClientOption) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.clientOptions = append(opts.clientOptions, clientOpts...)
 		return opts, nil
 	}
 }
@@ -134,6 +417,291 @@ func WithFailureMessenger(msger Messenger) Option {
 	}
 }
 
+// WithFailureLogger returns an option to log the failure events and their
+// attributes at error level with the given logger when no failure Messenger
+// is set, instead of dropping them. A nil logger logs with the logger of the
+// request context.
+func WithFailureLogger(logger *slog.Logger) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.withFailureLogger = true
+		opts.failureLogger = logger
+		return opts, nil
+	}
+}
+
+// WithIndexMessenger returns an option to set the Messenger for index events
+// when creating an EventHandler. A minimal [IndexEvent] is sent to it for every
+// successfully processed pmap event.
+func WithIndexMessenger(msger Messenger) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.indexMessenger = msger
+		return opts, nil
+	}
+}
+
+// WithDualWriteMessenger returns an option to additionally send every success
+// event to the Messenger marshaled with the other JSON key casing, i.e. the
+// lowerCamelCase JSON names when [WithProtoNames] is set and the proto field
+// names otherwise. It allows the consumers of a topic to migrate between the
+// casings independently.
+func WithDualWriteMessenger(msger Messenger) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.dualWriteMessenger = msger
+		return opts, nil
+	}
+}
+
+// WithHandleTimeout returns an option to set the maximum duration of a whole
+// [EventHandler.Handle] call, including reading the GCS object, running the
+// processors and sending the events downstream. No timeout is enforced by default.
+func WithHandleTimeout(d time.Duration) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if d < 0 {
+			return nil, fmt.Errorf("handle timeout cannot be negative: %s", d)
+		}
+		opts.handleTimeout = d
+		return opts, nil
+	}
+}
+
+// WithFilePathFallback returns an option to set how the file path is derived
+// for objects whose ID lacks the [GCSPathSeparatorKey]. The file path is left
+// empty for such objects by default.
+func WithFilePathFallback(f FilePathFunc) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.filePathFallback = f
+		return opts, nil
+	}
+}
+
+// WithProtoNames returns an option to marshal the emitted events with the
+// proto field names, e.g. "github_source", instead of the lowerCamelCase JSON
+// names, e.g. "githubSource", to match snake_case BigQuery table schemas.
+func WithProtoNames() Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.useProtoNames = true
+		return opts, nil
+	}
+}
+
+// WithObjectMetadataAttribute returns an option to attach the complete custom
+// metadata of the GCS object to the emitted events as the JSON encoded
+// [AttrKeyObjectMetadata] attribute, for debugging. Entries are dropped in
+// key order to keep the attribute within limit bytes, which can't exceed
+// [MaxObjectMetadataAttrBytes]. The metadata is not attached by default.
+func WithObjectMetadataAttribute(limit int) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if limit <= 0 || limit > MaxObjectMetadataAttrBytes {
+			return nil, fmt.Errorf("object metadata attribute limit must be in (0, %d]: %d", MaxObjectMetadataAttrBytes, limit)
+		}
+		opts.objectMetadataLimit = limit
+		return opts, nil
+	}
+}
+
+// WithEventTransformer returns an option to apply the transformer to every
+// pmap event, successful or not, right before it's marshaled. Events are sent
+// as generated by default.
+func WithEventTransformer(t EventTransformer) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.eventTransformer = t
+		return opts, nil
+	}
+}
+
+// WithSequenceAttribute returns an option to number the events sent to the
+// success and failure messengers with the [AttrKeySequence] attribute, so
+// consumers can detect gaps and reordering without Pub/Sub message ordering.
+// The sequence is best-effort: it's per handler instance, restarts from 1 when
+// the process restarts, and isn't attached when no event is sent.
+func WithSequenceAttribute() Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.withSequence = true
+		return opts, nil
+	}
+}
+
+// WithRequireProvenance returns an option to fail notifications that carry no
+// object metadata, e.g. created with payloadFormat NONE, with a user facing
+// error explaining the GitHub provenance is required. It takes precedence
+// over [WithOptionalGitHubSource].
+func WithRequireProvenance() Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.requireProvenance = true
+		return opts, nil
+	}
+}
+
+// WithOptionalGitHubSource returns an option to let notifications that carry
+// no object metadata, e.g. created with payloadFormat NONE or without
+// payloadFormat, produce events without the GitHub provenance. By default
+// they fail with a user facing "unsupported payloadFormat" error, since the
+// provenance is only parsed from the JSON_API_V1 payload or the CloudEvents
+// attributes.
+func WithOptionalGitHubSource() Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.optionalGitHubSource = true
+		return opts, nil
+	}
+}
+
+// WithDropEmptyAnnotations returns an option to recursively remove the empty
+// structs and lists from the annotations of the payload before the event is
+// marshaled, e.g. "assetInfo: {}" when a processor found nothing, so they
+// don't produce empty columns downstream. Payloads without annotations are
+// not changed.
+func WithDropEmptyAnnotations() Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.dropEmptyAnnotations = true
+		return opts, nil
+	}
+}
+
+// WithClock returns an option to set the clock the event timestamps are taken
+// from, e.g. a fixed time in tests. It defaults to [time.Now].
+func WithClock(clock func() time.Time) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if clock == nil {
+			return nil, fmt.Errorf("clock cannot be nil")
+		}
+		opts.clock = clock
+		return opts, nil
+	}
+}
+
+// WithStaticAttributes returns an option to merge the static attributes into
+// the attributes of every event sent downstream, e.g. to tag the events with
+// the deployment for routing. The per-event attributes such as
+// [AttrKeyProcessErr] take precedence over the static attributes with the same
+// key.
+func WithStaticAttributes(attrs map[string]string) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		for k := range attrs {
+			if k == "" {
+				return nil, fmt.Errorf("static attribute key cannot be empty")
+			}
+		}
+		opts.staticAttributes = maps.Clone(attrs)
+		return opts, nil
+	}
+}
+
+// WithPushVerifier returns an option to verify the OIDC token of the push
+// requests served by [EventHandler.HTTPHandler] with the given verifier.
+// Requests without a valid token are rejected with 401, the verified identity
+// is attached to the events as the [AttrKeyPublisher] attribute for audit.
+// Requests are not verified by default.
+func WithPushVerifier(v PushVerifier) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.pushVerifier = v
+		return opts, nil
+	}
+}
+
+// WithPayloadDecoder returns an option to decode the objects of the given
+// content type, e.g. "application/toml", with the decoder. It replaces the
+// built-in decoder of [ContentTypeYAML] or [ContentTypeJSON] when given either.
+// The content type is taken from the notification, objects without a
+// registered content type are decoded by their name extension or as YAML.
+func WithPayloadDecoder(contentType string, d PayloadDecoder) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if contentType == "" {
+			return nil, fmt.Errorf("payload decoder content type cannot be empty")
+		}
+		if d == nil {
+			return nil, fmt.Errorf("payload decoder of %q cannot be nil", contentType)
+		}
+		if opts.payloadDecoders == nil {
+			opts.payloadDecoders = make(map[string]PayloadDecoder)
+		}
+		opts.payloadDecoders[contentType] = d
+		return opts, nil
+	}
+}
+
+// WithMaxObjectSize returns an option to set the size limit of the GCS objects
+// in bytes, it defaults to [DefaultMaxObjectSize]. Larger objects are rejected with a user
+// facing error instead of being parsed.
+func WithMaxObjectSize(n int64) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if n <= 0 {
+			return nil, fmt.Errorf("max object size must be positive: %d", n)
+		}
+		opts.maxObjectSize = n
+		return opts, nil
+	}
+}
+
+// WithReadRetry returns an option to retry the transient failures of the GCS
+// object reads, such as 5xx responses and connection resets, with the backoff
+// returned by newBackoff. Backoffs are stateful, so a new one is created for
+// every object, e.g.:
+//
+//	WithReadRetry(func() retry.Backoff {
+//		return retry.WithMaxRetries(3, retry.NewExponential(100*time.Millisecond))
+//	})
+//
+// Errors such as 404 are not retried. Objects are read once by default.
+func WithReadRetry(newBackoff func() retry.Backoff) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if newBackoff == nil {
+			return nil, fmt.Errorf("read backoff cannot be nil")
+		}
+		opts.newReadBackoff = newBackoff
+		return opts, nil
+	}
+}
+
+// WithConcurrentProcessors returns an option to run up to n processors at
+// once, e.g. independent enrichment processors waiting on remote lookups. A
+// processor still starts only after the processors named in its DependsOn and
+// RunsAfter succeeded. The processors share the payload, so they must hold
+// [PayloadLock] while accessing it, and declare the processors whose changes
+// they read or overwrite, as the built-in processors do. All the processors
+// run even if one fails, and the first user facing error in processor order is
+// returned. Processors are run one at a time and stop at the first error by
+// default, or when n is 1.
+func WithConcurrentProcessors(n int) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if n <= 0 {
+			return nil, fmt.Errorf("processor concurrency must be positive: %d", n)
+		}
+		opts.processorConcurrency = n
+		return opts, nil
+	}
+}
+
+// WithReadinessCheck returns an option to add a check of the readiness of
+// the handler served at [HealthzPath], e.g. a ping of the BigQuery dataset or
+// Pub/Sub topic the events end up in. The handler is not ready when any check
+// fails. Only the object store is checked by default.
+func WithReadinessCheck(check func(context.Context) error) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if check == nil {
+			return nil, fmt.Errorf("readiness check cannot be nil")
+		}
+		opts.readinessChecks = append(opts.readinessChecks, check)
+		return opts, nil
+	}
+}
+
+// WithRateLimit returns an option to limit the rate of requests served by
+// [EventHandler.HTTPHandler] with a token bucket of the given QPS and burst.
+// Requests over the limit are rejected with 429 so Pub/Sub backs off and
+// redelivers them later. No rate limit is enforced by default.
+func WithRateLimit(qps float64, burst int) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if qps <= 0 {
+			return nil, fmt.Errorf("rate limit qps must be positive: %v", qps)
+		}
+		if burst <= 0 {
+			return nil, fmt.Errorf("rate limit burst must be positive: %d", burst)
+		}
+		opts.rateLimiter = rate.NewLimiter(rate.Limit(qps), burst)
+		return opts, nil
+	}
+}
+
 // Create a new Handler with the given processors, successMessenger, and handler options.
 // failureMessenger will default to NoopMessenger if not provided.
 //
@@ -154,28 +722,147 @@ func NewHandler[T any, P ProtoWrapper[T]](ctx context.Context, ps []Processor[P]
 			return nil, fmt.Errorf("failed to apply handler options: %w", err)
 		}
 	}
-	h.client = handlerOpt.client
+	h.store = handlerOpt.store
 	h.failureMessenger = handlerOpt.failureMessenger
+	h.indexMessenger = handlerOpt.indexMessenger
+	h.dualWriteMessenger = handlerOpt.dualWriteMessenger
+	h.handleTimeout = handlerOpt.handleTimeout
+	h.filePathFallback = handlerOpt.filePathFallback
+	h.rateLimiter = handlerOpt.rateLimiter
+	h.useProtoNames = handlerOpt.useProtoNames
+	h.objectMetadataLimit = handlerOpt.objectMetadataLimit
+	h.eventTransformer = handlerOpt.eventTransformer
+	h.withSequence = handlerOpt.withSequence
+	h.requireProvenance = handlerOpt.requireProvenance
+	h.optionalGitHubSource = handlerOpt.optionalGitHubSource
+	h.dropEmptyAnnotations = handlerOpt.dropEmptyAnnotations
+	h.clock = handlerOpt.clock
+	if h.clock == nil {
+		h.clock = time.Now
+	}
+	h.staticAttributes = handlerOpt.staticAttributes
+	h.pushVerifier = handlerOpt.pushVerifier
+	h.payloadDecoders = defaultPayloadDecoders()
+	h.maxObjectSize = handlerOpt.maxObjectSize
+	h.newReadBackoff = handlerOpt.newReadBackoff
+	h.processorConcurrency = handlerOpt.processorConcurrency
+	h.readinessChecks = handlerOpt.readinessChecks
+	h.dedupCache = handlerOpt.dedupCache
+	h.withWarnings = handlerOpt.withWarnings
+	h.metrics = handlerOpt.metrics
+	h.resourceProviders = handlerOpt.resourceProviders
+	if h.metrics == nil {
+		h.metrics = &NoopMetricsRecorder{}
+	}
+	if h.maxObjectSize == 0 {
+		h.maxObjectSize = DefaultMaxObjectSize
+	}
+	maps.Copy(h.payloadDecoders, handlerOpt.payloadDecoders)
+	h.schemaVersion = schemaVersion(P(new(T)))
+	h.payloadType = string(P(new(T)).ProtoReflect().Descriptor().FullName())
 
 	if h.successMessenger == nil {
 		return nil, fmt.Errorf("successMessenger cannot be nil")
 	}
 
-	// Default to no-op Messenger.
+	if err := validateProcessorOrder(ps); err != nil {
+		return nil, fmt.Errorf("invalid processors: %w", err)
+	}
+
+	// Default to no-op Messenger unless failure events are logged.
 	if h.failureMessenger == nil {
 		h.failureMessenger = &NoopMessenger{}
+		if handlerOpt.withFailureLogger {
+			h.failureMessenger = &logMessenger{logger: handlerOpt.failureLogger}
+		}
 	}
 
-	if h.client == nil {
-		client, err := storage.NewClient(ctx)
+	if h.store == nil {
+		client, err := storage.NewClient(ctx, handlerOpt.clientOptions...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create the GCS storage client: %w", err)
 		}
-		h.client = client
+		h.store = NewGCSObjectStore(client)
 	}
 	return h, nil
 }
 
+// cleanupFlushTimeout bounds the flush of the messengers by [EventHandler.Cleanup],
+// so a stuck publish doesn't hang the shutdown.
+const cleanupFlushTimeout = 30 * time.Second
+
+// Cleanup stops the processors which implement [StoppableProcessor], e.g. to
+// flush their caches or close their clients, flushes the messengers which
+// implement [FlushMessenger] within cleanupFlushTimeout, and returns the
+// joined errors. The handler must not be used after.
+func (h *EventHandler[T, P]) Cleanup() error {
+	var merr error
+	for _, processor := range h.processors {
+		s, ok := processor.(StoppableProcessor[P])
+		if !ok {
+			continue
+		}
+		if err := s.Stop(); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("failed to stop processor %q: %w", processorName(processor), err))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupFlushTimeout)
+	defer cancel()
+
+	// A messenger may be used for several kinds of events, flushing it again
+	// is a no-op.
+	for _, m := range []Messenger{h.successMessenger, h.failureMessenger, h.indexMessenger, h.dualWriteMessenger} {
+		f, ok := m.(FlushMessenger)
+		if !ok {
+			continue
+		}
+		if err := f.Flush(ctx); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("failed to flush messenger: %w", err))
+		}
+	}
+	return merr
+}
+
+// validateProcessorOrder checks that every processor is placed after all
+// the processors it depends on, and the configured processors it runs after.
+func validateProcessorOrder[P proto.Message](ps []Processor[P]) (retErr error) {
+	positions := make(map[string]int, len(ps))
+	for i, p := range ps {
+		positions[processorName(p)] = i
+	}
+
+	for i, p := range ps {
+		if d, ok := p.(DependentProcessor); ok {
+			for _, dep := range d.DependsOn() {
+				pos, found := positions[dep]
+				switch {
+				case !found:
+					retErr = errors.Join(retErr, fmt.Errorf("processor %q depends on missing processor %q", processorName(p), dep))
+				case pos > i:
+					retErr = errors.Join(retErr, fmt.Errorf("processor %q must be placed after its dependency %q", processorName(p), dep))
+				}
+			}
+		}
+		if o, ok := p.(OrderedProcessor); ok {
+			for _, prev := range o.RunsAfter() {
+				if pos, found := positions[prev]; found && pos > i {
+					retErr = errors.Join(retErr, fmt.Errorf("processor %q must be placed after processor %q", processorName(p), prev))
+				}
+			}
+		}
+	}
+	return retErr
+}
+
+// processorName returns the name of the processor.
+func processorName(p any) string {
+	if n, ok := p.(NamedProcessor); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", p)
+}
+
 // PubSubMessage is the payload of a [Pub/Sub message].
 //
 // GCS objects' custom metadata will be included in [Data].
@@ -186,21 +873,78 @@ type PubSubMessage struct {
 	Message struct {
 		Data       []byte            `json:"data,omitempty"`
 		Attributes map[string]string `json:"attributes"`
+		MessageID  string            `json:"messageId,omitempty"`
 	} `json:"message"`
 	Subscription string `json:"subscription"`
 }
 
+// The statuses of the handled push requests, reported in the response body
+// and in the "status" log field. The response body is "OK: processed" when
+// the object was processed, and "OK: skipped: <reason>" when the message was
+// skipped, e.g. "OK: skipped: duplicate message". The code is 201 and 200
+// respectively.
+const (
+	HandleStatusProcessed = "processed"
+	HandleStatusSkipped   = "skipped"
+)
+
 // HTTPHandler provides an [http.Handler] that accepts [GCS notifications]
 // in HTTP requests and calls [Handle] to handle the events.
 //
 // Object's metadata change will be included in payload of the notification.
+// The event schema version is negotiated with the [HeaderSchemaVersion]
+// header.
+//
+// The readiness of the handler is served at [HealthzPath], and the push
+// requests at any other path.
 //
 // [GCS notifications]: https://cloud.google.com/storage/docs/pubsub-notifications#format
 func (h *EventHandler[T, P]) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(HealthzPath, h.healthzHandler())
+	mux.Handle("/", h.pushHandler())
+	return mux
+}
+
+// pushHandler handles the Pub/Sub push requests, see [EventHandler.HTTPHandler].
+func (h *EventHandler[T, P]) pushHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := logging.FromContext(ctx).With("logger", fmt.Sprintf("%T", h))
 
+		if h.rateLimiter != nil && !h.rateLimiter.Allow() {
+			logger.WarnContext(ctx, "rate limit exceeded",
+				"code", http.StatusTooManyRequests)
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		if h.pushVerifier != nil {
+			publisher, err := verifyPush(ctx, h.pushVerifier, r)
+			if err != nil {
+				logger.WarnContext(ctx, "failed to verify the push request",
+					"error", err,
+					"code", http.StatusUnauthorized)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			ctx = withPublisher(ctx, publisher)
+		}
+
+		version, ok := negotiateSchemaVersion(r.Header.Get(HeaderSchemaVersion), h.schemaVersion)
+		if !ok {
+			logger.WarnContext(ctx, "no supported schema version is accepted",
+				"accepted", r.Header.Get(HeaderSchemaVersion),
+				"supported", h.schemaVersion,
+				"code", http.StatusNotAcceptable)
+			http.Error(w, fmt.Sprintf("unsupported schema version %q, supported: [%s]",
+				r.Header.Get(HeaderSchemaVersion), h.schemaVersion), http.StatusNotAcceptable)
+			return
+		}
+		if version != "" {
+			w.Header().Set(HeaderSchemaVersion, version)
+		}
+
 		// Handle Pub/Sub http request which is a GCS notification message.
 		body, err := io.ReadAll(io.LimitReader(r.Body, httpRequestSizeLimitInBytes))
 		if err != nil {
@@ -227,11 +971,24 @@ func (h *EventHandler[T, P]) HTTPHandler() http.Handler {
 
 		// Extract out notification information.
 		n := pubsub.Message{
+			ID:         m.Message.MessageID,
 			Data:       m.Message.Data, // Notification payload.
 			Attributes: m.Message.Attributes,
 		}
 		//nolint:sloglint
-		if err := h.Handle(ctx, n); err != nil {
+		skipReason, err := h.handle(ctx, n)
+		if err != nil {
+			if retryAfter, ok := retryAfterSeconds(err); ok {
+				logger.WarnContext(ctx, "failed to handle request, retry later",
+					"error", err,
+					"code", http.StatusTooManyRequests,
+					"retryAfter", retryAfter,
+					"bucketId", n.Attributes["bucketId"],
+					"objectId", n.Attributes["objectId"])
+				w.Header().Set("Retry-After", retryAfter)
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
 			logger.ErrorContext(ctx, "failed to handle request",
 				"error", err,
 				"code", http.StatusInternalServerError,
@@ -241,93 +998,486 @@ func (h *EventHandler[T, P]) HTTPHandler() http.Handler {
 			return
 		}
 
-		w.WriteHeader(http.StatusCreated)
-		fmt.Fprint(w, "OK")
+		status, code, respBody := HandleStatusProcessed, http.StatusCreated, "OK: "+HandleStatusProcessed
+		if skipReason != "" {
+			status, code, respBody = HandleStatusSkipped, http.StatusOK, "OK: "+HandleStatusSkipped+": "+skipReason
+		}
+		logger.InfoContext(ctx, "handled request",
+			"status", status,
+			"skipReason", skipReason,
+			"code", code,
+			"bucketId", n.Attributes["bucketId"],
+			"objectId", n.Attributes["objectId"])
+		w.WriteHeader(code)
+		fmt.Fprint(w, respBody)
 	})
 }
 
 // Handle retrieves a GCS object with the given [GCS notification],
 // processes the object with the list of processors, and passes it downstream.
+// The messages already handled are skipped with [WithDedupCache].
 //
 // [GCS notification]: https://cloud.google.com/storage/docs/pubsub-notifications#format
 func (h *EventHandler[T, P]) Handle(ctx context.Context, m pubsub.Message) error {
+	_, err := h.handle(ctx, m)
+	return err
+}
+
+// handle calls [EventHandler.HandleResult] unless the message was seen, see
+// [WithDedupCache], and returns the reason the message was skipped, or "" when
+// it was handled. The metrics of the handled messages which weren't skipped
+// are recorded.
+func (h *EventHandler[T, P]) handle(ctx context.Context, m pubsub.Message) (string, error) {
 	logger := logging.FromContext(ctx)
 
-	eventBytes, err := h.generatePmapEventBytes(ctx, m)
+	dedup := h.dedupCache != nil && m.ID != ""
+	if dedup {
+		seen, err := h.dedupCache.Seen(ctx, m.ID)
+		if err != nil {
+			logger.WarnContext(ctx, "failed to look up the message in the dedup cache",
+				"error", err,
+				"messageId", m.ID)
+		}
+		if seen {
+			logger.InfoContext(ctx, "skipping duplicate message",
+				"messageId", m.ID,
+				"bucketId", m.Attributes[AttrKeyBucketID],
+				"objectId", m.Attributes[AttrKeyObjectID])
+			return skipReasonDuplicate, nil
+		}
+	}
+
+	start := time.Now()
+	result, err := h.HandleResult(ctx, m)
+	if err == nil && result.Outcome == OutcomeSkipped {
+		return result.SkipReason, nil
+	}
+	eventType := m.Attributes[AttrKeyEventType]
+	h.metrics.ObserveLatency(eventType, time.Since(start))
+	h.metrics.IncProcessed(eventType, err == nil && result.Outcome == OutcomeSuccess)
+	if err != nil {
+		return "", err
+	}
+
+	// The message was passed downstream, failing it now would only cause the
+	// duplicate the cache is meant to prevent.
+	if dedup {
+		if err := h.dedupCache.Mark(ctx, m.ID); err != nil {
+			logger.WarnContext(ctx, "failed to mark the message in the dedup cache",
+				"error", err,
+				"messageId", m.ID)
+		}
+	}
+	return "", nil
+}
+
+// Result is the result of handling a GCS notification that was passed
+// downstream, or skipped.
+type Result struct {
+	// Outcome is either OutcomeSuccess, OutcomeFailure or OutcomeSkipped in
+	// which case nothing was sent downstream.
+	Outcome string
 
-	attr := map[string]string{}
+	// SkipReason is the reason the notification was skipped, e.g. `resource
+	// provider "aws" is not handled`, it's only set with OutcomeSkipped.
+	SkipReason string
+
+	// Event is the pmap event sent downstream. It's nil when the object
+	// failed before an event could be generated, e.g. invalid object yaml.
+	Event *v1alpha1.PmapEvent
+
+	// Attributes are the attributes sent along with the event.
+	Attributes map[string]string
+}
+
+// HandleResult is the same as [EventHandler.Handle] and additionally returns
+// the result passed downstream. A user facing error is reported as a Result
+// with OutcomeFailure and a nil error, the Result is nil for any other error.
+func (h *EventHandler[T, P]) HandleResult(ctx context.Context, m pubsub.Message) (*Result, error) {
+	logger := logging.FromContext(ctx)
+
+	if h.handleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.handleTimeout)
+		defer cancel()
+	}
+
+	var warnings *warningCollector
+	if h.withWarnings {
+		ctx, warnings = withWarningCollector(ctx)
+	}
+
+	event, eventBytes, err := h.generatePmapEventBytes(ctx, m)
+
+	var skipErr *skipError
+	if errors.As(err, &skipErr) {
+		logger.InfoContext(ctx, "skipping object",
+			"reason", skipErr.reason,
+			"bucketId", m.Attributes[AttrKeyBucketID],
+			"objectId", m.Attributes[AttrKeyObjectID])
+		return &Result{Outcome: OutcomeSkipped, SkipReason: skipErr.reason}, nil
+	}
+
+	// Processors may report the timeout as a user facing error, return a
+	// retryable error instead of sending a failure event.
+	if h.handleTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		if err != nil {
+			return nil, fmt.Errorf("handle timed out after %s: %w: %v", h.handleTimeout, ctx.Err(), err) //nolint:errorlint // Don't wrap the user facing error.
+		}
+		return nil, fmt.Errorf("handle timed out after %s: %w", h.handleTimeout, ctx.Err())
+	}
+
+	attr := h.newAttributes()
+	if h.schemaVersion != "" {
+		attr[AttrKeySchemaVersion] = h.schemaVersion
+	}
+	for _, k := range []string{AttrKeyBucketID, AttrKeyObjectID, AttrKeyObjectGeneration} {
+		if v, ok := m.Attributes[k]; ok {
+			attr[k] = v
+		}
+	}
+	deleted := isObjectDelete(m)
+	if deleted {
+		attr[AttrKeyDeleted] = "true"
+	}
+	if publisher := publisherFromContext(ctx); publisher != "" {
+		attr[AttrKeyPublisher] = publisher
+	}
+	if h.objectMetadataLimit > 0 {
+		if metadata, ok, err := notificationMetadata(m); err == nil && ok && len(metadata) > 0 {
+			keys := slices.Sorted(maps.Keys(metadata))
+			if err := setJSONAttribute(attr, AttrKeyObjectMetadata, AttrKeyObjectMetadataTruncated, keys,
+				func(kept []string) any {
+					m := make(map[string]string, len(kept))
+					for _, k := range kept {
+						m[k] = metadata[k]
+					}
+					return m
+				}, h.objectMetadataLimit); err != nil {
+				return nil, fmt.Errorf("failed to encode object metadata: %w", err)
+			}
+		}
+	}
+
+	// Events of unparsable objects have no payload.
+	if event.GetPayload() != nil {
+		key, err := eventResourceKey(event)
+		if err != nil {
+			return nil, err
+		}
+		if key != "" {
+			attr[AttrKeyResourceKey] = key
+		}
+	}
+
+	if h.withSequence && (err == nil || pmaperrors.Is(err)) {
+		attr[AttrKeySequence] = strconv.FormatUint(h.sequence.Add(1), 10)
+	}
 
 	if err != nil {
 		// We only write the failure event if it's an user facing error.
 		if !pmaperrors.Is(err) {
-			return err
+			return nil, err
 		}
-		attr[AttrKeyProcessErr] = err.Error()
+		// The error is logged in full, the attribute is cut to the Pub/Sub
+		// limit so a long error doesn't prevent the failure event.
+		attr[AttrKeyProcessErr] = truncateUTF8(err.Error(), MaxTopicAttrValueBytes)
+		attr[AttrKeyOutcome] = OutcomeFailure
 		//nolint:sloglint
 		logger.ErrorContext(ctx, "failed to handle event",
 			"error", err.Error(),
 			"bucketId", m.Attributes["bucketId"],
-			"objectId", m.Attributes["objectId"])
+			"objectId", m.Attributes["objectId"],
+			"objectGeneration", m.Attributes[AttrKeyObjectGeneration])
 		if err := h.failureMessenger.Send(ctx, eventBytes, attr); err != nil {
-			return fmt.Errorf("failed to send failure event downstream: %w", err)
+			return nil, fmt.Errorf("failed to send failure event downstream: %w", err)
 		}
-		return nil
+		return &Result{Outcome: OutcomeFailure, Event: event, Attributes: attr}, nil
+	}
+	attr[AttrKeyOutcome] = OutcomeSuccess
+	if ws := warnings.list(); len(ws) > 0 {
+		if err := setJSONAttribute(attr, AttrKeyWarnings, AttrKeyWarningsTruncated, ws,
+			func(kept []string) any { return kept }, MaxTopicAttrValueBytes); err != nil {
+			return nil, fmt.Errorf("failed to encode warnings: %w", err)
+		}
+		logger.WarnContext(ctx, "processors added warnings",
+			"warnings", ws,
+			"bucketId", m.Attributes[AttrKeyBucketID],
+			"objectId", m.Attributes[AttrKeyObjectID])
 	}
 	if err := h.successMessenger.Send(ctx, eventBytes, attr); err != nil {
-		return fmt.Errorf("failed to send succuss event downstream: %w", err)
+		return nil, fmt.Errorf("failed to send succuss event downstream: %w", err)
 	}
-	return nil
+
+	if h.dualWriteMessenger != nil {
+		dualBytes, err := marshalEvent(event, !h.useProtoNames)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal dual write event to byte: %w", err)
+		}
+		// Messengers may keep the attributes, don't share them.
+		if err := h.dualWriteMessenger.Send(ctx, dualBytes, maps.Clone(attr)); err != nil {
+			return nil, fmt.Errorf("failed to send dual write event downstream: %w", err)
+		}
+	}
+
+	// Index events are optional, tombstones have no payload to index.
+	if h.indexMessenger != nil && !deleted {
+		indexBytes, err := newIndexEventBytes(event, m.Attributes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate index event: %w", err)
+		}
+		if err := h.indexMessenger.Send(ctx, indexBytes, h.newAttributes()); err != nil {
+			return nil, fmt.Errorf("failed to send index event downstream: %w", err)
+		}
+	}
+	return &Result{Outcome: OutcomeSuccess, Event: event, Attributes: attr}, nil
+}
+
+// skipError is returned when generating the event of a notification which is
+// acked without sending any event.
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return "skipped: " + e.reason
 }
 
-func (h *EventHandler[T, P]) generatePmapEventBytes(ctx context.Context, m pubsub.Message) ([]byte, error) {
+// newAttributes returns the attributes of a new event, which are a copy of the
+// static attributes.
+func (h *EventHandler[T, P]) newAttributes() map[string]string {
+	attr := make(map[string]string, len(h.staticAttributes))
+	maps.Copy(attr, h.staticAttributes)
+	return attr
+}
+
+func (h *EventHandler[T, P]) generatePmapEventBytes(ctx context.Context, m pubsub.Message) (*v1alpha1.PmapEvent, []byte, error) {
+	// The object of a delete notification is gone, reading it would fail
+	// until the notification is dropped. An overwritten object isn't gone,
+	// the finalize notification of the new object replaces its event.
+	if isObjectDelete(m) {
+		if generation := m.Attributes[AttrKeyOverwrittenByGeneration]; generation != "" {
+			return nil, nil, &skipError{reason: fmt.Sprintf("object overwritten by generation %s", generation)}
+		}
+		return h.tombstoneEvent(ctx, m)
+	}
+
 	// Get the GCS object as a proto message given GCS notification information.
 	b, err := h.getGCSObjectBytes(ctx, m.Attributes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get GCS object: %w", err)
+		return nil, nil, fmt.Errorf("failed to get GCS object: %w", err)
+	}
+
+	metadata, hasMetadata, err := notificationMetadata(m)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	if err := h.checkMetadata(ctx, m, hasMetadata); err != nil {
+		return nil, nil, err
+	}
+	// Make the object metadata available to processors.
+	ctx = WithObjectMetadata(ctx, metadata)
+	if t, ok := notificationUpdateTime(m); ok {
+		ctx = WithObjectUpdateTime(ctx, t)
+	}
+
+	// Oversized objects are truncated by the reader, don't parse them.
+	if int64(len(b)) > h.maxObjectSize {
+		return h.parseFailureEvent(ctx, m, metadata, hasMetadata,
+			pmaperrors.New("object exceeds max size %d", h.maxObjectSize))
 	}
 
 	// Convert the object bytes into a proto message wrapper.
 	// This is a user facing error as the object bytes are from
-	// yaml files that user uploaded.
+	// files that user uploaded.
 	p := P(new(T))
-	if err := protoutil.FromYAML(b, p); err != nil {
-		return nil, pmaperrors.New("failed to unmarshal object yaml: %v", err)
+	contentType := payloadContentType(m, h.payloadDecoders)
+	if err := h.payloadDecoders[contentType](b, p); err != nil {
+		return h.parseFailureEvent(ctx, m, metadata, hasMetadata,
+			pmaperrors.New("failed to unmarshal object %s: %v", contentTypeName(contentType), err))
+	}
+	if err := checkResourceProvider(h.resourceProviders, p); err != nil {
+		return nil, nil, err
 	}
 
 	var processErr error
+	if err := h.runProcessors(ctx, p); err != nil {
+		processErr = fmt.Errorf("failed to process object: %w", err)
+	}
 
-	for _, processor := range h.processors {
-		if err := processor.Process(ctx, p); err != nil {
-			processErr = fmt.Errorf("failed to process object: %w", err)
-			break
+	if h.dropEmptyAnnotations {
+		if a, ok := any(p).(annotationsGetter); ok {
+			dropEmptyValues(a.GetAnnotations())
 		}
 	}
 
-	payload, err := anypb.New(p)
-	if err != nil {
-		return nil, errors.Join(processErr, fmt.Errorf("failed to convert object to pmap event payload: %w", err))
+	payload := &anypb.Any{}
+	if err := anypb.MarshalFrom(payload, p, proto.MarshalOptions{Deterministic: true}); err != nil {
+		return nil, nil, errors.Join(processErr, fmt.Errorf("failed to convert object to pmap event payload: %w", err))
 	}
 
 	var gr *v1alpha1.GitHubSource
-	if m.Attributes["payloadFormat"] == "JSON_API_V1" {
-		gr, err = parseGitHubSource(ctx, m.Data, m.Attributes)
+	if hasMetadata {
+		gr, err = ParseGitHubSource(ctx, metadata, m.Attributes, h.filePathFallback)
 		if err != nil {
 			// Join with the processErr. We don't want to lose the user facing error if it's not nil.
-			return nil, errors.Join(processErr, fmt.Errorf("failed to parse metadata: %w", err))
+			return nil, nil, errors.Join(processErr, fmt.Errorf("failed to parse metadata: %w", err))
 		}
 	}
 
 	event := &v1alpha1.PmapEvent{
 		Payload:      payload,
+		Type:         h.payloadType,
+		Timestamp:    timestamppb.New(h.clock()),
 		GithubSource: gr,
 	}
 
-	eventBytes, err := protojson.Marshal(event)
+	if h.eventTransformer != nil {
+		if err := h.eventTransformer(event); err != nil {
+			// Join with the processErr. We don't want to lose the user facing error if it's not nil.
+			return nil, nil, errors.Join(processErr, fmt.Errorf("failed to transform event: %w", err))
+		}
+	}
+
+	eventBytes, err := marshalEvent(event, h.useProtoNames)
 	if err != nil {
 		// Join with the processErr. We don't want to lose the user facing error if it's not nil.
-		return nil, errors.Join(processErr, fmt.Errorf("failed to marshal event to byte: %w", err))
+		return nil, nil, errors.Join(processErr, fmt.Errorf("failed to marshal event to byte: %w", err))
+	}
+	return event, eventBytes, processErr
+}
+
+// parseFailureEvent returns the event of an object that can't be parsed along
+// with the parse error. The parse error is permanent, so the event goes to the
+// failure messenger instead of being redelivered. It has no payload but keeps
+// the type and timestamp, and the GitHub provenance when the notification has the
+// object metadata, so the uploader of the malformed object can be located.
+func (h *EventHandler[T, P]) parseFailureEvent(ctx context.Context, m pubsub.Message, metadata map[string]string,
+	hasMetadata bool, parseErr error,
+) (*v1alpha1.PmapEvent, []byte, error) {
+	event := &v1alpha1.PmapEvent{
+		Type:      h.payloadType,
+		Timestamp: timestamppb.New(h.clock()),
+	}
+	if hasMetadata {
+		gr, err := ParseGitHubSource(ctx, metadata, m.Attributes, h.filePathFallback)
+		if err != nil {
+			// Join with the parseErr. We don't want to lose the user facing error.
+			return nil, nil, errors.Join(parseErr, fmt.Errorf("failed to parse metadata: %w", err))
+		}
+		event.GithubSource = gr
+	}
+	eventBytes, err := marshalEvent(event, h.useProtoNames)
+	if err != nil {
+		return nil, nil, errors.Join(parseErr, fmt.Errorf("failed to marshal event to byte: %w", err))
+	}
+	return event, eventBytes, parseErr
+}
+
+// isObjectDelete returns whether the notification is about a deleted object.
+func isObjectDelete(m pubsub.Message) bool {
+	return m.Attributes[AttrKeyEventType] == EventTypeObjectDelete
+}
+
+// tombstoneEvent returns the event of a deleted object, which has no payload
+// but keeps the type and timestamp, and the GitHub provenance of the deleted
+// object when the notification has its metadata. The object isn't read.
+func (h *EventHandler[T, P]) tombstoneEvent(ctx context.Context, m pubsub.Message) (*v1alpha1.PmapEvent, []byte, error) {
+	logging.FromContext(ctx).InfoContext(ctx, "object deleted, emitting tombstone event",
+		"bucketId", m.Attributes[AttrKeyBucketID],
+		"objectId", m.Attributes[AttrKeyObjectID])
+
+	event := &v1alpha1.PmapEvent{
+		Type:      h.payloadType,
+		Timestamp: timestamppb.New(h.clock()),
+	}
+	metadata, hasMetadata, err := notificationMetadata(m)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	if err := h.checkMetadata(ctx, m, hasMetadata); err != nil {
+		return nil, nil, err
+	}
+	if hasMetadata {
+		gr, err := ParseGitHubSource(ctx, metadata, m.Attributes, h.filePathFallback)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse metadata: %w", err)
+		}
+		event.GithubSource = gr
+	}
+	if h.eventTransformer != nil {
+		if err := h.eventTransformer(event); err != nil {
+			return nil, nil, fmt.Errorf("failed to transform event: %w", err)
+		}
+	}
+	eventBytes, err := marshalEvent(event, h.useProtoNames)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal event to byte: %w", err)
+	}
+	return event, eventBytes, nil
+}
+
+// schemaVersion returns the contract version of the message, which is the
+// last element of its Go package, e.g. "v1alpha1" for
+// "github.com/abcxyz/pmap/apis/v1alpha1". It returns an empty string for
+// unversioned messages such as structpb.Struct.
+func schemaVersion(m proto.Message) string {
+	opts, ok := m.ProtoReflect().Descriptor().ParentFile().Options().(*descriptorpb.FileOptions)
+	if !ok {
+		return ""
+	}
+	v := path.Base(opts.GetGoPackage())
+	if !schemaVersionRegexp.MatchString(v) {
+		return ""
 	}
-	return eventBytes, processErr
+	return v
+}
+
+// marshalEvent returns the JSON encoding of the event. The same logical event
+// always yields identical bytes, which allows content based deduplication.
+// Map entries such as annotations are sorted by protojson, and the output is
+// compacted since protojson may randomly add whitespaces. The proto field
+// names are used instead of the JSON names if useProtoNames is set.
+func marshalEvent(event *v1alpha1.PmapEvent, useProtoNames bool) ([]byte, error) {
+	b, err := protojson.MarshalOptions{UseProtoNames: useProtoNames}.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return nil, fmt.Errorf("failed to compact event json: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// setJSONAttribute sets the key attribute to the JSON encoding, within limit
+// bytes, of the value build returns for the kept entries. Entries are kept in
+// order and the ones that don't fit are dropped, in which case the
+// truncatedKey attribute is set to "true".
+func setJSONAttribute[E any](attr map[string]string, key, truncatedKey string, entries []E, build func(kept []E) any, limit int) error {
+	kept := make([]E, 0, len(entries))
+	encoded, err := json.Marshal(build(kept))
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+	var truncated bool
+	for _, e := range entries {
+		b, err := json.Marshal(build(append(kept, e)))
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", key, err)
+		}
+		if len(b) > limit {
+			truncated = true
+			continue
+		}
+		kept = append(kept, e)
+		encoded = b
+	}
+	attr[key] = string(encoded)
+	if truncated {
+		attr[truncatedKey] = "true"
+	}
+	return nil
 }
 
 // getGCSObjectBytes calls the GCS storage client with objAttrs information, and returns the object as []byte.
@@ -342,30 +1492,114 @@ func (h *EventHandler[T, P]) getGCSObjectBytes(ctx context.Context, objAttrs map
 		return nil, fmt.Errorf("object ID not found")
 	}
 
-	// Read the object from bucket.
-	rc, err := h.client.Bucket(bucketID).Object(objectID).NewReader(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create GCS object reader: %w", err)
+	// Read the object from bucket, it's read once without a read backoff.
+	read := func(ctx context.Context) ([]byte, error) {
+		rc, err := h.store.NewObjectReader(ctx, bucketID, objectID)
+		if err != nil {
+			return nil, err //nolint:wrapcheck // Wrapped by the store.
+		}
+		defer rc.Close()
+		// Read one byte over the limit to tell oversized objects apart.
+		b, err := io.ReadAll(io.LimitReader(rc, h.maxObjectSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object from GCS: %w", err)
+		}
+		return b, nil
 	}
-	defer rc.Close()
-	b, err := io.ReadAll(io.LimitReader(rc, gcsObjectSizeLimitInBytes))
-	if err != nil {
-		return nil, fmt.Errorf("failed to read object from GCS: %w", err)
+	if h.newReadBackoff == nil {
+		return read(ctx)
 	}
-	return b, nil
+	//nolint:wrapcheck // Errors of read are wrapped.
+	return retry.DoValue(ctx, h.newReadBackoff(), func(ctx context.Context) ([]byte, error) {
+		b, err := read(ctx)
+		// Only the transient errors such as 5xx and connection resets are
+		// retried, not 404.
+		if err != nil && storage.ShouldRetry(err) {
+			return nil, retry.RetryableError(err)
+		}
+		return b, err
+	})
 }
 
 type notificationPayload struct {
-	Metadata map[string]string `json:"metadata,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	ContentType string            `json:"contentType,omitempty"`
+	Updated     string            `json:"updated,omitempty"`
 }
 
-func parseGitHubSource(ctx context.Context, data []byte, objAttrs map[string]string) (*v1alpha1.GitHubSource, error) {
-	logger := logging.FromContext(ctx)
+// notificationMetadata returns the object custom metadata carried by the
+// notification, either in the JSON_API_V1 payload or as CloudEvents extension
+// attributes. ok is false for notification formats without metadata.
+func notificationMetadata(m pubsub.Message) (metadata map[string]string, ok bool, retErr error) {
+	switch {
+	case m.Attributes["payloadFormat"] == "JSON_API_V1":
+		pm, err := parseNotificationPayload(m.Data)
+		if err != nil {
+			return nil, false, err
+		}
+		return pm.Metadata, true, nil
+	case m.Attributes[AttrKeyCloudEventsSpecVersion] != "":
+		metadata = map[string]string{}
+		for _, k := range cloudEventsMetadataKeys {
+			if v, ok := m.Attributes[CloudEventsAttrKey(k)]; ok {
+				metadata[k] = v
+			}
+		}
+		return metadata, true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// checkMetadata returns a user facing error when the notification has no
+// object metadata to parse the GitHub provenance from, unless the provenance
+// is optional.
+func (h *EventHandler[T, P]) checkMetadata(ctx context.Context, m pubsub.Message, hasMetadata bool) error {
+	if hasMetadata {
+		return nil
+	}
+	payloadFormat := m.Attributes["payloadFormat"]
+	if h.requireProvenance {
+		return pmaperrors.New("notification with payloadFormat %q has no object metadata, GitHub provenance is required",
+			payloadFormat)
+	}
+	if !h.optionalGitHubSource {
+		return pmaperrors.New("unsupported payloadFormat %q", payloadFormat)
+	}
+	logging.FromContext(ctx).InfoContext(ctx, "notification has no object metadata, emitting event without GitHub provenance",
+		"payloadFormat", payloadFormat)
+	return nil
+}
+
+// repoOwner returns the owner of the "owner/repo" repository name, or empty
+// when it has no owner.
+func repoOwner(repoName string) string {
+	owner, repo, found := strings.Cut(repoName, "/")
+	if !found || repo == "" {
+		return ""
+	}
+	return owner
+}
 
-	var pm *notificationPayload
+// parseNotificationPayload parses the object resource representation included
+// in the notification data.
+func parseNotificationPayload(data []byte) (*notificationPayload, error) {
+	var pm notificationPayload
 	if err := json.Unmarshal(data, &pm); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal payloadMetadata %w", err)
 	}
+	return &pm, nil
+}
+
+// ParseGitHubSource parses the GitHub provenance from the GCS object custom
+// metadata set by the reusable workflow. Missing metadata keys are logged and
+// left empty. The objAttrs are the Pub/Sub notification attributes, where the
+// "objectId" is used to get the file path, the filePathFallback is used when
+// it lacks the [GCSPathSeparatorKey] and can be nil.
+func ParseGitHubSource(ctx context.Context, metadata, objAttrs map[string]string, filePathFallback FilePathFunc) (*v1alpha1.GitHubSource, error) {
+	logger := logging.FromContext(ctx)
+
+	pm := &notificationPayload{Metadata: metadata}
 
 	var r v1alpha1.GitHubSource
 
@@ -387,6 +1621,7 @@ func parseGitHubSource(ctx context.Context, data []byte, objAttrs map[string]str
 			"key", MetadataKeyGitHubRepo)
 	} else {
 		r.RepoName = rn
+		r.RepoOwner = repoOwner(rn)
 	}
 
 	// Set github-workflow.
@@ -422,9 +1657,20 @@ func parseGitHubSource(ctx context.Context, data []byte, objAttrs map[string]str
 	}
 
 	if objectID, found := objAttrs["objectId"]; found {
-		parts := strings.Split(objectID, "/gh-prefix/")
-		if len(parts) == 2 {
+		parts := strings.Split(objectID, GCSPathSeparatorKey)
+		switch {
+		case len(parts) == 2:
 			r.FilePath = parts[1]
+		case filePathFallback != nil:
+			r.FilePath = filePathFallback(objectID)
+			logger.DebugContext(ctx, "object path separator not found, using fallback file path",
+				"objectId", objectID,
+				"separator", GCSPathSeparatorKey,
+				"filePath", r.FilePath)
+		default:
+			logger.DebugContext(ctx, "object path separator not found, leaving file path empty",
+				"objectId", objectID,
+				"separator", GCSPathSeparatorKey)
 		}
 	}
 
@@ -444,3 +1690,21 @@ type NoopMessenger struct{}
 func (m *NoopMessenger) Send(_ context.Context, _ []byte, _ map[string]string) error {
 	return nil
 }
+
+// logMessenger is a Messenger which logs the events at error level, see
+// [WithFailureLogger].
+type logMessenger struct {
+	// logger is the logger of the request context when nil.
+	logger *slog.Logger
+}
+
+func (m *logMessenger) Send(ctx context.Context, data []byte, attr map[string]string) error {
+	logger := m.logger
+	if logger == nil {
+		logger = logging.FromContext(ctx)
+	}
+	logger.ErrorContext(ctx, "failure event",
+		"event", string(data),
+		"attributes", attr)
+	return nil
+}
@@ -19,20 +19,29 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/storage"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/sethvargo/go-retry"
 	"google.golang.org/api/option"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
@@ -79,7 +88,7 @@ func TestEventHandler_NewHandler(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			_, gotErr := NewHandler(ctx, []Processor[*structpb.Struct]{}, tc.successMessenger, WithStorageClient(c))
+			_, gotErr := NewHandler(ctx, []Processor[*structpb.Struct]{}, tc.successMessenger, WithOptionalGitHubSource(), WithStorageClient(c))
 
 			if diff := testutil.DiffErrString(gotErr, tc.wantErr); diff != "" {
 				t.Errorf("Process(%+v) got unexpected error substring: %v", tc.name, diff)
@@ -88,6 +97,80 @@ func TestEventHandler_NewHandler(t *testing.T) {
 	}
 }
 
+func TestEventHandler_NewHandlerProcessorOrder(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	hc := newTestServer(t, testHandleObjectRead(t, []byte("test")))
+	c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+	if err != nil {
+		t.Fatalf("failed to creat GCS storage client %v", err)
+	}
+
+	cases := []struct {
+		name       string
+		processors []Processor[*structpb.Struct]
+		wantErr    string
+	}{
+		{
+			name: "success",
+			processors: []Processor[*structpb.Struct]{
+				&testDependentProcessor{name: "enrich"},
+				&testDependentProcessor{name: "policy", deps: []string{"enrich"}},
+				&testProcessor{},
+			},
+		},
+		{
+			name: "success_depends_on_type_name",
+			processors: []Processor[*structpb.Struct]{
+				&testProcessor{},
+				&testDependentProcessor{name: "policy", deps: []string{"*server.testProcessor"}},
+			},
+		},
+		{
+			name: "misordered",
+			processors: []Processor[*structpb.Struct]{
+				&testDependentProcessor{name: "policy", deps: []string{"enrich"}},
+				&testDependentProcessor{name: "enrich"},
+			},
+			wantErr: `processor "policy" must be placed after its dependency "enrich"`,
+		},
+		{
+			name: "missing_dependency",
+			processors: []Processor[*structpb.Struct]{
+				&testDependentProcessor{name: "policy", deps: []string{"enrich"}},
+			},
+			wantErr: `processor "policy" depends on missing processor "enrich"`,
+		},
+		{
+			name: "runs_after_missing_processor",
+			processors: []Processor[*structpb.Struct]{
+				&testDependentProcessor{name: "enrich", after: []string{"validate"}},
+			},
+		},
+		{
+			name: "misordered_runs_after",
+			processors: []Processor[*structpb.Struct]{
+				&testDependentProcessor{name: "enrich", after: []string{"validate"}},
+				&testDependentProcessor{name: "validate"},
+			},
+			wantErr: `processor "enrich" must be placed after processor "validate"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, gotErr := NewHandler(ctx, tc.processors, &NoopMessenger{}, WithOptionalGitHubSource(), WithStorageClient(c))
+			if diff := testutil.DiffErrString(gotErr, tc.wantErr); diff != "" {
+				t.Errorf("Process(%+v) got unexpected error substring: %v", tc.name, diff)
+			}
+		})
+	}
+}
+
 func TestEventHandler_HttpHandler(t *testing.T) {
 	t.Parallel()
 
@@ -106,6 +189,7 @@ func TestEventHandler_HttpHandler(t *testing.T) {
 				Message: struct {
 					Data       []byte            `json:"data,omitempty"`
 					Attributes map[string]string `json:"attributes"`
+					MessageID  string            `json:"messageId,omitempty"`
 				}{
 					Attributes: map[string]string{
 						"bucketId":      "foo",
@@ -143,6 +227,7 @@ isOK: true`),
 				Message: struct {
 					Data       []byte            `json:"data,omitempty"`
 					Attributes map[string]string `json:"attributes"`
+					MessageID  string            `json:"messageId,omitempty"`
 				}{
 					Attributes: map[string]string{
 						"bucketId":      "foo",
@@ -171,6 +256,7 @@ isOK: true`),
 				Message: struct {
 					Data       []byte            `json:"data,omitempty"`
 					Attributes map[string]string `json:"attributes"`
+					MessageID  string            `json:"messageId,omitempty"`
 				}{
 					Attributes: map[string]string{
 						"bucketId":      "foo",
@@ -194,6 +280,7 @@ isOK: true`),
 				Message: struct {
 					Data       []byte            `json:"data,omitempty"`
 					Attributes map[string]string `json:"attributes"`
+					MessageID  string            `json:"messageId,omitempty"`
 				}{
 					Attributes: map[string]string{
 						"bucketId":      "foo",
@@ -229,7 +316,7 @@ isOK: true`),
 				t.Fatalf("failed to creat GCS storage client %v", err)
 			}
 
-			h, err := NewHandler(ctx, []Processor[*structpb.Struct]{&testProcessor{}}, &NoopMessenger{}, WithStorageClient(c))
+			h, err := NewHandler(ctx, []Processor[*structpb.Struct]{&testProcessor{}}, &NoopMessenger{}, WithOptionalGitHubSource(), WithStorageClient(c))
 			if err != nil {
 				t.Fatalf("failed to create event handler %v", err)
 			}
@@ -248,235 +335,273 @@ isOK: true`),
 	}
 }
 
-func TestEventHandler_Handle(t *testing.T) {
+func TestEventHandler_HttpHandlerRateLimit(t *testing.T) {
 	t.Parallel()
 
+	ctx := context.Background()
+
+	body := testToJSON(t, &PubSubMessage{
+		Message: struct {
+			Data       []byte            `json:"data,omitempty"`
+			Attributes map[string]string `json:"attributes"`
+			MessageID  string            `json:"messageId,omitempty"`
+		}{
+			Attributes: map[string]string{
+				"bucketId": "foo",
+				"objectId": "pmap-test/gh-prefix/dir1/dir2/bar",
+			},
+		},
+	})
+
 	cases := []struct {
-		name                 string
-		notification         *pubsub.Message
-		gcsObjectBytes       []byte
-		githubSourceBytes    []byte
-		processors           []Processor[*structpb.Struct]
-		successMessenger     *testMessenger
-		failureMessenger     *testMessenger
-		wantErrSubstr        string
-		wantPmapEvent        *v1alpha1.PmapEvent
-		wantFailuerPmapEvent *v1alpha1.PmapEvent
-		wantAttr             map[string]string
+		name            string
+		opts            []Option
+		wantStatusCodes []int
 	}{
 		{
-			name: "success",
-			notification: &pubsub.Message{
-				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
-				Data:       testGCSMetadataBytes(),
-			},
-			gcsObjectBytes: []byte(
-				`
+			name:            "no_rate_limit",
+			wantStatusCodes: []int{http.StatusCreated, http.StatusCreated, http.StatusCreated},
+		},
+		{
+			name:            "within_limit",
+			opts:            []Option{WithRateLimit(0.001, 3)},
+			wantStatusCodes: []int{http.StatusCreated, http.StatusCreated, http.StatusCreated},
+		},
+		{
+			name:            "exceeds_limit",
+			opts:            []Option{WithRateLimit(0.001, 1)},
+			wantStatusCodes: []int{http.StatusCreated, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			hc := newTestServer(t, testHandleObjectRead(t, []byte(`foo: bar`)))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+
+			h, err := NewHandler(ctx, []Processor[*structpb.Struct]{&testProcessor{}}, &NoopMessenger{},
+				append([]Option{WithStorageClient(c)}, tc.opts...)...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			gotStatusCodes := make([]int, 0, len(tc.wantStatusCodes))
+			for range tc.wantStatusCodes {
+				req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body))
+				resp := httptest.NewRecorder()
+				h.HTTPHandler().ServeHTTP(resp, req)
+				gotStatusCodes = append(gotStatusCodes, resp.Code)
+			}
+			if diff := cmp.Diff(tc.wantStatusCodes, gotStatusCodes); diff != "" {
+				t.Errorf("HTTPHandler(%+v) got status codes diff (-want, +got): %v", tc.name, diff)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HttpHandlerRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	mappingYAML := []byte(`
 resource:
   name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
   provider: gcp
-annotations:
-  labels:
-    env: dev
-contacts:
-  email:
-  - test.gmail.com
-`),
-			processors: []Processor[*structpb.Struct]{&testProcessor{}},
-			successMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-			},
-			wantPmapEvent: &v1alpha1.PmapEvent{
-				GithubSource: &v1alpha1.GitHubSource{
-					RepoName:                   "test-github-repo",
-					Commit:                     "test-github-commit",
-					Workflow:                   "test-workflow",
-					WorkflowSha:                "test-workflow-sha",
-					WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
-					WorkflowRunId:              "5050509831",
-					WorkflowRunAttempt:         1,
-					FilePath:                   "dir1/dir2/bar",
-				},
-			},
+`)
+
+	cases := []struct {
+		name           string
+		processErr     error
+		wantStatusCode int
+		wantRetryAfter string
+	}{
+		{
+			name:           "retry_after_rounded_up",
+			processErr:     &RetryAfterError{Err: fmt.Errorf("quota exceeded"), RetryAfter: 1500 * time.Millisecond},
+			wantStatusCode: http.StatusTooManyRequests,
+			wantRetryAfter: "2",
 		},
 		{
-			name: "failed_send_downstream",
-			notification: &pubsub.Message{
-				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
-				Data:       testGCSMetadataBytes(),
-			},
-			gcsObjectBytes: []byte(`foo: bar
-isOK: true`),
-			processors: []Processor[*structpb.Struct]{&testProcessor{}},
-			successMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-				returnErr:    fmt.Errorf("always fail"),
-			},
-			wantErrSubstr: "failed to send succuss event downstream",
-			wantPmapEvent: &v1alpha1.PmapEvent{
-				GithubSource: &v1alpha1.GitHubSource{
-					RepoName:                   "test-github-repo",
-					Commit:                     "test-github-commit",
-					Workflow:                   "test-workflow",
-					WorkflowSha:                "test-workflow-sha",
-					WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
-					WorkflowRunId:              "5050509831",
-					WorkflowRunAttempt:         1,
-					FilePath:                   "dir1/dir2/bar",
-				},
-			},
+			name:           "wrapped_retry_after",
+			processErr:     fmt.Errorf("failed to search: %w", &RetryAfterError{Err: fmt.Errorf("quota exceeded"), RetryAfter: 30 * time.Second}),
+			wantStatusCode: http.StatusTooManyRequests,
+			wantRetryAfter: "30",
 		},
 		{
-			name: "missing_bucket_id",
-			notification: &pubsub.Message{
-				Attributes: map[string]string{"objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
-				Data:       testGCSMetadataBytes(),
-			},
-			successMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-			},
-			wantErrSubstr: "bucket ID not found",
-			wantPmapEvent: &v1alpha1.PmapEvent{},
+			name:           "zero_retry_after",
+			processErr:     &RetryAfterError{Err: fmt.Errorf("quota exceeded")},
+			wantStatusCode: http.StatusTooManyRequests,
+			wantRetryAfter: "1",
 		},
 		{
-			name: "failed_parsing_timestamp",
-			notification: &pubsub.Message{
-				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
-				Data: []byte(`{
-									"metadata": {
-									  "github-commit": "test-github-commit",
-									  "github-workflow-triggered-timestamp": "2023",
-									  "github-workflow-sha": "test-workflow-sha",
-									  "github-workflow": "test-workflow",
-									  "github-repo": "test-github-repo",
-									  "github-run-id": "5050509831",
-									  "github-run-attempt": "1"
-									}
-								  }`),
-			},
-			successMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-			},
-			wantErrSubstr: "failed to parse date",
-			wantPmapEvent: &v1alpha1.PmapEvent{},
+			name:           "other_error",
+			processErr:     fmt.Errorf("quota exceeded"),
+			wantStatusCode: http.StatusInternalServerError,
 		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{tc.processErr}},
+				&testRawMessenger{}, WithOptionalGitHubSource(), WithStorageClient(c))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			body := testToJSON(t, &PubSubMessage{
+				Message: struct {
+					Data       []byte            `json:"data,omitempty"`
+					Attributes map[string]string `json:"attributes"`
+					MessageID  string            `json:"messageId,omitempty"`
+				}{
+					Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+				},
+			})
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body))
+			resp := httptest.NewRecorder()
+			h.HTTPHandler().ServeHTTP(resp, req)
+
+			if resp.Code != tc.wantStatusCode {
+				t.Errorf("StatusCode got %d, want %d", resp.Code, tc.wantStatusCode)
+			}
+			if got := resp.Header().Get("Retry-After"); got != tc.wantRetryAfter {
+				t.Errorf("Retry-After got %q, want %q", got, tc.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HttpHandlerPushVerifier(t *testing.T) {
+	t.Parallel()
+
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+`)
+	const publisher = "pmap-push@test-project.iam.gserviceaccount.com"
+
+	cases := []struct {
+		name           string
+		authorization  string
+		wantStatusCode int
+		wantPublisher  string
+	}{
 		{
-			name: "missing_object_id",
-			notification: &pubsub.Message{
-				Attributes: map[string]string{"bucketId": "foo"},
-				Data:       testGCSMetadataBytes(),
-			},
-			successMessenger: &testMessenger{},
-			wantErrSubstr:    "object ID not found",
+			name:           "verified",
+			authorization:  "Bearer valid-token",
+			wantStatusCode: http.StatusCreated,
+			wantPublisher:  publisher,
 		},
 		{
-			name: "bucket_not_exist",
-			notification: &pubsub.Message{
-				Attributes: map[string]string{"bucketId": "foo2", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
-				Data:       testGCSMetadataBytes(),
-			},
-			successMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-			},
-			wantErrSubstr: "failed to create GCS object reader",
-			wantPmapEvent: &v1alpha1.PmapEvent{},
+			name:           "invalid_token",
+			authorization:  "Bearer invalid-token",
+			wantStatusCode: http.StatusUnauthorized,
 		},
 		{
-			name: "invalid_yaml_format",
-			notification: &pubsub.Message{
-				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
-				Data:       testGCSMetadataBytes(),
-			},
-			gcsObjectBytes: []byte(`foo, bar`),
-			successMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-			},
-			failureMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-			},
-			wantPmapEvent: &v1alpha1.PmapEvent{},
-			wantAttr: map[string]string{
-				AttrKeyProcessErr: fmt.Sprintf("pmap process err: failed to unmarshal object yaml: failed to unmarshal yaml: %s",
-					"yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `foo, bar` into map[string]interface {}"),
-			},
-			wantFailuerPmapEvent: &v1alpha1.PmapEvent{},
+			name:           "missing_token",
+			wantStatusCode: http.StatusUnauthorized,
 		},
 		{
-			name: "invalid_object_metadata",
-			notification: &pubsub.Message{
-				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
-				Data:       []byte("}"),
-			},
-			gcsObjectBytes: []byte(`foo: bar
-isOK: true`),
-			successMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-			},
-			wantErrSubstr: "failed to parse metadata",
-			wantPmapEvent: &v1alpha1.PmapEvent{},
+			name:           "not_bearer_token",
+			authorization:  "Basic valid-token",
+			wantStatusCode: http.StatusUnauthorized,
 		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			messenger := &testRawMessenger{}
+			h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{}},
+				messenger, WithOptionalGitHubSource(), WithStorageClient(c),
+				WithPushVerifier(&fakePushVerifier{token: "valid-token", subject: publisher}))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			body := testToJSON(t, &PubSubMessage{
+				Message: struct {
+					Data       []byte            `json:"data,omitempty"`
+					Attributes map[string]string `json:"attributes"`
+					MessageID  string            `json:"messageId,omitempty"`
+				}{
+					Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+				},
+			})
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body))
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			resp := httptest.NewRecorder()
+			h.HTTPHandler().ServeHTTP(resp, req)
+
+			if resp.Code != tc.wantStatusCode {
+				t.Errorf("StatusCode got %d, want %d", resp.Code, tc.wantStatusCode)
+			}
+			if got := messenger.gotAttr[AttrKeyPublisher]; got != tc.wantPublisher {
+				t.Errorf("publisher attribute got %q, want %q", got, tc.wantPublisher)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HttpHandlerSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+`)
+
+	cases := []struct {
+		name               string
+		schemaVersion      string
+		wantStatusCode     int
+		wantRespBodySubstr string
+		wantHeader         string
+		wantAttr           string
+	}{
 		{
-			name: "failed_process_not_processErr",
-			notification: &pubsub.Message{
-				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
-				Data:       testGCSMetadataBytes(),
-			},
-			gcsObjectBytes: []byte(`foo: bar
-isOK: true`),
-			processors: []Processor[*structpb.Struct]{&testProcessor{fmt.Errorf("always fail")}},
-			successMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-			},
-			wantErrSubstr: "always fail",
-			wantPmapEvent: &v1alpha1.PmapEvent{},
+			name:               "default",
+			wantStatusCode:     http.StatusCreated,
+			wantRespBodySubstr: "OK",
+			wantHeader:         "v1alpha1",
+			wantAttr:           "v1alpha1",
 		},
 		{
-			name: "failed_process_with_processErr",
-			notification: &pubsub.Message{
-				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
-				Data:       testGCSMetadataBytes(),
-			},
-			gcsObjectBytes: []byte(`foo: bar
-isOK: true`),
-			processors: []Processor[*structpb.Struct]{&testProcessor{pmaperrors.New("user facing error")}},
-			successMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-			},
-			wantPmapEvent: &v1alpha1.PmapEvent{},
+			name:               "requested_version",
+			schemaVersion:      "v1beta1, v1alpha1",
+			wantStatusCode:     http.StatusCreated,
+			wantRespBodySubstr: "OK",
+			wantHeader:         "v1alpha1",
+			wantAttr:           "v1alpha1",
 		},
 		{
-			name: "failed_process_and_send_with_processErr",
-			notification: &pubsub.Message{
-				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
-				Data:       testGCSMetadataBytes(),
-			},
-			gcsObjectBytes: []byte(`foo: bar
-isOK: true`),
-			processors: []Processor[*structpb.Struct]{&testProcessor{pmaperrors.New("user facing error")}},
-			successMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-			},
-			failureMessenger: &testMessenger{
-				gotPmapEvent: &v1alpha1.PmapEvent{},
-				returnErr:    fmt.Errorf("always fail"),
-			},
-			wantErrSubstr: "failed to send failure event downstream",
-			wantPmapEvent: &v1alpha1.PmapEvent{},
-			wantFailuerPmapEvent: &v1alpha1.PmapEvent{
-				GithubSource: &v1alpha1.GitHubSource{
-					RepoName:                   "test-github-repo",
-					Commit:                     "test-github-commit",
-					Workflow:                   "test-workflow",
-					WorkflowSha:                "test-workflow-sha",
-					WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
-					WorkflowRunId:              "5050509831",
-					WorkflowRunAttempt:         1,
-					FilePath:                   "dir1/dir2/bar",
-				},
-			},
-			wantAttr: map[string]string{
-				AttrKeyProcessErr: "failed to process object: pmap process err: user facing error",
-			},
+			name:               "unsupported_version",
+			schemaVersion:      "v1beta1",
+			wantStatusCode:     http.StatusNotAcceptable,
+			wantRespBodySubstr: `unsupported schema version "v1beta1", supported: [v1alpha1]`,
 		},
 	}
 
@@ -485,155 +610,3094 @@ isOK: true`),
 			t.Parallel()
 
 			ctx := context.Background()
-
-			// Create fake http client for storage client.
-			hc := newTestServer(t, testHandleObjectRead(t, tc.gcsObjectBytes))
-
-			// Setup test handler with fake storage client.
+			hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
 			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
 			if err != nil {
 				t.Fatalf("failed to creat GCS storage client %v", err)
 			}
-			opts := []Option{
-				WithStorageClient(c),
-				WithFailureMessenger(tc.failureMessenger),
-			}
-			h, err := NewHandler(ctx, tc.processors, tc.successMessenger, opts...)
+			messenger := &testRawMessenger{}
+			h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{}},
+				messenger, WithOptionalGitHubSource(), WithStorageClient(c))
 			if err != nil {
 				t.Fatalf("failed to create event handler %v", err)
 			}
 
-			// Run test.
-			gotErr := h.Handle(ctx, *tc.notification)
-			if diff := testutil.DiffErrString(gotErr, tc.wantErrSubstr); diff != "" {
-				t.Errorf("Process(%+v) got unexpected error substring: %v", tc.name, diff)
+			body := testToJSON(t, &PubSubMessage{
+				Message: struct {
+					Data       []byte            `json:"data,omitempty"`
+					Attributes map[string]string `json:"attributes"`
+					MessageID  string            `json:"messageId,omitempty"`
+				}{
+					Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+				},
+			})
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body))
+			if tc.schemaVersion != "" {
+				req.Header.Set(HeaderSchemaVersion, tc.schemaVersion)
 			}
+			resp := httptest.NewRecorder()
+			h.HTTPHandler().ServeHTTP(resp, req)
 
-			cmpOpts := []cmp.Option{
-				protocmp.Transform(),
-				protocmp.IgnoreFields(&v1alpha1.PmapEvent{}, "payload"),
+			if resp.Code != tc.wantStatusCode {
+				t.Errorf("StatusCode got %d, want %d", resp.Code, tc.wantStatusCode)
 			}
-			if diff := cmp.Diff(tc.wantPmapEvent, tc.successMessenger.getPmapEvent(), cmpOpts...); diff != "" {
-				t.Errorf("successMessenger got unexpected pmapEvent diff (-want, +got):\n%s", diff)
+			if !strings.Contains(resp.Body.String(), tc.wantRespBodySubstr) {
+				t.Errorf("ResponseBody got %q, want substring %q", resp.Body.String(), tc.wantRespBodySubstr)
 			}
-			if tc.failureMessenger != nil {
-				if diff := cmp.Diff(tc.wantFailuerPmapEvent, tc.failureMessenger.getPmapEvent(), cmpOpts...); diff != "" {
-					t.Errorf("failureMessenger got unexpected pmapEvent diff (-want, +got):\n%s", diff)
-				}
-
-				if diff := cmp.Diff(tc.wantAttr, tc.failureMessenger.getAttr()); diff != "" {
-					t.Errorf("failureMessenger got unexpected attribute diff (-want, +got):\n%s", diff)
-				}
+			if got := resp.Header().Get(HeaderSchemaVersion); got != tc.wantHeader {
+				t.Errorf("%s header got %q, want %q", HeaderSchemaVersion, got, tc.wantHeader)
+			}
+			if got := messenger.gotAttr[AttrKeySchemaVersion]; got != tc.wantAttr {
+				t.Errorf("schema version attribute got %q, want %q", got, tc.wantAttr)
 			}
 		})
 	}
 }
 
-// Creates a fake http client.
-func newTestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) *http.Client {
-	t.Helper()
-	ts := httptest.NewTLSServer(http.HandlerFunc(handler))
-	// Need insecure TLS option for testing.
-	// #nosec G402
-	tlsConf := &tls.Config{InsecureSkipVerify: true}
-	tr := &http.Transport{
-		TLSClientConfig: tlsConf,
-		DialTLS: func(netw, addr string) (net.Conn, error) {
-			return tls.Dial("tcp", ts.Listener.Addr().String(), tlsConf)
+func TestEventHandler_HandleMaxObjectSize(t *testing.T) {
+	t.Parallel()
+
+	// The object is 12 bytes.
+	object := []byte("foo: barbaz\n")
+
+	cases := []struct {
+		name          string
+		opts          []Option
+		wantOutcome   string
+		wantErrSubstr string
+		wantAttr      string
+	}{
+		{
+			name:        "default_limit",
+			wantOutcome: OutcomeSuccess,
+		},
+		{
+			name:        "at_limit",
+			opts:        []Option{WithMaxObjectSize(12)},
+			wantOutcome: OutcomeSuccess,
+		},
+		{
+			name:        "over_limit",
+			opts:        []Option{WithMaxObjectSize(11)},
+			wantOutcome: OutcomeFailure,
+			wantAttr:    "pmap process err: object exceeds max size 11",
+		},
+		{
+			name:          "invalid_limit",
+			opts:          []Option{WithMaxObjectSize(0)},
+			wantErrSubstr: "max object size must be positive: 0",
 		},
 	}
-	t.Cleanup(func() {
-		tr.CloseIdleConnections()
-		ts.Close()
-	})
-	return &http.Client{Transport: tr}
-}
 
-// Returns fake metadata that include github resource info.
-func testGCSMetadataBytes() []byte {
-	return []byte(`{
-		"metadata": {
-		  "github-commit": "test-github-commit",
-		  "github-workflow-triggered-timestamp": "2023-04-25T17:44:57+00:00",
-		  "github-workflow-sha": "test-workflow-sha",
-		  "github-workflow": "test-workflow",
-		  "github-repo": "test-github-repo",
-		  "github-run-id": "5050509831",
-		  "github-run-attempt": "1"
-		}
-	  }`)
-}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
 
-// Returns a fake http func that writes the data in http response.
-func testHandleObjectRead(tb testing.TB, data []byte) func(w http.ResponseWriter, r *http.Request) {
-	tb.Helper()
+			ctx := context.Background()
+			hc := newTestServer(t, testHandleObjectRead(t, object))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			opts := append([]Option{WithStorageClient(c), WithFailureMessenger(&testRawMessenger{}), WithOptionalGitHubSource()}, tc.opts...)
+			h, err := NewHandler(ctx, []Processor[*structpb.Struct]{}, &testRawMessenger{}, opts...)
+			if diff := testutil.DiffErrString(err, tc.wantErrSubstr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		// This is for getting object info
-		case "/foo/pmap-test/gh-prefix/dir1/dir2/bar":
-			_, err := w.Write(data)
+			result, err := h.HandleResult(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+			})
 			if err != nil {
-				tb.Fatalf("failed to write response for object info: %v", err)
+				t.Fatalf("HandleResult got unexpected error: %v", err)
 			}
-		default:
-			http.Error(w, "injected error", http.StatusNotFound)
-		}
+			if result.Outcome != tc.wantOutcome {
+				t.Errorf("HandleResult got outcome %q, want %q", result.Outcome, tc.wantOutcome)
+			}
+			if got := result.Attributes[AttrKeyProcessErr]; got != tc.wantAttr {
+				t.Errorf("process error attribute got %q, want %q", got, tc.wantAttr)
+			}
+		})
 	}
 }
 
-func testToJSON(tb testing.TB, in any) []byte {
-	tb.Helper()
+func TestEventHandler_HandleObjectUpdateTime(t *testing.T) {
+	t.Parallel()
 
-	b, err := json.Marshal(in)
-	if err != nil {
-		tb.Fatal(err)
+	cases := []struct {
+		name         string
+		notification pubsub.Message
+		wantTime     time.Time
+		wantOK       bool
+	}{
+		{
+			name: "payload_updated",
+			notification: pubsub.Message{
+				Attributes: map[string]string{
+					"bucketId":       "foo",
+					"objectId":       "bar",
+					"payloadFormat":  "JSON_API_V1",
+					AttrKeyEventTime: "2023-04-25T18:00:00.000000Z",
+				},
+				Data: []byte(`{"updated": "2023-04-25T17:44:57.123Z"}`),
+			},
+			wantTime: time.Date(2023, time.April, 25, 17, 44, 57, 123_000_000, time.UTC),
+			wantOK:   true,
+		},
+		{
+			name: "event_time_attribute",
+			notification: pubsub.Message{
+				Attributes: map[string]string{
+					"bucketId":       "foo",
+					"objectId":       "bar",
+					"payloadFormat":  "NONE",
+					AttrKeyEventTime: "2023-04-25T18:00:00.000000Z",
+				},
+			},
+			wantTime: time.Date(2023, time.April, 25, 18, 0, 0, 0, time.UTC),
+			wantOK:   true,
+		},
+		{
+			name: "invalid_event_time",
+			notification: pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "bar", AttrKeyEventTime: "yesterday"},
+			},
+		},
+		{
+			name: "no_update_time",
+			notification: pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "bar"},
+			},
+		},
 	}
 
-	return b
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			p := &testUpdateTimeProcessor{}
+			h, err := NewHandler(ctx, []Processor[*structpb.Struct]{p}, &testRawMessenger{},
+				WithOptionalGitHubSource(),
+				WithObjectStore(&testObjectStore{data: map[string][]byte{"foo/bar": []byte("foo: bar")}}))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			if err := h.Handle(ctx, tc.notification); err != nil {
+				t.Fatalf("Handle got unexpected error: %v", err)
+			}
+			if !p.gotTime.Equal(tc.wantTime) || p.gotOK != tc.wantOK {
+				t.Errorf("object update time got (%v, %t), want (%v, %t)", p.gotTime, p.gotOK, tc.wantTime, tc.wantOK)
+			}
+		})
+	}
 }
 
-type testProcessor struct {
-	returnErr error
+// testUpdateTimeProcessor records the object update time passed to
+// processors.
+type testUpdateTimeProcessor struct {
+	gotTime time.Time
+	gotOK   bool
 }
 
-func (p *testProcessor) Process(_ context.Context, m *structpb.Struct) error {
-	if p.returnErr == nil {
+func (p *testUpdateTimeProcessor) Process(ctx context.Context, _ *structpb.Struct) error {
+	p.gotTime, p.gotOK = ObjectUpdateTimeFromContext(ctx)
+	return nil
+}
+
+func TestEventHandler_ReadRetry(t *testing.T) {
+	t.Parallel()
+
+	object := []byte("foo: bar\n")
+
+	cases := []struct {
+		name          string
+		failures      int
+		failureCode   int
+		opts          []Option
+		wantErrSubstr string
+		wantRequests  int32
+	}{
+		{
+			name:         "retry_until_success",
+			failures:     2,
+			failureCode:  http.StatusServiceUnavailable,
+			opts:         []Option{WithReadRetry(testReadBackoff(3))},
+			wantRequests: 3,
+		},
+		{
+			name:          "retries_exhausted",
+			failures:      4,
+			failureCode:   http.StatusServiceUnavailable,
+			opts:          []Option{WithReadRetry(testReadBackoff(2))},
+			wantErrSubstr: "failed to get GCS object",
+			wantRequests:  3,
+		},
+		{
+			name:          "not_found_not_retried",
+			failures:      1,
+			failureCode:   http.StatusNotFound,
+			opts:          []Option{WithReadRetry(testReadBackoff(3))},
+			wantErrSubstr: "object doesn't exist",
+			wantRequests:  1,
+		},
+		{
+			name:          "no_retry_by_default",
+			failures:      1,
+			failureCode:   http.StatusServiceUnavailable,
+			wantErrSubstr: "failed to create GCS object reader",
+			wantRequests:  1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			var requests atomic.Int32
+			hc := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= int32(tc.failures) {
+					http.Error(w, "injected error", tc.failureCode)
+					return
+				}
+				if _, err := w.Write(object); err != nil {
+					t.Errorf("failed to write response for object: %v", err)
+				}
+			})
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			// Disable the client retries to exercise the handler retries.
+			c.SetRetry(storage.WithPolicy(storage.RetryNever))
+
+			opts := append([]Option{WithStorageClient(c)}, tc.opts...)
+			h, err := NewHandler(ctx, []Processor[*structpb.Struct]{}, &testRawMessenger{}, opts...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			gotErr := h.Handle(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "bar"},
+			})
+			if diff := testutil.DiffErrString(gotErr, tc.wantErrSubstr); diff != "" {
+				t.Error(diff)
+			}
+			if got := requests.Load(); got != tc.wantRequests {
+				t.Errorf("got %d object requests, want %d", got, tc.wantRequests)
+			}
+		})
+	}
+}
+
+// testReadBackoff returns a read backoff with the given max retries.
+func testReadBackoff(maxRetries uint64) func() retry.Backoff {
+	return func() retry.Backoff {
+		return retry.WithMaxRetries(maxRetries, retry.NewConstant(time.Millisecond))
+	}
+}
+
+func TestWithReadRetry(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHandler(context.Background(), []Processor[*structpb.Struct]{}, &testRawMessenger{},
+		WithOptionalGitHubSource(),
+		WithObjectStore(&testObjectStore{}), WithReadRetry(nil))
+	if diff := testutil.DiffErrString(err, "read backoff cannot be nil"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestEventHandler_HandleObjectDelete(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		eventType      string
+		attrs          map[string]string
+		data           []byte
+		wantSkipped    bool
+		wantDeleted    bool
+		wantPayload    bool
+		wantCommit     string
+		wantIndexEvent bool
+	}{
+		{
+			name:           "finalize",
+			eventType:      EventTypeObjectFinalize,
+			data:           testGCSMetadataBytes(),
+			wantPayload:    true,
+			wantCommit:     "test-github-commit",
+			wantIndexEvent: true,
+		},
+		{
+			name:        "delete",
+			eventType:   EventTypeObjectDelete,
+			data:        testGCSMetadataBytes(),
+			wantDeleted: true,
+			wantCommit:  "test-github-commit",
+		},
+		{
+			name:        "delete_without_metadata",
+			eventType:   EventTypeObjectDelete,
+			wantDeleted: true,
+		},
+		{
+			name:        "delete_overwritten",
+			eventType:   EventTypeObjectDelete,
+			attrs:       map[string]string{AttrKeyOverwrittenByGeneration: "1700000000000001"},
+			data:        testGCSMetadataBytes(),
+			wantSkipped: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			// A deleted object is gone from the store.
+			data := map[string][]byte{}
+			if !tc.wantDeleted {
+				data["foo/dir/bar"] = []byte("foo: bar")
+			}
+			successMessenger, failureMessenger, indexMessenger := &testRawMessenger{}, &testRawMessenger{}, &testRawMessenger{}
+			h, err := NewHandler(ctx, []Processor[*structpb.Struct]{&testProcessor{}}, successMessenger,
+				WithOptionalGitHubSource(),
+				WithObjectStore(&testObjectStore{data: data}),
+				WithFailureMessenger(failureMessenger),
+				WithIndexMessenger(indexMessenger))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			attrs := map[string]string{"bucketId": "foo", "objectId": "dir/bar", AttrKeyEventType: tc.eventType}
+			maps.Copy(attrs, tc.attrs)
+			if tc.data != nil {
+				attrs["payloadFormat"] = "JSON_API_V1"
+			}
+			result, err := h.HandleResult(ctx, pubsub.Message{Attributes: attrs, Data: tc.data})
+			if err != nil {
+				t.Fatalf("HandleResult got unexpected error: %v", err)
+			}
+			if tc.wantSkipped {
+				if result.Outcome != OutcomeSkipped {
+					t.Errorf("HandleResult got outcome %q, want %q", result.Outcome, OutcomeSkipped)
+				}
+				for _, m := range []*testRawMessenger{successMessenger, failureMessenger, indexMessenger} {
+					if m.gotData != nil {
+						t.Errorf("messenger got event %s, want none", m.gotData)
+					}
+				}
+				return
+			}
+			if result.Outcome != OutcomeSuccess {
+				t.Fatalf("HandleResult got outcome %q, want %q", result.Outcome, OutcomeSuccess)
+			}
+			if failureMessenger.gotData != nil {
+				t.Errorf("failure messenger got event %s, want none", failureMessenger.gotData)
+			}
+
+			if got, want := successMessenger.gotAttr[AttrKeyDeleted] == "true", tc.wantDeleted; got != want {
+				t.Errorf("success event got deleted %t, want %t", got, want)
+			}
+			if got, want := result.Event.GetPayload() != nil, tc.wantPayload; got != want {
+				t.Errorf("success event got payload %t, want %t", got, want)
+			}
+			if got, want := result.Event.GetGithubSource().GetCommit(), tc.wantCommit; got != want {
+				t.Errorf("success event got commit %q, want %q", got, want)
+			}
+			if got, want := indexMessenger.gotData != nil, tc.wantIndexEvent; got != want {
+				t.Errorf("index messenger got event %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+// fakePushVerifier verifies the given token as the subject.
+type fakePushVerifier struct {
+	token   string
+	subject string
+}
+
+func (v *fakePushVerifier) Verify(_ context.Context, token string) (string, error) {
+	if token != v.token {
+		return "", fmt.Errorf("invalid token %q", token)
+	}
+	return v.subject, nil
+}
+
+func TestWithRateLimit(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		qps     float64
+		burst   int
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			qps:   10,
+			burst: 20,
+		},
+		{
+			name:    "zero_qps",
+			burst:   1,
+			wantErr: "rate limit qps must be positive: 0",
+		},
+		{
+			name:    "zero_burst",
+			qps:     10,
+			wantErr: "rate limit burst must be positive: 0",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := WithRateLimit(tc.qps, tc.burst)(context.Background(), &HandlerOpts{})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Errorf("WithRateLimit(%+v) got unexpected err: %s", tc.name, diff)
+			}
+		})
+	}
+}
+
+func TestEventHandler_Handle(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name                 string
+		notification         *pubsub.Message
+		gcsObjectBytes       []byte
+		githubSourceBytes    []byte
+		processors           []Processor[*structpb.Struct]
+		successMessenger     *testMessenger
+		failureMessenger     *testMessenger
+		wantErrSubstr        string
+		wantPmapEvent        *v1alpha1.PmapEvent
+		wantFailuerPmapEvent *v1alpha1.PmapEvent
+		wantAttr             map[string]string
+		wantSuccessAttr      map[string]string
+		// wantPayload is compared with the success event payload when set.
+		wantPayload *structpb.Struct
+	}{
+		{
+			name: "success",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
+				Data:       testGCSMetadataBytes(),
+			},
+			gcsObjectBytes: []byte(
+				`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+annotations:
+  labels:
+    env: dev
+contacts:
+  email:
+  - test.gmail.com
+`),
+			processors: []Processor[*structpb.Struct]{&testProcessor{}},
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantPmapEvent: &v1alpha1.PmapEvent{
+				Type:      "google.protobuf.Struct",
+				Timestamp: timestamppb.New(testEventTime),
+				GithubSource: &v1alpha1.GitHubSource{
+					RepoName:                   "test-github-repo",
+					Commit:                     "test-github-commit",
+					Workflow:                   "test-workflow",
+					WorkflowSha:                "test-workflow-sha",
+					WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
+					WorkflowRunId:              "5050509831",
+					WorkflowRunAttempt:         1,
+					FilePath:                   "dir1/dir2/bar",
+				},
+			},
+			wantSuccessAttr: map[string]string{
+				AttrKeyOutcome:  OutcomeSuccess,
+				AttrKeyBucketID: "foo",
+				AttrKeyObjectID: "pmap-test/gh-prefix/dir1/dir2/bar",
+			},
+		},
+		{
+			name: "success_yaml_extension",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar.yaml", "payloadFormat": "JSON_API_V1"},
+				Data:       testGCSMetadataBytes(),
+			},
+			gcsObjectBytes: []byte(`foo: bar
+isOK: true`),
+			processors: []Processor[*structpb.Struct]{&testProcessor{}},
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantPmapEvent: &v1alpha1.PmapEvent{
+				Type:      "google.protobuf.Struct",
+				Timestamp: timestamppb.New(testEventTime),
+				GithubSource: &v1alpha1.GitHubSource{
+					RepoName:                   "test-github-repo",
+					Commit:                     "test-github-commit",
+					Workflow:                   "test-workflow",
+					WorkflowSha:                "test-workflow-sha",
+					WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
+					WorkflowRunId:              "5050509831",
+					WorkflowRunAttempt:         1,
+					FilePath:                   "dir1/dir2/bar.yaml",
+				},
+			},
+			wantPayload: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"foo":       structpb.NewStringValue("bar"),
+				"isOK":      structpb.NewBoolValue(true),
+				"processed": structpb.NewBoolValue(true),
+			}},
+			wantSuccessAttr: map[string]string{
+				AttrKeyOutcome:  OutcomeSuccess,
+				AttrKeyBucketID: "foo",
+				AttrKeyObjectID: "pmap-test/gh-prefix/dir1/dir2/bar.yaml",
+			},
+		},
+		{
+			name: "success_json_extension",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar.json", "payloadFormat": "JSON_API_V1"},
+				Data:       testGCSMetadataBytes(),
+			},
+			// The escaped slashes are valid in JSON but not in YAML.
+			gcsObjectBytes: []byte(`{"foo": "bar", "isOK": true, "url": "https:\/\/example.com"}`),
+			processors:     []Processor[*structpb.Struct]{&testProcessor{}},
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantPmapEvent: &v1alpha1.PmapEvent{
+				Type:      "google.protobuf.Struct",
+				Timestamp: timestamppb.New(testEventTime),
+				GithubSource: &v1alpha1.GitHubSource{
+					RepoName:                   "test-github-repo",
+					Commit:                     "test-github-commit",
+					Workflow:                   "test-workflow",
+					WorkflowSha:                "test-workflow-sha",
+					WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
+					WorkflowRunId:              "5050509831",
+					WorkflowRunAttempt:         1,
+					FilePath:                   "dir1/dir2/bar.json",
+				},
+			},
+			wantPayload: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"foo":       structpb.NewStringValue("bar"),
+				"isOK":      structpb.NewBoolValue(true),
+				"processed": structpb.NewBoolValue(true),
+				"url":       structpb.NewStringValue("https://example.com"),
+			}},
+			wantSuccessAttr: map[string]string{
+				AttrKeyOutcome:  OutcomeSuccess,
+				AttrKeyBucketID: "foo",
+				AttrKeyObjectID: "pmap-test/gh-prefix/dir1/dir2/bar.json",
+			},
+		},
+		{
+			name: "success_json_content_type",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
+				Data:       testGCSMetadataBytesWithContentType("application/json; charset=utf-8"),
+			},
+			// The escaped slashes are valid in JSON but not in YAML.
+			gcsObjectBytes: []byte(`{"foo": "bar", "isOK": true, "url": "https:\/\/example.com"}`),
+			processors:     []Processor[*structpb.Struct]{&testProcessor{}},
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantPmapEvent: &v1alpha1.PmapEvent{
+				Type:      "google.protobuf.Struct",
+				Timestamp: timestamppb.New(testEventTime),
+				GithubSource: &v1alpha1.GitHubSource{
+					RepoName:                   "test-github-repo",
+					Commit:                     "test-github-commit",
+					Workflow:                   "test-workflow",
+					WorkflowSha:                "test-workflow-sha",
+					WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
+					WorkflowRunId:              "5050509831",
+					WorkflowRunAttempt:         1,
+					FilePath:                   "dir1/dir2/bar",
+				},
+			},
+			wantPayload: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"foo":       structpb.NewStringValue("bar"),
+				"isOK":      structpb.NewBoolValue(true),
+				"processed": structpb.NewBoolValue(true),
+				"url":       structpb.NewStringValue("https://example.com"),
+			}},
+			wantSuccessAttr: map[string]string{
+				AttrKeyOutcome:  OutcomeSuccess,
+				AttrKeyBucketID: "foo",
+				AttrKeyObjectID: "pmap-test/gh-prefix/dir1/dir2/bar",
+			},
+		},
+		{
+			name: "failed_send_downstream",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
+				Data:       testGCSMetadataBytes(),
+			},
+			gcsObjectBytes: []byte(`foo: bar
+isOK: true`),
+			processors: []Processor[*structpb.Struct]{&testProcessor{}},
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+				returnErr:    fmt.Errorf("always fail"),
+			},
+			wantErrSubstr: "failed to send succuss event downstream",
+			wantPmapEvent: &v1alpha1.PmapEvent{
+				Type:      "google.protobuf.Struct",
+				Timestamp: timestamppb.New(testEventTime),
+				GithubSource: &v1alpha1.GitHubSource{
+					RepoName:                   "test-github-repo",
+					Commit:                     "test-github-commit",
+					Workflow:                   "test-workflow",
+					WorkflowSha:                "test-workflow-sha",
+					WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
+					WorkflowRunId:              "5050509831",
+					WorkflowRunAttempt:         1,
+					FilePath:                   "dir1/dir2/bar",
+				},
+			},
+			wantSuccessAttr: map[string]string{
+				AttrKeyOutcome:  OutcomeSuccess,
+				AttrKeyBucketID: "foo",
+				AttrKeyObjectID: "pmap-test/gh-prefix/dir1/dir2/bar",
+			},
+		},
+		{
+			name: "missing_bucket_id",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+				Data:       testGCSMetadataBytes(),
+			},
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantErrSubstr: "bucket ID not found",
+			wantPmapEvent: &v1alpha1.PmapEvent{},
+		},
+		{
+			name: "failed_parsing_timestamp",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
+				Data: []byte(`{
+									"metadata": {
+									  "github-commit": "test-github-commit",
+									  "github-workflow-triggered-timestamp": "2023",
+									  "github-workflow-sha": "test-workflow-sha",
+									  "github-workflow": "test-workflow",
+									  "github-repo": "test-github-repo",
+									  "github-run-id": "5050509831",
+									  "github-run-attempt": "1"
+									}
+								  }`),
+			},
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantErrSubstr: "failed to parse date",
+			wantPmapEvent: &v1alpha1.PmapEvent{},
+		},
+		{
+			name: "missing_object_id",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo"},
+				Data:       testGCSMetadataBytes(),
+			},
+			successMessenger: &testMessenger{},
+			wantErrSubstr:    "object ID not found",
+		},
+		{
+			name: "bucket_not_exist",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo2", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
+				Data:       testGCSMetadataBytes(),
+			},
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantErrSubstr: "failed to create GCS object reader",
+			wantPmapEvent: &v1alpha1.PmapEvent{},
+		},
+		{
+			name: "invalid_yaml_format",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
+				Data:       testGCSMetadataBytes(),
+			},
+			gcsObjectBytes: []byte(`foo, bar`),
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			failureMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantPmapEvent: &v1alpha1.PmapEvent{},
+			wantAttr: map[string]string{
+				AttrKeyOutcome:  OutcomeFailure,
+				AttrKeyBucketID: "foo",
+				AttrKeyObjectID: "pmap-test/gh-prefix/dir1/dir2/bar",
+				AttrKeyProcessErr: fmt.Sprintf("pmap process err: failed to unmarshal object yaml: failed to unmarshal yaml: %s",
+					"yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `foo, bar` into map[string]interface {}"),
+			},
+			wantFailuerPmapEvent: &v1alpha1.PmapEvent{
+				Type:      "google.protobuf.Struct",
+				Timestamp: timestamppb.New(testEventTime),
+				GithubSource: &v1alpha1.GitHubSource{
+					RepoName:                   "test-github-repo",
+					Commit:                     "test-github-commit",
+					Workflow:                   "test-workflow",
+					WorkflowSha:                "test-workflow-sha",
+					WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
+					WorkflowRunId:              "5050509831",
+					WorkflowRunAttempt:         1,
+					FilePath:                   "dir1/dir2/bar",
+				},
+			},
+		},
+		{
+			name: "duplicate_yaml_keys",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
+				Data:       testGCSMetadataBytes(),
+			},
+			gcsObjectBytes: []byte(`annotations:
+  location: us
+  location: eu`),
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			failureMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantPmapEvent: &v1alpha1.PmapEvent{},
+			wantAttr: map[string]string{
+				AttrKeyOutcome:  OutcomeFailure,
+				AttrKeyBucketID: "foo",
+				AttrKeyObjectID: "pmap-test/gh-prefix/dir1/dir2/bar",
+				AttrKeyProcessErr: fmt.Sprintf("pmap process err: failed to unmarshal object yaml: failed to unmarshal yaml: %s",
+					"yaml: unmarshal errors:\n  line 3: mapping key \"location\" already defined at line 2"),
+			},
+			wantFailuerPmapEvent: &v1alpha1.PmapEvent{
+				Type:      "google.protobuf.Struct",
+				Timestamp: timestamppb.New(testEventTime),
+				GithubSource: &v1alpha1.GitHubSource{
+					RepoName:                   "test-github-repo",
+					Commit:                     "test-github-commit",
+					Workflow:                   "test-workflow",
+					WorkflowSha:                "test-workflow-sha",
+					WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
+					WorkflowRunId:              "5050509831",
+					WorkflowRunAttempt:         1,
+					FilePath:                   "dir1/dir2/bar",
+				},
+			},
+		},
+		{
+			name: "invalid_object_metadata",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
+				Data:       []byte("}"),
+			},
+			gcsObjectBytes: []byte(`foo: bar
+isOK: true`),
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantErrSubstr: "failed to parse metadata",
+			wantPmapEvent: &v1alpha1.PmapEvent{},
+		},
+		{
+			name: "failed_process_not_processErr",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+				Data:       testGCSMetadataBytes(),
+			},
+			gcsObjectBytes: []byte(`foo: bar
+isOK: true`),
+			processors: []Processor[*structpb.Struct]{&testProcessor{fmt.Errorf("always fail")}},
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantErrSubstr: "always fail",
+			wantPmapEvent: &v1alpha1.PmapEvent{},
+		},
+		{
+			name: "failed_process_with_processErr",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+				Data:       testGCSMetadataBytes(),
+			},
+			gcsObjectBytes: []byte(`foo: bar
+isOK: true`),
+			processors: []Processor[*structpb.Struct]{&testProcessor{pmaperrors.New("user facing error")}},
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			wantPmapEvent: &v1alpha1.PmapEvent{},
+		},
+		{
+			name: "failed_process_and_send_with_processErr",
+			notification: &pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
+				Data:       testGCSMetadataBytes(),
+			},
+			gcsObjectBytes: []byte(`foo: bar
+isOK: true`),
+			processors: []Processor[*structpb.Struct]{&testProcessor{pmaperrors.New("user facing error")}},
+			successMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+			},
+			failureMessenger: &testMessenger{
+				gotPmapEvent: &v1alpha1.PmapEvent{},
+				returnErr:    fmt.Errorf("always fail"),
+			},
+			wantErrSubstr: "failed to send failure event downstream",
+			wantPmapEvent: &v1alpha1.PmapEvent{},
+			wantFailuerPmapEvent: &v1alpha1.PmapEvent{
+				Type:      "google.protobuf.Struct",
+				Timestamp: timestamppb.New(testEventTime),
+				GithubSource: &v1alpha1.GitHubSource{
+					RepoName:                   "test-github-repo",
+					Commit:                     "test-github-commit",
+					Workflow:                   "test-workflow",
+					WorkflowSha:                "test-workflow-sha",
+					WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
+					WorkflowRunId:              "5050509831",
+					WorkflowRunAttempt:         1,
+					FilePath:                   "dir1/dir2/bar",
+				},
+			},
+			wantAttr: map[string]string{
+				AttrKeyOutcome:    OutcomeFailure,
+				AttrKeyBucketID:   "foo",
+				AttrKeyObjectID:   "pmap-test/gh-prefix/dir1/dir2/bar",
+				AttrKeyProcessErr: "failed to process object: pmap process err: user facing error",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			// Create fake http client for storage client.
+			hc := newTestServer(t, testHandleObjectRead(t, tc.gcsObjectBytes))
+
+			// Setup test handler with fake storage client.
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			opts := []Option{
+				WithStorageClient(c),
+				WithFailureMessenger(tc.failureMessenger),
+				WithClock(func() time.Time { return testEventTime }),
+				WithOptionalGitHubSource(),
+			}
+			h, err := NewHandler(ctx, tc.processors, tc.successMessenger, opts...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			// Run test.
+			gotErr := h.Handle(ctx, *tc.notification)
+			if diff := testutil.DiffErrString(gotErr, tc.wantErrSubstr); diff != "" {
+				t.Errorf("Process(%+v) got unexpected error substring: %v", tc.name, diff)
+			}
+
+			cmpOpts := []cmp.Option{
+				protocmp.Transform(),
+				protocmp.IgnoreFields(&v1alpha1.PmapEvent{}, "payload"),
+			}
+			if diff := cmp.Diff(tc.wantPmapEvent, tc.successMessenger.getPmapEvent(), cmpOpts...); diff != "" {
+				t.Errorf("successMessenger got unexpected pmapEvent diff (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantSuccessAttr, tc.successMessenger.getAttr()); diff != "" {
+				t.Errorf("successMessenger got unexpected attribute diff (-want, +got):\n%s", diff)
+			}
+			if tc.wantPayload != nil {
+				gotPayload := &structpb.Struct{}
+				if err := tc.successMessenger.getPmapEvent().GetPayload().UnmarshalTo(gotPayload); err != nil {
+					t.Fatalf("failed to unmarshal payload: %v", err)
+				}
+				if diff := cmp.Diff(tc.wantPayload, gotPayload, protocmp.Transform()); diff != "" {
+					t.Errorf("successMessenger got unexpected payload diff (-want, +got):\n%s", diff)
+				}
+			}
+			if tc.failureMessenger != nil {
+				if diff := cmp.Diff(tc.wantFailuerPmapEvent, tc.failureMessenger.getPmapEvent(), cmpOpts...); diff != "" {
+					t.Errorf("failureMessenger got unexpected pmapEvent diff (-want, +got):\n%s", diff)
+				}
+
+				if diff := cmp.Diff(tc.wantAttr, tc.failureMessenger.getAttr()); diff != "" {
+					t.Errorf("failureMessenger got unexpected attribute diff (-want, +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleWithIndexMessenger(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		gcsObjectBytes []byte
+		processors     []Processor[*v1alpha1.ResourceMapping]
+		indexMessenger *testRawMessenger
+		wantErrSubstr  string
+		wantIndexEvent *IndexEvent
+		wantSuccess    bool
+	}{
+		{
+			name: "success",
+			gcsObjectBytes: []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`),
+			indexMessenger: &testRawMessenger{},
+			wantIndexEvent: &IndexEvent{
+				ResourceName: "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+				Type:         "abcxyz.pmap.ResourceMapping",
+				Timestamp:    testEventTime,
+				ObjectID:     "pmap-test/gh-prefix/dir1/dir2/bar",
+			},
+			wantSuccess: true,
+		},
+		{
+			name: "no_index_event_on_failure",
+			gcsObjectBytes: []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+`),
+			processors:     []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{pmaperrors.New("user facing error")}},
+			indexMessenger: &testRawMessenger{},
+		},
+		{
+			name: "failed_send_index_event",
+			gcsObjectBytes: []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+`),
+			indexMessenger: &testRawMessenger{returnErr: fmt.Errorf("always fail")},
+			wantErrSubstr:  "failed to send index event downstream",
+			wantSuccess:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			hc := newTestServer(t, testHandleObjectRead(t, tc.gcsObjectBytes))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			successMessenger := &testRawMessenger{}
+			h, err := NewHandler(ctx, tc.processors, successMessenger,
+				WithOptionalGitHubSource(),
+				WithStorageClient(c),
+				WithIndexMessenger(tc.indexMessenger),
+				WithClock(func() time.Time { return testEventTime }))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			gotErr := h.Handle(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+			})
+			if diff := testutil.DiffErrString(gotErr, tc.wantErrSubstr); diff != "" {
+				t.Errorf("Process(%+v) got unexpected error substring: %v", tc.name, diff)
+			}
+
+			if got := successMessenger.gotData != nil; got != tc.wantSuccess {
+				t.Errorf("Process(%+v) sent success event got %t, want %t", tc.name, got, tc.wantSuccess)
+			}
+
+			var gotIndexEvent *IndexEvent
+			if tc.indexMessenger.gotData != nil && tc.indexMessenger.returnErr == nil {
+				gotIndexEvent = &IndexEvent{}
+				if err := json.Unmarshal(tc.indexMessenger.gotData, gotIndexEvent); err != nil {
+					t.Fatalf("failed to unmarshal index event: %v", err)
+				}
+			}
+			if diff := cmp.Diff(tc.wantIndexEvent, gotIndexEvent); diff != "" {
+				t.Errorf("indexMessenger got unexpected index event diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleWithTimeout(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		timeout       time.Duration
+		processors    []Processor[*structpb.Struct]
+		wantErrSubstr string
+		wantSuccess   bool
+	}{
+		{
+			name:        "success_within_timeout",
+			timeout:     time.Minute,
+			processors:  []Processor[*structpb.Struct]{&testProcessor{}},
+			wantSuccess: true,
+		},
+		{
+			name:          "exceeds_timeout",
+			timeout:       10 * time.Millisecond,
+			processors:    []Processor[*structpb.Struct]{&testProcessor{}, &testBlockingProcessor{}},
+			wantErrSubstr: "handle timed out after 10ms",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			hc := newTestServer(t, testHandleObjectRead(t, []byte(`foo: bar`)))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			successMessenger := &testRawMessenger{}
+			failureMessenger := &testRawMessenger{}
+			h, err := NewHandler(ctx, tc.processors, successMessenger,
+				WithOptionalGitHubSource(),
+				WithStorageClient(c),
+				WithFailureMessenger(failureMessenger),
+				WithHandleTimeout(tc.timeout))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			gotErr := h.Handle(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+			})
+			if diff := testutil.DiffErrString(gotErr, tc.wantErrSubstr); diff != "" {
+				t.Errorf("Process(%+v) got unexpected error substring: %v", tc.name, diff)
+			}
+			if gotErr != nil {
+				if !errors.Is(gotErr, context.DeadlineExceeded) {
+					t.Errorf("Process(%+v) got error %v, want context.DeadlineExceeded", tc.name, gotErr)
+				}
+				if pmaperrors.Is(gotErr) {
+					t.Errorf("Process(%+v) got user facing error %v, want retryable error", tc.name, gotErr)
+				}
+			}
+			if got := successMessenger.gotData != nil; got != tc.wantSuccess {
+				t.Errorf("Process(%+v) sent success event got %t, want %t", tc.name, got, tc.wantSuccess)
+			}
+			if failureMessenger.gotData != nil {
+				t.Errorf("Process(%+v) got unexpected failure event", tc.name)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleResult(t *testing.T) {
+	t.Parallel()
+
+	mapping := &v1alpha1.ResourceMapping{
+		Resource: &v1alpha1.Resource{
+			Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+			Provider: "gcp",
+		},
+		Contacts: &v1alpha1.Contacts{Email: []string{"pmap@example.com"}},
+	}
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)
+
+	cases := []struct {
+		name             string
+		gcsObjectBytes   []byte
+		processors       []Processor[*v1alpha1.ResourceMapping]
+		successMessenger *testRawMessenger
+		wantResult       *Result
+		wantPayload      *v1alpha1.ResourceMapping
+		wantErrSubstr    string
+	}{
+		{
+			name:             "success",
+			gcsObjectBytes:   mappingYAML,
+			successMessenger: &testRawMessenger{},
+			wantResult: &Result{
+				Outcome: OutcomeSuccess,
+				Attributes: map[string]string{
+					AttrKeyOutcome:       OutcomeSuccess,
+					AttrKeyBucketID:      "foo",
+					AttrKeyObjectID:      "pmap-test/gh-prefix/dir1/dir2/bar",
+					AttrKeySchemaVersion: "v1alpha1",
+					AttrKeyResourceKey:   ResourceKey(mapping.GetResource()),
+				},
+			},
+			wantPayload: mapping,
+		},
+		{
+			name:             "process_failure",
+			gcsObjectBytes:   mappingYAML,
+			processors:       []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{pmaperrors.New("user facing error")}},
+			successMessenger: &testRawMessenger{},
+			wantResult: &Result{
+				Outcome: OutcomeFailure,
+				Attributes: map[string]string{
+					AttrKeyOutcome:       OutcomeFailure,
+					AttrKeyBucketID:      "foo",
+					AttrKeyObjectID:      "pmap-test/gh-prefix/dir1/dir2/bar",
+					AttrKeySchemaVersion: "v1alpha1",
+					AttrKeyResourceKey:   ResourceKey(mapping.GetResource()),
+					AttrKeyProcessErr:    "failed to process object: pmap process err: user facing error",
+				},
+			},
+			wantPayload: mapping,
+		},
+		{
+			name:             "invalid_yaml_failure",
+			gcsObjectBytes:   []byte(`foo`),
+			successMessenger: &testRawMessenger{},
+			wantResult: &Result{
+				Outcome: OutcomeFailure,
+				Attributes: map[string]string{
+					AttrKeyOutcome:       OutcomeFailure,
+					AttrKeyBucketID:      "foo",
+					AttrKeyObjectID:      "pmap-test/gh-prefix/dir1/dir2/bar",
+					AttrKeySchemaVersion: "v1alpha1",
+					AttrKeyProcessErr:    "pmap process err: failed to unmarshal object yaml: failed to unmarshal yaml: yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `foo` into map[string]interface {}",
+				},
+			},
+		},
+		{
+			name:             "failed_send_downstream",
+			gcsObjectBytes:   mappingYAML,
+			successMessenger: &testRawMessenger{returnErr: fmt.Errorf("always fail")},
+			wantErrSubstr:    "failed to send succuss event downstream",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			hc := newTestServer(t, testHandleObjectRead(t, tc.gcsObjectBytes))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			h, err := NewHandler(ctx, tc.processors, tc.successMessenger,
+				WithOptionalGitHubSource(),
+				WithStorageClient(c),
+				WithFailureMessenger(&testRawMessenger{}))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			got, gotErr := h.HandleResult(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+			})
+			if diff := testutil.DiffErrString(gotErr, tc.wantErrSubstr); diff != "" {
+				t.Errorf("HandleResult(%+v) got unexpected error substring: %v", tc.name, diff)
+			}
+
+			if diff := cmp.Diff(tc.wantResult, got, cmpopts.IgnoreFields(Result{}, "Event")); diff != "" {
+				t.Errorf("HandleResult(%+v) got result diff (-want, +got): %v", tc.name, diff)
+			}
+
+			var gotEvent *v1alpha1.PmapEvent
+			if got != nil {
+				gotEvent = got.Event
+			}
+			if tc.wantPayload == nil {
+				if gotEvent.GetPayload() != nil {
+					t.Errorf("HandleResult(%+v) got event payload %v, want nil", tc.name, gotEvent.GetPayload())
+				}
+				return
+			}
+			gotPayload := &v1alpha1.ResourceMapping{}
+			if err := gotEvent.GetPayload().UnmarshalTo(gotPayload); err != nil {
+				t.Fatalf("failed to unmarshal event payload: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantPayload, gotPayload, protocmp.Transform()); diff != "" {
+				t.Errorf("HandleResult(%+v) got payload diff (-want, +got): %v", tc.name, diff)
+			}
+		})
+	}
+}
+
+// Creates a fake http client.
+func newTestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) *http.Client {
+	t.Helper()
+	ts := httptest.NewTLSServer(http.HandlerFunc(handler))
+	// Need insecure TLS option for testing.
+	// #nosec G402
+	tlsConf := &tls.Config{InsecureSkipVerify: true}
+	tr := &http.Transport{
+		TLSClientConfig: tlsConf,
+		DialTLS: func(netw, addr string) (net.Conn, error) {
+			return tls.Dial("tcp", ts.Listener.Addr().String(), tlsConf)
+		},
+	}
+	t.Cleanup(func() {
+		tr.CloseIdleConnections()
+		ts.Close()
+	})
+	return &http.Client{Transport: tr}
+}
+
+// testEventTime is the time the events are stamped with in tests.
+var testEventTime = time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+// Returns fake metadata that include github resource info.
+func testGCSMetadataBytes() []byte {
+	return []byte(`{
+		"metadata": {
+		  "github-commit": "test-github-commit",
+		  "github-workflow-triggered-timestamp": "2023-04-25T17:44:57+00:00",
+		  "github-workflow-sha": "test-workflow-sha",
+		  "github-workflow": "test-workflow",
+		  "github-repo": "test-github-repo",
+		  "github-run-id": "5050509831",
+		  "github-run-attempt": "1"
+		}
+	  }`)
+}
+
+// Returns fake metadata like testGCSMetadataBytes with the object content
+// type.
+func testGCSMetadataBytesWithContentType(contentType string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"contentType": %q,
+		"metadata": {
+		  "github-commit": "test-github-commit",
+		  "github-workflow-triggered-timestamp": "2023-04-25T17:44:57+00:00",
+		  "github-workflow-sha": "test-workflow-sha",
+		  "github-workflow": "test-workflow",
+		  "github-repo": "test-github-repo",
+		  "github-run-id": "5050509831",
+		  "github-run-attempt": "1"
+		}
+	  }`, contentType))
+}
+
+// Returns a fake http func that writes the data in http response.
+func testHandleObjectRead(tb testing.TB, data []byte) func(w http.ResponseWriter, r *http.Request) {
+	tb.Helper()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		// This is for getting object info
+		case "/foo/pmap-test/gh-prefix/dir1/dir2/bar",
+			"/foo/pmap-test/gh-prefix/dir1/dir2/bar.yaml",
+			"/foo/pmap-test/gh-prefix/dir1/dir2/bar.json":
+			_, err := w.Write(data)
+			if err != nil {
+				tb.Fatalf("failed to write response for object info: %v", err)
+			}
+		default:
+			http.Error(w, "injected error", http.StatusNotFound)
+		}
+	}
+}
+
+func testToJSON(tb testing.TB, in any) []byte {
+	tb.Helper()
+
+	b, err := json.Marshal(in)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return b
+}
+
+type testProcessor struct {
+	returnErr error
+}
+
+func (p *testProcessor) Process(_ context.Context, m *structpb.Struct) error {
+	if p.returnErr == nil {
 		m.Fields["processed"] = structpb.NewBoolValue(true)
 		return nil
 	}
-	return p.returnErr
+	return p.returnErr
+}
+
+// testBlockingProcessor blocks until the context is done, and reports
+// the context error as a user facing error.
+type testBlockingProcessor struct{}
+
+func (p *testBlockingProcessor) Process(ctx context.Context, _ *structpb.Struct) error {
+	<-ctx.Done()
+	return pmaperrors.Wrap(ctx.Err())
+}
+
+type testDependentProcessor struct {
+	name  string
+	deps  []string
+	after []string
+}
+
+func (p *testDependentProcessor) Process(_ context.Context, _ *structpb.Struct) error {
+	return nil
+}
+
+func (p *testDependentProcessor) Name() string {
+	return p.name
+}
+
+func (p *testDependentProcessor) DependsOn() []string {
+	return p.deps
+}
+
+func (p *testDependentProcessor) RunsAfter() []string {
+	return p.after
+}
+
+type testMessenger struct {
+	gotPmapEvent *v1alpha1.PmapEvent
+	gotAttr      map[string]string
+	returnErr    error
+}
+
+func (m *testMessenger) Send(_ context.Context, data []byte, attr map[string]string) error {
+	if m == nil {
+		return nil
+	}
+
+	// Don't record gotPmapEvent when data is nil.
+	// Also protojson.Unmarshal will return err
+	// when unmarshal an empty byte slice
+	if len(data) != 0 {
+		if err := protojson.Unmarshal(data, m.gotPmapEvent); err != nil {
+			return fmt.Errorf("failed to unmarshal to PmapEvent: %w", err)
+		}
+	}
+
+	m.gotAttr = attr
+
+	return m.returnErr
+}
+
+func (m *testMessenger) getPmapEvent() *v1alpha1.PmapEvent {
+	return m.gotPmapEvent
+}
+
+func (m *testMessenger) getAttr() map[string]string {
+	return m.gotAttr
+}
+
+type testMappingProcessor struct {
+	returnErr error
+}
+
+func (p *testMappingProcessor) Process(_ context.Context, _ *v1alpha1.ResourceMapping) error {
+	return p.returnErr
+}
+
+// testRawMessenger records the raw data it receives.
+type testRawMessenger struct {
+	gotData   []byte
+	gotAttr   map[string]string
+	returnErr error
+}
+
+func (m *testRawMessenger) Send(_ context.Context, data []byte, attr map[string]string) error {
+	m.gotData = data
+	m.gotAttr = attr
+	return m.returnErr
+}
+
+func TestEventHandler_HandleWithObjectMetadata(t *testing.T) {
+	t.Parallel()
+
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)
+	metadata := map[string]string{
+		"github-repo":   "abcxyz/pmap",
+		"github-commit": "0123456789abcdef0123456789abcdef01234567",
+		"custom-key":    "custom-value",
+	}
+	resourceKey := ResourceKey(&v1alpha1.Resource{
+		Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+		Provider: "gcp",
+	})
+
+	cases := []struct {
+		name     string
+		opts     []Option
+		wantAttr map[string]string
+	}{
+		{
+			name: "disabled",
+			wantAttr: map[string]string{
+				AttrKeyOutcome:       OutcomeSuccess,
+				AttrKeyBucketID:      "foo",
+				AttrKeyObjectID:      "pmap-test/gh-prefix/dir1/dir2/bar",
+				AttrKeySchemaVersion: "v1alpha1",
+				AttrKeyResourceKey:   resourceKey,
+			},
+		},
+		{
+			name: "full_metadata",
+			opts: []Option{WithObjectMetadataAttribute(MaxObjectMetadataAttrBytes)},
+			wantAttr: map[string]string{
+				AttrKeyOutcome:        OutcomeSuccess,
+				AttrKeyBucketID:       "foo",
+				AttrKeyObjectID:       "pmap-test/gh-prefix/dir1/dir2/bar",
+				AttrKeySchemaVersion:  "v1alpha1",
+				AttrKeyResourceKey:    resourceKey,
+				AttrKeyObjectMetadata: `{"custom-key":"custom-value","github-commit":"0123456789abcdef0123456789abcdef01234567","github-repo":"abcxyz/pmap"}`,
+			},
+		},
+		{
+			name: "truncated_metadata",
+			opts: []Option{WithObjectMetadataAttribute(60)},
+			wantAttr: map[string]string{
+				AttrKeyOutcome:                 OutcomeSuccess,
+				AttrKeyBucketID:                "foo",
+				AttrKeyObjectID:                "pmap-test/gh-prefix/dir1/dir2/bar",
+				AttrKeySchemaVersion:           "v1alpha1",
+				AttrKeyResourceKey:             resourceKey,
+				AttrKeyObjectMetadata:          `{"custom-key":"custom-value","github-repo":"abcxyz/pmap"}`,
+				AttrKeyObjectMetadataTruncated: "true",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			opts := append([]Option{WithStorageClient(c)}, tc.opts...)
+			h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{}, &testRawMessenger{}, opts...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			data, err := json.Marshal(map[string]any{"metadata": metadata})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := h.HandleResult(ctx, pubsub.Message{
+				Data: data,
+				Attributes: map[string]string{
+					"bucketId":      "foo",
+					"objectId":      "pmap-test/gh-prefix/dir1/dir2/bar",
+					"payloadFormat": "JSON_API_V1",
+				},
+			})
+			if err != nil {
+				t.Fatalf("HandleResult got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantAttr, got.Attributes); diff != "" {
+				t.Errorf("HandleResult got attributes diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleWithFailureLogger(t *testing.T) {
+	t.Parallel()
+
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)
+
+	cases := []struct {
+		name             string
+		processors       []Processor[*v1alpha1.ResourceMapping]
+		failureMessenger Messenger
+		wantLogged       bool
+	}{
+		{
+			name:       "user_facing_error_without_failure_messenger",
+			processors: []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{pmaperrors.New("user facing error")}},
+			wantLogged: true,
+		},
+		{
+			name:             "user_facing_error_with_failure_messenger",
+			processors:       []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{pmaperrors.New("user facing error")}},
+			failureMessenger: &testRawMessenger{},
+		},
+		{
+			name: "success",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+
+			var b bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&b, nil))
+			opts := []Option{WithStorageClient(c), WithFailureLogger(logger), WithOptionalGitHubSource()}
+			if tc.failureMessenger != nil {
+				opts = append(opts, WithFailureMessenger(tc.failureMessenger))
+			}
+			h, err := NewHandler(ctx, tc.processors, &testRawMessenger{}, opts...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			if _, err := h.HandleResult(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+			}); err != nil {
+				t.Fatalf("HandleResult got unexpected error: %v", err)
+			}
+
+			if !tc.wantLogged {
+				if b.Len() > 0 {
+					t.Errorf("HandleResult got unexpected log: %s", b.String())
+				}
+				return
+			}
+
+			var got struct {
+				Level      string            `json:"level"`
+				Msg        string            `json:"msg"`
+				Event      string            `json:"event"`
+				Attributes map[string]string `json:"attributes"`
+				MessageID  string            `json:"messageId,omitempty"`
+			}
+			if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+				t.Fatalf("failed to unmarshal log %q: %v", b.String(), err)
+			}
+			if got.Level != "ERROR" || got.Msg != "failure event" {
+				t.Errorf("HandleResult got log level %q message %q, want ERROR %q", got.Level, got.Msg, "failure event")
+			}
+			if !strings.Contains(got.Event, "test-topic") {
+				t.Errorf("HandleResult got logged event %q, want the full event", got.Event)
+			}
+			if diff := cmp.Diff("failed to process object: pmap process err: user facing error", got.Attributes[AttrKeyProcessErr]); diff != "" {
+				t.Errorf("HandleResult got logged process error diff (-want, +got): %v", diff)
+			}
+			if diff := cmp.Diff(OutcomeFailure, got.Attributes[AttrKeyOutcome]); diff != "" {
+				t.Errorf("HandleResult got logged outcome diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleWithStaticAttributes(t *testing.T) {
+	t.Parallel()
+
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)
+	resourceKey := ResourceKey(&v1alpha1.Resource{
+		Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+		Provider: "gcp",
+	})
+	staticAttrs := map[string]string{
+		"deployment":      "prod",
+		AttrKeyOutcome:    "static",
+		AttrKeyProcessErr: "static",
+	}
+
+	cases := []struct {
+		name           string
+		processors     []Processor[*v1alpha1.ResourceMapping]
+		wantAttr       map[string]string
+		wantIndexAttr  map[string]string
+		wantFailureMsg bool
+	}{
+		{
+			name: "success",
+			wantAttr: map[string]string{
+				"deployment":         "prod",
+				AttrKeyOutcome:       OutcomeSuccess,
+				AttrKeyProcessErr:    "static",
+				AttrKeyBucketID:      "foo",
+				AttrKeyObjectID:      "pmap-test/gh-prefix/dir1/dir2/bar",
+				AttrKeySchemaVersion: "v1alpha1",
+				AttrKeyResourceKey:   resourceKey,
+			},
+			wantIndexAttr: staticAttrs,
+		},
+		{
+			name:       "failure",
+			processors: []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{pmaperrors.New("user facing error")}},
+			wantAttr: map[string]string{
+				"deployment":         "prod",
+				AttrKeyOutcome:       OutcomeFailure,
+				AttrKeyProcessErr:    "failed to process object: pmap process err: user facing error",
+				AttrKeyBucketID:      "foo",
+				AttrKeyObjectID:      "pmap-test/gh-prefix/dir1/dir2/bar",
+				AttrKeySchemaVersion: "v1alpha1",
+				AttrKeyResourceKey:   resourceKey,
+			},
+			wantFailureMsg: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			successMessenger := &testRawMessenger{}
+			failureMessenger := &testRawMessenger{}
+			indexMessenger := &testRawMessenger{}
+			h, err := NewHandler(ctx, tc.processors, successMessenger,
+				WithOptionalGitHubSource(),
+				WithStorageClient(c),
+				WithFailureMessenger(failureMessenger),
+				WithIndexMessenger(indexMessenger),
+				WithStaticAttributes(staticAttrs))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			if _, err := h.HandleResult(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+			}); err != nil {
+				t.Fatalf("HandleResult got unexpected error: %v", err)
+			}
+
+			gotAttr := successMessenger.gotAttr
+			if tc.wantFailureMsg {
+				gotAttr = failureMessenger.gotAttr
+			}
+			if diff := cmp.Diff(tc.wantAttr, gotAttr); diff != "" {
+				t.Errorf("HandleResult got attributes diff (-want, +got): %v", diff)
+			}
+			if diff := cmp.Diff(tc.wantIndexAttr, indexMessenger.gotAttr); diff != "" {
+				t.Errorf("HandleResult got index attributes diff (-want, +got): %v", diff)
+			}
+			if got := staticAttrs[AttrKeyOutcome]; got != "static" {
+				t.Errorf("HandleResult modified the static attributes: %v", staticAttrs)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleParseFailureObjectReference(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		objectData  []byte
+		wantProcErr string
+	}{
+		{
+			name:        "invalid_yaml",
+			objectData:  []byte(`foo`),
+			wantProcErr: "failed to unmarshal object yaml",
+		},
+		{
+			name: "unknown_field",
+			objectData: []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+unknown: field
+`),
+			wantProcErr: "failed to unmarshal object yaml",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			hc := newTestServer(t, testHandleObjectRead(t, tc.objectData))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			successMessenger := &testRawMessenger{}
+			failureMessenger := &testRawMessenger{}
+			h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{}, successMessenger,
+				WithOptionalGitHubSource(),
+				WithStorageClient(c),
+				WithFailureMessenger(failureMessenger),
+				WithClock(func() time.Time { return testEventTime }))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			result, err := h.HandleResult(ctx, pubsub.Message{
+				Attributes: map[string]string{
+					"bucketId":         "foo",
+					"objectId":         "pmap-test/gh-prefix/dir1/dir2/bar",
+					"objectGeneration": "1700000000000000",
+					"eventType":        "OBJECT_FINALIZE",
+				},
+			})
+			if err != nil {
+				t.Fatalf("HandleResult got unexpected error: %v", err)
+			}
+			if result.Outcome != OutcomeFailure {
+				t.Errorf("HandleResult got outcome %q, want %q", result.Outcome, OutcomeFailure)
+			}
+			if successMessenger.gotAttr != nil {
+				t.Errorf("HandleResult sent unexpected success event: %v", successMessenger.gotAttr)
+			}
+
+			gotAttr := failureMessenger.gotAttr
+			if diff := testutil.DiffErrString(errors.New(gotAttr[AttrKeyProcessErr]), tc.wantProcErr); diff != "" {
+				t.Error(diff)
+			}
+			delete(gotAttr, AttrKeyProcessErr)
+			wantAttr := map[string]string{
+				AttrKeyOutcome:          OutcomeFailure,
+				AttrKeyBucketID:         "foo",
+				AttrKeyObjectID:         "pmap-test/gh-prefix/dir1/dir2/bar",
+				AttrKeyObjectGeneration: "1700000000000000",
+				AttrKeySchemaVersion:    "v1alpha1",
+			}
+			if diff := cmp.Diff(wantAttr, gotAttr); diff != "" {
+				t.Errorf("HandleResult got failure attributes diff (-want, +got): %v", diff)
+			}
+			// Unparsable objects only have the type and timestamp without metadata.
+			var gotEvent v1alpha1.PmapEvent
+			if err := protojson.Unmarshal(failureMessenger.gotData, &gotEvent); err != nil {
+				t.Fatalf("failed to unmarshal failure event: %v", err)
+			}
+			wantEvent := &v1alpha1.PmapEvent{
+				Type:      "abcxyz.pmap.ResourceMapping",
+				Timestamp: timestamppb.New(testEventTime),
+			}
+			if diff := cmp.Diff(wantEvent, &gotEvent, protocmp.Transform()); diff != "" {
+				t.Errorf("HandleResult got failure event diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HttpHandlerMalformedYAML(t *testing.T) {
+	t.Parallel()
+
+	wantGitHubSource := &v1alpha1.GitHubSource{
+		RepoName:                   "test-github-repo",
+		Commit:                     "test-github-commit",
+		Workflow:                   "test-workflow",
+		WorkflowSha:                "test-workflow-sha",
+		WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, time.April, 25, 17, 44, 57, 0, time.UTC)),
+		WorkflowRunId:              "5050509831",
+		WorkflowRunAttempt:         1,
+		FilePath:                   "dir1/dir2/bar",
+	}
+
+	cases := []struct {
+		name          string
+		data          []byte
+		attributes    map[string]string
+		wantFailEvent *v1alpha1.PmapEvent
+	}{
+		{
+			name: "with_provenance",
+			data: testGCSMetadataBytes(),
+			attributes: map[string]string{
+				"bucketId":         "foo",
+				"objectId":         "pmap-test/gh-prefix/dir1/dir2/bar",
+				"objectGeneration": "1700000000000000",
+				"payloadFormat":    "JSON_API_V1",
+			},
+			wantFailEvent: &v1alpha1.PmapEvent{
+				Type:         "abcxyz.pmap.ResourceMapping",
+				Timestamp:    timestamppb.New(testEventTime),
+				GithubSource: wantGitHubSource,
+			},
+		},
+		{
+			name: "without_provenance",
+			attributes: map[string]string{
+				"bucketId":         "foo",
+				"objectId":         "pmap-test/gh-prefix/dir1/dir2/bar",
+				"objectGeneration": "1700000000000000",
+				"payloadFormat":    "NONE",
+			},
+			wantFailEvent: &v1alpha1.PmapEvent{
+				Type:      "abcxyz.pmap.ResourceMapping",
+				Timestamp: timestamppb.New(testEventTime),
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			hc := newTestServer(t, testHandleObjectRead(t, []byte("resource: [unterminated")))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			successMessenger := &testRawMessenger{}
+			failureMessenger := &testRawMessenger{}
+			h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{}},
+				successMessenger, WithOptionalGitHubSource(), WithStorageClient(c), WithFailureMessenger(failureMessenger),
+				WithClock(func() time.Time { return testEventTime }))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			body := testToJSON(t, &PubSubMessage{
+				Message: struct {
+					Data       []byte            `json:"data,omitempty"`
+					Attributes map[string]string `json:"attributes"`
+					MessageID  string            `json:"messageId,omitempty"`
+				}{
+					Data:       tc.data,
+					Attributes: tc.attributes,
+				},
+			})
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body))
+			resp := httptest.NewRecorder()
+			h.HTTPHandler().ServeHTTP(resp, req)
+
+			// The malformed object is acknowledged instead of being redelivered.
+			if got, want := resp.Code, http.StatusCreated; got != want {
+				t.Errorf("StatusCode got %d, want %d", got, want)
+			}
+			if successMessenger.gotAttr != nil {
+				t.Errorf("HTTPHandler sent unexpected success event: %v", successMessenger.gotAttr)
+			}
+
+			gotAttr := failureMessenger.gotAttr
+			if diff := testutil.DiffErrString(errors.New(gotAttr[AttrKeyProcessErr]), "failed to unmarshal object yaml"); diff != "" {
+				t.Error(diff)
+			}
+			for _, k := range []string{AttrKeyBucketID, AttrKeyObjectID, AttrKeyObjectGeneration} {
+				if got, want := gotAttr[k], tc.attributes[k]; got != want {
+					t.Errorf("failure attribute %q got %q, want %q", k, got, want)
+				}
+			}
+
+			var got v1alpha1.PmapEvent
+			if err := protojson.Unmarshal(failureMessenger.gotData, &got); err != nil {
+				t.Fatalf("failed to unmarshal failure event: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantFailEvent, &got, protocmp.Transform()); diff != "" {
+				t.Errorf("HTTPHandler got failure event diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleJoinedProcessErrors(t *testing.T) {
+	t.Parallel()
+
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+`)
+
+	cases := []struct {
+		name        string
+		processErr  error
+		wantOutcome string
+		wantErr     string
+	}{
+		{
+			name: "joined_user_facing_and_internal",
+			processErr: errors.Join(
+				pmaperrors.New("annotations violate the schema"),
+				fmt.Errorf("failed to search resources")),
+			wantOutcome: OutcomeFailure,
+		},
+		{
+			name: "joined_internal",
+			processErr: errors.Join(
+				fmt.Errorf("failed to search resources"),
+				fmt.Errorf("failed to search iam policies")),
+			wantErr: "failed to search resources\nfailed to search iam policies",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			successMessenger := &testRawMessenger{}
+			failureMessenger := &testRawMessenger{}
+			h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{returnErr: tc.processErr}},
+				successMessenger, WithOptionalGitHubSource(), WithStorageClient(c), WithFailureMessenger(failureMessenger))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			result, err := h.HandleResult(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if successMessenger.gotAttr != nil {
+				t.Errorf("HandleResult sent unexpected success event: %v", successMessenger.gotAttr)
+			}
+			if err != nil {
+				// Internal errors are retried, no failure event is sent.
+				if failureMessenger.gotAttr != nil {
+					t.Errorf("HandleResult sent unexpected failure event: %v", failureMessenger.gotAttr)
+				}
+				return
+			}
+
+			if result.Outcome != tc.wantOutcome {
+				t.Errorf("HandleResult got outcome %q, want %q", result.Outcome, tc.wantOutcome)
+			}
+			// Both the user facing and the internal errors are reported.
+			if got, want := failureMessenger.gotAttr[AttrKeyProcessErr],
+				"failed to process object: pmap process err: annotations violate the schema\nfailed to search resources"; got != want {
+				t.Errorf("failure event got process error %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleResourceAliases(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+  aliases:
+  - //pubsub.googleapis.com/projects/test-project/topics/old-topic
+  - //pubsub.googleapis.com/projects/old-project/topics/old-topic
+contacts:
+  email:
+  - pmap@example.com
+`)
+
+	hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+	c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+	if err != nil {
+		t.Fatalf("failed to creat GCS storage client %v", err)
+	}
+	successMessenger := &testRawMessenger{}
+	h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{}}, successMessenger,
+		WithOptionalGitHubSource(),
+		WithStorageClient(c))
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+
+	if err := h.Handle(ctx, pubsub.Message{
+		Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+	}); err != nil {
+		t.Fatalf("Handle got unexpected error: %v", err)
+	}
+
+	var event v1alpha1.PmapEvent
+	if err := protojson.Unmarshal(successMessenger.gotData, &event); err != nil {
+		t.Fatalf("failed to unmarshal success event: %v", err)
+	}
+	var got v1alpha1.ResourceMapping
+	if err := event.GetPayload().UnmarshalTo(&got); err != nil {
+		t.Fatalf("failed to unmarshal event payload: %v", err)
+	}
+	want := []string{
+		"//pubsub.googleapis.com/projects/test-project/topics/old-topic",
+		"//pubsub.googleapis.com/projects/old-project/topics/old-topic",
+	}
+	if diff := cmp.Diff(want, got.GetResource().GetAliases()); diff != "" {
+		t.Errorf("event got resource aliases diff (-want, +got): %v", diff)
+	}
+}
+
+func TestEventHandler_WithStorageClientOptions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)
+
+	// The handler creates its own client pointed at the fake server.
+	hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+	successMessenger := &testRawMessenger{}
+	h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{}, successMessenger,
+		WithOptionalGitHubSource(),
+		WithStorageClientOptions(option.WithHTTPClient(hc)))
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+
+	result, err := h.HandleResult(ctx, pubsub.Message{
+		Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+	})
+	if err != nil {
+		t.Fatalf("HandleResult got unexpected error: %v", err)
+	}
+	if result.Outcome != OutcomeSuccess {
+		t.Errorf("HandleResult got outcome %q, want %q", result.Outcome, OutcomeSuccess)
+	}
+
+	var got v1alpha1.ResourceMapping
+	if err := result.Event.GetPayload().UnmarshalTo(&got); err != nil {
+		t.Fatalf("failed to unmarshal event payload: %v", err)
+	}
+	if got, want := got.GetResource().GetName(), "//pubsub.googleapis.com/projects/test-project/topics/test-topic"; got != want {
+		t.Errorf("HandleResult got resource name %q, want %q", got, want)
+	}
+}
+
+func TestWithStaticAttributes(t *testing.T) {
+	t.Parallel()
+
+	if _, err := WithStaticAttributes(map[string]string{"": "value"})(context.Background(), &HandlerOpts{}); err == nil {
+		t.Errorf("WithStaticAttributes got no error for empty key")
+	}
+
+	attrs := map[string]string{"deployment": "prod"}
+	opts, err := WithStaticAttributes(attrs)(context.Background(), &HandlerOpts{})
+	if err != nil {
+		t.Fatalf("WithStaticAttributes got unexpected error: %v", err)
+	}
+	attrs["deployment"] = "dev"
+	if got := opts.staticAttributes["deployment"]; got != "prod" {
+		t.Errorf("WithStaticAttributes got attribute %q after the input changed, want %q", got, "prod")
+	}
+}
+
+func TestEventHandler_HandleWithEventTransformer(t *testing.T) {
+	t.Parallel()
+
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)
+
+	cases := []struct {
+		name          string
+		transformer   EventTransformer
+		wantSource    *v1alpha1.GitHubSource
+		wantType      string
+		wantErrSubstr string
+	}{
+		{
+			name:     "no_transformer",
+			wantType: "abcxyz.pmap.ResourceMapping",
+			wantSource: &v1alpha1.GitHubSource{
+				RepoName: "pmap",
+				FilePath: "dir1/dir2/bar",
+			},
+		},
+		{
+			name: "mutate_event",
+			transformer: func(event *v1alpha1.PmapEvent) error {
+				event.Type = "mapping"
+				event.GithubSource = nil
+				return nil
+			},
+			wantType: "mapping",
+		},
+		{
+			name: "transformer_error",
+			transformer: func(*v1alpha1.PmapEvent) error {
+				return fmt.Errorf("unsupported event")
+			},
+			wantErrSubstr: "failed to transform event: unsupported event",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			messenger := &testRawMessenger{}
+			opts := []Option{WithStorageClient(c)}
+			if tc.transformer != nil {
+				opts = append(opts, WithEventTransformer(tc.transformer))
+			}
+			h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{}, messenger, opts...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			data, err := json.Marshal(map[string]any{"metadata": map[string]string{"github-repo": "pmap"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = h.Handle(ctx, pubsub.Message{
+				Data: data,
+				Attributes: map[string]string{
+					"bucketId":      "foo",
+					"objectId":      "pmap-test/gh-prefix/dir1/dir2/bar",
+					"payloadFormat": "JSON_API_V1",
+				},
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErrSubstr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			got := &v1alpha1.PmapEvent{}
+			if err := protojson.Unmarshal(messenger.gotData, got); err != nil {
+				t.Fatalf("failed to unmarshal published event: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantSource, got.GetGithubSource(), protocmp.Transform(),
+				protocmp.IgnoreFields(&v1alpha1.GitHubSource{}, "workflow_triggered_timestamp")); diff != "" {
+				t.Errorf("published event got github source diff (-want, +got): %v", diff)
+			}
+			if got, want := got.GetType(), tc.wantType; got != want {
+				t.Errorf("published event got type %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleCloudEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)
+	hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+	c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+	if err != nil {
+		t.Fatalf("failed to creat GCS storage client %v", err)
+	}
+	h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{}, &testRawMessenger{}, WithOptionalGitHubSource(), WithStorageClient(c))
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+
+	got, err := h.HandleResult(ctx, pubsub.Message{
+		Attributes: map[string]string{
+			"bucketId":                            "foo",
+			"objectId":                            "pmap-test/gh-prefix/dir1/dir2/bar",
+			AttrKeyCloudEventsSpecVersion:         "1.0",
+			"ce-type":                             "google.cloud.storage.object.v1.finalized",
+			"ce-source":                           "//storage.googleapis.com/projects/_/buckets/foo",
+			"ce-githubcommit":                     "0123456789abcdef0123456789abcdef01234567",
+			"ce-githubrepo":                       "abcxyz/pmap",
+			"ce-githubworkflow":                   "snapshot",
+			"ce-githubworkflowsha":                "89abcdef0123456789abcdef0123456789abcdef",
+			"ce-githubworkflowtriggeredtimestamp": "2023-04-25T17:44:57+00:00",
+			"ce-githubrunid":                      "5050509831",
+			"ce-githubrunattempt":                 "2",
+		},
+	})
+	if err != nil {
+		t.Fatalf("HandleResult got unexpected error: %v", err)
+	}
+
+	want := &v1alpha1.GitHubSource{
+		RepoName:                   "abcxyz/pmap",
+		Commit:                     "0123456789abcdef0123456789abcdef01234567",
+		Workflow:                   "snapshot",
+		WorkflowSha:                "89abcdef0123456789abcdef0123456789abcdef",
+		WorkflowTriggeredTimestamp: timestamppb.New(time.Date(2023, 4, 25, 17, 44, 57, 0, time.UTC)),
+		WorkflowRunId:              "5050509831",
+		WorkflowRunAttempt:         2,
+		FilePath:                   "dir1/dir2/bar",
+		RepoOwner:                  "abcxyz",
+	}
+	if diff := cmp.Diff(want, got.Event.GetGithubSource(), protocmp.Transform()); diff != "" {
+		t.Errorf("HandleResult got github source diff (-want, +got): %v", diff)
+	}
+}
+
+func TestEventHandler_HandlePayloadFormat(t *testing.T) {
+	t.Parallel()
+
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)
+
+	cases := []struct {
+		name             string
+		payloadFormat    string
+		data             []byte
+		opts             []Option
+		wantOutcome      string
+		wantProcessErr   string
+		wantSuccessSent  bool
+		wantGitHubSource bool
+	}{
+		{
+			name:             "json_api_v1",
+			payloadFormat:    "JSON_API_V1",
+			data:             testGCSMetadataBytes(),
+			wantOutcome:      OutcomeSuccess,
+			wantSuccessSent:  true,
+			wantGitHubSource: true,
+		},
+		{
+			name:           "none_fails_by_default",
+			payloadFormat:  "NONE",
+			wantOutcome:    OutcomeFailure,
+			wantProcessErr: `pmap process err: unsupported payloadFormat "NONE"`,
+		},
+		{
+			name:           "missing_fails_by_default",
+			wantOutcome:    OutcomeFailure,
+			wantProcessErr: `pmap process err: unsupported payloadFormat ""`,
+		},
+		{
+			name:           "unknown_fails_by_default",
+			payloadFormat:  "JSON_API_V2",
+			wantOutcome:    OutcomeFailure,
+			wantProcessErr: `pmap process err: unsupported payloadFormat "JSON_API_V2"`,
+		},
+		{
+			name:            "none_optional_github_source",
+			payloadFormat:   "NONE",
+			opts:            []Option{WithOptionalGitHubSource()},
+			wantOutcome:     OutcomeSuccess,
+			wantSuccessSent: true,
+		},
+		{
+			name:            "missing_optional_github_source",
+			opts:            []Option{WithOptionalGitHubSource()},
+			wantOutcome:     OutcomeSuccess,
+			wantSuccessSent: true,
+		},
+		{
+			name:           "none_require_provenance",
+			payloadFormat:  "NONE",
+			opts:           []Option{WithRequireProvenance(), WithOptionalGitHubSource()},
+			wantOutcome:    OutcomeFailure,
+			wantProcessErr: `pmap process err: notification with payloadFormat "NONE" has no object metadata, GitHub provenance is required`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			successMessenger := &testRawMessenger{}
+			failureMessenger := &testRawMessenger{}
+			opts := append([]Option{WithStorageClient(c), WithFailureMessenger(failureMessenger)}, tc.opts...)
+			h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{}, successMessenger, opts...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			attrs := map[string]string{
+				"bucketId": "foo",
+				"objectId": "pmap-test/gh-prefix/dir1/dir2/bar",
+			}
+			if tc.payloadFormat != "" {
+				attrs["payloadFormat"] = tc.payloadFormat
+			}
+			got, err := h.HandleResult(ctx, pubsub.Message{Attributes: attrs, Data: tc.data})
+			if err != nil {
+				t.Fatalf("HandleResult got unexpected error: %v", err)
+			}
+
+			if got.Outcome != tc.wantOutcome {
+				t.Errorf("HandleResult got outcome %q, want %q", got.Outcome, tc.wantOutcome)
+			}
+			if gotSource := got.Event.GetGithubSource() != nil; gotSource != tc.wantGitHubSource {
+				t.Errorf("HandleResult got github source %t, want %t", gotSource, tc.wantGitHubSource)
+			}
+			if diff := cmp.Diff(tc.wantProcessErr, got.Attributes[AttrKeyProcessErr]); diff != "" {
+				t.Errorf("HandleResult got process error diff (-want, +got): %v", diff)
+			}
+			if gotSent := successMessenger.gotAttr != nil; gotSent != tc.wantSuccessSent {
+				t.Errorf("HandleResult sent success event %t, want %t", gotSent, tc.wantSuccessSent)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleResourceKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	mappingYAML := func(subscope string) []byte {
+		return []byte(fmt.Sprintf(`
+resource:
+  name: //storage.googleapis.com/test-bucket
+  provider: gcp
+  subscope: %s
+contacts:
+  email:
+  - pmap@example.com
+`, subscope))
+	}
+
+	gotKeys := map[string]string{}
+	for _, subscope := range []string{"parent/foo?key1=value1", "parent/bar?key1=value1"} {
+		hc := newTestServer(t, testHandleObjectRead(t, mappingYAML(subscope)))
+		c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+		if err != nil {
+			t.Fatalf("failed to creat GCS storage client %v", err)
+		}
+		h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{}, &testRawMessenger{}, WithOptionalGitHubSource(), WithStorageClient(c))
+		if err != nil {
+			t.Fatalf("failed to create event handler %v", err)
+		}
+
+		got, err := h.HandleResult(ctx, pubsub.Message{
+			Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+		})
+		if err != nil {
+			t.Fatalf("HandleResult got unexpected error: %v", err)
+		}
+		gotKeys[subscope] = got.Attributes[AttrKeyResourceKey]
+	}
+
+	if gotKeys["parent/foo?key1=value1"] == "" {
+		t.Fatalf("HandleResult got no %q attribute", AttrKeyResourceKey)
+	}
+	if gotKeys["parent/foo?key1=value1"] == gotKeys["parent/bar?key1=value1"] {
+		t.Errorf("HandleResult got the same resource key %q for distinct subscopes", gotKeys["parent/foo?key1=value1"])
+	}
+}
+
+func TestResourceKey(t *testing.T) {
+	t.Parallel()
+
+	base := &v1alpha1.Resource{Provider: "gcp", Name: "//storage.googleapis.com/test-bucket"}
+	withSubscope := func(subscope string) *v1alpha1.Resource {
+		return &v1alpha1.Resource{Provider: base.GetProvider(), Name: base.GetName(), Subscope: subscope}
+	}
+
+	cases := []struct {
+		name     string
+		r1       *v1alpha1.Resource
+		r2       *v1alpha1.Resource
+		wantSame bool
+	}{
+		{
+			name:     "same_resource",
+			r1:       base,
+			r2:       withSubscope(""),
+			wantSame: true,
+		},
+		{
+			name: "subscope_and_no_subscope",
+			r1:   base,
+			r2:   withSubscope("parent/foo"),
+		},
+		{
+			name: "distinct_subscopes",
+			r1:   withSubscope("parent/foo?key1=value1"),
+			r2:   withSubscope("parent/foo?key1=value2"),
+		},
+		{
+			name:     "qualifier_order",
+			r1:       withSubscope("parent/foo?key1=value1&key2=value2"),
+			r2:       withSubscope("parent/foo?key2=value2&key1=value1"),
+			wantSame: true,
+		},
+		{
+			name: "distinct_providers",
+			r1:   base,
+			r2:   &v1alpha1.Resource{Provider: "aws", Name: base.GetName()},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			k1, k2 := ResourceKey(tc.r1), ResourceKey(tc.r2)
+			if gotSame := k1 == k2; gotSame != tc.wantSame {
+				t.Errorf("ResourceKey(%v)=%q and ResourceKey(%v)=%q got same %t, want %t", tc.r1, k1, tc.r2, k2, gotSame, tc.wantSame)
+			}
+		})
+	}
+}
+
+func TestNotificationMetadata(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		msg     pubsub.Message
+		want    map[string]string
+		wantOK  bool
+		wantErr string
+	}{
+		{
+			name: "json_api_v1",
+			msg: pubsub.Message{
+				Data:       []byte(`{"metadata":{"github-repo":"abcxyz/pmap","custom":"value"}}`),
+				Attributes: map[string]string{"payloadFormat": "JSON_API_V1"},
+			},
+			want:   map[string]string{"github-repo": "abcxyz/pmap", "custom": "value"},
+			wantOK: true,
+		},
+		{
+			name: "invalid_json_api_v1",
+			msg: pubsub.Message{
+				Data:       []byte(`{`),
+				Attributes: map[string]string{"payloadFormat": "JSON_API_V1"},
+			},
+			wantErr: "failed to unmarshal payloadMetadata",
+		},
+		{
+			name: "cloud_events",
+			msg: pubsub.Message{
+				Attributes: map[string]string{
+					AttrKeyCloudEventsSpecVersion: "1.0",
+					"ce-githubrepo":               "abcxyz/pmap",
+					"ce-resourcescope":            "projects/test-project",
+					"ce-unknown":                  "ignored",
+				},
+			},
+			want: map[string]string{
+				MetadataKeyGitHubRepo:    "abcxyz/pmap",
+				MetadataKeyResourceScope: "projects/test-project",
+			},
+			wantOK: true,
+		},
+		{
+			name: "no_metadata_format",
+			msg: pubsub.Message{
+				Attributes: map[string]string{"payloadFormat": "NONE"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, gotOK, err := notificationMetadata(tc.msg)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("notificationMetadata got diff (-want, +got): %v", diff)
+			}
+			if gotOK != tc.wantOK {
+				t.Errorf("notificationMetadata got ok %t, want %t", gotOK, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleWithSequenceAttribute(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)
+	hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+	c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+	if err != nil {
+		t.Fatalf("failed to creat GCS storage client %v", err)
+	}
+	processor := &testMappingProcessor{}
+	h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{processor}, &testRawMessenger{},
+		WithOptionalGitHubSource(),
+		WithStorageClient(c),
+		WithFailureMessenger(&testRawMessenger{}),
+		WithSequenceAttribute())
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+
+	msg := pubsub.Message{
+		Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+	}
+
+	var got []string
+	for i := 0; i < 3; i++ {
+		// Failure events are numbered in the same sequence.
+		processor.returnErr = nil
+		if i == 1 {
+			processor.returnErr = pmaperrors.New("user facing error")
+		}
+		result, err := h.HandleResult(ctx, msg)
+		if err != nil {
+			t.Fatalf("HandleResult got unexpected error: %v", err)
+		}
+		got = append(got, result.Attributes[AttrKeySequence])
+	}
+
+	if diff := cmp.Diff([]string{"1", "2", "3"}, got); diff != "" {
+		t.Errorf("HandleResult got sequence diff (-want, +got): %v", diff)
+	}
 }
 
-type testMessenger struct {
-	gotPmapEvent *v1alpha1.PmapEvent
-	gotAttr      map[string]string
-	returnErr    error
+func TestWithObjectMetadataAttribute(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		limit   int
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			limit: 512,
+		},
+		{
+			name:    "zero_limit",
+			limit:   0,
+			wantErr: "object metadata attribute limit must be in (0, 1024]: 0",
+		},
+		{
+			name:    "over_pubsub_limit",
+			limit:   2048,
+			wantErr: "object metadata attribute limit must be in (0, 1024]: 2048",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := WithObjectMetadataAttribute(tc.limit)(context.Background(), &HandlerOpts{})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
 }
 
-func (m *testMessenger) Send(_ context.Context, data []byte, attr map[string]string) error {
-	if m == nil {
-		return nil
+func TestMarshalEvent_Deterministic(t *testing.T) {
+	t.Parallel()
+
+	// Build the same logical event twice with annotations inserted in
+	// different orders.
+	keys := []string{"location", "retention", "env", "team", "owner", "tier", "region", "cost"}
+	newEvent := func(keys []string) *v1alpha1.PmapEvent {
+		annos := &structpb.Struct{Fields: map[string]*structpb.Value{}}
+		for _, k := range keys {
+			annos.Fields[k] = structpb.NewStringValue("value-" + k)
+		}
+		payload := &anypb.Any{}
+		if err := anypb.MarshalFrom(payload, &v1alpha1.ResourceMapping{
+			Resource:    &v1alpha1.Resource{Provider: "gcp", Name: "//storage.googleapis.com/test-bucket"},
+			Annotations: annos,
+		}, proto.MarshalOptions{Deterministic: true}); err != nil {
+			t.Fatal(err)
+		}
+		return &v1alpha1.PmapEvent{Payload: payload}
 	}
 
-	// Don't record gotPmapEvent when data is nil.
-	// Also protojson.Unmarshal will return err
-	// when unmarshal an empty byte slice
-	if len(data) != 0 {
-		if err := protojson.Unmarshal(data, m.gotPmapEvent); err != nil {
-			return fmt.Errorf("failed to unmarshal to PmapEvent: %w", err)
+	reversed := slices.Clone(keys)
+	slices.Reverse(reversed)
+
+	want, err := marshalEvent(newEvent(keys), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		got, err := marshalEvent(newEvent(reversed), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want, got) {
+			t.Fatalf("marshalEvent got different bytes for the same event:\n%s\n%s", want, got)
 		}
 	}
+}
 
-	m.gotAttr = attr
+func TestMarshalEvent_KeyCasing(t *testing.T) {
+	t.Parallel()
 
-	return m.returnErr
+	event := &v1alpha1.PmapEvent{
+		GithubSource: &v1alpha1.GitHubSource{
+			RepoName:      "pmap",
+			WorkflowRunId: "100",
+		},
+	}
+
+	cases := []struct {
+		name          string
+		useProtoNames bool
+		want          string
+	}{
+		{
+			name: "camel_case",
+			want: `{"githubSource":{"repoName":"pmap","workflowRunId":"100"}}`,
+		},
+		{
+			name:          "snake_case",
+			useProtoNames: true,
+			want:          `{"github_source":{"repo_name":"pmap","workflow_run_id":"100"}}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := marshalEvent(event, tc.useProtoNames)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("marshalEvent got diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
 }
 
-func (m *testMessenger) getPmapEvent() *v1alpha1.PmapEvent {
-	return m.gotPmapEvent
+func TestParseGitHubSource_FilePath(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		objectID string
+		fallback FilePathFunc
+		want     string
+	}{
+		{
+			name:     "with_separator",
+			objectID: "foo/pmap-test/gh-prefix/dir1/dir2/bar",
+			want:     "dir1/dir2/bar",
+		},
+		{
+			name:     "with_separator_ignores_fallback",
+			objectID: "foo/pmap-test/gh-prefix/dir1/dir2/bar",
+			fallback: ObjectIDFilePath,
+			want:     "dir1/dir2/bar",
+		},
+		{
+			name:     "without_separator_no_fallback",
+			objectID: "foo/pmap-test/dir1/dir2/bar",
+			want:     "",
+		},
+		{
+			name:     "without_separator_object_id_fallback",
+			objectID: "foo/pmap-test/dir1/dir2/bar",
+			fallback: ObjectIDFilePath,
+			want:     "foo/pmap-test/dir1/dir2/bar",
+		},
+		{
+			name:     "without_separator_custom_fallback",
+			objectID: "foo/pmap-test/dir1/dir2/bar",
+			fallback: func(objectID string) string {
+				return strings.TrimPrefix(objectID, "foo/pmap-test/")
+			},
+			want: "dir1/dir2/bar",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseGitHubSource(context.Background(), nil,
+				map[string]string{"objectId": tc.objectID}, tc.fallback)
+			if err != nil {
+				t.Fatalf("ParseGitHubSource got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got.GetFilePath()); diff != "" {
+				t.Errorf("ParseGitHubSource got file path diff (-want, +got): %v", diff)
+			}
+		})
+	}
 }
 
-func (m *testMessenger) getAttr() map[string]string {
-	return m.gotAttr
+func TestParseGitHubSource_RepoOwner(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		repo      string
+		wantName  string
+		wantOwner string
+	}{
+		{
+			name:      "owner_and_repo",
+			repo:      "abcxyz/pmap",
+			wantName:  "abcxyz/pmap",
+			wantOwner: "abcxyz",
+		},
+		{
+			name:     "bare_repo",
+			repo:     "pmap",
+			wantName: "pmap",
+		},
+		{
+			name:     "empty_repo",
+			repo:     "abcxyz/",
+			wantName: "abcxyz/",
+		},
+		{
+			name:     "empty_owner",
+			repo:     "/pmap",
+			wantName: "/pmap",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseGitHubSource(context.Background(),
+				map[string]string{MetadataKeyGitHubRepo: tc.repo}, nil, nil)
+			if err != nil {
+				t.Fatalf("ParseGitHubSource got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantName, got.GetRepoName()); diff != "" {
+				t.Errorf("ParseGitHubSource got repo name diff (-want, +got): %v", diff)
+			}
+			if diff := cmp.Diff(tc.wantOwner, got.GetRepoOwner()); diff != "" {
+				t.Errorf("ParseGitHubSource got repo owner diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		msg  proto.Message
+		want string
+	}{
+		{
+			name: "v1alpha1_resource_mapping",
+			msg:  &v1alpha1.ResourceMapping{},
+			want: "v1alpha1",
+		},
+		{
+			name: "v1alpha1_pmap_event",
+			msg:  &v1alpha1.PmapEvent{},
+			want: "v1alpha1",
+		},
+		{
+			name: "unversioned_struct",
+			msg:  &structpb.Struct{},
+			want: "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := schemaVersion(tc.msg); got != tc.want {
+				t.Errorf("schemaVersion(%T) got %q, want %q", tc.msg, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleDropEmptyAnnotations(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+annotations:
+  assetInfo: {}
+  labels:
+    env: prod
+    owners: []
+  notes: []
+  tags:
+  - {}
+  - team
+  - []
+contacts:
+  email:
+  - pmap@example.com
+`)
+
+	hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+	c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+	if err != nil {
+		t.Fatalf("failed to creat GCS storage client %v", err)
+	}
+	successMessenger := &testRawMessenger{}
+	h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{}}, successMessenger,
+		WithOptionalGitHubSource(),
+		WithStorageClient(c), WithDropEmptyAnnotations())
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+
+	if err := h.Handle(ctx, pubsub.Message{
+		Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+	}); err != nil {
+		t.Fatalf("Handle got unexpected error: %v", err)
+	}
+
+	var event v1alpha1.PmapEvent
+	if err := protojson.Unmarshal(successMessenger.gotData, &event); err != nil {
+		t.Fatalf("failed to unmarshal success event: %v", err)
+	}
+	var got v1alpha1.ResourceMapping
+	if err := event.GetPayload().UnmarshalTo(&got); err != nil {
+		t.Fatalf("failed to unmarshal event payload: %v", err)
+	}
+	want := map[string]any{
+		"labels": map[string]any{"env": "prod"},
+		"tags":   []any{"team"},
+	}
+	if diff := cmp.Diff(want, got.GetAnnotations().AsMap()); diff != "" {
+		t.Errorf("event got annotations diff (-want, +got): %v", diff)
+	}
+}
+
+func TestEventHandler_HandleDualWrite(t *testing.T) {
+	t.Parallel()
+
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)
+
+	cases := []struct {
+		name             string
+		opts             []Option
+		processErr       error
+		wantSuccessKey   string
+		wantDualWriteKey string
+	}{
+		{
+			name:             "camel_case_with_snake_case_dual_write",
+			wantSuccessKey:   "githubSource",
+			wantDualWriteKey: "github_source",
+		},
+		{
+			name:             "snake_case_with_camel_case_dual_write",
+			opts:             []Option{WithProtoNames()},
+			wantSuccessKey:   "github_source",
+			wantDualWriteKey: "githubSource",
+		},
+		{
+			name:       "failure_not_dual_written",
+			processErr: pmaperrors.New("user facing error"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+			c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+			if err != nil {
+				t.Fatalf("failed to creat GCS storage client %v", err)
+			}
+			successMessenger := &testRawMessenger{}
+			dualWriteMessenger := &testRawMessenger{}
+			opts := append([]Option{
+				WithStorageClient(c),
+				WithDualWriteMessenger(dualWriteMessenger),
+			}, tc.opts...)
+			h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{returnErr: tc.processErr}},
+				successMessenger, opts...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			if err := h.Handle(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar", "payloadFormat": "JSON_API_V1"},
+				Data:       testGCSMetadataBytes(),
+			}); err != nil {
+				t.Fatalf("Handle got unexpected error: %v", err)
+			}
+
+			if tc.wantDualWriteKey == "" {
+				if dualWriteMessenger.gotData != nil {
+					t.Errorf("Handle sent unexpected dual write event: %s", dualWriteMessenger.gotData)
+				}
+				return
+			}
+
+			for _, m := range []struct {
+				name    string
+				data    []byte
+				wantKey string
+			}{
+				{name: "success", data: successMessenger.gotData, wantKey: tc.wantSuccessKey},
+				{name: "dual write", data: dualWriteMessenger.gotData, wantKey: tc.wantDualWriteKey},
+			} {
+				var got map[string]any
+				if err := json.Unmarshal(m.data, &got); err != nil {
+					t.Fatalf("failed to unmarshal %s event: %v", m.name, err)
+				}
+				if _, ok := got[m.wantKey]; !ok {
+					t.Errorf("%s event got keys %v, want %q", m.name, slices.Sorted(maps.Keys(got)), m.wantKey)
+				}
+			}
+
+			// Both casings decode to the same event.
+			var gotSuccess, gotDualWrite v1alpha1.PmapEvent
+			if err := protojson.Unmarshal(successMessenger.gotData, &gotSuccess); err != nil {
+				t.Fatalf("failed to unmarshal success event: %v", err)
+			}
+			if err := protojson.Unmarshal(dualWriteMessenger.gotData, &gotDualWrite); err != nil {
+				t.Fatalf("failed to unmarshal dual write event: %v", err)
+			}
+			if diff := cmp.Diff(&gotSuccess, &gotDualWrite, protocmp.Transform()); diff != "" {
+				t.Errorf("dual write event got diff (-success, +dual write): %v", diff)
+			}
+			if diff := cmp.Diff(successMessenger.gotAttr, dualWriteMessenger.gotAttr); diff != "" {
+				t.Errorf("dual write attributes got diff (-success, +dual write): %v", diff)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleLongProcessError(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)
+
+	hc := newTestServer(t, testHandleObjectRead(t, mappingYAML))
+	c, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
+	if err != nil {
+		t.Fatalf("failed to creat GCS storage client %v", err)
+	}
+	failureMessenger := &testRawMessenger{}
+	processErr := pmaperrors.New("%s", strings.Repeat("a", 2*MaxTopicAttrValueBytes))
+	h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{returnErr: processErr}},
+		&testRawMessenger{}, WithOptionalGitHubSource(), WithStorageClient(c), WithFailureMessenger(failureMessenger))
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+
+	if err := h.Handle(ctx, pubsub.Message{
+		Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+	}); err != nil {
+		t.Fatalf("Handle got unexpected error: %v", err)
+	}
+
+	// The process error is cut so the failure event can still be published.
+	got := failureMessenger.gotAttr[AttrKeyProcessErr]
+	if got, want := len(got), MaxTopicAttrValueBytes; got != want {
+		t.Errorf("failure event got process error attribute of %d bytes, want %d", got, want)
+	}
+	if want := "failed to process object: pmap process err: aaa"; !strings.HasPrefix(got, want) {
+		t.Errorf("failure event got process error attribute %q, want prefix %q", got, want)
+	}
 }
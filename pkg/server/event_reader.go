@@ -0,0 +1,112 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+// EventRecord is a line of a [JSON Lines] event file, it holds the data and
+// attributes a Messenger sends.
+//
+// [JSON Lines]: https://jsonlines.org
+type EventRecord struct {
+	// Data is the JSON encoded pmap event, it's null for events without data.
+	Data       json.RawMessage   `json:"data"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// MarshalEventRecord returns the JSON Lines encoded EventRecord of the given
+// data and attributes, including the trailing newline.
+func MarshalEventRecord(data []byte, attr map[string]string) ([]byte, error) {
+	rec := &EventRecord{Attributes: attr}
+	if len(data) > 0 {
+		rec.Data = data
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event record: %w", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// EventReader reads pmap events from a JSON Lines event file.
+type EventReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// NewEventReader creates a new EventReader reading from r.
+func NewEventReader(r io.Reader) *EventReader {
+	return &EventReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next event and its attributes. It returns [io.EOF] when
+// there are no more events. A corrupt trailing line without a newline, e.g.
+// left by an interrupted write, is treated as the end of the file.
+func (r *EventReader) Next() (*v1alpha1.PmapEvent, map[string]string, error) {
+	for {
+		b, err := r.r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("failed to read line %d: %w", r.line+1, err)
+		}
+		partial := errors.Is(err, io.EOF)
+		if partial && len(b) == 0 {
+			return nil, nil, io.EOF
+		}
+		r.line++
+
+		b = bytes.TrimSpace(b)
+		if len(b) == 0 {
+			if partial {
+				return nil, nil, io.EOF
+			}
+			continue
+		}
+
+		event, attr, err := parseEventRecord(b)
+		if err != nil {
+			if partial {
+				return nil, nil, io.EOF
+			}
+			return nil, nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return event, attr, nil
+	}
+}
+
+func parseEventRecord(b []byte) (*v1alpha1.PmapEvent, map[string]string, error) {
+	var rec EventRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal event record: %w", err)
+	}
+
+	event := &v1alpha1.PmapEvent{}
+	if len(rec.Data) > 0 && !bytes.Equal(rec.Data, []byte("null")) {
+		if err := protojson.Unmarshal(rec.Data, event); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal pmap event: %w", err)
+		}
+	}
+	return event, rec.Attributes, nil
+}
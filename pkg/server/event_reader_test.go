@@ -0,0 +1,144 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+type testEventRecord struct {
+	event *v1alpha1.PmapEvent
+	attr  map[string]string
+}
+
+func TestEventReader_Next(t *testing.T) {
+	t.Parallel()
+
+	payload, err := anypb.New(&v1alpha1.ResourceMapping{
+		Resource: &v1alpha1.Resource{
+			Provider: "gcp",
+			Name:     "//pubsub.googleapis.com/projects/test-project/topics/test-topic",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []*testEventRecord{
+		{
+			event: &v1alpha1.PmapEvent{
+				Payload:      payload,
+				GithubSource: &v1alpha1.GitHubSource{RepoName: "test-github-repo"},
+			},
+			attr: map[string]string{AttrKeyOutcome: OutcomeSuccess},
+		},
+		{
+			event: &v1alpha1.PmapEvent{},
+			attr: map[string]string{
+				AttrKeyOutcome:    OutcomeFailure,
+				AttrKeyProcessErr: "user facing error",
+			},
+		},
+		{
+			event: &v1alpha1.PmapEvent{Payload: payload},
+		},
+	}
+
+	var file bytes.Buffer
+	for _, r := range records {
+		var data []byte
+		// Failure events may have no data.
+		if r.event.GetPayload() != nil {
+			data, err = protojson.Marshal(r.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		b, err := MarshalEventRecord(data, r.attr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write(b)
+	}
+
+	cases := []struct {
+		name        string
+		data        []byte
+		wantRecords []*testEventRecord
+		wantErr     string
+	}{
+		{
+			name:        "round_trip",
+			data:        file.Bytes(),
+			wantRecords: records,
+		},
+		{
+			name:        "empty_lines",
+			data:        append([]byte("\n\n"), file.Bytes()...),
+			wantRecords: records,
+		},
+		{
+			name:        "partial_trailing_line",
+			data:        append(bytes.Clone(file.Bytes()), []byte(`{"data":{"payl`)...),
+			wantRecords: records,
+		},
+		{
+			name:        "corrupt_line",
+			data:        append([]byte("{\n"), file.Bytes()...),
+			wantRecords: nil,
+			wantErr:     "line 1: failed to unmarshal event record",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewEventReader(bytes.NewReader(tc.data))
+			var got []*testEventRecord
+			var gotErr error
+			for {
+				event, attr, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					gotErr = err
+					break
+				}
+				got = append(got, &testEventRecord{event: event, attr: attr})
+			}
+
+			if diff := testutil.DiffErrString(gotErr, tc.wantErr); diff != "" {
+				t.Errorf("Next() got unexpected error: %s", diff)
+			}
+			if diff := cmp.Diff(tc.wantRecords, got,
+				cmp.AllowUnexported(testEventRecord{}), protocmp.Transform()); diff != "" {
+				t.Errorf("Next() got diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
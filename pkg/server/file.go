@@ -0,0 +1,85 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileMessenger implements the Messenger interface by appending each event
+// as an [EventRecord] line to a writer, e.g. a local file to observe the
+// events without Pub/Sub. The file can be read back with [EventReader]. It's
+// safe for concurrent use.
+type FileMessenger struct {
+	mu sync.Mutex
+	w  io.Writer
+	// f is the file opened by OpenFileMessenger, it's nil for writers.
+	f *os.File
+}
+
+// NewFileMessenger creates a new instance of the FileMessenger writing to w.
+func NewFileMessenger(w io.Writer) *FileMessenger {
+	return &FileMessenger{w: w}
+}
+
+// NewStdoutMessenger creates a new instance of the FileMessenger writing to
+// stdout, to be collected by a logging agent.
+func NewStdoutMessenger() *FileMessenger {
+	return NewFileMessenger(os.Stdout)
+}
+
+// OpenFileMessenger creates a new instance of the FileMessenger appending to
+// the file at path, which is created if it doesn't exist. The file must be
+// closed with [FileMessenger.Close].
+func OpenFileMessenger(path string) (*FileMessenger, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event file: %w", err)
+	}
+	return &FileMessenger{w: f, f: f}, nil
+}
+
+// Send appends the event with its attributes as a single line. The event data
+// must be JSON.
+func (m *FileMessenger) Send(_ context.Context, data []byte, attr map[string]string) error {
+	b, err := MarshalEventRecord(data, attr)
+	if err != nil {
+		return err
+	}
+
+	// Write the line with one call so concurrent events aren't interleaved.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.w.Write(b); err != nil {
+		return fmt.Errorf("failed to write event record: %w", err)
+	}
+	return nil
+}
+
+// Close closes the file opened by [OpenFileMessenger], it's a no-op for the
+// messengers created with a writer.
+func (m *FileMessenger) Close() error {
+	if m.f == nil {
+		return nil
+	}
+	if err := m.f.Close(); err != nil {
+		return fmt.Errorf("failed to close event file: %w", err)
+	}
+	return nil
+}
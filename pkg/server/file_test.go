@@ -0,0 +1,174 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+func TestFileMessenger_Send(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var buf bytes.Buffer
+	m := NewFileMessenger(&buf)
+
+	if err := m.Send(ctx, []byte(`{"type": "abcxyz.pmap.ResourceMapping",
+"githubSource": {"repoName": "foo/bar"}}`), map[string]string{AttrKeyOutcome: OutcomeSuccess, "trace": "123"}); err != nil {
+		t.Fatalf("Send got unexpected error: %v", err)
+	}
+	if err := m.Send(ctx, nil, map[string]string{AttrKeyOutcome: OutcomeFailure}); err != nil {
+		t.Fatalf("Send got unexpected error: %v", err)
+	}
+
+	want := `{"data":{"type":"abcxyz.pmap.ResourceMapping","githubSource":{"repoName":"foo/bar"}},"attributes":{"pmapOutcome":"success","trace":"123"}}` + "\n" +
+		`{"data":null,"attributes":{"pmapOutcome":"failure"}}` + "\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("output (-want, +got):\n%s", diff)
+	}
+}
+
+func TestFileMessenger_SendInvalidJSON(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	m := NewFileMessenger(&buf)
+
+	err := m.Send(context.Background(), []byte(`not json`), nil)
+	if diff := testutil.DiffErrString(err, "failed to marshal event record"); diff != "" {
+		t.Error(diff)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got unexpected output %q", buf.String())
+	}
+}
+
+func TestFileMessenger_SendConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const n = 50
+	var buf bytes.Buffer
+	m := NewFileMessenger(&buf)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data := []byte(fmt.Sprintf(`{"n":%d}`, i))
+			if err := m.Send(context.Background(), data, map[string]string{"n": fmt.Sprint(i)}); err != nil {
+				t.Errorf("Send got unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if got := len(lines); got != n {
+		t.Fatalf("got %d lines, want %d", got, n)
+	}
+	seen := make(map[int]bool, n)
+	for _, l := range lines {
+		var rec struct {
+			Data struct {
+				N int `json:"n"`
+			} `json:"data"`
+			Attributes map[string]string `json:"attributes"`
+		}
+		if err := json.Unmarshal([]byte(l), &rec); err != nil {
+			t.Fatalf("line %q is not JSON: %v", l, err)
+		}
+		if got, want := rec.Attributes["n"], fmt.Sprint(rec.Data.N); got != want {
+			t.Errorf("line %q got attribute n %q, want %q", l, got, want)
+		}
+		seen[rec.Data.N] = true
+	}
+	if got := len(seen); got != n {
+		t.Errorf("got %d distinct events, want %d", got, n)
+	}
+}
+
+func TestOpenFileMessenger(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	attrs := []map[string]string{
+		{AttrKeyOutcome: OutcomeSuccess, AttrKeyObjectID: "dir/foo.yaml"},
+		{AttrKeyOutcome: OutcomeFailure, AttrKeyProcessErr: "pmap process err: \"quoted\"\nnewline"},
+	}
+	// Events are appended to the existing file.
+	for _, attr := range attrs {
+		m, err := OpenFileMessenger(path)
+		if err != nil {
+			t.Fatalf("OpenFileMessenger got unexpected error: %v", err)
+		}
+		if err := m.Send(ctx, []byte(`{"type":"abcxyz.pmap.ResourceMapping"}`), attr); err != nil {
+			t.Fatalf("Send got unexpected error: %v", err)
+		}
+		if err := m.Close(); err != nil {
+			t.Fatalf("Close got unexpected error: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	r := NewEventReader(f)
+	for i, want := range attrs {
+		event, gotAttr, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next got unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(&v1alpha1.PmapEvent{Type: "abcxyz.pmap.ResourceMapping"}, event, protocmp.Transform()); diff != "" {
+			t.Errorf("event %d (-want, +got):\n%s", i, diff)
+		}
+		if diff := cmp.Diff(want, gotAttr); diff != "" {
+			t.Errorf("attributes %d (-want, +got):\n%s", i, diff)
+		}
+	}
+	if _, _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Next got %v, want io.EOF", err)
+	}
+}
+
+func TestOpenFileMessenger_Error(t *testing.T) {
+	t.Parallel()
+
+	_, err := OpenFileMessenger(filepath.Join(t.TempDir(), "missing", "events.jsonl"))
+	if diff := testutil.DiffErrString(err, "failed to open event file"); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// HealthzPath is the path of the readiness endpoint of
+// [EventHandler.HTTPHandler]. It responds 200 when the handler is ready to
+// handle events and 503 otherwise, it's not rate limited nor verified.
+const HealthzPath = "/healthz"
+
+// ready returns an error when the handler can't handle events, i.e. it has no
+// object store or any readiness check fails.
+func (h *EventHandler[T, P]) ready(ctx context.Context) error {
+	if h.store == nil {
+		return fmt.Errorf("object store is not set")
+	}
+	var merr error
+	for _, check := range h.readinessChecks {
+		if err := check(ctx); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("readiness check failed: %w", err))
+		}
+	}
+	return merr
+}
+
+// healthzHandler serves [HealthzPath].
+func (h *EventHandler[T, P]) healthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if err := h.ready(ctx); err != nil {
+			logging.FromContext(ctx).WarnContext(ctx, "handler is not ready",
+				"error", err,
+				"code", http.StatusServiceUnavailable)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "OK")
+	})
+}
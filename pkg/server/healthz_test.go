@@ -0,0 +1,119 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestEventHandler_Healthz(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		opts     []Option
+		nilStore bool
+		requests int
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "healthy",
+			wantCode: http.StatusOK,
+			wantBody: "OK",
+		},
+		{
+			name: "readiness_checks_pass",
+			opts: []Option{
+				WithReadinessCheck(func(context.Context) error { return nil }),
+				WithReadinessCheck(func(context.Context) error { return nil }),
+			},
+			wantCode: http.StatusOK,
+			wantBody: "OK",
+		},
+		{
+			name: "readiness_checks_fail",
+			opts: []Option{
+				WithReadinessCheck(func(context.Context) error { return fmt.Errorf("bigquery unreachable") }),
+				WithReadinessCheck(func(context.Context) error { return nil }),
+				WithReadinessCheck(func(context.Context) error { return fmt.Errorf("topic not found") }),
+			},
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "readiness check failed: bigquery unreachable\nreadiness check failed: topic not found",
+		},
+		{
+			name:     "no_object_store",
+			nilStore: true,
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "object store is not set",
+		},
+		{
+			name:     "not_rate_limited",
+			opts:     []Option{WithRateLimit(1, 1)},
+			requests: 3,
+			wantCode: http.StatusOK,
+			wantBody: "OK",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := append([]Option{WithObjectStore(&testObjectStore{})}, tc.opts...)
+			h, err := NewHandler(context.Background(), []Processor[*structpb.Struct]{}, &testRawMessenger{}, opts...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+			if tc.nilStore {
+				h.store = nil
+			}
+			handler := h.HTTPHandler()
+
+			requests := max(tc.requests, 1)
+			for i := 0; i < requests; i++ {
+				resp := httptest.NewRecorder()
+				handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, HealthzPath, nil))
+
+				if got, want := resp.Code, tc.wantCode; got != want {
+					t.Errorf("request %d got code %d, want %d", i, got, want)
+				}
+				if got, want := strings.TrimSpace(resp.Body.String()), tc.wantBody; got != want {
+					t.Errorf("request %d got body %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithReadinessCheck(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHandler(context.Background(), []Processor[*structpb.Struct]{}, &testRawMessenger{},
+		WithOptionalGitHubSource(),
+		WithObjectStore(&testObjectStore{}), WithReadinessCheck(nil))
+	if diff := testutil.DiffErrString(err, "readiness check cannot be nil"); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+// IndexEvent is a trimmed pmap event for consumers that only need to index
+// the processed objects, e.g. a catalog, without the full payload.
+type IndexEvent struct {
+	// ResourceName is the name of the resource the payload describes. It's
+	// empty for payloads that don't describe a resource, e.g. policies.
+	ResourceName string `json:"resourceName,omitempty"`
+	// Type is the full name of the payload proto message.
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	ObjectID  string    `json:"objectId"`
+}
+
+// resourceGetter is implemented by payloads that describe a resource such as
+// [v1alpha1.ResourceMapping].
+type resourceGetter interface {
+	GetResource() *v1alpha1.Resource
+}
+
+// ResourceKey returns the deduplication key of the resource, which is the hex
+// encoded SHA-256 of its provider, name and normalized subscope. Resources
+// which only differ in the subscope get distinct keys, while the qualifier
+// order of the subscope doesn't matter. An invalid subscope is used as is.
+func ResourceKey(r *v1alpha1.Resource) string {
+	subscope, err := v1alpha1.NormalizeSubscope(r.GetSubscope())
+	if err != nil {
+		subscope = r.GetSubscope()
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{r.GetProvider(), r.GetName(), subscope}, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// eventResourceKey returns the [ResourceKey] of the event payload, it's empty
+// for payloads that don't describe a resource.
+func eventResourceKey(event *v1alpha1.PmapEvent) (string, error) {
+	payload, err := event.GetPayload().UnmarshalNew()
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal event payload: %w", err)
+	}
+	r, ok := payload.(resourceGetter)
+	if !ok || r.GetResource() == nil {
+		return "", nil
+	}
+	return ResourceKey(r.GetResource()), nil
+}
+
+// newIndexEventBytes builds the JSON encoded index event of the given pmap
+// event, with the same type and timestamp.
+func newIndexEventBytes(event *v1alpha1.PmapEvent, objAttrs map[string]string) ([]byte, error) {
+	ie := &IndexEvent{
+		Type:      event.GetType(),
+		Timestamp: event.GetTimestamp().AsTime(),
+		ObjectID:  objAttrs[AttrKeyObjectID],
+	}
+
+	payload, err := event.GetPayload().UnmarshalNew()
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event payload: %w", err)
+	}
+	if r, ok := payload.(resourceGetter); ok {
+		ie.ResourceName = r.GetResource().GetName()
+	}
+
+	b, err := json.Marshal(ie)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal index event: %w", err)
+	}
+	return b, nil
+}
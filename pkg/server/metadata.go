@@ -0,0 +1,83 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// objectMetadataKey is the context key for the GCS object custom metadata.
+type objectMetadataKey struct{}
+
+// WithObjectMetadata returns a copy of the context with the given GCS object
+// custom metadata attached. The handler uses it to pass the object metadata
+// to processors.
+func WithObjectMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	return context.WithValue(ctx, objectMetadataKey{}, metadata)
+}
+
+// ObjectMetadataFromContext returns the GCS object custom metadata attached to
+// the context, or nil if there is none.
+func ObjectMetadataFromContext(ctx context.Context) map[string]string {
+	if v, ok := ctx.Value(objectMetadataKey{}).(map[string]string); ok {
+		return v
+	}
+	return nil
+}
+
+// objectUpdateTimeKey is the context key for the GCS object update time.
+type objectUpdateTimeKey struct{}
+
+// AttrKeyEventTime is the GCS notification attribute key for the time the
+// object changed, see
+// https://cloud.google.com/storage/docs/pubsub-notifications#attributes.
+const AttrKeyEventTime = "eventTime"
+
+// WithObjectUpdateTime returns a copy of the context with the given GCS object
+// update time attached. The handler uses it to pass the update time to
+// processors.
+func WithObjectUpdateTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, objectUpdateTimeKey{}, t)
+}
+
+// ObjectUpdateTimeFromContext returns the GCS object update time attached to
+// the context, ok is false if there is none.
+func ObjectUpdateTimeFromContext(ctx context.Context) (t time.Time, ok bool) {
+	t, ok = ctx.Value(objectUpdateTimeKey{}).(time.Time)
+	return t, ok
+}
+
+// notificationUpdateTime returns the time the object was updated, which is
+// the "updated" time of the JSON_API_V1 payload, or the "eventTime" attribute
+// for notifications without the payload. ok is false if neither is set or
+// valid.
+func notificationUpdateTime(m pubsub.Message) (t time.Time, ok bool) {
+	if m.Attributes["payloadFormat"] == "JSON_API_V1" {
+		if pm, err := parseNotificationPayload(m.Data); err == nil && pm.Updated != "" {
+			if t, err := time.Parse(time.RFC3339Nano, pm.Updated); err == nil {
+				return t, true
+			}
+		}
+	}
+	if v := m.Attributes[AttrKeyEventTime]; v != "" {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MetricsRecorder records the metrics of the handled notifications, e.g. to
+// export them to Prometheus or Cloud Monitoring. The eventType is the GCS
+// notification event type, e.g. [EventTypeObjectFinalize], which is empty
+// for notifications without one. Implementations must be safe for concurrent
+// use.
+type MetricsRecorder interface {
+	// IncProcessed counts a handled notification, success is false when the
+	// event was sent to the failure messenger or the handling failed.
+	IncProcessed(eventType string, success bool)
+
+	// ObserveLatency records the time it took to handle a notification.
+	ObserveLatency(eventType string, d time.Duration)
+}
+
+// NoopMetricsRecorder is a no-op implementation of MetricsRecorder interface.
+type NoopMetricsRecorder struct{}
+
+// IncProcessed implements [MetricsRecorder].
+func (r *NoopMetricsRecorder) IncProcessed(_ string, _ bool) {}
+
+// ObserveLatency implements [MetricsRecorder].
+func (r *NoopMetricsRecorder) ObserveLatency(_ string, _ time.Duration) {}
+
+// MemoryMetricsRecorder is an in-memory [MetricsRecorder] counting the
+// handled notifications, e.g. for tests.
+type MemoryMetricsRecorder struct {
+	mu        sync.Mutex
+	succeeded map[string]int
+	failed    map[string]int
+	latencies map[string][]time.Duration
+}
+
+// NewMemoryMetricsRecorder creates an empty [MemoryMetricsRecorder].
+func NewMemoryMetricsRecorder() *MemoryMetricsRecorder {
+	return &MemoryMetricsRecorder{
+		succeeded: make(map[string]int),
+		failed:    make(map[string]int),
+		latencies: make(map[string][]time.Duration),
+	}
+}
+
+// IncProcessed implements [MetricsRecorder].
+func (r *MemoryMetricsRecorder) IncProcessed(eventType string, success bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if success {
+		r.succeeded[eventType]++
+	} else {
+		r.failed[eventType]++
+	}
+}
+
+// ObserveLatency implements [MetricsRecorder].
+func (r *MemoryMetricsRecorder) ObserveLatency(eventType string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.latencies[eventType] = append(r.latencies[eventType], d)
+}
+
+// Processed returns the number of succeeded and failed notifications of the
+// event type.
+func (r *MemoryMetricsRecorder) Processed(eventType string) (succeeded, failed int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.succeeded[eventType], r.failed[eventType]
+}
+
+// Latencies returns the recorded latencies of the event type in order.
+func (r *MemoryMetricsRecorder) Latencies(eventType string) []time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]time.Duration(nil), r.latencies[eventType]...)
+}
+
+// WithMetrics returns an option to record the metrics of the handled
+// notifications with the recorder. The skipped notifications, e.g. the
+// duplicates, are not recorded. Metrics are not recorded by default.
+func WithMetrics(r MetricsRecorder) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if r == nil {
+			return nil, fmt.Errorf("metrics recorder cannot be nil")
+		}
+		opts.metrics = r
+		return opts, nil
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+)
+
+func TestEventHandler_HandleMetrics(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		eventType     string
+		processErr    error
+		messageIDs    []string
+		wantErr       string
+		wantSucceeded int
+		wantFailed    int
+	}{
+		{
+			name:          "success",
+			eventType:     EventTypeObjectFinalize,
+			messageIDs:    []string{"1"},
+			wantSucceeded: 1,
+		},
+		{
+			name:       "user_facing_failure",
+			eventType:  EventTypeObjectFinalize,
+			processErr: pmaperrors.New("invalid contacts"),
+			messageIDs: []string{"1"},
+			wantFailed: 1,
+		},
+		{
+			name:       "internal_failure",
+			eventType:  EventTypeObjectFinalize,
+			processErr: fmt.Errorf("unavailable"),
+			messageIDs: []string{"1"},
+			wantErr:    "unavailable",
+			wantFailed: 1,
+		},
+		{
+			name:          "no_event_type",
+			messageIDs:    []string{"1"},
+			wantSucceeded: 1,
+		},
+		{
+			name:          "duplicates_not_recorded",
+			eventType:     EventTypeObjectFinalize,
+			messageIDs:    []string{"1", "1", "2"},
+			wantSucceeded: 2,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			metrics := NewMemoryMetricsRecorder()
+			h, err := NewHandler(ctx, []Processor[*structpb.Struct]{&testProcessor{returnErr: tc.processErr}}, &testRawMessenger{},
+				WithObjectStore(&testObjectStore{data: map[string][]byte{"foo/bar": []byte("foo: bar")}}),
+				WithOptionalGitHubSource(),
+				WithDedupCache(&fakeSeenCache{seen: map[string]bool{}}),
+				WithMetrics(metrics))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			attrs := map[string]string{"bucketId": "foo", "objectId": "bar"}
+			if tc.eventType != "" {
+				attrs[AttrKeyEventType] = tc.eventType
+			}
+			for _, id := range tc.messageIDs {
+				err := h.Handle(ctx, pubsub.Message{ID: id, Attributes: attrs})
+				if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+					t.Error(diff)
+				}
+			}
+
+			succeeded, failed := metrics.Processed(tc.eventType)
+			if succeeded != tc.wantSucceeded || failed != tc.wantFailed {
+				t.Errorf("got %d succeeded and %d failed, want %d and %d", succeeded, failed, tc.wantSucceeded, tc.wantFailed)
+			}
+			if got, want := len(metrics.Latencies(tc.eventType)), tc.wantSucceeded+tc.wantFailed; got != want {
+				t.Errorf("got %d latencies, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHandler(context.Background(), []Processor[*structpb.Struct]{}, &testRawMessenger{},
+		WithObjectStore(&testObjectStore{}), WithMetrics(nil))
+	if diff := testutil.DiffErrString(err, "metrics recorder cannot be nil"); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+)
+
+// payloadLockKey is the context key of the payload lock.
+type payloadLockKey struct{}
+
+// noopLocker is the payload lock of processors run sequentially.
+type noopLocker struct{}
+
+func (noopLocker) Lock()   {}
+func (noopLocker) Unlock() {}
+
+// errDependencyFailed is the result of processors skipped because a
+// processor they depend on failed.
+var errDependencyFailed = errors.New("dependency failed")
+
+// PayloadLock returns the lock processors must hold while reading or writing
+// the payload when they're run with [WithConcurrentProcessors], since all of
+// them share the same payload. It's a no-op lock when the processors are run
+// sequentially. The lock doesn't order the processors, which is done with
+// [DependentProcessor] and [OrderedProcessor].
+func PayloadLock(ctx context.Context) sync.Locker {
+	if l, ok := ctx.Value(payloadLockKey{}).(sync.Locker); ok {
+		return l
+	}
+	return noopLocker{}
+}
+
+// runProcessors runs the processors on the payload. They're run in order and
+// the first error stops the run, unless the processor concurrency is above 1.
+func (h *EventHandler[T, P]) runProcessors(ctx context.Context, p P) error {
+	if h.processorConcurrency <= 1 {
+		for _, processor := range h.processors {
+			if err := processor.Process(ctx, p); err != nil {
+				return err //nolint:wrapcheck // Wrapped by the caller.
+			}
+		}
+		return nil
+	}
+	return runConcurrentProcessors(ctx, h.processors, p, h.processorConcurrency)
+}
+
+// runConcurrentProcessors runs up to n processors at once on the shared
+// payload. A processor starts once the processors it depends on or runs after
+// succeeded, and is skipped when any of them failed. All the other processors run to
+// completion, so the returned error doesn't depend on the timing: it's the
+// first user facing error in processor order, or the first error when none
+// is user facing.
+func runConcurrentProcessors[P proto.Message](ctx context.Context, ps []Processor[P], p P, n int) error {
+	ctx = context.WithValue(ctx, payloadLockKey{}, &sync.Mutex{})
+
+	// The dependencies are placed before their dependents, which is checked
+	// when the handler is created, so waiting on them can't deadlock.
+	positions := make(map[string]int, len(ps))
+	for i, processor := range ps {
+		positions[processorName(processor)] = i
+	}
+
+	done := make([]chan struct{}, len(ps))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	errs := make([]error, len(ps))
+	sem := make(chan struct{}, n)
+
+	var wg sync.WaitGroup
+	for i, processor := range ps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+
+			for _, j := range processorDependencies(processor, positions) {
+				<-done[j]
+				if errs[j] != nil {
+					errs[i] = errDependencyFailed
+					return
+				}
+			}
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = processor.Process(ctx, p)
+		}()
+	}
+	wg.Wait()
+
+	var firstErr error
+	for _, err := range errs {
+		if err == nil || errors.Is(err, errDependencyFailed) {
+			continue
+		}
+		if pmaperrors.Is(err) {
+			return err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// processorDependencies returns the positions of the processors the processor
+// must wait for: the ones it depends on, and the configured ones it runs after.
+func processorDependencies(processor any, positions map[string]int) []int {
+	var deps []int
+	if d, ok := processor.(DependentProcessor); ok {
+		for _, dep := range d.DependsOn() {
+			deps = append(deps, positions[dep])
+		}
+	}
+	if o, ok := processor.(OrderedProcessor); ok {
+		for _, prev := range o.RunsAfter() {
+			if j, found := positions[prev]; found {
+				deps = append(deps, j)
+			}
+		}
+	}
+	return deps
+}
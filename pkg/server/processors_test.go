@@ -0,0 +1,360 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+)
+
+// testConcurrentProcessor sets its name in the payload after the delay,
+// holding the payload lock. It fails instead when returnErr is set, and when
+// a processor it depends on or runs after hasn't set its name.
+type testConcurrentProcessor struct {
+	name      string
+	deps      []string
+	after     []string
+	delay     time.Duration
+	returnErr error
+
+	// started, when set, is waited on before the processor finishes, so the
+	// processors sharing it must run at once.
+	started *sync.WaitGroup
+
+	// gotPayload is the payload the processor was run with.
+	gotPayload *structpb.Struct
+}
+
+func (p *testConcurrentProcessor) Process(ctx context.Context, m *structpb.Struct) error {
+	p.gotPayload = m
+	if p.started != nil {
+		p.started.Done()
+		waited := make(chan struct{})
+		go func() {
+			p.started.Wait()
+			close(waited)
+		}()
+		select {
+		case <-waited:
+		case <-time.After(5 * time.Second):
+			return fmt.Errorf("processor %s timed out waiting for the others to start", p.name)
+		}
+	}
+	time.Sleep(p.delay)
+	if p.returnErr != nil {
+		return p.returnErr
+	}
+
+	l := PayloadLock(ctx)
+	l.Lock()
+	defer l.Unlock()
+	for _, dep := range slices.Concat(p.deps, p.after) {
+		if _, ok := m.GetFields()[dep]; !ok {
+			return fmt.Errorf("processor %s ran before its dependency %s", p.name, dep)
+		}
+	}
+	m.Fields[p.name] = structpb.NewBoolValue(true)
+	return nil
+}
+
+func (p *testConcurrentProcessor) Name() string {
+	return p.name
+}
+
+func (p *testConcurrentProcessor) DependsOn() []string {
+	return p.deps
+}
+
+func (p *testConcurrentProcessor) RunsAfter() []string {
+	return p.after
+}
+
+func TestRunConcurrentProcessors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		processors []*testConcurrentProcessor
+		wantErr    string
+		wantFields []string
+	}{
+		{
+			name: "all_succeed",
+			processors: []*testConcurrentProcessor{
+				{name: "a", delay: 30 * time.Millisecond},
+				{name: "b", delay: 10 * time.Millisecond},
+				{name: "c"},
+			},
+			wantFields: []string{"a", "b", "c"},
+		},
+		{
+			name: "user_facing_error_over_internal_error",
+			processors: []*testConcurrentProcessor{
+				{name: "a", delay: 20 * time.Millisecond, returnErr: fmt.Errorf("a failed")},
+				{name: "b", returnErr: pmaperrors.New("b failed")},
+				{name: "c"},
+			},
+			wantErr:    "pmap process err: b failed",
+			wantFields: []string{"c"},
+		},
+		{
+			name: "first_user_facing_error_in_order",
+			processors: []*testConcurrentProcessor{
+				{name: "a", delay: 20 * time.Millisecond, returnErr: pmaperrors.New("a failed")},
+				{name: "b", returnErr: pmaperrors.New("b failed")},
+			},
+			wantErr: "pmap process err: a failed",
+		},
+		{
+			name: "first_internal_error_in_order",
+			processors: []*testConcurrentProcessor{
+				{name: "a", delay: 20 * time.Millisecond, returnErr: fmt.Errorf("a failed")},
+				{name: "b", returnErr: fmt.Errorf("b failed")},
+			},
+			wantErr: "a failed",
+		},
+		{
+			name: "dependency_runs_first",
+			processors: []*testConcurrentProcessor{
+				{name: "a", delay: 20 * time.Millisecond},
+				{name: "b", deps: []string{"a"}},
+				{name: "c", deps: []string{"a", "b"}},
+			},
+			wantFields: []string{"a", "b", "c"},
+		},
+		{
+			name: "runs_after_configured_processor",
+			processors: []*testConcurrentProcessor{
+				{name: "a", delay: 20 * time.Millisecond},
+				{name: "b", after: []string{"a"}},
+			},
+			wantFields: []string{"a", "b"},
+		},
+		{
+			name: "dependent_skipped_on_dependency_failure",
+			processors: []*testConcurrentProcessor{
+				{name: "a", delay: 20 * time.Millisecond, returnErr: pmaperrors.New("a failed")},
+				{name: "b", deps: []string{"a"}},
+				{name: "c"},
+			},
+			wantErr:    "pmap process err: a failed",
+			wantFields: []string{"c"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ps := make([]Processor[*structpb.Struct], 0, len(tc.processors))
+			for _, p := range tc.processors {
+				ps = append(ps, p)
+			}
+			payload := &structpb.Struct{Fields: map[string]*structpb.Value{}}
+
+			err := runConcurrentProcessors(context.Background(), ps, payload, 2)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(tc.wantFields, slices.Sorted(maps.Keys(payload.GetFields()))); diff != "" {
+				t.Errorf("payload fields got diff (-want, +got):\n%s", diff)
+			}
+			for _, p := range tc.processors {
+				if p.gotPayload != nil && p.gotPayload != payload {
+					t.Errorf("processor %s got payload %p, want %p", p.name, p.gotPayload, payload)
+				}
+			}
+		})
+	}
+}
+
+// Ensure up to n processors are run at once.
+func TestRunConcurrentProcessors_Parallelism(t *testing.T) {
+	t.Parallel()
+
+	var started sync.WaitGroup
+	started.Add(3)
+	ps := []Processor[*structpb.Struct]{
+		&testConcurrentProcessor{name: "a", started: &started},
+		&testConcurrentProcessor{name: "b", started: &started},
+		&testConcurrentProcessor{name: "c", started: &started},
+	}
+	payload := &structpb.Struct{Fields: map[string]*structpb.Value{}}
+
+	if err := runConcurrentProcessors(context.Background(), ps, payload, 3); err != nil {
+		t.Fatalf("runConcurrentProcessors got unexpected error: %v", err)
+	}
+	if got, want := len(payload.GetFields()), 3; got != want {
+		t.Errorf("payload got %d fields, want %d", got, want)
+	}
+}
+
+func TestEventHandler_ConcurrentProcessors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		opts       []Option
+		wantErr    string
+		wantFields []string
+	}{
+		{
+			name:       "sequential_stops_at_first_error",
+			wantFields: []string{"foo"},
+		},
+		{
+			name:       "single_processor_at_once_stops_at_first_error",
+			opts:       []Option{WithConcurrentProcessors(1)},
+			wantFields: []string{"foo"},
+		},
+		{
+			name:       "concurrent_runs_all_processors",
+			opts:       []Option{WithConcurrentProcessors(2)},
+			wantFields: []string{"b", "foo"},
+		},
+		{
+			name:    "invalid_concurrency",
+			opts:    []Option{WithConcurrentProcessors(0)},
+			wantErr: "processor concurrency must be positive: 0",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			ps := []Processor[*structpb.Struct]{
+				&testConcurrentProcessor{name: "a", returnErr: pmaperrors.New("a failed")},
+				&testConcurrentProcessor{name: "b"},
+			}
+			store := &testObjectStore{data: map[string][]byte{"foo/bar": []byte("foo: bar")}}
+			opts := append([]Option{WithObjectStore(store), WithOptionalGitHubSource()}, tc.opts...)
+			h, err := NewHandler(ctx, ps, &testRawMessenger{}, opts...)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			result, err := h.HandleResult(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "bar"},
+			})
+			if err != nil {
+				t.Fatalf("HandleResult got unexpected error: %v", err)
+			}
+			if result.Outcome != OutcomeFailure {
+				t.Errorf("HandleResult got outcome %q, want %q", result.Outcome, OutcomeFailure)
+			}
+
+			got := &structpb.Struct{}
+			if err := result.Event.GetPayload().UnmarshalTo(got); err != nil {
+				t.Fatalf("failed to unmarshal event payload: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantFields, slices.Sorted(maps.Keys(got.GetFields()))); diff != "" {
+				t.Errorf("payload fields got diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// testStoppableProcessor counts its Stop calls and returns stopErr from them.
+type testStoppableProcessor struct {
+	name    string
+	stopErr error
+	stops   int
+}
+
+func (p *testStoppableProcessor) Process(context.Context, *structpb.Struct) error {
+	return nil
+}
+
+func (p *testStoppableProcessor) Name() string {
+	return p.name
+}
+
+func (p *testStoppableProcessor) Stop() error {
+	p.stops++
+	return p.stopErr
+}
+
+func TestEventHandler_Cleanup(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		stoppables []*testStoppableProcessor
+		wantErr    string
+	}{
+		{
+			name: "no_stoppable_processors",
+		},
+		{
+			name: "stops_all",
+			stoppables: []*testStoppableProcessor{
+				{name: "a"},
+				{name: "b"},
+			},
+		},
+		{
+			name: "joins_errors",
+			stoppables: []*testStoppableProcessor{
+				{name: "a", stopErr: fmt.Errorf("a stop failed")},
+				{name: "b"},
+				{name: "c", stopErr: fmt.Errorf("c stop failed")},
+			},
+			wantErr: "failed to stop processor \"a\": a stop failed\nfailed to stop processor \"c\": c stop failed",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Processors which aren't stoppable are skipped.
+			ps := []Processor[*structpb.Struct]{&testProcessor{}}
+			for _, p := range tc.stoppables {
+				ps = append(ps, p)
+			}
+			h, err := NewHandler(context.Background(), ps, &testRawMessenger{}, WithOptionalGitHubSource(), WithObjectStore(&testObjectStore{}))
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			err = h.Cleanup()
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			for _, p := range tc.stoppables {
+				if got, want := p.stops, 1; got != want {
+					t.Errorf("processor %s got %d Stop calls, want %d", p.name, got, want)
+				}
+			}
+		})
+	}
+}
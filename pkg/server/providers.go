@@ -0,0 +1,53 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// WithResourceProviders returns an option to only emit events for the
+// payloads whose resource provider is one of the providers, e.g. "gcp". The
+// notifications of the other payloads are acked and ignored without any
+// event, so the out-of-scope providers of a mixed bucket don't cause failure
+// events. Payloads without a resource such as policies, unparsable objects and
+// deleted objects are not filtered. All providers are handled by default.
+func WithResourceProviders(providers ...string) Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		if len(providers) == 0 {
+			return nil, fmt.Errorf("resource providers cannot be empty")
+		}
+		opts.resourceProviders = providers
+		return opts, nil
+	}
+}
+
+// checkResourceProvider returns a [skipError] when the resource provider of
+// the payload isn't handled, see [WithResourceProviders].
+func checkResourceProvider(providers []string, payload any) error {
+	if len(providers) == 0 {
+		return nil
+	}
+	r, ok := payload.(resourceGetter)
+	if !ok {
+		return nil
+	}
+	if provider := r.GetResource().GetProvider(); !slices.Contains(providers, provider) {
+		return &skipError{reason: fmt.Sprintf("resource provider %q is not handled", provider)}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+func TestEventHandler_HTTPHandlerResourceProviders(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		provider       string
+		providers      []string
+		wantStatusCode int
+		wantBody       string
+		wantSuccess    int
+		wantProcessed  int
+	}{
+		{
+			name:           "in_scope_provider",
+			provider:       "gcp",
+			providers:      []string{"gcp"},
+			wantStatusCode: http.StatusCreated,
+			wantBody:       "OK: processed",
+			wantSuccess:    1,
+			wantProcessed:  1,
+		},
+		{
+			name:           "one_of_providers",
+			provider:       "aws",
+			providers:      []string{"gcp", "aws"},
+			wantStatusCode: http.StatusCreated,
+			wantBody:       "OK: processed",
+			wantSuccess:    1,
+			wantProcessed:  1,
+		},
+		{
+			name:           "out_of_scope_provider",
+			provider:       "aws",
+			providers:      []string{"gcp"},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `OK: skipped: resource provider "aws" is not handled`,
+		},
+		{
+			name:           "missing_provider",
+			providers:      []string{"gcp"},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `OK: skipped: resource provider "" is not handled`,
+		},
+		{
+			name:           "all_providers_by_default",
+			provider:       "aws",
+			wantStatusCode: http.StatusCreated,
+			wantBody:       "OK: processed",
+			wantSuccess:    1,
+			wantProcessed:  1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			mappingYAML := `
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: ` + tc.provider + `
+contacts:
+  email:
+  - pmap@example.com
+`
+			metrics := NewMemoryMetricsRecorder()
+			successMessenger, failureMessenger := &countMessenger{}, &countMessenger{}
+			opts := []Option{
+				WithObjectStore(&testObjectStore{
+					data: map[string][]byte{"foo/bar": []byte(mappingYAML)},
+				}),
+				WithFailureMessenger(failureMessenger),
+				WithOptionalGitHubSource(),
+				WithMetrics(metrics),
+			}
+			if tc.providers != nil {
+				opts = append(opts, WithResourceProviders(tc.providers...))
+			}
+			h, err := NewHandler(context.Background(), []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{}},
+				successMessenger, opts...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			var m PubSubMessage
+			m.Message.Attributes = map[string]string{AttrKeyBucketID: "foo", AttrKeyObjectID: "bar"}
+			body, err := json.Marshal(m)
+			if err != nil {
+				t.Fatalf("failed to marshal message: %v", err)
+			}
+			resp := httptest.NewRecorder()
+			h.HTTPHandler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body)))
+
+			if got, want := resp.Code, tc.wantStatusCode; got != want {
+				t.Errorf("got status code %d, want %d", got, want)
+			}
+			if diff := cmp.Diff(tc.wantBody, resp.Body.String()); diff != "" {
+				t.Errorf("got body diff (-want, +got): %v", diff)
+			}
+			if got, want := successMessenger.sent, tc.wantSuccess; got != want {
+				t.Errorf("got %d success events sent, want %d", got, want)
+			}
+			if got := failureMessenger.sent; got != 0 {
+				t.Errorf("got %d failure events sent, want 0", got)
+			}
+			if got, _ := metrics.Processed(""); got != tc.wantProcessed {
+				t.Errorf("got %d processed notifications recorded, want %d", got, tc.wantProcessed)
+			}
+		})
+	}
+}
+
+func TestEventHandler_HandleResultResourceProviders(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mappingYAML := []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: aws
+contacts:
+  email:
+  - pmap@example.com
+`)
+	h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{&testMappingProcessor{}}, &countMessenger{},
+		WithObjectStore(&testObjectStore{data: map[string][]byte{"foo/bar": mappingYAML}}),
+		WithOptionalGitHubSource(),
+		WithResourceProviders("gcp"))
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+
+	got, err := h.HandleResult(ctx, pubsub.Message{
+		Attributes: map[string]string{AttrKeyBucketID: "foo", AttrKeyObjectID: "bar"},
+	})
+	if err != nil {
+		t.Fatalf("HandleResult got unexpected error: %v", err)
+	}
+	want := &Result{Outcome: OutcomeSkipped, SkipReason: `resource provider "aws" is not handled`}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("HandleResult got diff (-want, +got): %v", diff)
+	}
+}
+
+func TestEventHandler_HandleResourceProvidersWithoutResource(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	msgr := &countMessenger{}
+	h, err := NewHandler(ctx, []Processor[*structpb.Struct]{&testProcessor{}}, msgr,
+		WithObjectStore(&testObjectStore{data: map[string][]byte{"foo/bar": []byte(`foo: bar`)}}),
+		WithOptionalGitHubSource(),
+		WithResourceProviders("gcp"))
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+
+	if err := h.Handle(ctx, pubsub.Message{
+		Attributes: map[string]string{AttrKeyBucketID: "foo", AttrKeyObjectID: "bar"},
+	}); err != nil {
+		t.Fatalf("Handle got unexpected error: %v", err)
+	}
+	if got, want := msgr.sent, 1; got != want {
+		t.Errorf("got %d events sent, want %d", got, want)
+	}
+}
+
+func TestWithResourceProviders(t *testing.T) {
+	t.Parallel()
+
+	_, err := WithResourceProviders()(context.Background(), &HandlerOpts{})
+	if diff := testutil.DiffErrString(err, "resource providers cannot be empty"); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/idtoken"
+)
+
+// PushVerifier verifies the OIDC token of authenticated Pub/Sub push
+// requests, see
+// https://cloud.google.com/pubsub/docs/authenticate-push-subscriptions.
+type PushVerifier interface {
+	// Verify returns the verified identity of the caller the token was
+	// issued to, e.g. the service account email.
+	Verify(ctx context.Context, token string) (string, error)
+}
+
+// IDTokenVerifier is a PushVerifier of the Google-signed OIDC ID tokens of
+// the push subscriptions with the given audience.
+type IDTokenVerifier struct {
+	validator *idtoken.Validator
+	audience  string
+}
+
+// NewIDTokenVerifier creates a new instance of the IDTokenVerifier.
+func NewIDTokenVerifier(ctx context.Context, audience string) (*IDTokenVerifier, error) {
+	validator, err := idtoken.NewValidator(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ID token validator: %w", err)
+	}
+	return &IDTokenVerifier{validator: validator, audience: audience}, nil
+}
+
+// Verify validates the token and returns its verified email, the subject is
+// returned for tokens without a verified email.
+func (v *IDTokenVerifier) Verify(ctx context.Context, token string) (string, error) {
+	payload, err := v.validator.Validate(ctx, token, v.audience)
+	if err != nil {
+		return "", fmt.Errorf("failed to validate ID token: %w", err)
+	}
+	email, _ := payload.Claims["email"].(string)
+	if verified, _ := payload.Claims["email_verified"].(bool); verified && email != "" {
+		return email, nil
+	}
+	if payload.Subject == "" {
+		return "", fmt.Errorf("ID token has no subject")
+	}
+	return payload.Subject, nil
+}
+
+// verifyPush returns the verified publisher of the push request from the
+// bearer token of its Authorization header.
+func verifyPush(ctx context.Context, v PushVerifier, r *http.Request) (string, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", fmt.Errorf("missing bearer token")
+	}
+	publisher, err := v.Verify(ctx, token)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify bearer token: %w", err)
+	}
+	return publisher, nil
+}
+
+// publisherKey is the context key for the verified publisher of the push
+// request.
+type publisherKey struct{}
+
+// withPublisher returns a copy of the context with the verified publisher
+// attached.
+func withPublisher(ctx context.Context, publisher string) context.Context {
+	return context.WithValue(ctx, publisherKey{}, publisher)
+}
+
+// publisherFromContext returns the verified publisher attached to the
+// context, or "" if the request wasn't verified.
+func publisherFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(publisherKey{}).(string)
+	return v
+}
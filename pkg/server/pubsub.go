@@ -15,10 +15,18 @@
 package server
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"unicode/utf8"
 
 	"cloud.google.com/go/pubsub"
+
+	"github.com/abcxyz/pkg/logging"
 )
 
 const (
@@ -26,38 +34,201 @@ const (
 	MaxTopicAttrValueBytes = 1024
 )
 
+const (
+	// AttrKeyContentEncoding is the attribute key of the encoding of the
+	// message data, the data is the JSON encoded event when it's absent.
+	AttrKeyContentEncoding = "contentEncoding"
+
+	// ContentEncodingGzip is the encoding of the gzip compressed data.
+	ContentEncodingGzip = "gzip"
+
+	// AttrKeyTruncated is the attribute key set to "true" when attribute
+	// values were truncated, see [WithTruncation].
+	AttrKeyTruncated = "truncated"
+)
+
+// TruncationMarker ends the attribute values truncated by [WithTruncation].
+const TruncationMarker = "…[truncated]"
+
 // PubSubMessenger implements the Messenger interface for Google Cloud PubSub.
 type PubSubMessenger struct {
-	topic *pubsub.Topic
+	topic    *pubsub.Topic
+	gzip     bool
+	truncate bool
+	// orderingKey returns the ordering key of the messages, they're unordered
+	// when it's nil.
+	orderingKey OrderingKeyFunc
+}
+
+// OrderingKeyFunc returns the Pub/Sub ordering key of an event from its data
+// and attributes, the event is published without ordering when it's empty.
+type OrderingKeyFunc func(data []byte, attr map[string]string) string
+
+// OrderingKeyFromAttribute returns an [OrderingKeyFunc] using the value of the
+// attribute as the ordering key, e.g. [AttrKeyResourceKey] to order the events
+// of the same resource.
+func OrderingKeyFromAttribute(key string) OrderingKeyFunc {
+	return func(_ []byte, attr map[string]string) string {
+		return attr[key]
+	}
+}
+
+// PubSubMessengerOption is the option to configure the PubSubMessenger.
+type PubSubMessengerOption func(p *PubSubMessenger)
+
+// WithGzip compresses the message data with gzip and sets the
+// AttrKeyContentEncoding attribute, so events closer to the Pub/Sub size limit
+// can be published. Consumers must decompress the data, e.g. with
+// [DecodeMessageData], and BigQuery subscriptions can't write the compressed
+// events as JSON.
+func WithGzip() PubSubMessengerOption {
+	return func(p *PubSubMessenger) {
+		p.gzip = true
+	}
+}
+
+// WithTruncation truncates the attribute values over MaxTopicAttrValueBytes
+// instead of failing to send the message. The truncated values end with the
+// [TruncationMarker] within the limit, and the [AttrKeyTruncated] attribute is
+// set on the message. The truncated values are lossy and may no longer be
+// parsable, e.g. JSON encoded values.
+func WithTruncation() PubSubMessengerOption {
+	return func(p *PubSubMessenger) {
+		p.truncate = true
+	}
 }
 
 // NewPubSubMessenger creates a new instance of the PubSubMessenger.
-func NewPubSubMessenger(topic *pubsub.Topic) *PubSubMessenger {
-	return &PubSubMessenger{topic: topic}
+func NewPubSubMessenger(topic *pubsub.Topic, opts ...PubSubMessengerOption) *PubSubMessenger {
+	p := &PubSubMessenger{topic: topic}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// NewPubSubMessengerWithOrdering creates a new instance of the PubSubMessenger
+// publishing the events with the ordering key returned by keyFunc, so the
+// events with the same key, e.g. of the same resource, are delivered in the
+// order they're published. It enables message ordering on the topic. The
+// events are only delivered in order to the subscriptions with message
+// ordering enabled, and the topic must be used from a single region.
+//
+// The key is resumed when a publish fails, so the next events with the key,
+// e.g. the redelivered one, can still be published.
+func NewPubSubMessengerWithOrdering(topic *pubsub.Topic, keyFunc OrderingKeyFunc, opts ...PubSubMessengerOption) *PubSubMessenger {
+	topic.EnableMessageOrdering = true
+	p := NewPubSubMessenger(topic, opts...)
+	p.orderingKey = keyFunc
+	return p
 }
 
 func (p *PubSubMessenger) Send(ctx context.Context, data []byte, attr map[string]string) error {
-	m, err := limitedSizeMessage(data, attr)
+	m, err := p.newMessage(data, attr)
 	if err != nil {
-		return fmt.Errorf("pubsub failed to publish message: %w", err)
+		return err
 	}
 
+	logger := logging.FromContext(ctx)
+	logger.DebugContext(ctx, "publishing message",
+		"topic", p.topic.String(),
+		"dataBytes", len(m.Data),
+		"attributeCount", len(m.Attributes),
+		"orderingKey", m.OrderingKey)
+
 	result := p.topic.Publish(ctx, m)
 
-	if _, err := result.Get(ctx); err != nil {
+	id, err := result.Get(ctx)
+	if err != nil {
+		// The topic pauses the key on failure, resume it so the redelivered
+		// event can be published again.
+		if m.OrderingKey != "" {
+			p.topic.ResumePublish(m.OrderingKey)
+		}
 		return fmt.Errorf("pubsub failed to get result returned from publish : %w", err)
 	}
+	logger.InfoContext(ctx, "published message",
+		"topic", p.topic.String(),
+		"messageID", id)
 	return nil
 }
 
-func limitedSizeMessage(data []byte, attr map[string]string) (*pubsub.Message, error) {
+// newMessage returns the message of the event to publish, compressed and
+// with the ordering key as configured.
+func (p *PubSubMessenger) newMessage(data []byte, attr map[string]string) (*pubsub.Message, error) {
+	var orderingKey string
+	if p.orderingKey != nil {
+		orderingKey = p.orderingKey(data, attr)
+	}
+
+	if p.gzip {
+		var err error
+		data, err = gzipData(data)
+		if err != nil {
+			return nil, fmt.Errorf("pubsub failed to compress message: %w", err)
+		}
+		attr = maps.Clone(attr)
+		if attr == nil {
+			attr = make(map[string]string, 1)
+		}
+		attr[AttrKeyContentEncoding] = ContentEncodingGzip
+	}
+
+	m, err := limitedSizeMessage(data, attr, p.truncate)
+	if err != nil {
+		return nil, fmt.Errorf("pubsub failed to publish message: %w", err)
+	}
+	m.OrderingKey = orderingKey
+	return m, nil
+}
+
+// publishPermission is the IAM permission to publish to a topic.
+const publishPermission = "pubsub.topics.publish"
+
+// VerifyPublish tests the publish permission on each topic, so missing publish
+// permissions fail at startup rather than on the first event. Nothing is
+// published.
+func VerifyPublish(ctx context.Context, topics ...*pubsub.Topic) error {
+	for _, topic := range topics {
+		granted, err := topic.IAM().TestPermissions(ctx, []string{publishPermission})
+		if err != nil {
+			return fmt.Errorf("failed to test publish permission on topic %q: %w", topic.String(), err)
+		}
+		if !slices.Contains(granted, publishPermission) {
+			return fmt.Errorf("permission denied to publish to topic %q, "+
+				"the service account needs roles/pubsub.publisher on it", topic.String())
+		}
+	}
+	return nil
+}
+
+// limitedSizeMessage returns the message of the data and attributes, it fails
+// if the data or any attribute value exceeds the Pub/Sub limits. The attribute
+// values are truncated to the limit with the [TruncationMarker] instead when
+// truncate is set, along with the [AttrKeyTruncated] attribute, attr is left
+// unchanged.
+func limitedSizeMessage(data []byte, attr map[string]string, truncate bool) (*pubsub.Message, error) {
 	if len(data) > MaxTopicDataBytes {
 		return nil, fmt.Errorf("data length(%d) exceed max size allowed(%d)", len(data), MaxTopicDataBytes)
 	}
 
-	for key, value := range attr {
-		v := []byte(value)[:min(MaxTopicAttrValueBytes, len(value))]
-		attr[key] = string(v)
+	cloned := false
+	for _, key := range slices.Sorted(maps.Keys(attr)) {
+		value := attr[key]
+		if len(value) <= MaxTopicAttrValueBytes {
+			continue
+		}
+		if !truncate {
+			return nil, fmt.Errorf("attribute %q value length(%d) exceed max size allowed(%d)", key, len(value), MaxTopicAttrValueBytes)
+		}
+		if !cloned {
+			// Don't modify the caller's attributes.
+			attr, cloned = maps.Clone(attr), true
+		}
+		attr[key] = truncateUTF8(value, MaxTopicAttrValueBytes-len(TruncationMarker)) + TruncationMarker
+	}
+	if cloned {
+		attr[AttrKeyTruncated] = "true"
 	}
 
 	return &pubsub.Message{
@@ -65,3 +236,51 @@ func limitedSizeMessage(data []byte, attr map[string]string) (*pubsub.Message, e
 		Attributes: attr,
 	}, nil
 }
+
+// truncateUTF8 truncates s to at most n bytes without splitting a multi-byte
+// character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// gzipData returns the gzip compressed data.
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to write gzip data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close gzip writer: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeMessageData returns the event bytes of the message data published by
+// the PubSubMessenger, decompressed according to the AttrKeyContentEncoding
+// attribute.
+func DecodeMessageData(data []byte, attr map[string]string) ([]byte, error) {
+	switch enc := attr[AttrKeyContentEncoding]; enc {
+	case "":
+		return data, nil
+	case ContentEncodingGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip data: %w", err)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", enc)
+	}
+}
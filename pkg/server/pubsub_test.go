@@ -15,17 +15,28 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
 	"testing"
 
+	"cloud.google.com/go/iam/apiv1/iampb"
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/pubsub/pstest"
+	"github.com/google/go-cmp/cmp"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
 
+	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/testutil"
 	"github.com/abcxyz/pmap/apis/v1alpha1"
 )
@@ -81,6 +92,302 @@ func TestPubSubMessenger_Send(t *testing.T) {
 	}
 }
 
+func TestPubSubMessenger_SendGzip(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	event := &v1alpha1.PmapEvent{
+		GithubSource: &v1alpha1.GitHubSource{
+			RepoName: "test-github-repo",
+			Commit:   "test-github-commit",
+			FilePath: "dir1/dir2/bar",
+		},
+	}
+	eventBytes, err := marshalEvent(event, false)
+	if err != nil {
+		t.Fatalf("failed to marshal event to byte: %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		opts     []PubSubMessengerOption
+		wantAttr map[string]string
+	}{
+		{
+			name:     "uncompressed_by_default",
+			wantAttr: map[string]string{AttrKeyOutcome: OutcomeSuccess},
+		},
+		{
+			name: "gzip",
+			opts: []PubSubMessengerOption{WithGzip()},
+			wantAttr: map[string]string{
+				AttrKeyOutcome:         OutcomeSuccess,
+				AttrKeyContentEncoding: ContentEncodingGzip,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			svr, testTopic := testNewPubSubServerTopic(ctx, t)
+
+			attr := map[string]string{AttrKeyOutcome: OutcomeSuccess}
+			if err := NewPubSubMessenger(testTopic, tc.opts...).Send(ctx, eventBytes, attr); err != nil {
+				t.Fatalf("Send got unexpected error: %v", err)
+			}
+			if _, ok := attr[AttrKeyContentEncoding]; ok {
+				t.Errorf("Send modified the given attributes: %v", attr)
+			}
+
+			msgs := svr.Messages()
+			if got, want := len(msgs), 1; got != want {
+				t.Fatalf("got %d published messages, want %d", got, want)
+			}
+			if diff := cmp.Diff(tc.wantAttr, msgs[0].Attributes); diff != "" {
+				t.Errorf("published attributes diff (-want, +got): %v", diff)
+			}
+
+			gotBytes, err := DecodeMessageData(msgs[0].Data, msgs[0].Attributes)
+			if err != nil {
+				t.Fatalf("DecodeMessageData got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(eventBytes, gotBytes); diff != "" {
+				t.Errorf("decoded data diff (-want, +got): %v", diff)
+			}
+			var got v1alpha1.PmapEvent
+			if err := protojson.Unmarshal(gotBytes, &got); err != nil {
+				t.Fatalf("failed to unmarshal decoded event: %v", err)
+			}
+			if diff := cmp.Diff(event, &got, protocmp.Transform()); diff != "" {
+				t.Errorf("decoded event diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestPubSubMessenger_SendOrdering(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name             string
+		newMessenger     func(topic *pubsub.Topic) *PubSubMessenger
+		attrs            []map[string]string
+		wantOrderingKeys []string
+	}{
+		{
+			name: "resource_key",
+			newMessenger: func(topic *pubsub.Topic) *PubSubMessenger {
+				return NewPubSubMessengerWithOrdering(topic, OrderingKeyFromAttribute(AttrKeyResourceKey))
+			},
+			attrs: []map[string]string{
+				{AttrKeyResourceKey: "key-1"},
+				{AttrKeyResourceKey: "key-2"},
+				{AttrKeyResourceKey: "key-1"},
+				{},
+			},
+			wantOrderingKeys: []string{"key-1", "key-2", "key-1", ""},
+		},
+		{
+			name: "data_key",
+			newMessenger: func(topic *pubsub.Topic) *PubSubMessenger {
+				return NewPubSubMessengerWithOrdering(topic, func(data []byte, _ map[string]string) string {
+					return string(data)
+				}, WithGzip())
+			},
+			attrs:            []map[string]string{{}},
+			wantOrderingKeys: []string{`{"type":"test"}`},
+		},
+		{
+			name: "unordered_by_default",
+			newMessenger: func(topic *pubsub.Topic) *PubSubMessenger {
+				return NewPubSubMessenger(topic)
+			},
+			attrs:            []map[string]string{{AttrKeyResourceKey: "key-1"}},
+			wantOrderingKeys: []string{""},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			svr, testTopic := testNewPubSubServerTopic(ctx, t)
+
+			m := tc.newMessenger(testTopic)
+			for _, attr := range tc.attrs {
+				if err := m.Send(ctx, []byte(`{"type":"test"}`), attr); err != nil {
+					t.Fatalf("Send got unexpected error: %v", err)
+				}
+			}
+
+			var gotOrderingKeys []string
+			for _, msg := range svr.Messages() {
+				gotOrderingKeys = append(gotOrderingKeys, msg.OrderingKey)
+			}
+			if diff := cmp.Diff(tc.wantOrderingKeys, gotOrderingKeys); diff != "" {
+				t.Errorf("published ordering keys diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+// failOnceReactor fails the first call with a non-retryable error.
+type failOnceReactor struct {
+	mu     sync.Mutex
+	failed bool
+}
+
+func (r *failOnceReactor) React(_ any) (bool, any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed {
+		return false, nil, nil
+	}
+	r.failed = true
+	return true, nil, status.Error(codes.InvalidArgument, injectedPublishError)
+}
+
+func TestPubSubMessenger_SendOrderingResumed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svr, testTopic := testNewPubSubServerTopic(ctx, t, pstest.ServerReactorOption{FuncName: "Publish", Reactor: &failOnceReactor{}})
+
+	m := NewPubSubMessengerWithOrdering(testTopic, OrderingKeyFromAttribute(AttrKeyResourceKey))
+	attr := map[string]string{AttrKeyResourceKey: "key-1"}
+	err := m.Send(ctx, []byte(`{"type":"test"}`), attr)
+	if diff := testutil.DiffErrString(err, injectedPublishError); diff != "" {
+		t.Error(diff)
+	}
+	if err := m.Send(ctx, []byte(`{"type":"test"}`), attr); err != nil {
+		t.Fatalf("Send got unexpected error after the key was resumed: %v", err)
+	}
+
+	msgs := svr.Messages()
+	if got, want := len(msgs), 1; got != want {
+		t.Fatalf("got %d published messages, want %d", got, want)
+	}
+	if got, want := msgs[0].OrderingKey, "key-1"; got != want {
+		t.Errorf("got ordering key %q, want %q", got, want)
+	}
+}
+
+// fakeIAMPolicyServer grants the permissions tested on the topics unless they
+// are denied, or fails with returnErr if set.
+type fakeIAMPolicyServer struct {
+	iampb.UnimplementedIAMPolicyServer
+
+	denied    bool
+	returnErr error
+}
+
+func (s *fakeIAMPolicyServer) TestIamPermissions(_ context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+	if s.returnErr != nil {
+		return nil, s.returnErr
+	}
+	if s.denied {
+		return &iampb.TestIamPermissionsResponse{}, nil
+	}
+	return &iampb.TestIamPermissionsResponse{Permissions: req.GetPermissions()}, nil
+}
+
+func TestVerifyPublish(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name          string
+		iamServer     *fakeIAMPolicyServer
+		wantErrSubstr string
+	}{
+		{
+			name:      "success",
+			iamServer: &fakeIAMPolicyServer{},
+		},
+		{
+			name:          "permission_denied",
+			iamServer:     &fakeIAMPolicyServer{denied: true},
+			wantErrSubstr: `permission denied to publish to topic "projects/test-project-id/topics/test-topic-id"`,
+		},
+		{
+			name:          "test_permissions_error",
+			iamServer:     &fakeIAMPolicyServer{returnErr: status.Error(codes.NotFound, "injected iam error")},
+			wantErrSubstr: `failed to test publish permission on topic "projects/test-project-id/topics/test-topic-id"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			svr := pstest.NewServerWithCallback(0, func(s *grpc.Server) {
+				iampb.RegisterIAMPolicyServer(s, tc.iamServer)
+			})
+			conn := testConnectPubSubServer(t, svr)
+			testTopic := testCreatePubsubTopic(ctx, t, serverProjectID, serverTopicID, option.WithGRPCConn(conn))
+
+			err := VerifyPublish(ctx, testTopic)
+			if diff := testutil.DiffErrString(err, tc.wantErrSubstr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			if got := len(svr.Messages()); got != 0 {
+				t.Errorf("got %d published messages, want none", got)
+			}
+		})
+	}
+}
+
+func TestDecodeMessageData(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		data    []byte
+		attr    map[string]string
+		want    []byte
+		wantErr string
+	}{
+		{
+			name: "no_encoding",
+			data: []byte(`{}`),
+			want: []byte(`{}`),
+		},
+		{
+			name:    "invalid_gzip",
+			data:    []byte(`{}`),
+			attr:    map[string]string{AttrKeyContentEncoding: ContentEncodingGzip},
+			wantErr: "failed to create gzip reader",
+		},
+		{
+			name:    "unsupported_encoding",
+			data:    []byte(`{}`),
+			attr:    map[string]string{AttrKeyContentEncoding: "br"},
+			wantErr: `unsupported content encoding "br"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := DecodeMessageData(tc.data, tc.attr)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("DecodeMessageData got diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
 // Creates a GRPC connection with PubSub test server. Note that the GRPC connection is not closed at the end because
 // it is duplicative if the PubSub client is also closing. Please remember to close the connection if the PubSub client
 // will not close.
@@ -88,7 +395,14 @@ func testNewPubSubGrpcConn(t *testing.T, opts ...pstest.ServerReactorOption) *gr
 	t.Helper()
 
 	// Create PubSub test server.
-	svr := pstest.NewServer(opts...)
+	return testConnectPubSubServer(t, pstest.NewServer(opts...))
+}
+
+// testConnectPubSubServer creates a GRPC connection with the given PubSub test
+// server, and closes the server at the end of the test.
+func testConnectPubSubServer(t *testing.T, svr *pstest.Server) *grpc.ClientConn {
+	t.Helper()
+
 	t.Cleanup(func() {
 		if err := svr.Close(); err != nil {
 			t.Fatalf("failed to cleanup test PubSub server: %v", err)
@@ -104,6 +418,16 @@ func testNewPubSubGrpcConn(t *testing.T, opts ...pstest.ServerReactorOption) *gr
 	return conn
 }
 
+// testNewPubSubServerTopic returns a PubSub test server and the test topic
+// created in it.
+func testNewPubSubServerTopic(ctx context.Context, t *testing.T, opts ...pstest.ServerReactorOption) (*pstest.Server, *pubsub.Topic) {
+	t.Helper()
+
+	svr := pstest.NewServer(opts...)
+	conn := testConnectPubSubServer(t, svr)
+	return svr, testCreatePubsubTopic(ctx, t, serverProjectID, serverTopicID, option.WithGRPCConn(conn))
+}
+
 func testCreatePubsubTopic(ctx context.Context, t *testing.T, projectID, topicID string, opts ...option.ClientOption) *pubsub.Topic {
 	t.Helper()
 
@@ -125,3 +449,202 @@ func testCreatePubsubTopic(ctx context.Context, t *testing.T, projectID, topicID
 
 	return topic
 }
+
+func TestPubSubMessenger_SendOversizedAttribute(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	longValue := strings.Repeat("a", MaxTopicAttrValueBytes+1)
+
+	cases := []struct {
+		name          string
+		opts          []PubSubMessengerOption
+		wantAttr      map[string]string
+		wantErrSubstr string
+	}{
+		{
+			name:          "fail_by_default",
+			wantErrSubstr: fmt.Sprintf(`attribute "long" value length(%d) exceed max size allowed(%d)`, MaxTopicAttrValueBytes+1, MaxTopicAttrValueBytes),
+		},
+		{
+			name: "truncation",
+			opts: []PubSubMessengerOption{WithTruncation()},
+			wantAttr: map[string]string{
+				AttrKeyOutcome:   OutcomeSuccess,
+				AttrKeyTruncated: "true",
+				"long":           longValue[:MaxTopicAttrValueBytes-len(TruncationMarker)] + TruncationMarker,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			svr, testTopic := testNewPubSubServerTopic(ctx, t)
+
+			attr := map[string]string{AttrKeyOutcome: OutcomeSuccess, "long": longValue}
+			gotErr := NewPubSubMessenger(testTopic, tc.opts...).Send(ctx, []byte("{}"), attr)
+			if diff := testutil.DiffErrString(gotErr, tc.wantErrSubstr); diff != "" {
+				t.Fatalf("Send got unexpected error substring: %v", diff)
+			}
+			if got := attr["long"]; got != longValue {
+				t.Errorf("Send modified the given attributes: got %d bytes, want %d", len(got), len(longValue))
+			}
+
+			msgs := svr.Messages()
+			if tc.wantErrSubstr != "" {
+				if len(msgs) != 0 {
+					t.Errorf("got %d published messages, want none", len(msgs))
+				}
+				return
+			}
+			if got, want := len(msgs), 1; got != want {
+				t.Fatalf("got %d published messages, want %d", got, want)
+			}
+			if diff := cmp.Diff(tc.wantAttr, msgs[0].Attributes); diff != "" {
+				t.Errorf("published attributes diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestLimitedSizeMessage(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		data          []byte
+		attr          map[string]string
+		truncate      bool
+		wantAttr      map[string]string
+		wantErrSubstr string
+	}{
+		{
+			name:     "within_limits",
+			data:     []byte("{}"),
+			attr:     map[string]string{"key": strings.Repeat("a", MaxTopicAttrValueBytes)},
+			wantAttr: map[string]string{"key": strings.Repeat("a", MaxTopicAttrValueBytes)},
+		},
+		{
+			name:          "data_too_large",
+			data:          make([]byte, MaxTopicDataBytes+1),
+			truncate:      true,
+			wantErrSubstr: "data length(10000001) exceed max size allowed(10000000)",
+		},
+		{
+			name:          "attribute_too_large",
+			data:          []byte("{}"),
+			attr:          map[string]string{"key": `{"json":"` + strings.Repeat("a", MaxTopicAttrValueBytes) + `"}`},
+			wantErrSubstr: `attribute "key" value length(1035) exceed max size allowed(1024)`,
+		},
+		{
+			name:     "attribute_truncated",
+			data:     []byte("{}"),
+			attr:     map[string]string{"key": strings.Repeat("a", MaxTopicAttrValueBytes+10), "short": "b"},
+			truncate: true,
+			wantAttr: map[string]string{
+				"key":            strings.Repeat("a", MaxTopicAttrValueBytes-len(TruncationMarker)) + TruncationMarker,
+				"short":          "b",
+				AttrKeyTruncated: "true",
+			},
+		},
+		{
+			name: "attribute_truncated_at_character_boundary",
+			data: []byte("{}"),
+			// The 2-byte "é" straddles the limit before the marker.
+			attr:     map[string]string{"key": strings.Repeat("a", MaxTopicAttrValueBytes-len(TruncationMarker)-1) + "é" + "bbbbbbbbbbbbbb"},
+			truncate: true,
+			wantAttr: map[string]string{
+				"key":            strings.Repeat("a", MaxTopicAttrValueBytes-len(TruncationMarker)-1) + TruncationMarker,
+				AttrKeyTruncated: "true",
+			},
+		},
+		{
+			name:     "within_limits_not_marked",
+			data:     []byte("{}"),
+			attr:     map[string]string{"key": strings.Repeat("a", MaxTopicAttrValueBytes)},
+			truncate: true,
+			wantAttr: map[string]string{"key": strings.Repeat("a", MaxTopicAttrValueBytes)},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := limitedSizeMessage(tc.data, tc.attr, tc.truncate)
+			if diff := testutil.DiffErrString(err, tc.wantErrSubstr); diff != "" {
+				t.Fatalf("limitedSizeMessage got unexpected error substring: %v", diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.wantAttr, got.Attributes); diff != "" {
+				t.Errorf("limitedSizeMessage got attributes diff (-want, +got): %v", diff)
+			}
+			for k, v := range got.Attributes {
+				if len(v) > MaxTopicAttrValueBytes {
+					t.Errorf("limitedSizeMessage got attribute %q of %d bytes, want at most %d", k, len(v), MaxTopicAttrValueBytes)
+				}
+			}
+		})
+	}
+}
+
+func TestPubSubMessenger_SendLogs(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&b, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ctx := logging.WithLogger(context.Background(), logger)
+
+	svr, testTopic := testNewPubSubServerTopic(ctx, t)
+
+	attr := map[string]string{AttrKeyOutcome: OutcomeSuccess, AttrKeyBucketID: "foo"}
+	if err := NewPubSubMessenger(testTopic).Send(ctx, []byte(`{"type":"test"}`), attr); err != nil {
+		t.Fatalf("Send got unexpected error: %v", err)
+	}
+
+	msgs := svr.Messages()
+	if got, want := len(msgs), 1; got != want {
+		t.Fatalf("got %d published messages, want %d", got, want)
+	}
+
+	type logLine struct {
+		Level          string `json:"level"`
+		Msg            string `json:"msg"`
+		Topic          string `json:"topic"`
+		DataBytes      int    `json:"dataBytes"`
+		AttributeCount int    `json:"attributeCount"`
+		MessageID      string `json:"messageID"`
+	}
+	var got []logLine
+	dec := json.NewDecoder(&b)
+	for dec.More() {
+		var l logLine
+		if err := dec.Decode(&l); err != nil {
+			t.Fatalf("failed to decode log line: %v", err)
+		}
+		got = append(got, l)
+	}
+
+	want := []logLine{
+		{
+			Level:          "DEBUG",
+			Msg:            "publishing message",
+			Topic:          testTopic.String(),
+			DataBytes:      len(`{"type":"test"}`),
+			AttributeCount: 2,
+		},
+		{
+			Level:     "INFO",
+			Msg:       "published message",
+			Topic:     testTopic.String(),
+			MessageID: msgs[0].ID,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Send got logs diff (-want, +got): %v", diff)
+	}
+}
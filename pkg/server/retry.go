@@ -0,0 +1,130 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/sethvargo/go-retry"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+)
+
+// RetryAfterError is a retryable error with a hint of when to retry, e.g. a
+// quota error of a dependency. Processors return it so
+// [EventHandler.HTTPHandler] responds with 429 and the Retry-After header
+// instead of having the message redelivered immediately.
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+// Error returns the error message with the retry hint.
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error() + " (retry after " + e.RetryAfter.String() + ")"
+}
+
+// Unwrap returns the wrapped error.
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// retryAfterSeconds returns the Retry-After header value of the error, which
+// is the retry hint rounded up to whole seconds. ok is false if the error is
+// not a [RetryAfterError].
+func retryAfterSeconds(err error) (string, bool) {
+	var rerr *RetryAfterError
+	if !errors.As(err, &rerr) {
+		return "", false
+	}
+	return strconv.Itoa(max(1, int(math.Ceil(rerr.RetryAfter.Seconds())))), true
+}
+
+// RetryProcessor is a [Processor] retrying the wrapped processor on transient
+// failures, e.g. a flaky directory lookup. User facing errors such as
+// validation failures are returned without retrying. The wrapped processor is
+// run again on the same payload, so it must be idempotent.
+//
+// It has the name and dependencies of the wrapped processor, and stops it
+// when it's stoppable.
+type RetryProcessor[P proto.Message] struct {
+	processor  Processor[P]
+	newBackoff func() retry.Backoff
+}
+
+// NewRetryProcessor creates a [RetryProcessor] of the processor with the
+// backoff returned by newBackoff. Backoffs are stateful, so a new one is
+// created for every payload, e.g.:
+//
+//	NewRetryProcessor(p, func() retry.Backoff {
+//		return retry.WithMaxRetries(3, retry.NewExponential(100*time.Millisecond))
+//	})
+func NewRetryProcessor[P proto.Message](p Processor[P], newBackoff func() retry.Backoff) (*RetryProcessor[P], error) {
+	if p == nil {
+		return nil, fmt.Errorf("processor cannot be nil")
+	}
+	if newBackoff == nil {
+		return nil, fmt.Errorf("backoff cannot be nil")
+	}
+	return &RetryProcessor[P]{processor: p, newBackoff: newBackoff}, nil
+}
+
+// Process runs the wrapped processor until it succeeds, fails with a user
+// facing error, or the backoff stops, and returns the last error.
+func (p *RetryProcessor[P]) Process(ctx context.Context, msg P) error {
+	//nolint:wrapcheck // Errors of the processor are returned as is.
+	return retry.Do(ctx, p.newBackoff(), func(ctx context.Context) error {
+		err := p.processor.Process(ctx, msg)
+		if err == nil || pmaperrors.Is(err) {
+			return err
+		}
+		return retry.RetryableError(err)
+	})
+}
+
+// Name returns the name of the wrapped processor.
+func (p *RetryProcessor[P]) Name() string {
+	return processorName(p.processor)
+}
+
+// DependsOn returns the dependencies of the wrapped processor.
+func (p *RetryProcessor[P]) DependsOn() []string {
+	if d, ok := p.processor.(DependentProcessor); ok {
+		return d.DependsOn()
+	}
+	return nil
+}
+
+// RunsAfter returns the processors the wrapped processor runs after.
+func (p *RetryProcessor[P]) RunsAfter() []string {
+	if o, ok := p.processor.(OrderedProcessor); ok {
+		return o.RunsAfter()
+	}
+	return nil
+}
+
+// Stop stops the wrapped processor when it's stoppable.
+func (p *RetryProcessor[P]) Stop() error {
+	if s, ok := p.processor.(StoppableProcessor[P]); ok {
+		return s.Stop() //nolint:wrapcheck // Wrapped by the caller.
+	}
+	return nil
+}
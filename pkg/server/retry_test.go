@@ -0,0 +1,153 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sethvargo/go-retry"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+)
+
+// testFlakyProcessor fails with the errors in order, then succeeds.
+type testFlakyProcessor struct {
+	errs  []error
+	calls int
+}
+
+func (p *testFlakyProcessor) Process(_ context.Context, _ *structpb.Struct) error {
+	p.calls++
+	if p.calls <= len(p.errs) {
+		return p.errs[p.calls-1]
+	}
+	return nil
+}
+
+func TestRetryProcessor(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		errs       []error
+		maxRetries uint64
+		wantErr    string
+		wantCalls  int
+	}{
+		{
+			name:       "success",
+			maxRetries: 3,
+			wantCalls:  1,
+		},
+		{
+			name:       "transient_failures_then_success",
+			errs:       []error{fmt.Errorf("unavailable"), fmt.Errorf("unavailable")},
+			maxRetries: 3,
+			wantCalls:  3,
+		},
+		{
+			name:       "retries_exhausted",
+			errs:       []error{fmt.Errorf("unavailable 1"), fmt.Errorf("unavailable 2"), fmt.Errorf("unavailable 3")},
+			maxRetries: 2,
+			wantErr:    "unavailable 3",
+			wantCalls:  3,
+		},
+		{
+			name:       "user_facing_error_not_retried",
+			errs:       []error{pmaperrors.New("invalid contacts")},
+			maxRetries: 3,
+			wantErr:    "invalid contacts",
+			wantCalls:  1,
+		},
+		{
+			name:       "user_facing_error_after_transient_failure",
+			errs:       []error{fmt.Errorf("unavailable"), pmaperrors.New("invalid contacts")},
+			maxRetries: 3,
+			wantErr:    "invalid contacts",
+			wantCalls:  2,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			flaky := &testFlakyProcessor{errs: tc.errs}
+			p, err := NewRetryProcessor[*structpb.Struct](flaky, func() retry.Backoff {
+				return retry.WithMaxRetries(tc.maxRetries, retry.NewConstant(time.Millisecond))
+			})
+			if err != nil {
+				t.Fatalf("failed to create retry processor: %v", err)
+			}
+
+			err = p.Process(context.Background(), &structpb.Struct{})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if got, want := flaky.calls, tc.wantCalls; got != want {
+				t.Errorf("got %d calls, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestRetryProcessor_Wrapped(t *testing.T) {
+	t.Parallel()
+
+	newBackoff := func() retry.Backoff { return retry.WithMaxRetries(1, retry.NewConstant(time.Millisecond)) }
+
+	p, err := NewRetryProcessor[*structpb.Struct](&testConcurrentProcessor{name: "b", deps: []string{"a"}}, newBackoff)
+	if err != nil {
+		t.Fatalf("failed to create retry processor: %v", err)
+	}
+	if got, want := p.Name(), "b"; got != want {
+		t.Errorf("Name() got %q, want %q", got, want)
+	}
+	if diff := cmp.Diff([]string{"a"}, p.DependsOn()); diff != "" {
+		t.Errorf("DependsOn() got diff (-want, +got): %v", diff)
+	}
+
+	stoppable := &testStoppableProcessor{name: "s", stopErr: fmt.Errorf("failed to close")}
+	sp, err := NewRetryProcessor[*structpb.Struct](stoppable, newBackoff)
+	if err != nil {
+		t.Fatalf("failed to create retry processor: %v", err)
+	}
+	if diff := testutil.DiffErrString(sp.Stop(), "failed to close"); diff != "" {
+		t.Error(diff)
+	}
+	if stoppable.stops != 1 {
+		t.Errorf("wrapped processor got %d stops, want 1", stoppable.stops)
+	}
+}
+
+func TestNewRetryProcessor(t *testing.T) {
+	t.Parallel()
+
+	newBackoff := func() retry.Backoff { return retry.NewConstant(time.Millisecond) }
+
+	if _, err := NewRetryProcessor[*structpb.Struct](nil, newBackoff); err == nil {
+		t.Errorf("NewRetryProcessor got no error for a nil processor")
+	}
+	_, err := NewRetryProcessor[*structpb.Struct](&testFlakyProcessor{}, nil)
+	if diff := testutil.DiffErrString(err, "backoff cannot be nil"); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+)
+
+// HeaderSchemaVersion is the header of the push requests listing the event
+// schema versions the caller accepts in preference order, like the Accept
+// header, e.g. "v1beta1, v1alpha1" or "*" for any. The events are emitted in
+// the current schema version when it's not set. The negotiated version is
+// returned in the same response header, and requests accepting no supported
+// version are rejected with 406.
+const HeaderSchemaVersion = "Pmap-Schema-Version"
+
+// schemaVersionAny accepts any schema version in [HeaderSchemaVersion].
+const schemaVersionAny = "*"
+
+// negotiateSchemaVersion returns the first version accepted by the
+// [HeaderSchemaVersion] value which is supported, only the current version is.
+// Parameters such as "q=0.5" are ignored, the versions are tried in order. The
+// current version is returned for an empty value, ok is false when no accepted
+// version is supported.
+func negotiateSchemaVersion(header, current string) (version string, ok bool) {
+	if strings.TrimSpace(header) == "" {
+		return current, true
+	}
+	for _, v := range strings.Split(header, ",") {
+		v, _, _ = strings.Cut(v, ";")
+		switch v = strings.TrimSpace(v); v {
+		case schemaVersionAny:
+			return current, true
+		case "":
+			continue
+		case current:
+			return current, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+)
+
+func TestNegotiateSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		header      string
+		current     string
+		wantVersion string
+		wantOK      bool
+	}{
+		{
+			name:        "default",
+			current:     "v1alpha1",
+			wantVersion: "v1alpha1",
+			wantOK:      true,
+		},
+		{
+			name:        "current",
+			header:      "v1alpha1",
+			current:     "v1alpha1",
+			wantVersion: "v1alpha1",
+			wantOK:      true,
+		},
+		{
+			name:        "any",
+			header:      "*",
+			current:     "v1alpha1",
+			wantVersion: "v1alpha1",
+			wantOK:      true,
+		},
+		{
+			name:        "preference_list",
+			header:      "v1beta1, v1alpha1;q=0.5",
+			current:     "v1alpha1",
+			wantVersion: "v1alpha1",
+			wantOK:      true,
+		},
+		{
+			name:    "unsupported",
+			header:  "v1beta1",
+			current: "v1alpha1",
+		},
+		{
+			name:    "empty_entries",
+			header:  " , ;q=1",
+			current: "v1alpha1",
+		},
+		{
+			name:   "unversioned_payload",
+			header: "v1alpha1",
+		},
+		{
+			name:   "unversioned_payload_any",
+			header: "*",
+			wantOK: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			gotVersion, gotOK := negotiateSchemaVersion(tc.header, tc.current)
+			if gotVersion != tc.wantVersion || gotOK != tc.wantOK {
+				t.Errorf("negotiateSchemaVersion(%q, %q) got (%q, %t), want (%q, %t)",
+					tc.header, tc.current, gotVersion, gotOK, tc.wantVersion, tc.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+// ObjectStore is the minimal set of storage operations pmap needs to read the
+// objects it's notified about.
+type ObjectStore interface {
+	// NewObjectReader returns a reader of the object content, the caller
+	// must close it.
+	NewObjectReader(ctx context.Context, bucketID, objectID string) (io.ReadCloser, error)
+	// ObjectMetadata returns the custom metadata of the object.
+	ObjectMetadata(ctx context.Context, bucketID, objectID string) (map[string]string, error)
+}
+
+var _ ObjectStore = (*GCSObjectStore)(nil)
+
+// GCSObjectStore is an [ObjectStore] backed by GCS.
+//
+// The store works with any GCS compatible server the client points at, e.g.
+// fake-gcs-server (https://github.com/fsouza/fake-gcs-server) in tests:
+//
+//	client, err := storage.NewClient(ctx,
+//		option.WithEndpoint("http://localhost:4443/storage/v1/"),
+//		option.WithoutAuthentication())
+//
+// Setting STORAGE_EMULATOR_HOST=localhost:4443 has the same effect for the
+// clients created with the default options, such as the one the
+// [EventHandler] creates when no client or store is set.
+type GCSObjectStore struct {
+	client *storage.Client
+}
+
+// NewGCSObjectStore creates a [GCSObjectStore] with the GCS storage client.
+func NewGCSObjectStore(client *storage.Client) *GCSObjectStore {
+	return &GCSObjectStore{client: client}
+}
+
+// NewObjectReader implements [ObjectStore].
+func (s *GCSObjectStore) NewObjectReader(ctx context.Context, bucketID, objectID string) (io.ReadCloser, error) {
+	rc, err := s.client.Bucket(bucketID).Object(objectID).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS object reader: %w", err)
+	}
+	return rc, nil
+}
+
+// ObjectMetadata implements [ObjectStore].
+func (s *GCSObjectStore) ObjectMetadata(ctx context.Context, bucketID, objectID string) (map[string]string, error) {
+	attrs, err := s.client.Bucket(bucketID).Object(objectID).Attrs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GCS object attributes: %w", err)
+	}
+	return attrs.Metadata, nil
+}
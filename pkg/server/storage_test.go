@@ -0,0 +1,272 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+// testObjectStore is an in-memory [ObjectStore], objects are keyed by
+// "bucketID/objectID".
+type testObjectStore struct {
+	data     map[string][]byte
+	metadata map[string]map[string]string
+}
+
+func (s *testObjectStore) NewObjectReader(_ context.Context, bucketID, objectID string) (io.ReadCloser, error) {
+	b, ok := s.data[bucketID+"/"+objectID]
+	if !ok {
+		return nil, fmt.Errorf("object %q not found in bucket %q", objectID, bucketID)
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s *testObjectStore) ObjectMetadata(_ context.Context, bucketID, objectID string) (map[string]string, error) {
+	if _, ok := s.data[bucketID+"/"+objectID]; !ok {
+		return nil, fmt.Errorf("object %q not found in bucket %q", objectID, bucketID)
+	}
+	return s.metadata[bucketID+"/"+objectID], nil
+}
+
+func TestGCSObjectStore(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Object attrs are read with the JSON API and object data is read with
+		// the XML API.
+		switch r.URL.Path {
+		case "/b/foo/o/dir/bar":
+			if err := json.NewEncoder(w).Encode(map[string]any{
+				"bucket":   "foo",
+				"name":     "dir/bar",
+				"metadata": map[string]string{"github-commit": "test-github-commit"},
+			}); err != nil {
+				t.Errorf("failed to write object attrs: %v", err)
+			}
+		case "/foo/dir/bar":
+			if _, err := w.Write([]byte("test-data")); err != nil {
+				t.Errorf("failed to write object data: %v", err)
+			}
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx, option.WithEndpoint(ts.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("failed to create storage client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	cases := []struct {
+		name         string
+		objectID     string
+		wantData     string
+		wantMetadata map[string]string
+		wantReadErr  string
+		wantAttrsErr string
+	}{
+		{
+			name:         "success",
+			objectID:     "dir/bar",
+			wantData:     "test-data",
+			wantMetadata: map[string]string{"github-commit": "test-github-commit"},
+		},
+		{
+			name:         "not_found",
+			objectID:     "dir/missing",
+			wantReadErr:  "failed to create GCS object reader",
+			wantAttrsErr: "failed to get GCS object attributes",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := NewGCSObjectStore(client)
+
+			rc, err := store.NewObjectReader(ctx, "foo", tc.objectID)
+			if diff := testutil.DiffErrString(err, tc.wantReadErr); diff != "" {
+				t.Errorf("NewObjectReader got unexpected error substring: %v", diff)
+			}
+			if err == nil {
+				defer rc.Close()
+				b, err := io.ReadAll(rc)
+				if err != nil {
+					t.Fatalf("failed to read object: %v", err)
+				}
+				if got, want := string(b), tc.wantData; got != want {
+					t.Errorf("NewObjectReader got data %q, want %q", got, want)
+				}
+			}
+
+			gotMetadata, err := store.ObjectMetadata(ctx, "foo", tc.objectID)
+			if diff := testutil.DiffErrString(err, tc.wantAttrsErr); diff != "" {
+				t.Errorf("ObjectMetadata got unexpected error substring: %v", diff)
+			}
+			if diff := cmp.Diff(tc.wantMetadata, gotMetadata); diff != "" {
+				t.Errorf("ObjectMetadata got metadata diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestEventHandler_WithObjectStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := &testObjectStore{
+		data: map[string][]byte{
+			"foo/pmap-test/gh-prefix/dir1/dir2/bar": []byte(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`),
+		},
+	}
+	h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{}, &testRawMessenger{},
+		WithOptionalGitHubSource(),
+		WithObjectStore(store))
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+
+	result, err := h.HandleResult(ctx, pubsub.Message{
+		Attributes: map[string]string{"bucketId": "foo", "objectId": "pmap-test/gh-prefix/dir1/dir2/bar"},
+	})
+	if err != nil {
+		t.Fatalf("HandleResult got unexpected error: %v", err)
+	}
+	if result.Outcome != OutcomeSuccess {
+		t.Errorf("HandleResult got outcome %q, want %q", result.Outcome, OutcomeSuccess)
+	}
+
+	var got v1alpha1.ResourceMapping
+	if err := result.Event.GetPayload().UnmarshalTo(&got); err != nil {
+		t.Fatalf("failed to unmarshal event payload: %v", err)
+	}
+	if got, want := got.GetResource().GetName(), "//pubsub.googleapis.com/projects/test-project/topics/test-topic"; got != want {
+		t.Errorf("HandleResult got resource name %q, want %q", got, want)
+	}
+}
+
+// TestGCSObjectStore_Emulator runs the handler against a GCS emulator such as
+// fake-gcs-server, it's skipped unless STORAGE_EMULATOR_HOST is set, e.g.:
+//
+//	docker run -d -p 4443:4443 fsouza/fake-gcs-server -scheme http
+//	STORAGE_EMULATOR_HOST=localhost:4443 go test ./pkg/server -run Emulator
+func TestGCSObjectStore_Emulator(t *testing.T) {
+	t.Parallel()
+
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		t.Skip("STORAGE_EMULATOR_HOST is not set")
+	}
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		t.Fatalf("failed to create storage client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	bucketID := fmt.Sprintf("pmap-emulator-test-%d", time.Now().UnixNano())
+	if err := client.Bucket(bucketID).Create(ctx, "test-project", nil); err != nil {
+		t.Fatalf("failed to create bucket: %v", err)
+	}
+
+	objectID := "pmap-test/gh-prefix/dir1/dir2/bar"
+	w := client.Bucket(bucketID).Object(objectID).NewWriter(ctx)
+	w.Metadata = map[string]string{
+		"github-commit":                       "test-github-commit",
+		"github-workflow-triggered-timestamp": "2023-04-25T17:44:57+00:00",
+		"github-workflow-sha":                 "test-workflow-sha",
+		"github-workflow":                     "test-workflow",
+		"github-repo":                         "test-github-repo",
+		"github-run-id":                       "5050509831",
+		"github-run-attempt":                  "1",
+	}
+	if _, err := io.Copy(w, strings.NewReader(`
+resource:
+  name: //pubsub.googleapis.com/projects/test-project/topics/test-topic
+  provider: gcp
+contacts:
+  email:
+  - pmap@example.com
+`)); err != nil {
+		t.Fatalf("failed to write object: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close object writer: %v", err)
+	}
+
+	// The handler creates its own client, which honors STORAGE_EMULATOR_HOST.
+	h, err := NewHandler(ctx, []Processor[*v1alpha1.ResourceMapping]{}, &testRawMessenger{}, WithOptionalGitHubSource())
+	if err != nil {
+		t.Fatalf("failed to create event handler %v", err)
+	}
+
+	metadata, err := NewGCSObjectStore(client).ObjectMetadata(ctx, bucketID, objectID)
+	if err != nil {
+		t.Fatalf("ObjectMetadata got unexpected error: %v", err)
+	}
+	data, err := json.Marshal(map[string]any{"metadata": metadata})
+	if err != nil {
+		t.Fatalf("failed to marshal notification payload: %v", err)
+	}
+
+	result, err := h.HandleResult(ctx, pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			"bucketId":      bucketID,
+			"objectId":      objectID,
+			"payloadFormat": "JSON_API_V1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("HandleResult got unexpected error: %v", err)
+	}
+	if result.Outcome != OutcomeSuccess {
+		t.Fatalf("HandleResult got outcome %q, want %q", result.Outcome, OutcomeSuccess)
+	}
+	if got, want := result.Event.GetGithubSource().GetCommit(), "test-github-commit"; got != want {
+		t.Errorf("HandleResult got github commit %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	// AttrKeyWarnings is the attribute key for the JSON encoded list of the
+	// warnings added by the processors of a success event, see
+	// [WithWarningsAttribute].
+	AttrKeyWarnings = "warnings"
+
+	// AttrKeyWarningsTruncated is the attribute key set to "true" when
+	// warnings are dropped from AttrKeyWarnings to fit the size limit.
+	AttrKeyWarningsTruncated = "warningsTruncated"
+)
+
+// warningsKey is the context key of the warning collector.
+type warningsKey struct{}
+
+// warningCollector collects the warnings of the processors of an object,
+// which may run concurrently.
+type warningCollector struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+// withWarningCollector returns a copy of the context with a new warning
+// collector attached.
+func withWarningCollector(ctx context.Context) (context.Context, *warningCollector) {
+	c := &warningCollector{}
+	return context.WithValue(ctx, warningsKey{}, c), c
+}
+
+// AddWarning attaches a non-fatal concern about the object being processed to
+// its event, e.g. "resource has no IAM bindings". Processors call it with the
+// context they're given. The warnings are surfaced on the success event with
+// [WithWarningsAttribute] and are dropped otherwise.
+func AddWarning(ctx context.Context, format string, args ...any) {
+	c, ok := ctx.Value(warningsKey{}).(*warningCollector)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// list returns the warnings in the order they were added, or nil for a nil
+// collector.
+func (c *warningCollector) list() []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.warnings...)
+}
+
+// WithWarningsAttribute returns an option to set the [AttrKeyWarnings]
+// attribute on the success events with the warnings added by the processors
+// with [AddWarning]. Warnings are dropped by default.
+func WithWarningsAttribute() Option {
+	return func(_ context.Context, opts *HandlerOpts) (*HandlerOpts, error) {
+		opts.withWarnings = true
+		return opts, nil
+	}
+}
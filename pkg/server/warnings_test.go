@@ -0,0 +1,153 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pmap/pkg/pmaperrors"
+)
+
+type testWarningProcessor struct {
+	name      string
+	warnings  []string
+	returnErr error
+}
+
+func (p *testWarningProcessor) Name() string {
+	return p.name
+}
+
+func (p *testWarningProcessor) Process(ctx context.Context, _ *structpb.Struct) error {
+	for _, w := range p.warnings {
+		AddWarning(ctx, "%s", w)
+	}
+	return p.returnErr
+}
+
+func TestEventHandler_HandleWarnings(t *testing.T) {
+	t.Parallel()
+
+	longWarning := strings.Repeat("a", 600)
+
+	cases := []struct {
+		name          string
+		processors    []Processor[*structpb.Struct]
+		opts          []Option
+		wantOutcome   string
+		wantWarnings  string
+		wantTruncated string
+	}{
+		{
+			name: "warning_on_success_event",
+			processors: []Processor[*structpb.Struct]{
+				&testWarningProcessor{name: "a", warnings: []string{"resource has no IAM bindings"}},
+			},
+			opts:         []Option{WithWarningsAttribute()},
+			wantOutcome:  OutcomeSuccess,
+			wantWarnings: `["resource has no IAM bindings"]`,
+		},
+		{
+			name: "warnings_of_all_processors",
+			processors: []Processor[*structpb.Struct]{
+				&testWarningProcessor{name: "a", warnings: []string{"foo"}},
+				&testWarningProcessor{name: "b"},
+				&testWarningProcessor{name: "c", warnings: []string{"bar", "baz"}},
+			},
+			opts:         []Option{WithWarningsAttribute()},
+			wantOutcome:  OutcomeSuccess,
+			wantWarnings: `["foo","bar","baz"]`,
+		},
+		{
+			name: "no_warnings",
+			processors: []Processor[*structpb.Struct]{
+				&testWarningProcessor{name: "a"},
+			},
+			opts:        []Option{WithWarningsAttribute()},
+			wantOutcome: OutcomeSuccess,
+		},
+		{
+			name: "warnings_dropped_by_default",
+			processors: []Processor[*structpb.Struct]{
+				&testWarningProcessor{name: "a", warnings: []string{"resource has no IAM bindings"}},
+			},
+			wantOutcome: OutcomeSuccess,
+		},
+		{
+			name: "no_warnings_on_failure_event",
+			processors: []Processor[*structpb.Struct]{
+				&testWarningProcessor{name: "a", warnings: []string{"foo"}, returnErr: pmaperrors.New("bar")},
+			},
+			opts:        []Option{WithWarningsAttribute()},
+			wantOutcome: OutcomeFailure,
+		},
+		{
+			name: "truncated",
+			processors: []Processor[*structpb.Struct]{
+				&testWarningProcessor{name: "a", warnings: []string{longWarning, longWarning, "foo"}},
+			},
+			opts:          []Option{WithWarningsAttribute()},
+			wantOutcome:   OutcomeSuccess,
+			wantWarnings:  `["` + longWarning + `","foo"]`,
+			wantTruncated: "true",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			opts := append([]Option{
+				WithObjectStore(&testObjectStore{data: map[string][]byte{"foo/bar": []byte("foo: bar")}}),
+				WithOptionalGitHubSource(),
+			}, tc.opts...)
+			h, err := NewHandler(ctx, tc.processors, &testRawMessenger{}, opts...)
+			if err != nil {
+				t.Fatalf("failed to create event handler %v", err)
+			}
+
+			got, err := h.HandleResult(ctx, pubsub.Message{
+				Attributes: map[string]string{"bucketId": "foo", "objectId": "bar"},
+			})
+			if err != nil {
+				t.Fatalf("HandleResult got unexpected error: %v", err)
+			}
+
+			if got.Outcome != tc.wantOutcome {
+				t.Errorf("HandleResult got outcome %q, want %q", got.Outcome, tc.wantOutcome)
+			}
+			if diff := cmp.Diff(tc.wantWarnings, got.Attributes[AttrKeyWarnings]); diff != "" {
+				t.Errorf("HandleResult got warnings diff (-want, +got): %v", diff)
+			}
+			if diff := cmp.Diff(tc.wantTruncated, got.Attributes[AttrKeyWarningsTruncated]); diff != "" {
+				t.Errorf("HandleResult got warnings truncated diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+func TestAddWarning_NoCollector(t *testing.T) {
+	t.Parallel()
+
+	// Processors may be run outside of a handler, e.g. by the CLI.
+	AddWarning(context.Background(), "foo")
+}
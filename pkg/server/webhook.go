@@ -0,0 +1,177 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sethvargo/go-retry"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	// WebhookHeaderPrefix prefixes the attribute keys sent as headers by the
+	// [WebhookMessenger], e.g. the "eventType" attribute is sent as the
+	// "X-Pmap-Eventtype" header once canonicalized. The header values are
+	// escaped with [url.QueryEscape], since attributes such as a multi-line
+	// processErr aren't valid header values.
+	WebhookHeaderPrefix = "X-Pmap-"
+
+	// WebhookSignatureHeader is the header of the HMAC-SHA256 signature of the
+	// request body, formatted as "sha256=<hex digest>", see
+	// [WithWebhookSecret].
+	WebhookSignatureHeader = "X-Pmap-Signature-256"
+)
+
+// WebhookMessenger implements the Messenger interface by POSTing the events to
+// an HTTP(S) webhook, for consumers which can't subscribe to Pub/Sub. The
+// event data is the request body and the attributes are sent as escaped
+// headers prefixed with [WebhookHeaderPrefix]. Requests failing with a network error,
+// 429 or a 5xx status are retried.
+type WebhookMessenger struct {
+	url        string
+	client     *http.Client
+	secret     []byte
+	newBackoff func() retry.Backoff
+}
+
+// WebhookMessengerOption is the option to configure the WebhookMessenger.
+type WebhookMessengerOption func(m *WebhookMessenger)
+
+// WithWebhookHTTPClient sends the requests with the client, e.g. to set a
+// timeout or authenticate. [http.DefaultClient] is used by default.
+func WithWebhookHTTPClient(c *http.Client) WebhookMessengerOption {
+	return func(m *WebhookMessenger) {
+		m.client = c
+	}
+}
+
+// WithWebhookSecret signs the request body with HMAC-SHA256 using the secret,
+// and sets the signature in the [WebhookSignatureHeader] so the webhook can
+// verify the events come from pmap. Requests are not signed by default.
+func WithWebhookSecret(secret []byte) WebhookMessengerOption {
+	return func(m *WebhookMessenger) {
+		m.secret = secret
+	}
+}
+
+// WithWebhookBackoff retries the failed requests with the backoff returned by
+// newBackoff, a new backoff is created for every event. By default requests
+// are retried 3 times with an exponential backoff starting at 200ms.
+func WithWebhookBackoff(newBackoff func() retry.Backoff) WebhookMessengerOption {
+	return func(m *WebhookMessenger) {
+		m.newBackoff = newBackoff
+	}
+}
+
+// defaultWebhookBackoff returns the default backoff of the failed webhook
+// requests.
+func defaultWebhookBackoff() retry.Backoff {
+	return retry.WithMaxRetries(3, retry.NewExponential(200*time.Millisecond))
+}
+
+// NewWebhookMessenger creates a new instance of the WebhookMessenger sending
+// the events to the absolute http or https URL.
+func NewWebhookMessenger(webhookURL string, opts ...WebhookMessengerOption) (*WebhookMessenger, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook url must be an absolute http or https url: %q", webhookURL)
+	}
+
+	m := &WebhookMessenger{
+		url:        webhookURL,
+		client:     http.DefaultClient,
+		newBackoff: defaultWebhookBackoff,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.client == nil {
+		return nil, fmt.Errorf("http client cannot be nil")
+	}
+	if m.newBackoff == nil {
+		return nil, fmt.Errorf("backoff cannot be nil")
+	}
+	return m, nil
+}
+
+// Send POSTs the event to the webhook, it fails when the webhook doesn't
+// respond with a 2xx status once the retries are exhausted or the context is
+// done.
+func (m *WebhookMessenger) Send(ctx context.Context, data []byte, attr map[string]string) error {
+	logger := logging.FromContext(ctx)
+
+	var signature string
+	if len(m.secret) > 0 {
+		mac := hmac.New(sha256.New, m.secret)
+		mac.Write(data)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	var attempts int
+	if err := retry.Do(ctx, m.newBackoff(), func(ctx context.Context) error {
+		attempts++
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to create webhook request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range attr {
+			req.Header.Set(WebhookHeaderPrefix+k, url.QueryEscape(v))
+		}
+		if signature != "" {
+			req.Header.Set(WebhookSignatureHeader, signature)
+		}
+
+		resp, err := m.client.Do(req)
+		if err != nil {
+			return retry.RetryableError(fmt.Errorf("failed to send webhook request: %w", err))
+		}
+		defer resp.Body.Close()
+		// Drain the body so the connection can be reused.
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("webhook responded with status %s", resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			logger.WarnContext(ctx, "webhook request failed, retrying",
+				"status", resp.StatusCode,
+				"attempt", attempts)
+			return retry.RetryableError(err)
+		}
+		return err
+	}); err != nil {
+		return fmt.Errorf("webhook failed to send message after %d attempts: %w", attempts, err)
+	}
+
+	logger.InfoContext(ctx, "sent message to webhook",
+		"attempts", attempts)
+	return nil
+}
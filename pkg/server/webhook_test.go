@@ -0,0 +1,266 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sethvargo/go-retry"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// webhookRequest is a request received by the test webhook.
+type webhookRequest struct {
+	method string
+	header http.Header
+	body   string
+}
+
+// testWebhook responds to the requests with the statuses in order, then with
+// 200, and records the requests.
+type testWebhook struct {
+	statuses []int
+
+	mu       sync.Mutex
+	requests []*webhookRequest
+}
+
+func (h *testWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests = append(h.requests, &webhookRequest{method: r.Method, header: r.Header, body: string(body)})
+	if n := len(h.requests); n <= len(h.statuses) {
+		w.WriteHeader(h.statuses[n-1])
+	}
+}
+
+// testWebhookBackoff retries up to maxRetries times without delay.
+func testWebhookBackoff(maxRetries uint64) WebhookMessengerOption {
+	return WithWebhookBackoff(func() retry.Backoff {
+		return retry.WithMaxRetries(maxRetries, retry.NewConstant(time.Millisecond))
+	})
+}
+
+func TestWebhookMessenger_Send(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`{"type":"abcxyz.pmap.ResourceMapping"}`)
+	attr := map[string]string{AttrKeyOutcome: OutcomeSuccess, "bucketId": "foo"}
+
+	cases := []struct {
+		name         string
+		attr         map[string]string
+		statuses     []int
+		secret       []byte
+		wantErr      string
+		wantRequests int
+	}{
+		{
+			name:         "success",
+			wantRequests: 1,
+		},
+		{
+			name:         "retried_then_success",
+			statuses:     []int{http.StatusInternalServerError, http.StatusTooManyRequests},
+			wantRequests: 3,
+		},
+		{
+			name: "retries_exhausted",
+			statuses: []int{
+				http.StatusInternalServerError,
+				http.StatusInternalServerError,
+				http.StatusInternalServerError,
+			},
+			wantErr:      "webhook failed to send message after 3 attempts: webhook responded with status 500 Internal Server Error",
+			wantRequests: 3,
+		},
+		{
+			name:         "client_error_not_retried",
+			statuses:     []int{http.StatusBadRequest},
+			wantErr:      "webhook failed to send message after 1 attempts: webhook responded with status 400 Bad Request",
+			wantRequests: 1,
+		},
+		{
+			name:         "signed",
+			secret:       []byte("test-secret"),
+			wantRequests: 1,
+		},
+		{
+			name: "multi_line_process_err",
+			attr: map[string]string{
+				AttrKeyOutcome:    OutcomeFailure,
+				AttrKeyProcessErr: "failed to validate: empty resource name\nmissing contacts: 100% \"réel\"",
+			},
+			wantRequests: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			webhook := &testWebhook{statuses: tc.statuses}
+			srv := httptest.NewServer(webhook)
+			t.Cleanup(srv.Close)
+
+			m, err := NewWebhookMessenger(srv.URL,
+				WithWebhookHTTPClient(srv.Client()),
+				WithWebhookSecret(tc.secret),
+				testWebhookBackoff(2))
+			if err != nil {
+				t.Fatalf("NewWebhookMessenger got unexpected error: %v", err)
+			}
+
+			wantAttr := attr
+			if tc.attr != nil {
+				wantAttr = tc.attr
+			}
+			err = m.Send(context.Background(), data, wantAttr)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			if got, want := len(webhook.requests), tc.wantRequests; got != want {
+				t.Fatalf("got %d webhook requests, want %d", got, want)
+			}
+			for _, r := range webhook.requests {
+				if got, want := r.method, http.MethodPost; got != want {
+					t.Errorf("got webhook request method %q, want %q", got, want)
+				}
+				if diff := cmp.Diff(string(data), r.body); diff != "" {
+					t.Errorf("webhook request body (-want, +got):\n%s", diff)
+				}
+				gotAttr := make(map[string]string, len(wantAttr))
+				for k := range wantAttr {
+					v, err := url.QueryUnescape(r.header.Get("X-Pmap-" + k))
+					if err != nil {
+						t.Fatalf("failed to unescape header of attribute %q: %v", k, err)
+					}
+					gotAttr[k] = v
+				}
+				if diff := cmp.Diff(wantAttr, gotAttr); diff != "" {
+					t.Errorf("webhook request attribute headers (-want, +got):\n%s", diff)
+				}
+
+				var wantSignature string
+				if len(tc.secret) > 0 {
+					mac := hmac.New(sha256.New, tc.secret)
+					mac.Write(data)
+					wantSignature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+				}
+				if diff := cmp.Diff(wantSignature, r.header.Get(WebhookSignatureHeader)); diff != "" {
+					t.Errorf("webhook request signature header (-want, +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookMessenger_SendCanceled(t *testing.T) {
+	t.Parallel()
+
+	webhook := &testWebhook{statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(webhook)
+	t.Cleanup(srv.Close)
+
+	m, err := NewWebhookMessenger(srv.URL,
+		WithWebhookHTTPClient(srv.Client()),
+		WithWebhookBackoff(func() retry.Backoff {
+			return retry.NewConstant(time.Hour)
+		}))
+	if err != nil {
+		t.Fatalf("NewWebhookMessenger got unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err = m.Send(ctx, []byte(`{}`), nil)
+	if diff := testutil.DiffErrString(err, context.DeadlineExceeded.Error()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestNewWebhookMessenger(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		url     string
+		opts    []WebhookMessengerOption
+		wantErr string
+	}{
+		{
+			name: "https",
+			url:  "https://example.com/pmap",
+		},
+		{
+			name:    "relative_url",
+			url:     "/pmap",
+			wantErr: `webhook url must be an absolute http or https url: "/pmap"`,
+		},
+		{
+			name:    "unsupported_scheme",
+			url:     "ftp://example.com/pmap",
+			wantErr: `webhook url must be an absolute http or https url: "ftp://example.com/pmap"`,
+		},
+		{
+			name:    "invalid_url",
+			url:     "https://example.com/%zz",
+			wantErr: "failed to parse webhook url",
+		},
+		{
+			name:    "nil_client",
+			url:     "https://example.com/pmap",
+			opts:    []WebhookMessengerOption{WithWebhookHTTPClient(nil)},
+			wantErr: "http client cannot be nil",
+		},
+		{
+			name:    "nil_backoff",
+			url:     "https://example.com/pmap",
+			opts:    []WebhookMessengerOption{WithWebhookBackoff(nil)},
+			wantErr: "backoff cannot be nil",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewWebhookMessenger(tc.url, tc.opts...)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/pkg/protoutil"
+)
+
+// jsonBufferPool holds the buffers the YAML documents are converted to JSON
+// into, so the buffers are reused across objects.
+var jsonBufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// yamlToProto converts the YAML document to the proto message. It's
+// equivalent to [protoutil.FromYAML], which decodes the YAML into a map and
+// marshals the map to JSON, but writes the JSON directly from the YAML nodes
+// to save the intermediate allocations. Documents using YAML features the
+// direct conversion doesn't support, such as aliases or timestamps, and
+// invalid documents are converted by [protoutil.FromYAML] so the result and
+// the errors are the same.
+func yamlToProto(b []byte, msg proto.Message) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return protoutil.FromYAML(b, msg) //nolint:wrapcheck // Same errors as the direct conversion.
+	}
+
+	buf := jsonBufferPool.Get().(*bytes.Buffer) //nolint:forcetypeassert // The pool only holds buffers.
+	defer jsonBufferPool.Put(buf)
+	buf.Reset()
+
+	w := &yamlJSONWriter{buf: buf, enc: json.NewEncoder(buf)}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode ||
+		!w.writeNode(doc.Content[0]) {
+		return protoutil.FromYAML(b, msg) //nolint:wrapcheck // Same errors as the direct conversion.
+	}
+
+	if err := protojson.Unmarshal(buf.Bytes(), msg); err != nil {
+		return fmt.Errorf("failed to unmarshal proto: %w", err)
+	}
+	return nil
+}
+
+// yamlJSONWriter writes the JSON encoding of YAML nodes.
+type yamlJSONWriter struct {
+	buf *bytes.Buffer
+	// enc writes to buf, it's used to encode strings and floats the same way
+	// encoding/json marshals them.
+	enc *json.Encoder
+}
+
+// writeNode writes the JSON encoding of the node the same way encoding/json
+// marshals the node decoded by yaml.v3, mapping keys are sorted likewise. It
+// returns false if the node isn't supported, in which case the JSON is
+// partially written.
+func (w *yamlJSONWriter) writeNode(n *yaml.Node) bool {
+	switch n.Kind {
+	case yaml.MappingNode:
+		// Indexes of the keys in the content, sorted by key.
+		keys := make([]int, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if k := n.Content[i]; k.Kind != yaml.ScalarNode || k.ShortTag() != "!!str" {
+				return false
+			}
+			keys = append(keys, i)
+		}
+		slices.SortFunc(keys, func(a, b int) int {
+			return strings.Compare(n.Content[a].Value, n.Content[b].Value)
+		})
+
+		w.buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				if n.Content[keys[i-1]].Value == n.Content[k].Value {
+					// Duplicate keys fail the decoding into a map.
+					return false
+				}
+				w.buf.WriteByte(',')
+			}
+			if !w.writeValue(n.Content[k].Value) {
+				return false
+			}
+			w.buf.WriteByte(':')
+			if !w.writeNode(n.Content[k+1]) {
+				return false
+			}
+		}
+		w.buf.WriteByte('}')
+		return true
+
+	case yaml.SequenceNode:
+		w.buf.WriteByte('[')
+		for i, c := range n.Content {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			if !w.writeNode(c) {
+				return false
+			}
+		}
+		w.buf.WriteByte(']')
+		return true
+
+	case yaml.ScalarNode:
+		return w.writeScalar(n)
+
+	default:
+		// Aliases need to be resolved, they're left to yaml.v3.
+		return false
+	}
+}
+
+// writeScalar writes the JSON encoding of the scalar node. Only the string,
+// integer, float, boolean and null tags are supported.
+func (w *yamlJSONWriter) writeScalar(n *yaml.Node) bool {
+	switch n.ShortTag() {
+	case "!!str":
+		return w.writeValue(n.Value)
+	case "!!null":
+		w.buf.WriteString("null")
+		return true
+	case "!!bool":
+		v, err := strconv.ParseBool(n.Value)
+		if err != nil {
+			return false
+		}
+		w.buf.WriteString(strconv.FormatBool(v))
+		return true
+	case "!!int":
+		v, err := strconv.ParseInt(n.Value, 10, 64)
+		if err != nil {
+			// Other bases and out of range values are left to yaml.v3.
+			return false
+		}
+		w.buf.WriteString(strconv.FormatInt(v, 10))
+		return true
+	case "!!float":
+		v, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+			return false
+		}
+		return w.writeValue(v)
+	default:
+		// Timestamps, binaries and custom tags are left to yaml.v3.
+		return false
+	}
+}
+
+// writeValue writes the JSON encoding of v with encoding/json. The newline
+// added by the encoder is dropped so the proto syntax errors have the same
+// positions.
+func (w *yamlJSONWriter) writeValue(v any) bool {
+	if err := w.enc.Encode(v); err != nil {
+		return false
+	}
+	w.buf.Truncate(w.buf.Len() - 1)
+	return true
+}
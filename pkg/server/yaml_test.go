@@ -0,0 +1,215 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/pkg/protoutil"
+	"github.com/abcxyz/pmap/apis/v1alpha1"
+)
+
+func TestYAMLToProto_Parity(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		yaml string
+		// newMsg returns the message to convert to, a ResourceMapping by
+		// default.
+		newMsg func() proto.Message
+	}{
+		{
+			name: "mapping",
+			yaml: `
+resource:
+  name: '//storage.googleapis.com/pmap-static-ci-bucket-9d89'
+  provider: 'gcp'
+  subscope: "parent/foo?key1=value1&key2=value2"
+annotations:
+  traceID: 'fake-pmap-dev-manual-test-mapping'
+  nested:
+    list: [1, -2, 3.5, 1e3, true, false, null, "<html>&"]
+    empty_map: {}
+    empty_list: []
+contacts:
+  email:
+    - 'pmap.mapping@gmail.com'
+    - "unicode-é@example.com"
+`,
+		},
+		{
+			name: "policy",
+			yaml: `
+policy_id: 'fake-policy-123'
+annotations:
+  traceID: 'fake-pmap-dev-manual-test-policy'
+deletion_timeline:
+  - '356 days'
+  - '1 day'
+`,
+			newMsg: func() proto.Message { return &structpb.Struct{} },
+		},
+		{
+			name: "scalars",
+			yaml: `
+a: 007
+b: +1
+c: 0x1F
+d: 0o17
+e: .inf
+f: -.Inf
+g: .nan
+h: True
+i: ~
+j:
+k: 2023-04-25T17:44:57Z
+l: !!binary aGVsbG8=
+m: !!str 123
+n: 1.0
+o: 99999999999999999999
+p: "multi
+  line"
+q: |
+  literal
+  block
+`,
+			newMsg: func() proto.Message { return &structpb.Struct{} },
+		},
+		{
+			name: "anchors_and_aliases",
+			yaml: `
+base: &base
+  key: value
+copy: *base
+merged:
+  <<: *base
+  other: value
+`,
+			newMsg: func() proto.Message { return &structpb.Struct{} },
+		},
+		{
+			name:   "non_string_keys",
+			yaml:   "1: one\ntrue: yes\nnested:\n  2: two\n",
+			newMsg: func() proto.Message { return &structpb.Struct{} },
+		},
+		{
+			name: "duplicate_keys",
+			yaml: "a: 1\na: 2\n",
+		},
+		{
+			name: "unknown_field",
+			yaml: "resource:\n  name: foo\nzzz: 1\naaa: 2\n",
+		},
+		{
+			name: "wrong_type",
+			yaml: "contacts:\n  email: foo\n",
+		},
+		{
+			name: "scalar_document",
+			yaml: "foo",
+		},
+		{
+			name: "sequence_document",
+			yaml: "- foo\n- bar\n",
+		},
+		{
+			name: "empty_document",
+			yaml: "",
+		},
+		{
+			name: "invalid_yaml",
+			yaml: "a: [",
+		},
+		{
+			name: "tabs",
+			yaml: "a:\n\tb: c\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			newMsg := tc.newMsg
+			if newMsg == nil {
+				newMsg = func() proto.Message { return &v1alpha1.ResourceMapping{} }
+			}
+
+			want := newMsg()
+			wantErr := protoutil.FromYAML([]byte(tc.yaml), want)
+			got := newMsg()
+			gotErr := yamlToProto([]byte(tc.yaml), got)
+
+			if diff := cmp.Diff(fmt.Sprint(wantErr), fmt.Sprint(gotErr)); diff != "" {
+				t.Errorf("yamlToProto got error diff (-want, +got): %v", diff)
+			}
+			if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("yamlToProto got message diff (-want, +got): %v", diff)
+			}
+		})
+	}
+}
+
+// benchmarkMappingYAML returns a mapping with n annotations, to mimic large
+// mapping files.
+func benchmarkMappingYAML(n int) []byte {
+	var b strings.Builder
+	b.WriteString(`
+resource:
+  name: //storage.googleapis.com/test-bucket
+  provider: gcp
+contacts:
+  email:
+    - owner@example.com
+    - team@example.com
+annotations:
+`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "  key%d:\n    description: \"annotation %d\"\n    values: [1, 2.5, true, \"x\"]\n", i, i)
+	}
+	return []byte(b.String())
+}
+
+func BenchmarkYAMLToProto(b *testing.B) {
+	for _, n := range []int{1, 100} {
+		data := benchmarkMappingYAML(n)
+
+		b.Run(fmt.Sprintf("protoutil_%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := protoutil.FromYAML(data, &v1alpha1.ResourceMapping{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("direct_%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := yamlToProto(data, &v1alpha1.ResourceMapping{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}